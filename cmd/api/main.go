@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"microblogCPT/cmd/app"
@@ -9,6 +10,8 @@ import (
 	handlers "microblogCPT/internal/handler"
 	"microblogCPT/internal/middleware"
 	"microblogCPT/internal/service"
+	"microblogCPT/internal/storage"
+	"microblogCPT/internal/worker"
 	"net/http"
 )
 
@@ -20,11 +23,21 @@ func main() {
 		log.Fatal("JWT_SECRET_KEY не установлен в .env файле")
 	}
 
-	db, repo, services := app.App(cfg)
+	db, repo, services, mediaHandler := app.App(cfg)
 	defer database.MethodsDB.CloseDB(db)
 
 	handler := handlers.NewHandlers(repo, services, cfg)
 
+	// background jobs
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	worker.StartTrashPurge(ctx, services.Post, cfg.TrashPurgeInterval)
+	worker.StartIdempotencyCleanup(ctx, repo, cfg.IdempotencyCleanup)
+	worker.StartUploadJanitor(ctx, services.Post, services.Upload, cfg.UploadCleanupInterval)
+	worker.StartVariantGenerator(ctx, services.Variant, cfg.VariantInterval)
+	worker.StartImageReconciler(ctx, services.Reconcile, cfg.ReconcileInterval, cfg.ReconcileDryRun)
+
 	mux := service.CreateMux()
 
 	// setting up routes
@@ -37,17 +50,50 @@ func main() {
 	mux.Mux.HandleFunc("/api/auth/refresh-token", handler.RefreshToken)
 
 	mux.Mux.HandleFunc("/api/me", handler.GetCurrentUser)
+	mux.Mux.HandleFunc("/api/me/trash", handler.GetTrash)
+	mux.Mux.HandleFunc("/api/me/usage", handler.GetUsage)
+	mux.Mux.HandleFunc("/api/me/avatar", handler.UserAvatar)
+	mux.Mux.HandleFunc("/api/me/banner", handler.UserBanner)
+	mux.Mux.HandleFunc("/api/me/profile", handler.UpdateProfile)
 	mux.Mux.HandleFunc("/api/user/", handler.GetUser)
+	mux.Mux.HandleFunc("/api/users/", handler.GetPublicProfile)
+	mux.Mux.HandleFunc("/api/users//follow", handler.Follow)
+	mux.Mux.HandleFunc("/api/users//followers", handler.GetFollowers)
+	mux.Mux.HandleFunc("/api/users//following", handler.GetFollowing)
+
+	mux.Mux.HandleFunc("/api/feed/home", handler.GetHomeFeed)
 
 	mux.Mux.HandleFunc("/api/posts", handler.GetPosts)
 	mux.Mux.HandleFunc("/api/posts/", handler.CreatePost)
 	mux.Mux.HandleFunc("/api/posts//status", handler.PublishPost)
+	mux.Mux.HandleFunc("/api/posts//restore", handler.RestorePost)
+
+	mux.Mux.HandleFunc("/api/posts//revisions", handler.GetPostRevisions)
+	mux.Mux.HandleFunc("/api/posts//revisions/", handler.GetPostRevision)
+	mux.Mux.HandleFunc("/api/posts//revisions/diff", handler.DiffPostRevisions)
+	mux.Mux.HandleFunc("/api/posts//revisions//restore", handler.RestorePostRevision)
+
+	mux.Mux.HandleFunc("/api/posts//comments", handler.Comments)
+	mux.Mux.HandleFunc("/api/posts//comments/", handler.Comment)
 
 	mux.Mux.HandleFunc("/api/posts//images", handler.AddedImage)
 	mux.Mux.HandleFunc("/api/posts//images/", handler.DeleteImage)
+	mux.Mux.HandleFunc("/api/posts//images/order", handler.ReorderImages)
+	mux.Mux.HandleFunc("/api/posts//images/uploads", handler.CreateImageUpload)
+	mux.Mux.HandleFunc("/api/posts//images/uploads/", handler.CompleteImageUpload)
+	mux.Mux.HandleFunc("/api/posts//images/tus/", handler.AttachTusUpload)
+
+	mux.Mux.HandleFunc("/api/uploads/", handler.TusUploads)
+
+	// files of the local and the memory storages, MinIO serves its own
+	if mediaHandler != nil {
+		mux.Mux.Handle(storage.MediaPathPrefix, mediaHandler)
+	}
 
 	handlerChain := middleware.Chain(
 		mux.Mux,
+		middleware.IdempotencyMiddleware(repo.Idempotency, cfg.IdempotencyKeyTTL),
+		middleware.AnonymousRateLimitMiddleware(cfg.AnonymousRateLimit, cfg.AnonymousRateWindow),
 		middleware.LoggingMiddleware,
 		middleware.CORSMiddleware,
 		middleware.AuthMiddleware(cfg),
@@ -7,25 +7,33 @@ import (
 	"microblogCPT/internal/repository"
 	"microblogCPT/internal/service"
 	"microblogCPT/internal/storage"
+	"net/http"
 )
 
-func App(cfg *config.Config) (*database.DB, *repository.Repository, *service.Service) {
+// App connects the dependencies of the API. The returned handler serves the files of the local
+// and the memory storages and is nil for MinIO
+func App(cfg *config.Config) (*database.DB, *repository.Repository, *service.Service, http.Handler) {
 	// connection DB
 	db, err := database.ConnectDB(cfg)
 	if err != nil {
 		log.Fatalf("Не удалось подключиться к БД: %v", err)
 	}
 
-	// connection MinIO
-	minioClient, err := storage.NewMinIOClient(cfg)
+	// connection to the object storage
+	store, mediaHandler, err := storage.New(cfg)
 	if err != nil {
-		log.Fatalf("Не удалось инициализировать MinIO: %v", err)
+		log.Fatalf("Не удалось инициализировать хранилище: %v", err)
 	}
 
 	// enabling dependencies
 	repo := repository.NewRepository(db.DB)
 
-	services := service.NewService(repo, cfg, minioClient)
+	// keys of a single instance can be kept in memory
+	if cfg.IdempotencyStore == "memory" {
+		repo.Idempotency = repository.NewMemoryIdempotencyRepository()
+	}
+
+	services := service.NewService(repo, cfg, store)
 
-	return db, repo, services
+	return db, repo, services, mediaHandler
 }
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"microblogCPT/cmd/app"
+	"microblogCPT/internal/config"
+	"microblogCPT/internal/database"
+	"microblogCPT/internal/worker"
+)
+
+// reconcile compares the object storage with the images table once and removes orphaned objects
+// and images without objects. With -dry-run it only reports them
+func main() {
+	dryRun := flag.Bool("dry-run", false, "только показать найденные объекты и изображения, ничего не удалять")
+	flag.Parse()
+
+	cfg := config.LoadConfig()
+
+	db, _, services, _ := app.App(cfg)
+	defer database.MethodsDB.CloseDB(db)
+
+	report, err := services.Reconcile.Reconcile(context.Background(), *dryRun)
+	if err != nil {
+		log.Fatalf("Ошибка сверки хранилища: %v", err)
+	}
+
+	worker.LogReconcileReport(report)
+	log.Printf("Найдено объектов без записи: %d, изображений без объекта: %d",
+		len(report.OrphanObjects), len(report.DanglingImages))
+}
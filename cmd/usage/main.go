@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"log"
+	"microblogCPT/cmd/app"
+	"microblogCPT/internal/config"
+	"microblogCPT/internal/database"
+)
+
+// usage recomputes the storage usage of the users and the posts when the counters have drifted:
+// the sizes of the images are taken from the storage and the counters are rebuilt from the images
+func main() {
+	cfg := config.LoadConfig()
+
+	db, _, services, _ := app.App(cfg)
+	defer database.MethodsDB.CloseDB(db)
+
+	corrected, err := services.Usage.Recompute(context.Background())
+	if err != nil {
+		log.Fatalf("Ошибка пересчета использования хранилища: %v", err)
+	}
+
+	log.Printf("Использование хранилища пересчитано, исправлен размер изображений: %d", corrected)
+}
@@ -3,8 +3,10 @@ package config
 import (
 	"github.com/joho/godotenv"
 	"log"
+	"microblogCPT/internal/models"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -18,23 +20,74 @@ type DB struct {
 }
 
 type MinIO struct {
-	Endpoint   string
-	AccessKey  string
-	SecretKey  string
-	BucketName string
-	UseSSL     bool
-	Region     string
+	Endpoint      string
+	AccessKey     string
+	SecretKey     string
+	BucketName    string
+	UseSSL        bool
+	Region        string
+	URLExpiry     time.Duration
+	PublicBaseURL string
+	// CreateBucket creates the bucket at startup when it does not exist
+	CreateBucket bool
+	// Versioning keeps the previous versions of the objects, they expire after NoncurrentDays
+	Versioning     bool
+	NoncurrentDays int
+	// AbortIncompleteDays aborts the multipart uploads left unfinished, 0 keeps them
+	AbortIncompleteDays int
+}
+
+// LocalStorage configures the storages that serve their objects through the API under /media/
+type LocalStorage struct {
+	Dir        string
+	BaseURL    string
+	SigningKey string
 	URLExpiry  time.Duration
 }
 
 type Config struct {
-	ServerPort           int
-	DB                   DB
-	MinIO                MinIO
-	JWTSecretKey         string
-	AccessTokenDuration  time.Duration
-	RefreshTokenDuration time.Duration
-	MaxUploadSize        int64
+	ServerPort            int
+	DB                    DB
+	StorageDriver         string
+	MinIO                 MinIO
+	LocalStorage          LocalStorage
+	JWTSecretKey          string
+	AccessTokenDuration   time.Duration
+	RefreshTokenDuration  time.Duration
+	MaxUploadSize         int64
+	TrashRetention        time.Duration
+	TrashPurgeInterval    time.Duration
+	IdempotencyKeyTTL     time.Duration
+	IdempotencyStore      string
+	IdempotencyCleanup    time.Duration
+	UploadURLExpiry       time.Duration
+	UploadCleanupInterval time.Duration
+	TusMaxSize            int64
+	TusUploadExpiry       time.Duration
+	ImageMaxWidth         int
+	ImageMaxHeight        int
+	ImageMaxPixels        int
+	ImageMaxFiles         int
+	ImageStripMetadata    bool
+	ImageKeepMetadata     []string
+	ImageRequireAltText   bool
+	VariantWidths         []int
+	VariantQuality        int
+	VariantInterval       time.Duration
+	VariantClaimTimeout   time.Duration
+	VariantMaxAttempts    int
+	ReconcileInterval     time.Duration
+	ReconcileDryRun       bool
+	ReconcileMinAge       time.Duration
+	HandleChangeInterval  time.Duration
+	HandleRedirectPeriod  time.Duration
+	// AnonymousRateLimit is the number of requests an anonymous client address may make per AnonymousRateWindow,
+	// 0 disables the limit
+	AnonymousRateLimit   int
+	AnonymousRateWindow  time.Duration
+	AnonymousCacheMaxAge time.Duration
+	// StorageQuotas limit the images of the users by role, a role without a quota is not limited
+	StorageQuotas map[string]models.StorageQuota
 }
 
 func getEnv(key string, defaultValue string) string {
@@ -83,13 +136,36 @@ func LoadDB() DB {
 
 func LoadMinIO() MinIO {
 	return MinIO{
-		Endpoint:   getEnv("MINIO_ENDPOINT", "localhost:9000"),
-		AccessKey:  getEnv("MINIO_ACCESS_KEY", "minioadmin"),
-		SecretKey:  getEnv("MINI	O_SECRET_KEY", "minioadmin"),
-		BucketName: getEnv("MINIO_BUCKET_NAME", "images"),
-		UseSSL:     getEnvBool("MINIO_USE_SSL", false),
-		Region:     getEnv("MINIO_REGION", "us-east-1"),
-		URLExpiry:  parseDuration(getEnv("MINIO_URL_EXPIRY", "7d")),
+		Endpoint:            getEnv("MINIO_ENDPOINT", "localhost:9000"),
+		AccessKey:           getEnv("MINIO_ACCESS_KEY", "minioadmin"),
+		SecretKey:           getEnv("MINIO_SECRET_KEY", "minioadmin"),
+		BucketName:          getEnv("MINIO_BUCKET_NAME", "images"),
+		UseSSL:              getEnvBool("MINIO_USE_SSL", false),
+		Region:              getEnv("MINIO_REGION", "us-east-1"),
+		URLExpiry:           parseDuration(getEnv("MINIO_URL_EXPIRY", "168h")),
+		PublicBaseURL:       getEnv("MINIO_PUBLIC_BASE_URL", ""),
+		CreateBucket:        getEnvBool("MINIO_CREATE_BUCKET", true),
+		Versioning:          getEnvBool("MINIO_VERSIONING", false),
+		NoncurrentDays:      getEnvAsInt("MINIO_NONCURRENT_DAYS", 30),
+		AbortIncompleteDays: getEnvAsInt("MINIO_ABORT_INCOMPLETE_DAYS", 7),
+	}
+}
+
+func LoadLocalStorage() LocalStorage {
+	return LocalStorage{
+		Dir:        getEnv("LOCAL_STORAGE_DIR", "./data/media"),
+		BaseURL:    getEnv("MEDIA_BASE_URL", "http://localhost:8080"),
+		SigningKey: getEnv("MEDIA_SIGNING_KEY", ""),
+		URLExpiry:  parseDuration(getEnv("MEDIA_URL_EXPIRY", "168h")),
+	}
+}
+
+func LoadStorageQuotas() map[string]models.StorageQuota {
+	return map[string]models.StorageQuota{
+		"Author": {
+			MaxBytes:   parseMaxUploadSize(getEnv("STORAGE_QUOTA_AUTHOR_BYTES", "1073741824")),
+			MaxObjects: getEnvAsInt("STORAGE_QUOTA_AUTHOR_OBJECTS", 1000),
+		},
 	}
 }
 
@@ -99,15 +175,54 @@ func LoadConfig() *Config {
 		log.Println("Warning: .env file not found, using environment variables")
 	}
 
-	return &Config{
-		ServerPort:           getEnvAsInt("SERVER_PORT", 8080),
-		DB:                   LoadDB(),
-		MinIO:                LoadMinIO(),
-		JWTSecretKey:         getEnv("JWT_SECRET_KEY", ""),
-		AccessTokenDuration:  parseDuration(getEnv("ACCESS_TOKEN_DURATION", "2h")),
-		RefreshTokenDuration: parseDuration(getEnv("REFRESH_TOKEN_DURATION", "168h")),
-		MaxUploadSize:        parseMaxUploadSize(getEnv("MAX_UPLOAD_SIZE", "10485760")),
+	cfg := &Config{
+		ServerPort:            getEnvAsInt("SERVER_PORT", 8080),
+		DB:                    LoadDB(),
+		StorageDriver:         getEnv("STORAGE_DRIVER", "minio"),
+		MinIO:                 LoadMinIO(),
+		LocalStorage:          LoadLocalStorage(),
+		JWTSecretKey:          getEnv("JWT_SECRET_KEY", ""),
+		AccessTokenDuration:   parseDuration(getEnv("ACCESS_TOKEN_DURATION", "2h")),
+		RefreshTokenDuration:  parseDuration(getEnv("REFRESH_TOKEN_DURATION", "168h")),
+		MaxUploadSize:         parseMaxUploadSize(getEnv("MAX_UPLOAD_SIZE", "10485760")),
+		TrashRetention:        parseDuration(getEnv("TRASH_RETENTION", "720h")),
+		TrashPurgeInterval:    parseDuration(getEnv("TRASH_PURGE_INTERVAL", "1h")),
+		IdempotencyKeyTTL:     parseDuration(getEnv("IDEMPOTENCY_KEY_TTL", "24h")),
+		IdempotencyStore:      getEnv("IDEMPOTENCY_STORE", "postgres"),
+		IdempotencyCleanup:    parseDuration(getEnv("IDEMPOTENCY_CLEANUP_INTERVAL", "1h")),
+		UploadURLExpiry:       parseDuration(getEnv("UPLOAD_URL_EXPIRY", "15m")),
+		UploadCleanupInterval: parseDuration(getEnv("UPLOAD_CLEANUP_INTERVAL", "1h")),
+		TusMaxSize:            parseMaxUploadSize(getEnv("TUS_MAX_SIZE", "524288000")),
+		TusUploadExpiry:       parseDuration(getEnv("TUS_UPLOAD_EXPIRY", "24h")),
+		ImageMaxWidth:         getEnvAsInt("IMAGE_MAX_WIDTH", 8192),
+		ImageMaxHeight:        getEnvAsInt("IMAGE_MAX_HEIGHT", 8192),
+		ImageMaxPixels:        getEnvAsInt("IMAGE_MAX_PIXELS", 40000000),
+		ImageMaxFiles:         getEnvAsInt("IMAGE_MAX_FILES", 10),
+		ImageStripMetadata:    getEnvBool("IMAGE_STRIP_METADATA", true),
+		ImageKeepMetadata:     parseList(getEnv("IMAGE_KEEP_METADATA", "")),
+		ImageRequireAltText:   getEnvBool("IMAGE_REQUIRE_ALT_TEXT", false),
+		VariantWidths:         parseWidths(getEnv("IMAGE_VARIANT_WIDTHS", "320,640,1280")),
+		VariantQuality:        getEnvAsInt("IMAGE_VARIANT_QUALITY", 82),
+		VariantInterval:       parseDuration(getEnv("IMAGE_VARIANT_INTERVAL", "30s")),
+		VariantClaimTimeout:   parseDuration(getEnv("IMAGE_VARIANT_CLAIM_TIMEOUT", "10m")),
+		VariantMaxAttempts:    getEnvAsInt("IMAGE_VARIANT_MAX_ATTEMPTS", 5),
+		ReconcileInterval:     parseDuration(getEnv("RECONCILE_INTERVAL", "0")),
+		ReconcileDryRun:       getEnvBool("RECONCILE_DRY_RUN", true),
+		ReconcileMinAge:       parseDuration(getEnv("RECONCILE_MIN_AGE", "24h")),
+		HandleChangeInterval:  parseDuration(getEnv("HANDLE_CHANGE_INTERVAL", "168h")),
+		HandleRedirectPeriod:  parseDuration(getEnv("HANDLE_REDIRECT_PERIOD", "720h")),
+		AnonymousRateLimit:    getEnvAsInt("ANON_RATE_LIMIT", 60),
+		AnonymousRateWindow:   parseDuration(getEnv("ANON_RATE_WINDOW", "1m")),
+		AnonymousCacheMaxAge:  parseDuration(getEnv("ANON_CACHE_MAX_AGE", "60s")),
+		StorageQuotas:         LoadStorageQuotas(),
+	}
+
+	// the media urls are signed with the JWT secret unless a separate key is set
+	if cfg.LocalStorage.SigningKey == "" {
+		cfg.LocalStorage.SigningKey = cfg.JWTSecretKey
 	}
+
+	return cfg
 }
 
 func parseMaxUploadSize(value string) int64 {
@@ -117,3 +232,26 @@ func parseMaxUploadSize(value string) int64 {
 	}
 	return size
 }
+
+// parseWidths reads a comma separated list of widths, invalid entries are skipped
+func parseWidths(value string) []int {
+	var widths []int
+	for _, part := range strings.Split(value, ",") {
+		width, err := strconv.Atoi(strings.TrimSpace(part))
+		if err == nil && width > 0 {
+			widths = append(widths, width)
+		}
+	}
+	return widths
+}
+
+// parseList reads a comma separated list, empty entries are skipped
+func parseList(value string) []string {
+	var items []string
+	for _, part := range strings.Split(value, ",") {
+		if item := strings.TrimSpace(part); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
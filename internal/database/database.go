@@ -7,6 +7,8 @@ import (
 	"log"
 	"microblogCPT/internal/config"
 	"os"
+	"path/filepath"
+	"sort"
 	"time"
 )
 
@@ -50,9 +52,18 @@ func ConnectDB(cfg *config.Config) (*DB, error) {
 
 	dbStruct := DB{db}
 
-	err = MethodsDB.RunMigrations(&dbStruct, "migrations/001_create_tables.sql")
+	// applying migrations in the order of their numbers
+	migrationFiles, err := filepath.Glob("migrations/*.sql")
 	if err != nil {
-		log.Printf("Внимание: ошибка при применении миграций: %v", err)
+		log.Printf("Внимание: ошибка при поиске миграций: %v", err)
+	}
+	sort.Strings(migrationFiles)
+
+	for _, migrationFile := range migrationFiles {
+		err = MethodsDB.RunMigrations(&dbStruct, migrationFile)
+		if err != nil {
+			log.Printf("Внимание: ошибка при применении миграций: %v", err)
+		}
 	}
 
 	err = MethodsDB.HealthCheck(&dbStruct)
@@ -109,5 +120,6 @@ func (db *DB) GetDB() *DB {
 // SELECT * FROM users;
 // SELECT * FROM posts;
 // SELECT * FROM images;
+// SELECT * FROM post_revisions;
 // DROP DATABASE IF EXISTS microblog;
 // CREATE DATABASE microblog;
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"microblogCPT/internal/models"
+	"microblogCPT/internal/repository"
+	"microblogCPT/internal/service"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+const maxCommentLength = 2000
+
+type CommentsResponse struct {
+	Comments   []models.Comment `json:"comments"`
+	NextCursor string           `json:"nextCursor,omitempty"`
+}
+
+// Comments handles GET and POST /api/posts/{id}/comments
+func (h *Handlers) Comments(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		h.CreateComment(w, r)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		WriteError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// check url
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) != 5 || pathParts[4] != "comments" {
+		WriteError(w, "Неверный URL", http.StatusBadRequest)
+		return
+	}
+
+	view := r.URL.Query().Get("view")
+	if view == "" {
+		view = service.CommentViewFlat
+	}
+	if view != service.CommentViewFlat && view != service.CommentViewTree {
+		WriteError(w, "Параметр view может быть flat или tree", http.StatusBadRequest)
+		return
+	}
+
+	principal := PrincipalFromContext(r.Context())
+
+	comments, next, err := h.CommentService.GetComments(r.Context(), pathParts[3], principal.UserID, view,
+		r.URL.Query().Get("cursor"), pageLimit(r))
+	if err != nil {
+		writeCommentError(w, principal, err)
+		return
+	}
+
+	h.setReadCacheHeaders(w, principal)
+	WriteSuccess(w, CommentsResponse{Comments: comments, NextCursor: next}, http.StatusOK)
+}
+
+// CreateComment adds a comment or, with parentID, a reply to a published post
+func (h *Handlers) CreateComment(w http.ResponseWriter, r *http.Request) {
+	principal := PrincipalFromContext(r.Context())
+	if principal.IsAnonymous() {
+		WriteError(w, "Требуется аутентификация", http.StatusUnauthorized)
+		return
+	}
+
+	// check url
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) != 5 || pathParts[4] != "comments" {
+		WriteError(w, "Неверный URL", http.StatusBadRequest)
+		return
+	}
+
+	var req repository.CreateCommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, "Неверный формат запроса", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateComment(req.Content); err != nil {
+		WriteError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req.PostID = pathParts[3]
+	req.AuthorID = principal.UserID
+
+	comment, err := h.CommentService.CreateComment(r.Context(), req)
+	if err != nil {
+		writeCommentError(w, principal, err)
+		return
+	}
+
+	WriteSuccess(w, comment, http.StatusCreated)
+}
+
+// Comment handles PATCH and DELETE /api/posts/{id}/comments/{commentId}. The author of the comment edits
+// its content, the author of the post hides it with "hidden"; both of them may delete it
+func (h *Handlers) Comment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch && r.Method != http.MethodDelete {
+		WriteError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	principal := PrincipalFromContext(r.Context())
+	if principal.IsAnonymous() {
+		WriteError(w, "Требуется аутентификация", http.StatusUnauthorized)
+		return
+	}
+
+	// check url
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) != 6 || pathParts[4] != "comments" || pathParts[5] == "" {
+		WriteError(w, "Неверный URL", http.StatusBadRequest)
+		return
+	}
+	postID, commentID := pathParts[3], pathParts[5]
+
+	if r.Method == http.MethodDelete {
+		if err := h.CommentService.DeleteComment(r.Context(), postID, commentID, principal.UserID); err != nil {
+			writeCommentError(w, principal, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var req repository.UpdateCommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, "Неверный формат запроса", http.StatusBadRequest)
+		return
+	}
+
+	if req.Content == nil && req.Hidden == nil {
+		WriteError(w, "Нет полей для изменения", http.StatusBadRequest)
+		return
+	}
+
+	if req.Content != nil {
+		if err := validateComment(*req.Content); err != nil {
+			WriteError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	req.PostID = postID
+	req.CommentID = commentID
+	req.UserID = principal.UserID
+
+	comment, err := h.CommentService.UpdateComment(r.Context(), req)
+	if err != nil {
+		writeCommentError(w, principal, err)
+		return
+	}
+
+	WriteSuccess(w, comment, http.StatusOK)
+}
+
+func validateComment(content string) error {
+	if strings.TrimSpace(content) == "" {
+		return errors.New("Отсутствует текст комментария")
+	}
+
+	if utf8.RuneCountInString(content) > maxCommentLength {
+		return errors.New("Комментарий не может быть длиннее 2000 символов")
+	}
+
+	return nil
+}
+
+func writeCommentError(w http.ResponseWriter, principal models.Principal, err error) {
+	switch {
+	case strings.Contains(err.Error(), "неверный курсор"):
+		WriteError(w, "Неверный курсор", http.StatusBadRequest)
+	case strings.Contains(err.Error(), "неверный parentID"):
+		WriteError(w, "Комментарий, на который дается ответ, не найден в этом посте", http.StatusBadRequest)
+	case strings.Contains(err.Error(), "комментарий") && strings.Contains(err.Error(), "не найден"):
+		WriteError(w, "Комментарий не найден", http.StatusNotFound)
+	case strings.Contains(err.Error(), "не найден"):
+		WriteError(w, "Пост не найден", http.StatusNotFound)
+	case strings.Contains(err.Error(), "только опубликованные"):
+		WriteError(w, "Комментировать можно только опубликованные посты", http.StatusConflict)
+	case strings.Contains(err.Error(), "нельзя ответить"):
+		WriteError(w, "Нельзя ответить на скрытый или удаленный комментарий", http.StatusConflict)
+	case strings.Contains(err.Error(), "доступ запрещен"):
+		writePostAccessError(w, principal)
+	default:
+		WriteError(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+)
+
+type FeedResponse struct {
+	Posts      []interface{} `json:"posts"`
+	NextCursor string        `json:"nextCursor,omitempty"`
+}
+
+// GetHomeFeed returns a page of the published posts of the authors the current user follows, newest first.
+// The next page is requested with ?cursor= from the previous response
+func (h *Handlers) GetHomeFeed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, "Требуется аутентификация", http.StatusUnauthorized)
+		return
+	}
+
+	options, err := parsePostResponseOptions(r)
+	if err != nil {
+		WriteError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	posts, next, err := h.TimelineService.HomeTimeline(r.Context(), userID, r.URL.Query().Get("cursor"), pageLimit(r))
+	if err != nil {
+		if strings.Contains(err.Error(), "неверный курсор") {
+			WriteError(w, "Неверный курсор", http.StatusBadRequest)
+		} else {
+			WriteError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if options.images {
+		if err := h.PostService.AttachImages(r.Context(), posts); err != nil {
+			WriteError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if options.author {
+		if err := h.UserService.AttachAuthors(r.Context(), posts); err != nil {
+			WriteError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	feedPosts := make([]interface{}, 0, len(posts))
+	for _, post := range posts {
+		selected, err := options.selectFields(post)
+		if err != nil {
+			WriteError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		feedPosts = append(feedPosts, selected)
+	}
+
+	WriteSuccess(w, FeedResponse{Posts: feedPosts, NextCursor: next}, http.StatusOK)
+}
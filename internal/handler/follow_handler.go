@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"microblogCPT/internal/models"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type FollowListResponse struct {
+	Users      []models.FollowUser `json:"users"`
+	NextCursor string              `json:"nextCursor,omitempty"`
+}
+
+// Follow handles PUT and DELETE /api/users/@{handle}/follow for the current user
+func (h *Handlers) Follow(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		WriteError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, "Требуется аутентификация", http.StatusUnauthorized)
+		return
+	}
+
+	handle, ok := handleFromPath(r.URL.Path)
+	if !ok {
+		WriteError(w, "Неверный URL", http.StatusBadRequest)
+		return
+	}
+
+	var (
+		status *models.FollowStatus
+		err    error
+	)
+	if r.Method == http.MethodPut {
+		status, err = h.FollowService.Follow(r.Context(), userID, handle)
+	} else {
+		status, err = h.FollowService.Unfollow(r.Context(), userID, handle)
+	}
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "не найден"):
+			WriteError(w, "Пользователь не найден", http.StatusNotFound)
+		case strings.Contains(err.Error(), "на себя"):
+			WriteError(w, "Нельзя подписаться на себя", http.StatusBadRequest)
+		default:
+			WriteError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	WriteSuccess(w, status, http.StatusOK)
+}
+
+// GetFollowers returns a page of GET /api/users/@{handle}/followers
+func (h *Handlers) GetFollowers(w http.ResponseWriter, r *http.Request) {
+	h.followList(w, r, h.FollowService.GetFollowers)
+}
+
+// GetFollowing returns a page of GET /api/users/@{handle}/following
+func (h *Handlers) GetFollowing(w http.ResponseWriter, r *http.Request) {
+	h.followList(w, r, h.FollowService.GetFollowing)
+}
+
+func (h *Handlers) followList(w http.ResponseWriter, r *http.Request,
+	list func(ctx context.Context, handle, cursor string, limit int) ([]models.FollowUser, string, error)) {
+	if r.Method != http.MethodGet {
+		WriteError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	handle, ok := handleFromPath(r.URL.Path)
+	if !ok {
+		WriteError(w, "Неверный URL", http.StatusBadRequest)
+		return
+	}
+
+	users, next, err := list(r.Context(), handle, r.URL.Query().Get("cursor"), pageLimit(r))
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "неверный курсор"):
+			WriteError(w, "Неверный курсор", http.StatusBadRequest)
+		case strings.Contains(err.Error(), "не найден"):
+			WriteError(w, "Пользователь не найден", http.StatusNotFound)
+		default:
+			WriteError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	WriteSuccess(w, FollowListResponse{Users: users, NextCursor: next}, http.StatusOK)
+}
+
+// pageLimit reads ?limit= from 1 to 100, 20 by default
+func pageLimit(r *http.Request) int {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	return limit
+}
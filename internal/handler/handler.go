@@ -11,28 +11,38 @@ import (
 )
 
 type Handlers struct {
-	UserService   service.UserService
-	UserRepo      repository.UserRepository
-	AuthService   service.AuthService
-	PostService   service.PostService
-	PostRepo      repository.PostRepository
-	TablesRepo    repository.TablesRepository
-	TablesService service.TablesService
-	Cfg           *config.Config
-	Validate      *validator.Validate
+	UserService     service.UserService
+	UserRepo        repository.UserRepository
+	AuthService     service.AuthService
+	PostService     service.PostService
+	UploadService   service.UploadService
+	UsageService    service.UsageService
+	FollowService   service.FollowService
+	TimelineService service.TimelineService
+	CommentService  service.CommentService
+	PostRepo        repository.PostRepository
+	TablesRepo      repository.TablesRepository
+	TablesService   service.TablesService
+	Cfg             *config.Config
+	Validate        *validator.Validate
 }
 
 func NewHandlers(repo *repository.Repository, service *service.Service, config *config.Config) *Handlers {
 	return &Handlers{
-		UserService:   service.User,
-		UserRepo:      repo.User,
-		AuthService:   service.Auth,
-		PostService:   service.Post,
-		PostRepo:      repo.Post,
-		TablesRepo:    repo.Tables,
-		TablesService: service.Tables,
-		Cfg:           config,
-		Validate:      validator.New(),
+		UserService:     service.User,
+		UserRepo:        repo.User,
+		AuthService:     service.Auth,
+		PostService:     service.Post,
+		UploadService:   service.Upload,
+		UsageService:    service.Usage,
+		FollowService:   service.Follow,
+		TimelineService: service.Timeline,
+		CommentService:  service.Comment,
+		PostRepo:        repo.Post,
+		TablesRepo:      repo.Tables,
+		TablesService:   service.Tables,
+		Cfg:             config,
+		Validate:        validator.New(),
 	}
 }
 
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"microblogCPT/internal/models"
+	"microblogCPT/internal/repository"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxAltTextLength = 1000
+	maxCaptionLength = 2000
+)
+
+type ReorderImagesRequest struct {
+	ImageIDs []string `json:"imageIds"`
+}
+
+type ReorderImagesResponse struct {
+	Images []*models.Image `json:"images"`
+}
+
+// UpdateImage changes the alt text, the caption or the position of the image
+func (h *Handlers) UpdateImage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		WriteError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// check url
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) < 6 || pathParts[4] != "images" {
+		WriteError(w, "Неверный URL", http.StatusBadRequest)
+		return
+	}
+	postID := pathParts[3]
+
+	if _, ok := h.checkImageAccess(w, r, postID); !ok {
+		return
+	}
+
+	var req repository.UpdateImageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, "Неверный формат запроса", http.StatusBadRequest)
+		return
+	}
+	req.PostID = postID
+	req.ImageID = pathParts[5]
+
+	if req.AltText == nil && req.Caption == nil && req.Position == nil {
+		WriteError(w, "Нет полей для обновления", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateImageDetails(req.AltText, req.Caption); err != nil {
+		WriteError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	image, err := h.PostService.UpdateImage(r.Context(), req)
+	if err != nil {
+		if strings.Contains(err.Error(), "не найдено") {
+			WriteError(w, "Пост или картинка не найдены", http.StatusNotFound)
+		} else {
+			WriteError(w, "Ошибка обновления изображения", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(image)
+}
+
+// ReorderImages puts the images of the post in the given order
+func (h *Handlers) ReorderImages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		WriteError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// check url
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) < 6 || pathParts[4] != "images" || pathParts[5] != "order" {
+		WriteError(w, "Неверный URL", http.StatusBadRequest)
+		return
+	}
+	postID := pathParts[3]
+
+	if _, ok := h.checkImageAccess(w, r, postID); !ok {
+		return
+	}
+
+	var req ReorderImagesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, "Неверный формат запроса", http.StatusBadRequest)
+		return
+	}
+
+	images, err := h.PostService.ReorderImages(r.Context(), postID, req.ImageIDs)
+	if err != nil {
+		if strings.Contains(err.Error(), "список должен") {
+			WriteError(w, "Список должен содержать каждое изображение поста один раз", http.StatusBadRequest)
+		} else {
+			WriteError(w, "Ошибка изменения порядка изображений", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ReorderImagesResponse{Images: images})
+}
+
+// decodeImageDetails reads the optional texts of the image from the body of the request
+// that finishes an upload, an empty body gives an image without them
+func decodeImageDetails(r *http.Request) (repository.ImageDetails, error) {
+	var details repository.ImageDetails
+	if err := json.NewDecoder(r.Body).Decode(&details); err != nil && !errors.Is(err, io.EOF) {
+		return details, errors.New("Неверный формат запроса")
+	}
+
+	return details, validateImageDetails(&details.AltText, &details.Caption)
+}
+
+// validateImageDetails checks the length of the texts of the image
+func validateImageDetails(altText, caption *string) error {
+	if altText != nil && utf8.RuneCountInString(*altText) > maxAltTextLength {
+		return fmt.Errorf("Альтернативный текст длиннее %d символов", maxAltTextLength)
+	}
+
+	if caption != nil && utf8.RuneCountInString(*caption) > maxCaptionLength {
+		return fmt.Errorf("Подпись длиннее %d символов", maxCaptionLength)
+	}
+
+	return nil
+}
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"microblogCPT/internal/models"
+	"microblogCPT/internal/repository"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ImageUploadResult is the outcome of one file of the request: created, failed or rolledBack
+// when it was stored but another file failed
+type ImageUploadResult struct {
+	FileName string         `json:"fileName"`
+	Status   string         `json:"status"`
+	Error    string         `json:"error,omitempty"`
+	Image    *ImageResponse `json:"image,omitempty"`
+}
+
+type AddImagesResponse struct {
+	Error  string              `json:"error,omitempty"`
+	Images []ImageUploadResult `json:"images"`
+}
+
+type PostImagesResponse struct {
+	Images []models.Image `json:"images"`
+}
+
+// uploadFailure is the response of a request that stored none of its files
+type uploadFailure struct {
+	status  int
+	message string
+}
+
+// addImageParts stores the files of the request in their order. The altText and caption fields
+// describe the file that follows them. It stops at the first failure and returns the results so far
+// together with the images it created
+func (h *Handlers) addImageParts(r *http.Request, reader *multipart.Reader, postID string) ([]ImageUploadResult, []*models.Image, *uploadFailure) {
+	results := []ImageUploadResult{}
+	created := []*models.Image{}
+	details := repository.ImageDetails{}
+
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return results, created, nil
+		}
+		if err != nil {
+			return results, created, &uploadFailure{status: http.StatusBadRequest, message: "Ошибка при обработке файла"}
+		}
+
+		switch part.FormName() {
+		case "altText":
+			details.AltText, err = readFormValue(part, maxAltTextLength)
+		case "caption":
+			details.Caption, err = readFormValue(part, maxCaptionLength)
+		case "image", "images":
+			if len(results) >= h.Cfg.ImageMaxFiles {
+				return results, created, &uploadFailure{status: http.StatusBadRequest,
+					message: fmt.Sprintf("Не больше %d файлов за запрос", h.Cfg.ImageMaxFiles)}
+			}
+
+			if err := validateImageDetails(&details.AltText, &details.Caption); err != nil {
+				return results, created, &uploadFailure{status: http.StatusBadRequest, message: err.Error()}
+			}
+
+			file := newSizeLimitedReader(part, h.Cfg.MaxUploadSize)
+			image, err := h.PostService.AddedImage(r.Context(), postID, part.FileName(), file, details)
+			if err != nil {
+				failure := imageUploadFailure(err, file.exceeded, h.Cfg.MaxUploadSize)
+				results = append(results, ImageUploadResult{FileName: part.FileName(), Status: "failed", Error: failure.message})
+				return results, created, failure
+			}
+
+			response := newImageResponse(image, part.FileName(), image.Size)
+			results = append(results, ImageUploadResult{FileName: part.FileName(), Status: "created", Image: &response})
+			created = append(created, image)
+
+			// the texts belong to one file only
+			details = repository.ImageDetails{}
+		}
+		part.Close()
+
+		if err != nil {
+			return results, created, &uploadFailure{status: http.StatusBadRequest, message: err.Error()}
+		}
+	}
+}
+
+// imageUploadFailure maps the error of one file to the response of the request
+func imageUploadFailure(err error, tooLarge bool, maxSize int64) *uploadFailure {
+	switch {
+	case tooLarge || strings.Contains(err.Error(), "размер файла превышает"):
+		return &uploadFailure{http.StatusBadRequest, fmt.Sprintf("Файл слишком большой (макс. %d MB)", maxSize/(1024*1024))}
+	case strings.Contains(err.Error(), "неподдерживаемый тип файла"):
+		return &uploadFailure{http.StatusBadRequest, "Неподдерживаемый тип файла. Разрешены: JPEG, PNG, GIF, WebP"}
+	case isInvalidImage(err):
+		return &uploadFailure{http.StatusBadRequest, err.Error()}
+	case strings.Contains(err.Error(), "доступ запрещен"):
+		return &uploadFailure{http.StatusForbidden, "Доступ запрещен"}
+	case strings.Contains(err.Error(), "пост не найден"):
+		return &uploadFailure{http.StatusNotFound, "Пост не найден"}
+	case isQuotaExceeded(err):
+		return &uploadFailure{http.StatusForbidden, err.Error()}
+	}
+	return &uploadFailure{http.StatusInternalServerError, "Ошибка загрузки изображения"}
+}
+
+// readFormValue reads a text field of the multipart request, a character takes up to 4 bytes in UTF-8
+func readFormValue(part *multipart.Part, maxLength int) (string, error) {
+	value, err := io.ReadAll(io.LimitReader(part, int64(maxLength)*4+1))
+	if err != nil {
+		return "", errors.New("Ошибка при обработке файла")
+	}
+
+	return string(value), nil
+}
+
+// sizeLimitedReader fails the read of a file larger than the limit, one byte past the limit
+// is read to tell a full file from a larger one
+type sizeLimitedReader struct {
+	reader   io.Reader
+	limit    int64
+	read     int64
+	exceeded bool
+}
+
+func newSizeLimitedReader(reader io.Reader, limit int64) *sizeLimitedReader {
+	return &sizeLimitedReader{reader: io.LimitReader(reader, limit+1), limit: limit}
+}
+
+func (l *sizeLimitedReader) Read(p []byte) (int, error) {
+	n, err := l.reader.Read(p)
+	l.read += int64(n)
+	if l.read > l.limit {
+		l.exceeded = true
+		return n, errors.New("размер файла превышает допустимый")
+	}
+
+	return n, err
+}
+
+// newImageResponse describes the stored image for the client that uploaded it
+func newImageResponse(image *models.Image, fileName string, fileSize int64) ImageResponse {
+	return ImageResponse{
+		ImageID:      image.ImageID,
+		PostID:       image.PostID,
+		ImageUrl:     image.ImageURL,
+		FileName:     fileName,
+		FileSize:     fileSize,
+		MimeType:     image.MimeType,
+		Width:        image.Width,
+		Height:       image.Height,
+		CreatedAt:    image.CreatedAt.Format(time.RFC3339),
+		AltText:      image.AltText,
+		Caption:      image.Caption,
+		Position:     image.Position,
+		Deduplicated: image.Deduplicated,
+	}
+}
+
+// GetPostImages returns the images of the post in their order, with the urls and the variants
+func (h *Handlers) GetPostImages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// check url
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) < 5 || pathParts[4] != "images" {
+		WriteError(w, "Неверный URL", http.StatusBadRequest)
+		return
+	}
+
+	images, ok := h.getPostImages(w, r, pathParts[3])
+	if !ok {
+		return
+	}
+
+	h.setReadCacheHeaders(w, PrincipalFromContext(r.Context()))
+	WriteSuccess(w, PostImagesResponse{Images: images}, http.StatusOK)
+}
+
+// GetImage returns one image of the post
+func (h *Handlers) GetImage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// check url
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) < 6 || pathParts[4] != "images" {
+		WriteError(w, "Неверный URL", http.StatusBadRequest)
+		return
+	}
+	imageID := pathParts[5]
+
+	images, ok := h.getPostImages(w, r, pathParts[3])
+	if !ok {
+		return
+	}
+
+	for _, image := range images {
+		if image.ImageID == imageID {
+			h.setReadCacheHeaders(w, PrincipalFromContext(r.Context()))
+			WriteSuccess(w, image, http.StatusOK)
+			return
+		}
+	}
+
+	WriteError(w, "Пост или картинка не найдены", http.StatusNotFound)
+}
+
+// getPostImages loads the images of the post that the principal may see: a published post or one of the user
+func (h *Handlers) getPostImages(w http.ResponseWriter, r *http.Request, postID string) ([]models.Image, bool) {
+	post, err := h.PostRepo.GetByID(r.Context(), postID)
+	if err != nil {
+		if strings.Contains(err.Error(), "не найден") {
+			WriteError(w, "Пост не найден", http.StatusNotFound)
+		} else {
+			WriteError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+
+	principal := PrincipalFromContext(r.Context())
+	if !canReadPost(principal, post) {
+		writePostAccessError(w, principal)
+		return nil, false
+	}
+
+	posts := []models.Post{*post}
+	if err := h.PostService.AttachImages(r.Context(), posts); err != nil {
+		WriteError(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if posts[0].Images == nil {
+		return []models.Image{}, true
+	}
+	return posts[0].Images, true
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"encoding/json"
+	"microblogCPT/internal/repository"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ImageUploadResponse struct {
+	UploadID  string            `json:"uploadId"`
+	UploadURL string            `json:"uploadUrl"`
+	Method    string            `json:"method"`
+	Headers   map[string]string `json:"headers"`
+	ExpiresAt time.Time         `json:"expiresAt"`
+}
+
+// CreateImageUpload issues a presigned url for uploading an image of the post straight to the storage
+func (h *Handlers) CreateImageUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		WriteError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// check url
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) < 6 || pathParts[4] != "images" || pathParts[5] != "uploads" {
+		WriteError(w, "Неверный URL", http.StatusBadRequest)
+		return
+	}
+	postID := pathParts[3]
+
+	authorID, ok := h.checkImageAccess(w, r, postID)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		FileName    string `json:"fileName" validate:"required"`
+		ContentType string `json:"contentType" validate:"required"`
+		Size        int64  `json:"size" validate:"required"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, "Неверный формат запроса", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Validate.Struct(req); err != nil {
+		WriteError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// check formats
+	if !allowedImageTypes[req.ContentType] {
+		WriteError(w, "Неподдерживаемый тип файла. Разрешены: JPEG, PNG, GIF, WebP", http.StatusBadRequest)
+		return
+	}
+
+	upload, uploadURL, err := h.PostService.CreateImageUpload(r.Context(), repository.CreateImageUploadRequest{
+		PostID:      postID,
+		AuthorID:    authorID,
+		FileName:    req.FileName,
+		ContentType: req.ContentType,
+		Size:        req.Size,
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "размер файла превышает") {
+			WriteError(w, err.Error(), http.StatusBadRequest)
+		} else if isQuotaExceeded(err) {
+			WriteError(w, err.Error(), http.StatusForbidden)
+		} else {
+			WriteError(w, "Ошибка создания загрузки", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// the client has to send exactly these headers, they are part of the signature
+	response := ImageUploadResponse{
+		UploadID:  upload.UploadID,
+		UploadURL: uploadURL,
+		Method:    http.MethodPut,
+		Headers: map[string]string{
+			"Content-Type":   upload.ContentType,
+			"Content-Length": strconv.FormatInt(upload.Size, 10),
+		},
+		ExpiresAt: upload.ExpiresAt,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// CompleteImageUpload adds the uploaded object to the post after checking it
+func (h *Handlers) CompleteImageUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		WriteError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// check url
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) < 8 || pathParts[4] != "images" || pathParts[5] != "uploads" || pathParts[7] != "complete" {
+		WriteError(w, "Неверный URL", http.StatusBadRequest)
+		return
+	}
+	postID := pathParts[3]
+	uploadID := pathParts[6]
+
+	if _, ok := h.checkImageAccess(w, r, postID); !ok {
+		return
+	}
+
+	details, err := decodeImageDetails(r)
+	if err != nil {
+		WriteError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	image, upload, err := h.PostService.CompleteImageUpload(r.Context(), postID, uploadID, details)
+	if err != nil {
+		if strings.Contains(err.Error(), "загрузка не найдена") {
+			WriteError(w, "Загрузка не найдена", http.StatusNotFound)
+		} else if strings.Contains(err.Error(), "срок загрузки истек") {
+			WriteError(w, "Срок загрузки истек", http.StatusGone)
+		} else if strings.Contains(err.Error(), "файл не загружен") {
+			WriteError(w, "Файл еще не загружен", http.StatusConflict)
+		} else if isQuotaExceeded(err) {
+			WriteError(w, err.Error(), http.StatusForbidden)
+		} else if isInvalidImage(err) {
+			WriteError(w, err.Error(), http.StatusUnprocessableEntity)
+		} else if strings.Contains(err.Error(), "не совпадает") {
+			WriteError(w, "Загруженный файл не совпадает с заявленным", http.StatusUnprocessableEntity)
+		} else {
+			WriteError(w, "Ошибка завершения загрузки", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// forming the response
+	response := newImageResponse(image, upload.FileName, upload.Size)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// checkImageAccess allows only the author of the post to upload its images and returns the author id
+func (h *Handlers) checkImageAccess(w http.ResponseWriter, r *http.Request, postID string) (string, bool) {
+	// checking the user's role
+	userRole, ok := r.Context().Value("role").(string)
+	if !ok || userRole != "Author" {
+		WriteError(w, "Доступ запрещен", http.StatusForbidden)
+		return "", false
+	}
+
+	// we receive a post on id
+	post, err := h.PostRepo.GetByID(r.Context(), postID)
+	if err != nil {
+		if strings.Contains(err.Error(), "не найден") {
+			WriteError(w, "Пост не найден", http.StatusNotFound)
+		} else {
+			WriteError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return "", false
+	}
+
+	authorID, _ := r.Context().Value("userID").(string)
+	if authorID != post.AuthorID {
+		WriteError(w, "Доступ запрещен", http.StatusForbidden)
+		return "", false
+	}
+
+	return authorID, true
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// postResponseOptions describes the shape of the post responses requested by the client
+type postResponseOptions struct {
+	// images embeds the images of the posts
+	images bool
+	// author embeds the author of the posts with the avatar
+	author bool
+	// fields keeps only the listed fields of a post, nil keeps all of them
+	fields map[string]bool
+}
+
+// parsePostResponseOptions reads ?include= and ?fields=. Images and the author are embedded by default,
+// an empty ?include= or a ?fields= list without images leaves the images out, the author is left out
+// only by ?fields=
+func parsePostResponseOptions(r *http.Request) (postResponseOptions, error) {
+	query := r.URL.Query()
+	options := postResponseOptions{images: true, author: true}
+
+	if query.Has("include") {
+		options.images = false
+		for _, name := range splitList(query.Get("include")) {
+			if name != "images" {
+				return options, fmt.Errorf("Неизвестное значение include: %s", name)
+			}
+			options.images = true
+		}
+	}
+
+	if fields := splitList(query.Get("fields")); len(fields) > 0 {
+		options.fields = make(map[string]bool, len(fields))
+		for _, field := range fields {
+			options.fields[field] = true
+		}
+		options.images = options.images && options.fields["images"]
+		options.author = options.fields["author"]
+	}
+
+	return options, nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// selectFields keeps only the requested fields of the encoded value
+func (o postResponseOptions) selectFields(value interface{}) (interface{}, error) {
+	if o.fields == nil {
+		return value, nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+
+	for field := range object {
+		if !o.fields[field] {
+			delete(object, field)
+		}
+	}
+
+	return object, nil
+}
@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"microblogCPT/internal/models"
 	"microblogCPT/internal/repository"
@@ -19,18 +21,24 @@ type PaginationResponse struct {
 }
 
 type PostsGetResponse struct {
-	Posts      []models.Post
-	Pagination PaginationResponse
+	Posts      []interface{}      `json:"posts"`
+	Pagination PaginationResponse `json:"pagination"`
+}
+
+type TrashResponse struct {
+	Posts []models.Post `json:"posts"`
 }
 
 type PostResponse struct {
-	PostId         string    `json:"postId"`
-	IdempotencyKey *string   `json:"idempotencyKey"`
-	Title          string    `json:"title"`
-	Content        string    `json:"content"`
-	Status         string    `json:"status"`
-	CreatedAt      time.Time `json:"createdAt"`
-	UpdatedAt      time.Time `json:"updatedAt"`
+	PostId         string         `json:"postId"`
+	IdempotencyKey *string        `json:"idempotencyKey"`
+	Title          string         `json:"title"`
+	Content        string         `json:"content"`
+	Status         string         `json:"status"`
+	Version        int            `json:"version"`
+	CreatedAt      time.Time      `json:"createdAt"`
+	UpdatedAt      time.Time      `json:"updatedAt"`
+	Images         []models.Image `json:"images,omitempty"`
 }
 
 type ImageResponse struct {
@@ -40,7 +48,36 @@ type ImageResponse struct {
 	FileName  string `json:"fileName"`
 	FileSize  int64  `json:"fileSize"`
 	MimeType  string `json:"mimeType"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
 	CreatedAt string `json:"createdAt"`
+	AltText   string `json:"altText"`
+	Caption   string `json:"caption"`
+	Position  int    `json:"position"`
+	// Deduplicated reports that the same content was already stored and the image refers to it
+	Deduplicated bool `json:"deduplicated"`
+}
+
+// formats image
+var allowedImageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/jpg":  true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// isQuotaExceeded reports whether the image does not fit into the storage quota of the author
+func isQuotaExceeded(err error) bool {
+	return strings.Contains(err.Error(), "превышена квота")
+}
+
+// isInvalidImage reports whether the service rejected the content of the file
+func isInvalidImage(err error) bool {
+	return strings.Contains(err.Error(), "неподдерживаемый тип файла") ||
+		strings.Contains(err.Error(), "не совпадает с типом") ||
+		strings.Contains(err.Error(), "размеры изображения") ||
+		strings.Contains(err.Error(), "не удалось прочитать изображение")
 }
 
 func (h *Handlers) GetPosts(w http.ResponseWriter, r *http.Request) {
@@ -50,8 +87,7 @@ func (h *Handlers) GetPosts(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Getting information about the user from the context
-	userRole, _ := r.Context().Value("role").(string)
-	userID, _ := r.Context().Value("userID").(string)
+	principal := PrincipalFromContext(r.Context())
 
 	// Pagination parameters
 	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
@@ -63,13 +99,17 @@ func (h *Handlers) GetPosts(w http.ResponseWriter, r *http.Request) {
 		limit = 20
 	}
 
+	options, err := parsePostResponseOptions(r)
+	if err != nil {
+		WriteError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	var posts []models.Post
-	var total int
-	var err error
 
-	if userRole == "Author" { // Returning the user posts
-		posts, err = h.PostRepo.GetByUserID(r.Context(), userID)
-	} else { // Returning the all posts
+	if !principal.IsAnonymous() && principal.Role == "Author" { // Returning the user posts
+		posts, err = h.PostRepo.GetByUserID(r.Context(), principal.UserID)
+	} else { // Returning the published posts, the only ones an anonymous visitor may read
 		posts, err = h.PostRepo.GetPublishPosts(r.Context())
 	}
 
@@ -78,9 +118,39 @@ func (h *Handlers) GetPosts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// cutting out the requested page
+	total := len(posts)
+	start := min((page-1)*limit, total)
+	posts = posts[start:min(start+limit, total)]
+
+	// the images of the whole page are loaded with one query
+	if options.images {
+		if err := h.PostService.AttachImages(r.Context(), posts); err != nil {
+			WriteError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if options.author {
+		if err := h.UserService.AttachAuthors(r.Context(), posts); err != nil {
+			WriteError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	pagePosts := make([]interface{}, 0, len(posts))
+	for _, post := range posts {
+		selected, err := options.selectFields(post)
+		if err != nil {
+			WriteError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		pagePosts = append(pagePosts, selected)
+	}
+
 	// forming the response
 	response := PostsGetResponse{
-		Posts: posts,
+		Posts: pagePosts,
 		Pagination: PaginationResponse{
 			Page:       page,
 			Limit:      limit,
@@ -89,6 +159,7 @@ func (h *Handlers) GetPosts(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
+	h.setReadCacheHeaders(w, principal)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
@@ -108,29 +179,56 @@ func (h *Handlers) GetPost(w http.ResponseWriter, r *http.Request) {
 	}
 	postID := pathParts[3]
 
-	userID, _ := r.Context().Value("userID").(string)
+	principal := PrincipalFromContext(r.Context())
 
-	// we receive a post on id
-	post, err := h.PostRepo.GetByID(r.Context(), postID)
-	if post.Content != "Published" && post.AuthorID != userID {
-		WriteError(w, "Доступ запрещен", http.StatusForbidden)
+	options, err := parsePostResponseOptions(r)
+	if err != nil {
+		WriteError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	// we receive a post on id
+	post, err := h.PostRepo.GetByID(r.Context(), postID)
 	if err != nil {
 		if strings.Contains(err.Error(), "не найден") {
 			WriteError(w, "Пост не найден", http.StatusNotFound)
-		} else if strings.Contains(err.Error(), "доступ запрещен") {
-			WriteError(w, "Доступ запрещен", http.StatusForbidden)
 		} else {
 			WriteError(w, err.Error(), http.StatusInternalServerError)
 		}
 		return
 	}
 
+	if !canReadPost(principal, post) {
+		writePostAccessError(w, principal)
+		return
+	}
+
+	posts := []models.Post{*post}
+	if options.images {
+		if err := h.PostService.AttachImages(r.Context(), posts); err != nil {
+			WriteError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if options.author {
+		if err := h.UserService.AttachAuthors(r.Context(), posts); err != nil {
+			WriteError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	post = &posts[0]
+
+	response, err := options.selectFields(post)
+	if err != nil {
+		WriteError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.setReadCacheHeaders(w, principal)
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", formatETag(post.Version))
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(post)
+	json.NewEncoder(w).Encode(response)
 }
 
 func (h *Handlers) CreatePost(w http.ResponseWriter, r *http.Request) {
@@ -139,6 +237,21 @@ func (h *Handlers) CreatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if r.Method == http.MethodDelete { // if delete, then we move the post to the trash
+		h.DeletePost(w, r)
+		return
+	}
+
+	if r.Method == http.MethodPatch { // if patch, then we partially update the post
+		h.PatchPost(w, r)
+		return
+	}
+
+	if r.Method == http.MethodGet && r.URL.Path != "/api/posts/" { // if get, then we return the post
+		h.GetPost(w, r)
+		return
+	}
+
 	if r.Method != http.MethodPost {
 		WriteError(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -167,9 +280,9 @@ func (h *Handlers) CreatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// checking the title of the post
-	if req.Title == "" {
-		WriteError(w, "Отсутствует заголовок", http.StatusBadRequest)
+	// checking the title and content of the post
+	if err := validatePost(req.Title, req.Content); err != nil {
+		WriteError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -182,31 +295,60 @@ func (h *Handlers) CreatePost(w http.ResponseWriter, r *http.Request) {
 		Content:        req.Content,
 	}
 
-	// creating a post
-	post, err := h.PostService.CreatePost(r.Context(), serviceReq)
+	// creating a post, a retry with the same key gets the original response
+	post, replay, err := h.PostService.CreatePost(r.Context(), serviceReq, postCreatedResponse)
 	if err != nil {
 		if strings.Contains(err.Error(), "ключ идемпотентности уже использован") {
-			WriteError(w, "Ключ идемпотентности уже использован", http.StatusConflict)
+			WriteError(w, "Ключ идемпотентности уже использован с другим запросом", http.StatusUnprocessableEntity)
 		} else {
 			WriteError(w, err.Error(), http.StatusInternalServerError)
 		}
 		return
 	}
 
-	// forming the response
-	response := PostResponse{
+	w.Header().Set("Content-Type", "application/json")
+
+	if replay != nil {
+		// the stored body is the response sent to the first request, its version is the one of the created post
+		var original PostResponse
+		if err := json.Unmarshal(replay.ResponseBody, &original); err == nil {
+			w.Header().Set("ETag", formatETag(original.Version))
+		}
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(replay.ResponseStatus)
+		w.Write(replay.ResponseBody)
+		return
+	}
+
+	status, body, err := postCreatedResponse(post)
+	if err != nil {
+		WriteError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", formatETag(post.Version))
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// postCreatedResponse renders the response to the creation of the post
+func postCreatedResponse(post *models.Post) (int, []byte, error) {
+	body, err := json.Marshal(PostResponse{
 		PostId:         post.PostID,
 		IdempotencyKey: post.IdempotencyKey,
 		Title:          post.Title,
 		Content:        post.Content,
 		Status:         post.Status,
+		Version:        post.Version,
 		CreatedAt:      post.CreatedAt,
 		UpdatedAt:      post.UpdatedAt,
+		Images:         post.Images,
+	})
+	if err != nil {
+		return 0, nil, fmt.Errorf("ошибка при формировании ответа: %w", err)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(response)
+	return http.StatusCreated, body, nil
 }
 
 func (h *Handlers) UpdatePost(w http.ResponseWriter, r *http.Request) {
@@ -230,6 +372,19 @@ func (h *Handlers) UpdatePost(w http.ResponseWriter, r *http.Request) {
 	}
 	postID := pathParts[3]
 
+	// the client must prove that it edits the latest version of the post
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		WriteError(w, "Требуется заголовок If-Match", http.StatusPreconditionRequired)
+		return
+	}
+
+	version, ok := parseETag(ifMatch)
+	if !ok {
+		WriteError(w, "Неверный формат If-Match", http.StatusBadRequest)
+		return
+	}
+
 	var req struct {
 		Title   string `json:"title" Validate:"required"`
 		Content string `json:"content" Validate:"required"`
@@ -245,8 +400,8 @@ func (h *Handlers) UpdatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Title == "" {
-		WriteError(w, "Отсутствует заголовок", http.StatusBadRequest)
+	if err := validatePost(req.Title, req.Content); err != nil {
+		WriteError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -254,11 +409,15 @@ func (h *Handlers) UpdatePost(w http.ResponseWriter, r *http.Request) {
 		PostID:  postID,
 		Title:   req.Title,
 		Content: req.Content,
+		Version: version,
 	}
 
 	// updating the post
-	if err := h.PostService.UpdatePost(r.Context(), serviceReq); err != nil {
-		if strings.Contains(err.Error(), "пост не найден") {
+	post, err := h.PostService.UpdatePost(r.Context(), serviceReq)
+	if err != nil {
+		if strings.Contains(err.Error(), "версия поста устарела") {
+			WriteError(w, "Пост был изменен, получите актуальную версию", http.StatusPreconditionFailed)
+		} else if strings.Contains(err.Error(), "не найден") {
 			WriteError(w, "Пост не найден", http.StatusNotFound)
 		} else if strings.Contains(err.Error(), "доступ запрещен") {
 			WriteError(w, "Доступ запрещен", http.StatusForbidden)
@@ -268,12 +427,13 @@ func (h *Handlers) UpdatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("ETag", formatETag(post.Version))
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(MessageResponse{Message: "Пост успешно обновлен"})
 }
 
-func (h *Handlers) AddedImage(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+func (h *Handlers) PatchPost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
 		WriteError(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
@@ -287,100 +447,232 @@ func (h *Handlers) AddedImage(w http.ResponseWriter, r *http.Request) {
 
 	// check url
 	pathParts := strings.Split(r.URL.Path, "/")
-	if len(pathParts) < 5 || pathParts[4] != "images" {
+	if len(pathParts) < 4 {
 		WriteError(w, "Неверный URL", http.StatusBadRequest)
 		return
 	}
+	postID := pathParts[3]
+
+	// the patch is applied to the version of the post known to the client
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		WriteError(w, "Требуется заголовок If-Match", http.StatusPreconditionRequired)
+		return
+	}
+
+	version, ok := parseETag(ifMatch)
+	if !ok {
+		WriteError(w, "Неверный формат If-Match", http.StatusBadRequest)
+		return
+	}
+
+	contentType := strings.TrimSpace(strings.Split(r.Header.Get("Content-Type"), ";")[0])
+	if contentType != mergePatchContentType && contentType != jsonPatchContentType {
+		WriteError(w, "Поддерживаются только "+mergePatchContentType+" и "+jsonPatchContentType,
+			http.StatusUnsupportedMediaType)
+		return
+	}
 
 	// we receive a post on id
-	postID := pathParts[3]
 	post, err := h.PostRepo.GetByID(r.Context(), postID)
 	if err != nil {
-		WriteError(w, err.Error(), http.StatusInternalServerError)
+		if strings.Contains(err.Error(), "не найден") {
+			WriteError(w, "Пост не найден", http.StatusNotFound)
+		} else {
+			WriteError(w, err.Error(), http.StatusInternalServerError)
+		}
 		return
 	}
 
-	// we check that only the author can add
-	authorID := r.Context().Value("userID").(string)
+	// we check that only the author can edit
+	authorID, _ := r.Context().Value("userID").(string)
 	if authorID != post.AuthorID {
 		WriteError(w, "Доступ запрещен", http.StatusForbidden)
 		return
 	}
 
-	// setting the size limit from the config
-	if err := r.ParseMultipartForm(h.Cfg.MaxUploadSize); err != nil {
-		if err.Error() == "http: request body too large" {
-			WriteError(w, fmt.Sprintf("Файл слишком большой (макс. %d MB)",
-				h.Cfg.MaxUploadSize/(1024*1024)), http.StatusBadRequest)
-		} else {
-			WriteError(w, "Ошибка при обработке файла", http.StatusBadRequest)
-		}
+	if post.Version != version {
+		WriteError(w, "Пост был изменен, получите актуальную версию", http.StatusPreconditionFailed)
 		return
 	}
 
-	// getting the file
-	file, handler, err := r.FormFile("image")
-	if err != nil {
-		WriteError(w, "Не удалось получить файл", http.StatusBadRequest)
+	// the patch is applied to the editable fields of the post only
+	var doc interface{} = map[string]interface{}{
+		"title":   post.Title,
+		"content": post.Content,
+	}
+
+	if contentType == mergePatchContentType {
+		var patch interface{}
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			WriteError(w, "Неверный формат запроса", http.StatusBadRequest)
+			return
+		}
+		doc = applyMergePatch(doc, patch)
+	} else {
+		var operations []patchOperation
+		if err := json.NewDecoder(r.Body).Decode(&operations); err != nil {
+			WriteError(w, "Неверный формат запроса", http.StatusBadRequest)
+			return
+		}
+		doc, err = applyJSONPatch(doc, operations)
+		if err != nil {
+			WriteError(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	patched, ok := doc.(map[string]interface{})
+	if !ok {
+		WriteError(w, "Результат патча должен быть объектом", http.StatusUnprocessableEntity)
 		return
 	}
-	defer file.Close()
 
-	// formats image
-	allowedTypes := map[string]bool{
-		"image/jpeg": true,
-		"image/jpg":  true,
-		"image/png":  true,
-		"image/gif":  true,
-		"image/webp": true,
+	for field := range patched {
+		if field != "title" && field != "content" {
+			WriteError(w, fmt.Sprintf("Поле %s нельзя изменить", field), http.StatusUnprocessableEntity)
+			return
+		}
 	}
 
-	// check formats
-	contentType := handler.Header.Get("Content-Type")
-	if !allowedTypes[contentType] {
-		WriteError(w, "Неподдерживаемый тип файла. Разрешены: JPEG, PNG, GIF, WebP", http.StatusBadRequest)
+	title, _ := patched["title"].(string)
+	content, _ := patched["content"].(string)
+
+	// the patched post is checked by the same rules as a new one
+	if err := validatePost(title, content); err != nil {
+		WriteError(w, err.Error(), http.StatusUnprocessableEntity)
 		return
 	}
 
-	// added image
-	image, err := h.PostService.AddedImage(r.Context(), postID, handler.Filename, file, handler.Size)
+	serviceReq := repository.UpdatePostRequest{
+		PostID:  postID,
+		Title:   title,
+		Content: content,
+		Version: version,
+	}
+
+	// updating the post
+	post, err = h.PostService.UpdatePost(r.Context(), serviceReq)
 	if err != nil {
-		if strings.Contains(err.Error(), "доступ запрещен") {
-			WriteError(w, "Доступ запрещен", http.StatusForbidden)
-		} else if strings.Contains(err.Error(), "пост не найден") {
+		if strings.Contains(err.Error(), "версия поста устарела") {
+			WriteError(w, "Пост был изменен, получите актуальную версию", http.StatusPreconditionFailed)
+		} else if strings.Contains(err.Error(), "не найден") {
 			WriteError(w, "Пост не найден", http.StatusNotFound)
-		} else if strings.Contains(err.Error(), "размер файла превышает") {
-			WriteError(w, err.Error(), http.StatusBadRequest)
 		} else {
-			WriteError(w, "Ошибка загрузки изображения", http.StatusInternalServerError)
+			WriteError(w, err.Error(), http.StatusInternalServerError)
 		}
 		return
 	}
 
 	// forming the response
-	response := ImageResponse{
-		ImageID:   image.ImageID,
-		PostID:    image.PostID,
-		ImageUrl:  image.ImageURL,
-		FileName:  handler.Filename,
-		FileSize:  handler.Size,
-		MimeType:  contentType,
-		CreatedAt: image.CreatedAt.Format(time.RFC3339),
+	response := PostResponse{
+		PostId:         post.PostID,
+		IdempotencyKey: post.IdempotencyKey,
+		Title:          post.Title,
+		Content:        post.Content,
+		Status:         post.Status,
+		Version:        post.Version,
+		CreatedAt:      post.CreatedAt,
+		UpdatedAt:      post.UpdatedAt,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
+	w.Header().Set("ETag", formatETag(post.Version))
+	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
 
+// AddedImage adds the files of a multipart request to the post. The parts are read one by one without
+// buffering the request, and the images are all-or-nothing: when a file fails, the ones stored before it are removed
+func (h *Handlers) AddedImage(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet { // if get, then we return the images of the post
+		h.GetPostImages(w, r)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		WriteError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// checking the user's role
+	userRole, ok := r.Context().Value("role").(string)
+	if !ok || userRole != "Author" {
+		WriteError(w, "Доступ запрещен", http.StatusForbidden)
+		return
+	}
+
+	// check url
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) < 5 || pathParts[4] != "images" {
+		WriteError(w, "Неверный URL", http.StatusBadRequest)
+		return
+	}
+
+	// we receive a post on id
+	postID := pathParts[3]
+	post, err := h.PostRepo.GetByID(r.Context(), postID)
+	if err != nil {
+		WriteError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// we check that only the author can add
+	authorID := r.Context().Value("userID").(string)
+	if authorID != post.AuthorID {
+		WriteError(w, "Доступ запрещен", http.StatusForbidden)
+		return
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		WriteError(w, "Ошибка при обработке файла", http.StatusBadRequest)
+		return
+	}
+
+	results, created, failure := h.addImageParts(r, reader, postID)
+
+	if failure == nil && len(created) == 0 {
+		failure = &uploadFailure{status: http.StatusBadRequest, message: "Не удалось получить файл"}
+	}
+
+	if failure != nil {
+		// all or nothing: the images stored before the failed file are removed,
+		// even when the failure is the client that has gone away
+		rollbackCtx := context.WithoutCancel(r.Context())
+		for i, image := range created {
+			if err := h.PostService.DeleteImage(rollbackCtx, postID, image.ImageID); err != nil {
+				fmt.Printf("Предупреждение: не удалось удалить изображение %s: %v\n", image.ImageID, err)
+			}
+			results[i].Status = "rolledBack"
+			results[i].Image = nil
+		}
+
+		WriteSuccess(w, AddImagesResponse{Error: failure.message, Images: results}, failure.status)
+		return
+	}
+
+	WriteSuccess(w, AddImagesResponse{Images: results}, http.StatusCreated)
+}
+
 func (h *Handlers) DeleteImage(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPatch { // if patch, then we update the image
+		h.UpdateImage(w, r)
+		return
+	}
+
+	if r.Method == http.MethodGet { // if get, then we return the image
+		h.GetImage(w, r)
+		return
+	}
+
 	if r.Method != http.MethodDelete {
 		WriteError(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	// checking the user's role
-	userRole, ok := r.Context().Value("userRole").(string)
+	userRole, ok := r.Context().Value("role").(string)
 	if !ok || userRole != "Author" {
 		WriteError(w, "Доступ запрещен", http.StatusForbidden)
 		return
@@ -398,7 +690,11 @@ func (h *Handlers) DeleteImage(w http.ResponseWriter, r *http.Request) {
 	// get post by id
 	post, err := h.PostRepo.GetByID(r.Context(), postID)
 	if err != nil {
-		WriteError(w, err.Error(), http.StatusInternalServerError)
+		if strings.Contains(err.Error(), "не найден") {
+			WriteError(w, "Пост или картинка не найдены", http.StatusNotFound)
+		} else {
+			WriteError(w, err.Error(), http.StatusInternalServerError)
+		}
 		return
 	}
 
@@ -410,7 +706,7 @@ func (h *Handlers) DeleteImage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// delete image
-	err = h.PostService.DeleteImage(r.Context(), imageID)
+	err = h.PostService.DeleteImage(r.Context(), postID, imageID)
 	if err != nil {
 		if strings.Contains(err.Error(), "доступ запрещен") {
 			WriteError(w, "Доступ запрещен", http.StatusForbidden)
@@ -427,6 +723,123 @@ func (h *Handlers) DeleteImage(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(MessageResponse{Message: "Картинка успешно удалена"})
 }
 
+func (h *Handlers) DeletePost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		WriteError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// checking the user's role
+	userRole, ok := r.Context().Value("role").(string)
+	if !ok || userRole != "Author" {
+		WriteError(w, "Доступ запрещен", http.StatusForbidden)
+		return
+	}
+
+	// check url
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) < 4 {
+		WriteError(w, "Неверный URL", http.StatusBadRequest)
+		return
+	}
+	postID := pathParts[3]
+
+	// we receive a post on id
+	post, err := h.PostRepo.GetByID(r.Context(), postID)
+	if err != nil {
+		if strings.Contains(err.Error(), "не найден") {
+			WriteError(w, "Пост не найден", http.StatusNotFound)
+		} else {
+			WriteError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// we check that only the author can delete
+	authorID, _ := r.Context().Value("userID").(string)
+	if authorID != post.AuthorID {
+		WriteError(w, "Доступ запрещен", http.StatusForbidden)
+		return
+	}
+
+	if err := h.PostService.DeletePost(r.Context(), postID); err != nil {
+		if strings.Contains(err.Error(), "не найден") {
+			WriteError(w, "Пост не найден", http.StatusNotFound)
+		} else {
+			WriteError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(MessageResponse{Message: "Пост перемещен в корзину"})
+}
+
+func (h *Handlers) GetTrash(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// checking the user's role
+	userRole, ok := r.Context().Value("role").(string)
+	if !ok || userRole != "Author" {
+		WriteError(w, "Доступ запрещен", http.StatusForbidden)
+		return
+	}
+
+	authorID, _ := r.Context().Value("userID").(string)
+
+	posts, err := h.PostService.GetTrash(r.Context(), authorID)
+	if err != nil {
+		WriteError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(TrashResponse{Posts: posts})
+}
+
+func (h *Handlers) RestorePost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		WriteError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// checking the user's role
+	userRole, ok := r.Context().Value("role").(string)
+	if !ok || userRole != "Author" {
+		WriteError(w, "Доступ запрещен", http.StatusForbidden)
+		return
+	}
+
+	// check url
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) < 5 || pathParts[4] != "restore" {
+		WriteError(w, "Неверный URL", http.StatusBadRequest)
+		return
+	}
+	postID := pathParts[3]
+
+	// only the author's own posts can be restored
+	authorID, _ := r.Context().Value("userID").(string)
+
+	if err := h.PostService.RestorePost(r.Context(), postID, authorID); err != nil {
+		if strings.Contains(err.Error(), "не найден") {
+			WriteError(w, "Пост не найден в корзине", http.StatusNotFound)
+		} else {
+			WriteError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(MessageResponse{Message: "Пост восстановлен"})
+}
+
 func (h *Handlers) PublishPost(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPatch {
 		WriteError(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -467,6 +880,8 @@ func (h *Handlers) PublishPost(w http.ResponseWriter, r *http.Request) {
 			WriteError(w, "Пост не найден", http.StatusNotFound)
 		} else if strings.Contains(err.Error(), "доступ запрещен") {
 			WriteError(w, "Доступ запрещен", http.StatusForbidden)
+		} else if strings.Contains(err.Error(), "альтернативного текста") {
+			WriteError(w, "У всех изображений поста должен быть альтернативный текст", http.StatusUnprocessableEntity)
 		} else {
 			WriteError(w, err.Error(), http.StatusInternalServerError)
 		}
@@ -476,3 +891,36 @@ func (h *Handlers) PublishPost(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(MessageResponse{Message: "Пост успешно опубликован"})
 }
+
+// validatePost checks the title and content of a post, the rules are shared by creation and editing
+func validatePost(title, content string) error {
+	if title == "" {
+		return errors.New("Отсутствует заголовок")
+	}
+
+	if content == "" {
+		return errors.New("Отсутствует содержание поста")
+	}
+
+	return nil
+}
+
+// formatETag represents the version of the post as a strong entity tag
+func formatETag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// parseETag extracts the version of the post from the If-Match header
+func parseETag(value string) (int, bool) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "W/")
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return 0, false
+	}
+
+	version, err := strconv.Atoi(value[1 : len(value)-1])
+	if err != nil || version < 1 {
+		return 0, false
+	}
+
+	return version, true
+}
@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+)
+
+// patchOperation is one operation of a JSON Patch document (RFC 6902)
+type patchOperation struct {
+	Op    string           `json:"op"`
+	Path  string           `json:"path"`
+	From  string           `json:"from"`
+	Value *json.RawMessage `json:"value"`
+}
+
+// applyMergePatch applies a JSON Merge Patch (RFC 7396) to the document
+func applyMergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = applyMergePatch(targetObject[key], value)
+	}
+
+	return targetObject
+}
+
+// applyJSONPatch applies the operations of a JSON Patch (RFC 6902) to the document one by one
+func applyJSONPatch(doc interface{}, operations []patchOperation) (interface{}, error) {
+	var err error
+
+	for _, operation := range operations {
+		var value interface{}
+		if operation.Value != nil {
+			if err := json.Unmarshal(*operation.Value, &value); err != nil {
+				return nil, fmt.Errorf("неверное значение операции %s: %w", operation.Op, err)
+			}
+		}
+
+		switch operation.Op {
+		case "add":
+			if operation.Value == nil {
+				return nil, errors.New("операция add требует value")
+			}
+			doc, err = patchAdd(doc, operation.Path, value)
+		case "remove":
+			doc, _, err = patchRemove(doc, operation.Path)
+		case "replace":
+			if operation.Value == nil {
+				return nil, errors.New("операция replace требует value")
+			}
+			if doc, _, err = patchRemove(doc, operation.Path); err == nil {
+				doc, err = patchAdd(doc, operation.Path, value)
+			}
+		case "move":
+			var moved interface{}
+			if doc, moved, err = patchRemove(doc, operation.From); err == nil {
+				doc, err = patchAdd(doc, operation.Path, moved)
+			}
+		case "copy":
+			var copied interface{}
+			if copied, err = patchGet(doc, operation.From); err == nil {
+				doc, err = patchAdd(doc, operation.Path, copied)
+			}
+		case "test":
+			var current interface{}
+			if current, err = patchGet(doc, operation.Path); err == nil && !reflect.DeepEqual(current, value) {
+				err = fmt.Errorf("проверка %s не пройдена", operation.Path)
+			}
+		default:
+			err = fmt.Errorf("неизвестная операция %q", operation.Op)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return doc, nil
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("неверный путь %q", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+
+	return tokens, nil
+}
+
+func patchGet(doc interface{}, pointer string) (interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, token := range tokens {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("путь %s не найден", pointer)
+			}
+			doc = value
+		case []interface{}:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, fmt.Errorf("путь %s не найден", pointer)
+			}
+			doc = node[index]
+		default:
+			return nil, fmt.Errorf("путь %s не найден", pointer)
+		}
+	}
+
+	return doc, nil
+}
+
+func patchAdd(doc interface{}, pointer string, value interface{}) (interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	return patchUpdate(doc, tokens, pointer, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			node[token] = value
+			return node, nil
+		case []interface{}:
+			if token == "-" {
+				return append(node, value), nil
+			}
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index > len(node) {
+				return nil, fmt.Errorf("неверный индекс в пути %s", pointer)
+			}
+			node = append(node, nil)
+			copy(node[index+1:], node[index:])
+			node[index] = value
+			return node, nil
+		default:
+			return nil, fmt.Errorf("путь %s не найден", pointer)
+		}
+	})
+}
+
+func patchRemove(doc interface{}, pointer string) (interface{}, interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil, errors.New("нельзя удалить весь документ")
+	}
+
+	var removed interface{}
+	doc, err = patchUpdate(doc, tokens, pointer, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("путь %s не найден", pointer)
+			}
+			removed = value
+			delete(node, token)
+			return node, nil
+		case []interface{}:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, fmt.Errorf("путь %s не найден", pointer)
+			}
+			removed = node[index]
+			return append(node[:index], node[index+1:]...), nil
+		default:
+			return nil, fmt.Errorf("путь %s не найден", pointer)
+		}
+	})
+
+	return doc, removed, err
+}
+
+// patchUpdate walks to the parent of the last token and replaces it with the result of change,
+// arrays are replaced on every level because append may reallocate them
+func patchUpdate(doc interface{}, tokens []string, pointer string, change func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 1 {
+		return change(doc, tokens[0])
+	}
+
+	child, err := patchGet(doc, "/"+escapeToken(tokens[0]))
+	if err != nil {
+		return nil, fmt.Errorf("путь %s не найден", pointer)
+	}
+
+	child, err = patchUpdate(child, tokens[1:], pointer, change)
+	if err != nil {
+		return nil, err
+	}
+
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		node[tokens[0]] = child
+	case []interface{}:
+		index, _ := strconv.Atoi(tokens[0])
+		node[index] = child
+	}
+
+	return doc, nil
+}
+
+func escapeToken(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"encoding/json"
+	"microblogCPT/internal/models"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type RevisionsResponse struct {
+	Revisions []models.PostRevision `json:"revisions"`
+}
+
+type RevisionDiffResponse struct {
+	From int    `json:"from"`
+	To   int    `json:"to"`
+	Diff string `json:"diff"`
+}
+
+func (h *Handlers) GetPostRevisions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// check url
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) < 5 || pathParts[4] != "revisions" {
+		WriteError(w, "Неверный URL", http.StatusBadRequest)
+		return
+	}
+	postID := pathParts[3]
+
+	if !h.checkRevisionAccess(w, r, postID) {
+		return
+	}
+
+	revisions, err := h.PostService.GetRevisions(r.Context(), postID)
+	if err != nil {
+		WriteError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(RevisionsResponse{Revisions: revisions})
+}
+
+func (h *Handlers) GetPostRevision(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// check url
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) < 6 || pathParts[4] != "revisions" {
+		WriteError(w, "Неверный URL", http.StatusBadRequest)
+		return
+	}
+	postID := pathParts[3]
+
+	revision, err := strconv.Atoi(pathParts[5])
+	if err != nil || revision < 1 {
+		WriteError(w, "Неверный номер ревизии", http.StatusBadRequest)
+		return
+	}
+
+	if !h.checkRevisionAccess(w, r, postID) {
+		return
+	}
+
+	postRevision, err := h.PostService.GetRevision(r.Context(), postID, revision)
+	if err != nil {
+		if strings.Contains(err.Error(), "не найдена") {
+			WriteError(w, "Ревизия не найдена", http.StatusNotFound)
+		} else {
+			WriteError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(postRevision)
+}
+
+func (h *Handlers) DiffPostRevisions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// check url
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) < 6 || pathParts[4] != "revisions" || pathParts[5] != "diff" {
+		WriteError(w, "Неверный URL", http.StatusBadRequest)
+		return
+	}
+	postID := pathParts[3]
+
+	// revisions are compared from ?from= to ?to=
+	from, errFrom := strconv.Atoi(r.URL.Query().Get("from"))
+	to, errTo := strconv.Atoi(r.URL.Query().Get("to"))
+	if errFrom != nil || errTo != nil || from < 1 || to < 1 {
+		WriteError(w, "Параметры from и to должны быть номерами ревизий", http.StatusBadRequest)
+		return
+	}
+
+	if !h.checkRevisionAccess(w, r, postID) {
+		return
+	}
+
+	diff, err := h.PostService.DiffRevisions(r.Context(), postID, from, to)
+	if err != nil {
+		if strings.Contains(err.Error(), "не найдена") {
+			WriteError(w, "Ревизия не найдена", http.StatusNotFound)
+		} else {
+			WriteError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(RevisionDiffResponse{From: from, To: to, Diff: diff})
+}
+
+func (h *Handlers) RestorePostRevision(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		WriteError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// check url
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) < 7 || pathParts[4] != "revisions" || pathParts[6] != "restore" {
+		WriteError(w, "Неверный URL", http.StatusBadRequest)
+		return
+	}
+	postID := pathParts[3]
+
+	revision, err := strconv.Atoi(pathParts[5])
+	if err != nil || revision < 1 {
+		WriteError(w, "Неверный номер ревизии", http.StatusBadRequest)
+		return
+	}
+
+	if !h.checkRevisionAccess(w, r, postID) {
+		return
+	}
+
+	post, err := h.PostService.RestoreRevision(r.Context(), postID, revision)
+	if err != nil {
+		if strings.Contains(err.Error(), "не найдена") {
+			WriteError(w, "Ревизия не найдена", http.StatusNotFound)
+		} else if strings.Contains(err.Error(), "не найден") {
+			WriteError(w, "Пост не найден", http.StatusNotFound)
+		} else {
+			WriteError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// forming the response
+	response := PostResponse{
+		PostId:         post.PostID,
+		IdempotencyKey: post.IdempotencyKey,
+		Title:          post.Title,
+		Content:        post.Content,
+		Status:         post.Status,
+		Version:        post.Version,
+		CreatedAt:      post.CreatedAt,
+		UpdatedAt:      post.UpdatedAt,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", formatETag(post.Version))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// checkRevisionAccess allows only the author of the post to work with its history
+func (h *Handlers) checkRevisionAccess(w http.ResponseWriter, r *http.Request, postID string) bool {
+	// checking the user's role
+	userRole, ok := r.Context().Value("role").(string)
+	if !ok || userRole != "Author" {
+		WriteError(w, "Доступ запрещен", http.StatusForbidden)
+		return false
+	}
+
+	// we receive a post on id
+	post, err := h.PostRepo.GetByID(r.Context(), postID)
+	if err != nil {
+		if strings.Contains(err.Error(), "не найден") {
+			WriteError(w, "Пост не найден", http.StatusNotFound)
+		} else {
+			WriteError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return false
+	}
+
+	authorID, _ := r.Context().Value("userID").(string)
+	if authorID != post.AuthorID {
+		WriteError(w, "Доступ запрещен", http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"microblogCPT/internal/models"
+	"net/http"
+)
+
+// PrincipalFromContext returns the principal put into the context by the auth middleware,
+// a request without one is anonymous
+func PrincipalFromContext(ctx context.Context) models.Principal {
+	principal, _ := ctx.Value("principal").(models.Principal)
+	return principal
+}
+
+// canReadPost reports whether the principal may see the post: everyone sees the published posts,
+// only the author sees the other ones
+func canReadPost(principal models.Principal, post *models.Post) bool {
+	if post.Status == "Published" {
+		return true
+	}
+	return !principal.IsAnonymous() && post.AuthorID == principal.UserID
+}
+
+// writePostAccessError answers a request for a post that the principal may not see,
+// the anonymous visitors are asked to sign in
+func writePostAccessError(w http.ResponseWriter, principal models.Principal) {
+	if principal.IsAnonymous() {
+		WriteError(w, "Требуется авторизация", http.StatusUnauthorized)
+		return
+	}
+	WriteError(w, "Доступ запрещен", http.StatusForbidden)
+}
+
+// setReadCacheHeaders lets the shared caches keep the responses to the anonymous visitors for
+// AnonymousCacheMaxAge, the responses to the signed-in users may contain their drafts and stay private
+func (h *Handlers) setReadCacheHeaders(w http.ResponseWriter, principal models.Principal) {
+	w.Header().Add("Vary", "Authorization")
+	if principal.IsAnonymous() && h.Cfg != nil && h.Cfg.AnonymousCacheMaxAge > 0 {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(h.Cfg.AnonymousCacheMaxAge.Seconds())))
+		return
+	}
+	w.Header().Set("Cache-Control", "private, no-cache")
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"microblogCPT/internal/models"
+	"microblogCPT/internal/repository"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 300
+	maxLinks             = 5
+	maxLinkLength        = 200
+)
+
+// handlePattern allows lowercase latin letters, digits and underscores
+var handlePattern = regexp.MustCompile(`^[a-z0-9_]{3,30}$`)
+
+// GetPublicProfile returns the profile of GET /api/users/@{handle} without the email. A previous handle
+// redirects to the current one while its grace period lasts
+func (h *Handlers) GetPublicProfile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	handle, ok := handleFromPath(r.URL.Path)
+	if !ok || len(strings.Split(r.URL.Path, "/")) != 4 {
+		WriteError(w, "Неверный URL", http.StatusBadRequest)
+		return
+	}
+
+	profile, current, err := h.UserService.GetPublicProfile(r.Context(), handle)
+	if err != nil {
+		if strings.Contains(err.Error(), "не найден") {
+			WriteError(w, "Пользователь не найден", http.StatusNotFound)
+		} else {
+			WriteError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if current != "" {
+		http.Redirect(w, r, "/api/users/@"+current, http.StatusFound)
+		return
+	}
+
+	h.setReadCacheHeaders(w, PrincipalFromContext(r.Context()))
+	WriteSuccess(w, profile, http.StatusOK)
+}
+
+// handleFromPath reads the handle from /api/users/@{handle}/..., handles are stored in lowercase
+func handleFromPath(path string) (string, bool) {
+	pathParts := strings.Split(path, "/")
+	if len(pathParts) < 4 {
+		return "", false
+	}
+
+	handle, ok := strings.CutPrefix(pathParts[3], "@")
+	if !ok || handle == "" {
+		return "", false
+	}
+
+	return strings.ToLower(handle), true
+}
+
+// UpdateProfile changes the handle, the display name, the bio or the links of the current user
+func (h *Handlers) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		WriteError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, "Требуется аутентификация", http.StatusUnauthorized)
+		return
+	}
+
+	var req repository.UpdateProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, "Неверный формат запроса", http.StatusBadRequest)
+		return
+	}
+	req.UserID = userID
+
+	if req.Handle == nil && req.DisplayName == nil && req.Bio == nil && req.Links == nil {
+		WriteError(w, "Нет полей для обновления", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateProfile(&req); err != nil {
+		WriteError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.UserService.UpdateProfile(r.Context(), req)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "уже занят"):
+			WriteError(w, err.Error(), http.StatusConflict)
+		case strings.Contains(err.Error(), "не чаще"):
+			WriteError(w, err.Error(), http.StatusTooManyRequests)
+		case strings.Contains(err.Error(), "не найден"):
+			WriteError(w, "Пользователь не найден", http.StatusNotFound)
+		default:
+			WriteError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	images, err := h.UserService.GetProfileImages(r.Context(), userID)
+	if err != nil {
+		WriteError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	WriteSuccess(w, newUserResponse(user, images, true), http.StatusOK)
+}
+
+// validateProfile normalizes the fields of the request and checks them. A handle may be sent with the @
+func validateProfile(req *repository.UpdateProfileRequest) error {
+	if req.Handle != nil {
+		handle := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(*req.Handle), "@"))
+		if !handlePattern.MatchString(handle) {
+			return fmt.Errorf("Handle должен содержать от 3 до 30 латинских букв, цифр или _")
+		}
+		req.Handle = &handle
+	}
+
+	if req.DisplayName != nil {
+		displayName := strings.TrimSpace(*req.DisplayName)
+		if utf8.RuneCountInString(displayName) > maxDisplayNameLength {
+			return fmt.Errorf("Имя длиннее %d символов", maxDisplayNameLength)
+		}
+		req.DisplayName = &displayName
+	}
+
+	if req.Bio != nil && utf8.RuneCountInString(*req.Bio) > maxBioLength {
+		return fmt.Errorf("Описание длиннее %d символов", maxBioLength)
+	}
+
+	if req.Links != nil {
+		if len(*req.Links) > maxLinks {
+			return fmt.Errorf("Не больше %d ссылок", maxLinks)
+		}
+		for _, link := range *req.Links {
+			parsed, err := url.Parse(link)
+			if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" ||
+				len(link) > maxLinkLength {
+				return fmt.Errorf("Неверная ссылка: %s", link)
+			}
+		}
+	}
+
+	return nil
+}
+
+// newUserResponse describes the user, the email is shown only to the user itself
+func newUserResponse(user *models.User, images *models.ProfileImages, withEmail bool) UserResponse {
+	links := []string(user.Links)
+	if links == nil {
+		links = []string{}
+	}
+
+	response := UserResponse{
+		UserId:        user.UserID,
+		Role:          user.Role,
+		Handle:        user.Handle,
+		DisplayName:   user.DisplayName,
+		Bio:           user.Bio,
+		Links:         links,
+		ProfileImages: *images,
+	}
+	if withEmail {
+		response.Email = user.Email
+	}
+
+	return response
+}
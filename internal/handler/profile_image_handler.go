@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"microblogCPT/internal/service"
+	"net/http"
+	"strings"
+)
+
+// UserAvatar handles PUT and DELETE /api/me/avatar
+func (h *Handlers) UserAvatar(w http.ResponseWriter, r *http.Request) {
+	h.profileImage(w, r, service.ProfileImageAvatar)
+}
+
+// UserBanner handles PUT and DELETE /api/me/banner
+func (h *Handlers) UserBanner(w http.ResponseWriter, r *http.Request) {
+	h.profileImage(w, r, service.ProfileImageBanner)
+}
+
+// profileImage replaces the image of the kind with the "image" file of the multipart body or removes it.
+// Both respond with the profile images of the user
+func (h *Handlers) profileImage(w http.ResponseWriter, r *http.Request, kind string) {
+	if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		WriteError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, "Требуется аутентификация", http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		if err := h.UserService.DeleteProfileImage(r.Context(), userID, kind); err != nil {
+			WriteError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		images, err := h.UserService.GetProfileImages(r.Context(), userID)
+		if err != nil {
+			WriteError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		WriteSuccess(w, images, http.StatusOK)
+		return
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		WriteError(w, "Ошибка при обработке файла", http.StatusBadRequest)
+		return
+	}
+
+	// the fields before the file are skipped
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			WriteError(w, "Не удалось получить файл", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			WriteError(w, "Ошибка при обработке файла", http.StatusBadRequest)
+			return
+		}
+
+		if part.FormName() != "image" {
+			part.Close()
+			continue
+		}
+
+		file := newSizeLimitedReader(part, h.Cfg.MaxUploadSize)
+		images, err := h.UserService.SetProfileImage(r.Context(), userID, kind, part.FileName(), file)
+		part.Close()
+		if err != nil {
+			// WebP can not be cropped, so it is left out of the allowed types
+			if strings.Contains(err.Error(), "WebP") || strings.Contains(err.Error(), "неподдерживаемый тип файла") {
+				WriteError(w, "Неподдерживаемый тип файла. Разрешены: JPEG, PNG, GIF", http.StatusBadRequest)
+				return
+			}
+
+			failure := imageUploadFailure(err, file.exceeded, h.Cfg.MaxUploadSize)
+			WriteError(w, failure.message, failure.status)
+			return
+		}
+
+		WriteSuccess(w, images, http.StatusOK)
+		return
+	}
+}
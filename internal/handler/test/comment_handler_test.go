@@ -0,0 +1,270 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"microblogCPT/internal/config"
+	handlers "microblogCPT/internal/handler"
+	"microblogCPT/internal/models"
+	"microblogCPT/internal/repository"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCommentsHandler_List(t *testing.T) {
+	parentID := "c1"
+	comments := []models.Comment{
+		{
+			CommentID: "c1",
+			PostID:    "post123",
+			Content:   "Первый",
+			Replies:   []models.Comment{{CommentID: "c2", PostID: "post123", ParentID: &parentID, Content: "Ответ"}},
+		},
+	}
+
+	tests := []struct {
+		name           string
+		url            string
+		userID         string
+		mockSetup      func(*MockCommentService)
+		expectedStatus int
+		checkResponse  func(*testing.T, handlers.CommentsResponse)
+	}{
+		{
+			name: "Дерево для анонима",
+			url:  "/api/posts/post123/comments?view=tree&limit=1",
+			mockSetup: func(service *MockCommentService) {
+				service.On("GetComments", mock.Anything, "post123", "", "tree", "", 1).Return(comments, "next-cursor", nil)
+			},
+			expectedStatus: http.StatusOK,
+			checkResponse: func(t *testing.T, response handlers.CommentsResponse) {
+				assert.Len(t, response.Comments, 1)
+				assert.Equal(t, "c2", response.Comments[0].Replies[0].CommentID)
+				assert.Equal(t, "next-cursor", response.NextCursor)
+			},
+		},
+		{
+			name:   "Плоский список по умолчанию",
+			url:    "/api/posts/post123/comments?cursor=abc",
+			userID: "456",
+			mockSetup: func(service *MockCommentService) {
+				service.On("GetComments", mock.Anything, "post123", "456", "flat", "abc", 20).Return([]models.Comment{}, "", nil)
+			},
+			expectedStatus: http.StatusOK,
+			checkResponse: func(t *testing.T, response handlers.CommentsResponse) {
+				assert.Empty(t, response.Comments)
+				assert.Empty(t, response.NextCursor)
+			},
+		},
+		{
+			name:           "Неверный view",
+			url:            "/api/posts/post123/comments?view=list",
+			mockSetup:      func(service *MockCommentService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "Черновик для анонима",
+			url:  "/api/posts/post123/comments",
+			mockSetup: func(service *MockCommentService) {
+				service.On("GetComments", mock.Anything, "post123", "", "flat", "", 20).Return(nil, "", errors.New("доступ запрещен"))
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "Пост не найден",
+			url:  "/api/posts/post404/comments",
+			mockSetup: func(service *MockCommentService) {
+				service.On("GetComments", mock.Anything, "post404", "", "flat", "", 20).Return(nil, "", errors.New("пост с ID post404 не найден"))
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCommentService := new(MockCommentService)
+			tt.mockSetup(mockCommentService)
+
+			handler := &handlers.Handlers{CommentService: mockCommentService, Cfg: &config.Config{}}
+
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			if tt.userID != "" {
+				req = withUser(req, tt.userID, "Reader")
+			}
+
+			rr := httptest.NewRecorder()
+			handler.Comments(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.checkResponse != nil {
+				var response handlers.CommentsResponse
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+				tt.checkResponse(t, response)
+			}
+			mockCommentService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCommentsHandler_Create(t *testing.T) {
+	parentID := "c1"
+
+	tests := []struct {
+		name           string
+		body           string
+		authenticated  bool
+		mockSetup      func(*MockCommentService)
+		expectedStatus int
+	}{
+		{
+			name:          "Ответ на комментарий",
+			body:          `{"content": "Согласен", "parentID": "c1"}`,
+			authenticated: true,
+			mockSetup: func(service *MockCommentService) {
+				service.On("CreateComment", mock.Anything, repository.CreateCommentRequest{
+					PostID: "post123", ParentID: &parentID, AuthorID: "456", Content: "Согласен",
+				}).Return(&models.Comment{CommentID: "c2", PostID: "post123", ParentID: &parentID}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "Пустой комментарий",
+			body:           `{"content": "   "}`,
+			authenticated:  true,
+			mockSetup:      func(service *MockCommentService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Слишком длинный комментарий",
+			body:           `{"content": "` + strings.Repeat("а", 2001) + `"}`,
+			authenticated:  true,
+			mockSetup:      func(service *MockCommentService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:          "Черновик",
+			body:          `{"content": "Текст"}`,
+			authenticated: true,
+			mockSetup: func(service *MockCommentService) {
+				service.On("CreateComment", mock.Anything, mock.Anything).
+					Return(nil, errors.New("комментировать можно только опубликованные посты"))
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:          "Родитель из другого поста",
+			body:          `{"content": "Текст", "parentID": "c9"}`,
+			authenticated: true,
+			mockSetup: func(service *MockCommentService) {
+				service.On("CreateComment", mock.Anything, mock.Anything).
+					Return(nil, errors.New("неверный parentID: комментарий не найден в этом посте"))
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Без аутентификации",
+			body:           `{"content": "Текст"}`,
+			mockSetup:      func(service *MockCommentService) {},
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCommentService := new(MockCommentService)
+			tt.mockSetup(mockCommentService)
+
+			handler := &handlers.Handlers{CommentService: mockCommentService, Cfg: &config.Config{}}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/posts/post123/comments", strings.NewReader(tt.body))
+			if tt.authenticated {
+				req = withUser(req, "456", "Reader")
+			}
+
+			rr := httptest.NewRecorder()
+			handler.Comments(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			mockCommentService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCommentHandler_UpdateAndDelete(t *testing.T) {
+	hidden := true
+
+	tests := []struct {
+		name           string
+		method         string
+		body           string
+		mockSetup      func(*MockCommentService)
+		expectedStatus int
+	}{
+		{
+			name:   "Автор поста скрывает комментарий",
+			method: http.MethodPatch,
+			body:   `{"hidden": true}`,
+			mockSetup: func(service *MockCommentService) {
+				service.On("UpdateComment", mock.Anything, repository.UpdateCommentRequest{
+					PostID: "post123", CommentID: "c1", UserID: "123", Hidden: &hidden,
+				}).Return(&models.Comment{CommentID: "c1", Hidden: true}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "Чужой комментарий",
+			method: http.MethodPatch,
+			body:   `{"content": "Новый текст"}`,
+			mockSetup: func(service *MockCommentService) {
+				service.On("UpdateComment", mock.Anything, mock.Anything).Return(nil, errors.New("доступ запрещен"))
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Нет полей",
+			method:         http.MethodPatch,
+			body:           `{}`,
+			mockSetup:      func(service *MockCommentService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "Удаление",
+			method: http.MethodDelete,
+			mockSetup: func(service *MockCommentService) {
+				service.On("DeleteComment", mock.Anything, "post123", "c1", "123").Return(nil)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:   "Комментарий не найден",
+			method: http.MethodDelete,
+			mockSetup: func(service *MockCommentService) {
+				service.On("DeleteComment", mock.Anything, "post123", "c1", "123").
+					Return(errors.New("комментарий с ID c1 не найден"))
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCommentService := new(MockCommentService)
+			tt.mockSetup(mockCommentService)
+
+			handler := &handlers.Handlers{CommentService: mockCommentService, Cfg: &config.Config{}}
+
+			req := httptest.NewRequest(tt.method, "/api/posts/post123/comments/c1", strings.NewReader(tt.body))
+			req = withUser(req, "123", "Author")
+
+			rr := httptest.NewRecorder()
+			handler.Comment(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			mockCommentService.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"microblogCPT/internal/config"
+	handlers "microblogCPT/internal/handler"
+	"microblogCPT/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetHomeFeedHandler(t *testing.T) {
+	posts := []models.Post{
+		{PostID: "post2", AuthorID: "456", Title: "Second", Status: "Published"},
+		{PostID: "post1", AuthorID: "456", Title: "First", Status: "Published"},
+	}
+
+	tests := []struct {
+		name           string
+		url            string
+		authenticated  bool
+		mockSetup      func(*MockTimelineService, *MockPostService, *MockUserService)
+		expectedStatus int
+		checkResponse  func(*testing.T, map[string]interface{})
+	}{
+		{
+			name:          "Лента подписок",
+			url:           "/api/feed/home?limit=2",
+			authenticated: true,
+			mockSetup: func(timeline *MockTimelineService, postService *MockPostService, users *MockUserService) {
+				timeline.On("HomeTimeline", mock.Anything, "123", "", 2).Return(posts, "next-cursor", nil)
+				postService.On("AttachImages", mock.Anything, mock.Anything).Return(nil)
+				users.On("AttachAuthors", mock.Anything, mock.Anything).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+			checkResponse: func(t *testing.T, response map[string]interface{}) {
+				assert.Len(t, response["posts"], 2)
+				assert.Equal(t, "next-cursor", response["nextCursor"])
+			},
+		},
+		{
+			name:          "Последняя страница без изображений",
+			url:           "/api/feed/home?cursor=abc&fields=postID",
+			authenticated: true,
+			mockSetup: func(timeline *MockTimelineService, postService *MockPostService, users *MockUserService) {
+				timeline.On("HomeTimeline", mock.Anything, "123", "abc", 20).Return(posts[1:], "", nil)
+			},
+			expectedStatus: http.StatusOK,
+			checkResponse: func(t *testing.T, response map[string]interface{}) {
+				assert.Equal(t, []interface{}{map[string]interface{}{"postID": "post1"}}, response["posts"])
+				assert.NotContains(t, response, "nextCursor")
+			},
+		},
+		{
+			name:          "Неверный курсор",
+			url:           "/api/feed/home?cursor=bad",
+			authenticated: true,
+			mockSetup: func(timeline *MockTimelineService, postService *MockPostService, users *MockUserService) {
+				timeline.On("HomeTimeline", mock.Anything, "123", "bad", 20).Return(nil, "", errors.New("неверный курсор"))
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Без аутентификации",
+			url:            "/api/feed/home",
+			mockSetup:      func(timeline *MockTimelineService, postService *MockPostService, users *MockUserService) {},
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockTimelineService := new(MockTimelineService)
+			mockPostService := new(MockPostService)
+			mockUserService := new(MockUserService)
+			tt.mockSetup(mockTimelineService, mockPostService, mockUserService)
+
+			handler := &handlers.Handlers{
+				TimelineService: mockTimelineService,
+				PostService:     mockPostService,
+				UserService:     mockUserService,
+				Cfg:             &config.Config{},
+			}
+
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			if tt.authenticated {
+				req = withUser(req, "123", "Reader")
+			}
+
+			rr := httptest.NewRecorder()
+			handler.GetHomeFeed(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.checkResponse != nil {
+				var response map[string]interface{}
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+				tt.checkResponse(t, response)
+			}
+			mockTimelineService.AssertExpectations(t)
+			mockPostService.AssertExpectations(t)
+			mockUserService.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"microblogCPT/internal/config"
+	handlers "microblogCPT/internal/handler"
+	"microblogCPT/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFollowHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		mockSetup      func(*MockFollowService)
+		expectedStatus int
+		expectedBody   *models.FollowStatus
+	}{
+		{
+			name:   "Подписка",
+			method: http.MethodPut,
+			url:    "/api/users/@Alice/follow",
+			mockSetup: func(service *MockFollowService) {
+				service.On("Follow", mock.Anything, "123", "alice").
+					Return(&models.FollowStatus{Following: true, FollowerCount: 4}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   &models.FollowStatus{Following: true, FollowerCount: 4},
+		},
+		{
+			name:   "Отписка",
+			method: http.MethodDelete,
+			url:    "/api/users/@alice/follow",
+			mockSetup: func(service *MockFollowService) {
+				service.On("Unfollow", mock.Anything, "123", "alice").
+					Return(&models.FollowStatus{Following: false, FollowerCount: 3}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   &models.FollowStatus{Following: false, FollowerCount: 3},
+		},
+		{
+			name:   "Подписка на себя",
+			method: http.MethodPut,
+			url:    "/api/users/@me/follow",
+			mockSetup: func(service *MockFollowService) {
+				service.On("Follow", mock.Anything, "123", "me").Return(nil, errors.New("нельзя подписаться на себя"))
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "Пользователь не найден",
+			method: http.MethodPut,
+			url:    "/api/users/@nobody/follow",
+			mockSetup: func(service *MockFollowService) {
+				service.On("Follow", mock.Anything, "123", "nobody").Return(nil, errors.New("пользователь @nobody не найден"))
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Неверный метод",
+			method:         http.MethodPost,
+			url:            "/api/users/@alice/follow",
+			mockSetup:      func(service *MockFollowService) {},
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockFollowService := new(MockFollowService)
+			tt.mockSetup(mockFollowService)
+
+			handler := &handlers.Handlers{
+				FollowService: mockFollowService,
+				Cfg:           &config.Config{},
+			}
+
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			req = withUser(req, "123", "Reader")
+
+			rr := httptest.NewRecorder()
+			handler.Follow(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedBody != nil {
+				var response models.FollowStatus
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+				assert.Equal(t, *tt.expectedBody, response)
+			}
+			mockFollowService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestFollowListHandlers(t *testing.T) {
+	users := []models.FollowUser{{UserID: "456", Handle: "bob", FollowedAt: time.Now()}}
+
+	t.Run("Подписчики со следующей страницей", func(t *testing.T) {
+		mockFollowService := new(MockFollowService)
+		mockFollowService.On("GetFollowers", mock.Anything, "alice", "", 1).Return(users, "next-cursor", nil)
+
+		handler := &handlers.Handlers{FollowService: mockFollowService, Cfg: &config.Config{}}
+
+		req := httptest.NewRequest(http.MethodGet, "/api/users/@alice/followers?limit=1", nil)
+		rr := httptest.NewRecorder()
+		handler.GetFollowers(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var response handlers.FollowListResponse
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		assert.Len(t, response.Users, 1)
+		assert.Equal(t, "next-cursor", response.NextCursor)
+		mockFollowService.AssertExpectations(t)
+	})
+
+	t.Run("Подписки по курсору", func(t *testing.T) {
+		mockFollowService := new(MockFollowService)
+		mockFollowService.On("GetFollowing", mock.Anything, "alice", "abc", 20).Return(users, "", nil)
+
+		handler := &handlers.Handlers{FollowService: mockFollowService, Cfg: &config.Config{}}
+
+		req := httptest.NewRequest(http.MethodGet, "/api/users/@alice/following?cursor=abc", nil)
+		rr := httptest.NewRecorder()
+		handler.GetFollowing(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NotContains(t, rr.Body.String(), "nextCursor")
+		mockFollowService.AssertExpectations(t)
+	})
+
+	t.Run("Неверный курсор", func(t *testing.T) {
+		mockFollowService := new(MockFollowService)
+		mockFollowService.On("GetFollowers", mock.Anything, "alice", "bad", 20).Return(nil, "", errors.New("неверный курсор"))
+
+		handler := &handlers.Handlers{FollowService: mockFollowService, Cfg: &config.Config{}}
+
+		req := httptest.NewRequest(http.MethodGet, "/api/users/@alice/followers?cursor=bad", nil)
+		rr := httptest.NewRecorder()
+		handler.GetFollowers(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
@@ -0,0 +1,140 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	handlers "microblogCPT/internal/handler"
+	"microblogCPT/internal/models"
+	"microblogCPT/internal/repository"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUpdateImageHandler(t *testing.T) {
+	altText := "Логотип компании"
+	position := 0
+
+	tests := []struct {
+		name           string
+		requestBody    string
+		mockSetup      func(*MockPostService)
+		expectedStatus int
+	}{
+		{
+			name:        "Обновление альтернативного текста и позиции",
+			requestBody: `{"altText": "Логотип компании", "position": 0}`,
+			mockSetup: func(service *MockPostService) {
+				service.On("UpdateImage", mock.Anything, repository.UpdateImageRequest{
+					PostID:   "post123",
+					ImageID:  "img123",
+					AltText:  &altText,
+					Position: &position,
+				}).Return(&models.Image{ImageID: "img123", PostID: "post123", AltText: altText}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Нет полей для обновления",
+			requestBody:    `{}`,
+			mockSetup:      func(service *MockPostService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Слишком длинный альтернативный текст",
+			requestBody:    `{"altText": "` + strings.Repeat("а", 1001) + `"}`,
+			mockSetup:      func(service *MockPostService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "Изображение не найдено",
+			requestBody: `{"caption": "Подпись"}`,
+			mockSetup: func(service *MockPostService) {
+				service.On("UpdateImage", mock.Anything, mock.Anything).Return(nil, errors.New("изображение не найдено"))
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockPostService := new(MockPostService)
+			mockPostRepo := new(MockPostRepository)
+			mockPostRepo.On("GetByID", mock.Anything, "post123").Return(&models.Post{PostID: "post123", AuthorID: "123"}, nil)
+			tt.mockSetup(mockPostService)
+
+			handler := &handlers.Handlers{PostService: mockPostService, PostRepo: mockPostRepo}
+
+			req := httptest.NewRequest(http.MethodPatch, "/api/posts/post123/images/img123", bytes.NewBufferString(tt.requestBody))
+			req = withUser(req, "123", "Author")
+			rr := httptest.NewRecorder()
+			handler.DeleteImage(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			mockPostService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestReorderImagesHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    string
+		mockSetup      func(*MockPostService)
+		expectedStatus int
+		expectedOrder  []string
+	}{
+		{
+			name:        "Новый порядок изображений",
+			requestBody: `{"imageIds": ["img2", "img1"]}`,
+			mockSetup: func(service *MockPostService) {
+				service.On("ReorderImages", mock.Anything, "post123", []string{"img2", "img1"}).Return([]*models.Image{
+					{ImageID: "img2", Position: 0},
+					{ImageID: "img1", Position: 1},
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedOrder:  []string{"img2", "img1"},
+		},
+		{
+			name:        "В списке не все изображения",
+			requestBody: `{"imageIds": ["img2"]}`,
+			mockSetup: func(service *MockPostService) {
+				service.On("ReorderImages", mock.Anything, "post123", []string{"img2"}).
+					Return(nil, errors.New("список должен содержать каждое изображение поста один раз"))
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockPostService := new(MockPostService)
+			mockPostRepo := new(MockPostRepository)
+			mockPostRepo.On("GetByID", mock.Anything, "post123").Return(&models.Post{PostID: "post123", AuthorID: "123"}, nil)
+			tt.mockSetup(mockPostService)
+
+			handler := &handlers.Handlers{PostService: mockPostService, PostRepo: mockPostRepo}
+
+			req := httptest.NewRequest(http.MethodPut, "/api/posts/post123/images/order", bytes.NewBufferString(tt.requestBody))
+			req = withUser(req, "123", "Author")
+			rr := httptest.NewRecorder()
+			handler.ReorderImages(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedOrder != nil {
+				var response handlers.ReorderImagesResponse
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+				for i, imageID := range tt.expectedOrder {
+					assert.Equal(t, imageID, response.Images[i].ImageID)
+					assert.Equal(t, i, response.Images[i].Position)
+				}
+			}
+			mockPostService.AssertExpectations(t)
+		})
+	}
+}
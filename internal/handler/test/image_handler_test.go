@@ -0,0 +1,286 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"io"
+	"microblogCPT/internal/config"
+	handlers "microblogCPT/internal/handler"
+	"microblogCPT/internal/models"
+	"microblogCPT/internal/repository"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// multipartImages builds a request body with the fields and files in the given order,
+// a field named image is written as a file
+func multipartImages(t *testing.T, parts [][2]string) (*bytes.Buffer, string) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	for _, part := range parts {
+		if part[0] == "image" {
+			file, err := writer.CreateFormFile("image", part[1])
+			assert.NoError(t, err)
+			file.Write([]byte("fake image content"))
+			continue
+		}
+		assert.NoError(t, writer.WriteField(part[0], part[1]))
+	}
+	writer.Close()
+
+	return body, writer.FormDataContentType()
+}
+
+func TestAddedImageHandlerMultipleFiles(t *testing.T) {
+	tests := []struct {
+		name             string
+		parts            [][2]string
+		maxUploadSize    int64
+		mockSetup        func(*MockPostService)
+		expectedStatus   int
+		expectedStatuses []string
+	}{
+		{
+			name: "Несколько файлов с текстами",
+			parts: [][2]string{
+				{"altText", "Логотип"},
+				{"image", "logo.png"},
+				{"caption", "Баннер"},
+				{"image", "banner.jpg"},
+			},
+			mockSetup: func(service *MockPostService) {
+				service.On("AddedImage", mock.Anything, "post123", "logo.png", mock.Anything, repository.ImageDetails{AltText: "Логотип"}).
+					Return(&models.Image{ImageID: "img1", PostID: "post123", AltText: "Логотип"}, nil)
+				service.On("AddedImage", mock.Anything, "post123", "banner.jpg", mock.Anything, repository.ImageDetails{Caption: "Баннер"}).
+					Return(&models.Image{ImageID: "img2", PostID: "post123", Caption: "Баннер", Position: 1}, nil)
+			},
+			expectedStatus:   http.StatusCreated,
+			expectedStatuses: []string{"created", "created"},
+		},
+		{
+			name: "Ошибка во втором файле отменяет первый",
+			parts: [][2]string{
+				{"image", "logo.png"},
+				{"image", "notes.txt"},
+				{"image", "banner.jpg"},
+			},
+			mockSetup: func(service *MockPostService) {
+				service.On("AddedImage", mock.Anything, "post123", "logo.png", mock.Anything, repository.ImageDetails{}).
+					Return(&models.Image{ImageID: "img1", PostID: "post123"}, nil)
+				service.On("AddedImage", mock.Anything, "post123", "notes.txt", mock.Anything, repository.ImageDetails{}).
+					Return(nil, errors.New("неподдерживаемый тип файла"))
+				service.On("DeleteImage", mock.Anything, "post123", "img1").Return(nil)
+			},
+			expectedStatus:   http.StatusBadRequest,
+			expectedStatuses: []string{"rolledBack", "failed"},
+		},
+		{
+			name:          "Файл больше допустимого размера",
+			parts:         [][2]string{{"image", "huge.jpg"}},
+			maxUploadSize: 4,
+			mockSetup: func(service *MockPostService) {
+				service.On("AddedImage", mock.Anything, "post123", "huge.jpg", mock.Anything, repository.ImageDetails{}).
+					Run(func(args mock.Arguments) { io.ReadAll(args.Get(3).(io.Reader)) }).
+					Return(nil, errors.New("ошибка чтения файла"))
+			},
+			expectedStatus:   http.StatusBadRequest,
+			expectedStatuses: []string{"failed"},
+		},
+		{
+			name: "Слишком много файлов",
+			parts: [][2]string{
+				{"image", "1.png"},
+				{"image", "2.png"},
+				{"image", "3.png"},
+			},
+			mockSetup: func(service *MockPostService) {
+				service.On("AddedImage", mock.Anything, "post123", "1.png", mock.Anything, repository.ImageDetails{}).
+					Return(&models.Image{ImageID: "img1", PostID: "post123"}, nil)
+				service.On("AddedImage", mock.Anything, "post123", "2.png", mock.Anything, repository.ImageDetails{}).
+					Return(&models.Image{ImageID: "img2", PostID: "post123"}, nil)
+				service.On("DeleteImage", mock.Anything, "post123", "img1").Return(nil)
+				service.On("DeleteImage", mock.Anything, "post123", "img2").Return(nil)
+			},
+			expectedStatus:   http.StatusBadRequest,
+			expectedStatuses: []string{"rolledBack", "rolledBack"},
+		},
+		{
+			name:             "Нет файлов",
+			parts:            [][2]string{{"altText", "Логотип"}},
+			mockSetup:        func(service *MockPostService) {},
+			expectedStatus:   http.StatusBadRequest,
+			expectedStatuses: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockPostService := new(MockPostService)
+			mockPostRepo := new(MockPostRepository)
+			mockPostRepo.On("GetByID", mock.Anything, "post123").Return(&models.Post{PostID: "post123", AuthorID: "123"}, nil)
+			tt.mockSetup(mockPostService)
+
+			maxUploadSize := tt.maxUploadSize
+			if maxUploadSize == 0 {
+				maxUploadSize = 10 * 1024 * 1024
+			}
+			handler := &handlers.Handlers{
+				PostService: mockPostService,
+				PostRepo:    mockPostRepo,
+				Cfg:         &config.Config{MaxUploadSize: maxUploadSize, ImageMaxFiles: 2},
+			}
+
+			body, contentType := multipartImages(t, tt.parts)
+			req := httptest.NewRequest(http.MethodPost, "/api/posts/post123/images", body)
+			req.Header.Set("Content-Type", contentType)
+			req = withUser(req, "123", "Author")
+
+			rr := httptest.NewRecorder()
+			handler.AddedImage(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+
+			var response handlers.AddImagesResponse
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+			statuses := []string{}
+			for _, result := range response.Images {
+				statuses = append(statuses, result.Status)
+				if result.Status != "created" {
+					assert.Nil(t, result.Image)
+				}
+			}
+			assert.Equal(t, tt.expectedStatuses, statuses)
+			if tt.expectedStatus != http.StatusCreated {
+				assert.NotEmpty(t, response.Error)
+			} else {
+				// the keys of the image stay as the existing clients read them
+				assert.Contains(t, rr.Body.String(), `"image_id":"img1"`)
+				assert.Contains(t, rr.Body.String(), `"post_id":"post123"`)
+			}
+
+			mockPostService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAddedImageHandler_RollbackAfterDisconnect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mockPostService := new(MockPostService)
+	mockPostService.On("AddedImage", mock.Anything, "post123", "logo.png", mock.Anything, repository.ImageDetails{}).
+		Return(&models.Image{ImageID: "img1", PostID: "post123"}, nil)
+	// the client drops the connection while the second file is read
+	mockPostService.On("AddedImage", mock.Anything, "post123", "banner.jpg", mock.Anything, repository.ImageDetails{}).
+		Run(func(args mock.Arguments) { cancel() }).
+		Return(nil, errors.New("неподдерживаемый тип файла"))
+	mockPostService.On("DeleteImage", mock.MatchedBy(func(ctx context.Context) bool { return ctx.Err() == nil }), "post123", "img1").
+		Return(nil)
+
+	mockPostRepo := new(MockPostRepository)
+	mockPostRepo.On("GetByID", mock.Anything, "post123").Return(&models.Post{PostID: "post123", AuthorID: "123"}, nil)
+
+	handler := &handlers.Handlers{
+		PostService: mockPostService,
+		PostRepo:    mockPostRepo,
+		Cfg:         &config.Config{MaxUploadSize: 10 * 1024 * 1024, ImageMaxFiles: 2},
+	}
+
+	body, contentType := multipartImages(t, [][2]string{{"image", "logo.png"}, {"image", "banner.jpg"}})
+	req := httptest.NewRequest(http.MethodPost, "/api/posts/post123/images", body).WithContext(ctx)
+	req.Header.Set("Content-Type", contentType)
+	req = withUser(req, "123", "Author")
+
+	rr := httptest.NewRecorder()
+	handler.AddedImage(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	mockPostService.AssertCalled(t, "DeleteImage", mock.Anything, "post123", "img1")
+	mockPostService.AssertExpectations(t)
+}
+
+func TestGetPostImagesHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		urlPath        string
+		userID         string
+		post           *models.Post
+		expectedStatus int
+		expectedImages int
+	}{
+		{
+			name:           "Изображения опубликованного поста",
+			urlPath:        "/api/posts/post123/images",
+			userID:         "456",
+			post:           &models.Post{PostID: "post123", AuthorID: "123", Status: "Published"},
+			expectedStatus: http.StatusOK,
+			expectedImages: 2,
+		},
+		{
+			name:           "Черновик чужого поста",
+			urlPath:        "/api/posts/post123/images",
+			userID:         "456",
+			post:           &models.Post{PostID: "post123", AuthorID: "123", Status: "Draft"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Одно изображение",
+			urlPath:        "/api/posts/post123/images/img2",
+			userID:         "123",
+			post:           &models.Post{PostID: "post123", AuthorID: "123", Status: "Draft"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Изображение другого поста",
+			urlPath:        "/api/posts/post123/images/img9",
+			userID:         "123",
+			post:           &models.Post{PostID: "post123", AuthorID: "123", Status: "Published"},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockPostService := new(MockPostService)
+			mockPostRepo := new(MockPostRepository)
+			mockPostRepo.On("GetByID", mock.Anything, "post123").Return(tt.post, nil)
+			mockPostService.On("AttachImages", mock.Anything, mock.Anything).
+				Run(func(args mock.Arguments) {
+					posts := args.Get(1).([]models.Post)
+					posts[0].Images = []models.Image{
+						{ImageID: "img1", PostID: "post123", Position: 0},
+						{ImageID: "img2", PostID: "post123", Position: 1},
+					}
+				}).
+				Return(nil).Maybe()
+
+			handler := &handlers.Handlers{PostService: mockPostService, PostRepo: mockPostRepo}
+
+			req := withUser(httptest.NewRequest(http.MethodGet, tt.urlPath, nil), tt.userID, "Reader")
+			rr := httptest.NewRecorder()
+			if tt.urlPath == "/api/posts/post123/images" {
+				handler.AddedImage(rr, req)
+			} else {
+				handler.DeleteImage(rr, req)
+			}
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedImages > 0 {
+				var response handlers.PostImagesResponse
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+				assert.Len(t, response.Images, tt.expectedImages)
+			} else if tt.expectedStatus == http.StatusOK {
+				var image models.Image
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &image))
+				assert.Equal(t, "img2", image.ImageID)
+			}
+		})
+	}
+}
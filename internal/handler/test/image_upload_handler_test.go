@@ -0,0 +1,203 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"microblogCPT/internal/config"
+	handlers "microblogCPT/internal/handler"
+	"microblogCPT/internal/models"
+	"microblogCPT/internal/repository"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newImageUploadTestHandler(service *MockPostService, repo *MockPostRepository) *handlers.Handlers {
+	return &handlers.Handlers{
+		PostService: service,
+		PostRepo:    repo,
+		Cfg:         &config.Config{MaxUploadSize: 10 * 1024 * 1024},
+		Validate:    validator.New(),
+	}
+}
+
+func TestCreateImageUploadHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		userID         string
+		body           map[string]interface{}
+		mockSetup      func(*MockPostService)
+		expectedStatus int
+	}{
+		{
+			name:   "Успешное создание загрузки",
+			userID: "123",
+			body: map[string]interface{}{
+				"fileName":    "photo.png",
+				"contentType": "image/png",
+				"size":        2048,
+			},
+			mockSetup: func(service *MockPostService) {
+				service.On("CreateImageUpload", mock.Anything, repository.CreateImageUploadRequest{
+					PostID:      "post123",
+					AuthorID:    "123",
+					FileName:    "photo.png",
+					ContentType: "image/png",
+					Size:        2048,
+				}).Return(&models.ImageUpload{
+					UploadID:    "upload123",
+					PostID:      "post123",
+					ContentType: "image/png",
+					Size:        2048,
+					ExpiresAt:   time.Now().Add(15 * time.Minute),
+				}, "http://minio/images/posts/post123/photo.png?X-Amz-Signature=abc", nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:   "Неподдерживаемый тип файла",
+			userID: "123",
+			body: map[string]interface{}{
+				"fileName":    "script.sh",
+				"contentType": "text/x-shellscript",
+				"size":        2048,
+			},
+			mockSetup:      func(service *MockPostService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "Файл слишком большой",
+			userID: "123",
+			body: map[string]interface{}{
+				"fileName":    "photo.png",
+				"contentType": "image/png",
+				"size":        100 * 1024 * 1024,
+			},
+			mockSetup: func(service *MockPostService) {
+				service.On("CreateImageUpload", mock.Anything, mock.Anything).
+					Return(nil, "", errors.New("размер файла превышает 10 MB"))
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "Чужой пост",
+			userID: "456",
+			body: map[string]interface{}{
+				"fileName":    "photo.png",
+				"contentType": "image/png",
+				"size":        2048,
+			},
+			mockSetup:      func(service *MockPostService) {},
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockPostService := new(MockPostService)
+			mockPostRepo := new(MockPostRepository)
+			mockPostRepo.On("GetByID", mock.Anything, "post123").
+				Return(&models.Post{PostID: "post123", AuthorID: "123"}, nil)
+			tt.mockSetup(mockPostService)
+
+			handler := newImageUploadTestHandler(mockPostService, mockPostRepo)
+
+			body, _ := json.Marshal(tt.body)
+			req := httptest.NewRequest(http.MethodPost, "/api/posts/post123/images/uploads", bytes.NewBuffer(body))
+			req = withUser(req, tt.userID, "Author")
+
+			rr := httptest.NewRecorder()
+			handler.CreateImageUpload(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+
+			if tt.expectedStatus == http.StatusCreated {
+				var response handlers.ImageUploadResponse
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+				assert.Equal(t, "upload123", response.UploadID)
+				assert.Equal(t, http.MethodPut, response.Method)
+				assert.Equal(t, "image/png", response.Headers["Content-Type"])
+				assert.Equal(t, "2048", response.Headers["Content-Length"])
+			}
+
+			mockPostService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCompleteImageUploadHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		mockSetup      func(*MockPostService)
+		expectedStatus int
+	}{
+		{
+			name: "Успешное завершение загрузки",
+			mockSetup: func(service *MockPostService) {
+				service.On("CompleteImageUpload", mock.Anything, "post123", "upload123", repository.ImageDetails{}).
+					Return(&models.Image{
+						ImageID:   "img123",
+						PostID:    "post123",
+						ImageURL:  "http://minio/images/posts/post123/photo.png?X-Amz-Signature=abc",
+						CreatedAt: time.Now(),
+					}, &models.ImageUpload{
+						UploadID:    "upload123",
+						FileName:    "photo.png",
+						ContentType: "image/png",
+						Size:        2048,
+					}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name: "Файл еще не загружен",
+			mockSetup: func(service *MockPostService) {
+				service.On("CompleteImageUpload", mock.Anything, "post123", "upload123", repository.ImageDetails{}).
+					Return(nil, nil, errors.New("файл не загружен"))
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name: "Файл не совпадает с заявленным",
+			mockSetup: func(service *MockPostService) {
+				service.On("CompleteImageUpload", mock.Anything, "post123", "upload123", repository.ImageDetails{}).
+					Return(nil, nil, errors.New("загруженный файл не совпадает с заявленным"))
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "Загрузка не найдена",
+			mockSetup: func(service *MockPostService) {
+				service.On("CompleteImageUpload", mock.Anything, "post123", "upload123", repository.ImageDetails{}).
+					Return(nil, nil, errors.New("загрузка не найдена"))
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockPostService := new(MockPostService)
+			mockPostRepo := new(MockPostRepository)
+			mockPostRepo.On("GetByID", mock.Anything, "post123").
+				Return(&models.Post{PostID: "post123", AuthorID: "123"}, nil)
+			tt.mockSetup(mockPostService)
+
+			handler := newImageUploadTestHandler(mockPostService, mockPostRepo)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/posts/post123/images/uploads/upload123/complete", nil)
+			req = withUser(req, "123", "Author")
+
+			rr := httptest.NewRecorder()
+			handler.CompleteImageUpload(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			mockPostService.AssertExpectations(t)
+		})
+	}
+}
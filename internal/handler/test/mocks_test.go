@@ -7,6 +7,7 @@ import (
 	"io"
 	"microblogCPT/internal/models"
 	"microblogCPT/internal/repository"
+	"microblogCPT/internal/service"
 	"time"
 )
 
@@ -70,14 +71,40 @@ func (m *MockUserRepository) GetUserByEmail(ctx context.Context, email string) (
 	return args.Get(0).(*models.User), args.Error(1)
 }
 
+func (m *MockUserRepository) GetUserByHandle(ctx context.Context, handle string) (*models.User, error) {
+	args := m.Called(ctx, handle)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUsersByIDs(ctx context.Context, userIDs []string) ([]models.User, error) {
+	args := m.Called(ctx, userIDs)
+	return args.Get(0).([]models.User), args.Error(1)
+}
+
+func (m *MockUserRepository) GetHandleRedirect(ctx context.Context, handle string) (string, error) {
+	args := m.Called(ctx, handle)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockUserRepository) UpdateProfile(ctx context.Context, user *models.User, previousHandle string, changeInterval time.Duration, redirectUntil time.Time) error {
+	args := m.Called(ctx, user, previousHandle, changeInterval, redirectUntil)
+	return args.Error(0)
+}
+
 func (m *MockUserRepository) UpdateUser(ctx context.Context, user *models.User) error {
 	args := m.Called(ctx, user)
 	return args.Error(0)
 }
 
-func (m *MockUserRepository) DeleteUser(ctx context.Context, userID string) error {
+func (m *MockUserRepository) DeleteUser(ctx context.Context, userID string) ([]string, error) {
 	args := m.Called(ctx, userID)
-	return args.Error(0)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
 }
 
 func (m *MockUserRepository) VerifyPassword(ctx context.Context, email, password string) (*models.User, error) {
@@ -112,11 +139,66 @@ func (m *MockUserService) DeleteUser(ctx context.Context, userID string) error {
 	return args.Error(0)
 }
 
+func (m *MockUserService) SetProfileImage(ctx context.Context, userID, kind, fileName string, file io.Reader) (*models.ProfileImages, error) {
+	args := m.Called(ctx, userID, kind, fileName, file)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ProfileImages), args.Error(1)
+}
+
+func (m *MockUserService) DeleteProfileImage(ctx context.Context, userID, kind string) error {
+	args := m.Called(ctx, userID, kind)
+	return args.Error(0)
+}
+
+func (m *MockUserService) GetProfileImages(ctx context.Context, userID string) (*models.ProfileImages, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ProfileImages), args.Error(1)
+}
+
+func (m *MockUserService) AttachAuthors(ctx context.Context, posts []models.Post) error {
+	args := m.Called(ctx, posts)
+	return args.Error(0)
+}
+
+func (m *MockUserService) UpdateProfile(ctx context.Context, req repository.UpdateProfileRequest) (*models.User, error) {
+	args := m.Called(ctx, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (m *MockUserService) GetPublicProfile(ctx context.Context, handle string) (*models.PublicProfile, string, error) {
+	args := m.Called(ctx, handle)
+	if args.Get(0) == nil {
+		return nil, args.String(1), args.Error(2)
+	}
+	return args.Get(0).(*models.PublicProfile), args.String(1), args.Error(2)
+}
+
 type MockPostService struct {
 	mock.Mock
 }
 
-func (m *MockPostService) CreatePost(ctx context.Context, req repository.CreatePostRequest) (*models.Post, error) {
+func (m *MockPostService) CreatePost(ctx context.Context, req repository.CreatePostRequest, response repository.PostCreatedResponse) (*models.Post, *models.IdempotencyKey, error) {
+	args := m.Called(ctx, req, response)
+	var post *models.Post
+	if args.Get(0) != nil {
+		post = args.Get(0).(*models.Post)
+	}
+	var replay *models.IdempotencyKey
+	if args.Get(1) != nil {
+		replay = args.Get(1).(*models.IdempotencyKey)
+	}
+	return post, replay, args.Error(2)
+}
+
+func (m *MockPostService) UpdatePost(ctx context.Context, req repository.UpdatePostRequest) (*models.Post, error) {
 	args := m.Called(ctx, req)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -124,34 +206,259 @@ func (m *MockPostService) CreatePost(ctx context.Context, req repository.CreateP
 	return args.Get(0).(*models.Post), args.Error(1)
 }
 
-func (m *MockPostService) UpdatePost(ctx context.Context, req repository.UpdatePostRequest) error {
-	args := m.Called(ctx, req)
+func (m *MockPostService) DeletePost(ctx context.Context, postID string) error {
+	args := m.Called(ctx, postID)
 	return args.Error(0)
 }
 
-func (m *MockPostService) DeletePost(ctx context.Context, postID string) error {
-	args := m.Called(ctx, postID)
+func (m *MockPostService) GetTrash(ctx context.Context, authorID string) ([]models.Post, error) {
+	args := m.Called(ctx, authorID)
+	return args.Get(0).([]models.Post), args.Error(1)
+}
+
+func (m *MockPostService) RestorePost(ctx context.Context, postID, authorID string) error {
+	args := m.Called(ctx, postID, authorID)
 	return args.Error(0)
 }
 
+func (m *MockPostService) PurgeTrash(ctx context.Context) (int, error) {
+	args := m.Called(ctx)
+	return args.Int(0), args.Error(1)
+}
+
 func (m *MockPostService) PublishPost(ctx context.Context, postID string) error {
 	args := m.Called(ctx, postID)
 	return args.Error(0)
 }
 
-func (m *MockPostService) AddedImage(ctx context.Context, postID, fileName string, file io.Reader, size int64) (*models.Image, error) {
-	args := m.Called(ctx, postID, fileName, file, size)
+func (m *MockPostService) AddedImage(ctx context.Context, postID, fileName string, file io.Reader, details repository.ImageDetails) (*models.Image, error) {
+	args := m.Called(ctx, postID, fileName, file, details)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Image), args.Error(1)
+}
+
+func (m *MockPostService) UpdateImage(ctx context.Context, req repository.UpdateImageRequest) (*models.Image, error) {
+	args := m.Called(ctx, req)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*models.Image), args.Error(1)
 }
 
-func (m *MockPostService) DeleteImage(ctx context.Context, imageID string) error {
-	args := m.Called(ctx, imageID)
+func (m *MockPostService) ReorderImages(ctx context.Context, postID string, imageIDs []string) ([]*models.Image, error) {
+	args := m.Called(ctx, postID, imageIDs)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Image), args.Error(1)
+}
+
+func (m *MockPostService) DeleteImage(ctx context.Context, postID, imageID string) error {
+	args := m.Called(ctx, postID, imageID)
+	return args.Error(0)
+}
+
+func (m *MockPostService) AttachImages(ctx context.Context, posts []models.Post) error {
+	args := m.Called(ctx, posts)
+	return args.Error(0)
+}
+
+func (m *MockPostService) CreateImageUpload(ctx context.Context, req repository.CreateImageUploadRequest) (*models.ImageUpload, string, error) {
+	args := m.Called(ctx, req)
+	if args.Get(0) == nil {
+		return nil, "", args.Error(2)
+	}
+	return args.Get(0).(*models.ImageUpload), args.String(1), args.Error(2)
+}
+
+func (m *MockPostService) CompleteImageUpload(ctx context.Context, postID, uploadID string, details repository.ImageDetails) (*models.Image, *models.ImageUpload, error) {
+	args := m.Called(ctx, postID, uploadID, details)
+	if args.Get(0) == nil {
+		return nil, nil, args.Error(2)
+	}
+	return args.Get(0).(*models.Image), args.Get(1).(*models.ImageUpload), args.Error(2)
+}
+
+func (m *MockPostService) CleanupExpiredUploads(ctx context.Context) (int, error) {
+	args := m.Called(ctx)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockPostService) GetRevisions(ctx context.Context, postID string) ([]models.PostRevision, error) {
+	args := m.Called(ctx, postID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.PostRevision), args.Error(1)
+}
+
+func (m *MockPostService) GetRevision(ctx context.Context, postID string, revision int) (*models.PostRevision, error) {
+	args := m.Called(ctx, postID, revision)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.PostRevision), args.Error(1)
+}
+
+func (m *MockPostService) DiffRevisions(ctx context.Context, postID string, fromRevision, toRevision int) (string, error) {
+	args := m.Called(ctx, postID, fromRevision, toRevision)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockPostService) RestoreRevision(ctx context.Context, postID string, revision int) (*models.Post, error) {
+	args := m.Called(ctx, postID, revision)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Post), args.Error(1)
+}
+
+type MockUploadService struct {
+	mock.Mock
+}
+
+func (m *MockUploadService) CreateUpload(ctx context.Context, req repository.CreateTusUploadRequest) (*models.TusUpload, error) {
+	args := m.Called(ctx, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.TusUpload), args.Error(1)
+}
+
+func (m *MockUploadService) GetUpload(ctx context.Context, uploadID, authorID string) (*models.TusUpload, error) {
+	args := m.Called(ctx, uploadID, authorID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.TusUpload), args.Error(1)
+}
+
+func (m *MockUploadService) WriteChunk(ctx context.Context, uploadID, authorID string, offset int64, chunk io.Reader) (*models.TusUpload, error) {
+	args := m.Called(ctx, uploadID, authorID, offset, chunk)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.TusUpload), args.Error(1)
+}
+
+func (m *MockUploadService) TerminateUpload(ctx context.Context, uploadID, authorID string) error {
+	args := m.Called(ctx, uploadID, authorID)
+	return args.Error(0)
+}
+
+func (m *MockUploadService) AttachUpload(ctx context.Context, uploadID, authorID, postID string, details repository.ImageDetails) (*models.Image, *models.TusUpload, error) {
+	args := m.Called(ctx, uploadID, authorID, postID, details)
+	if args.Get(0) == nil {
+		return nil, nil, args.Error(2)
+	}
+	return args.Get(0).(*models.Image), args.Get(1).(*models.TusUpload), args.Error(2)
+}
+
+func (m *MockUploadService) CleanupExpiredUploads(ctx context.Context) (int, error) {
+	args := m.Called(ctx)
+	return args.Int(0), args.Error(1)
+}
+
+type MockUsageService struct {
+	mock.Mock
+}
+
+func (m *MockUsageService) GetUsage(ctx context.Context, userID string) (*service.UsageReport, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.UsageReport), args.Error(1)
+}
+
+func (m *MockUsageService) Recompute(ctx context.Context) (int, error) {
+	args := m.Called(ctx)
+	return args.Int(0), args.Error(1)
+}
+
+type MockFollowService struct {
+	mock.Mock
+}
+
+func (m *MockFollowService) Follow(ctx context.Context, followerID, handle string) (*models.FollowStatus, error) {
+	args := m.Called(ctx, followerID, handle)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.FollowStatus), args.Error(1)
+}
+
+func (m *MockFollowService) Unfollow(ctx context.Context, followerID, handle string) (*models.FollowStatus, error) {
+	args := m.Called(ctx, followerID, handle)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.FollowStatus), args.Error(1)
+}
+
+func (m *MockFollowService) GetFollowers(ctx context.Context, handle, cursor string, limit int) ([]models.FollowUser, string, error) {
+	args := m.Called(ctx, handle, cursor, limit)
+	if args.Get(0) == nil {
+		return nil, args.String(1), args.Error(2)
+	}
+	return args.Get(0).([]models.FollowUser), args.String(1), args.Error(2)
+}
+
+func (m *MockFollowService) GetFollowing(ctx context.Context, handle, cursor string, limit int) ([]models.FollowUser, string, error) {
+	args := m.Called(ctx, handle, cursor, limit)
+	if args.Get(0) == nil {
+		return nil, args.String(1), args.Error(2)
+	}
+	return args.Get(0).([]models.FollowUser), args.String(1), args.Error(2)
+}
+
+type MockCommentService struct {
+	mock.Mock
+}
+
+func (m *MockCommentService) CreateComment(ctx context.Context, req repository.CreateCommentRequest) (*models.Comment, error) {
+	args := m.Called(ctx, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Comment), args.Error(1)
+}
+
+func (m *MockCommentService) UpdateComment(ctx context.Context, req repository.UpdateCommentRequest) (*models.Comment, error) {
+	args := m.Called(ctx, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Comment), args.Error(1)
+}
+
+func (m *MockCommentService) DeleteComment(ctx context.Context, postID, commentID, userID string) error {
+	args := m.Called(ctx, postID, commentID, userID)
 	return args.Error(0)
 }
 
+func (m *MockCommentService) GetComments(ctx context.Context, postID, viewerID, view, cursor string, limit int) ([]models.Comment, string, error) {
+	args := m.Called(ctx, postID, viewerID, view, cursor, limit)
+	if args.Get(0) == nil {
+		return nil, args.String(1), args.Error(2)
+	}
+	return args.Get(0).([]models.Comment), args.String(1), args.Error(2)
+}
+
+type MockTimelineService struct {
+	mock.Mock
+}
+
+func (m *MockTimelineService) HomeTimeline(ctx context.Context, userID, cursor string, limit int) ([]models.Post, string, error) {
+	args := m.Called(ctx, userID, cursor, limit)
+	if args.Get(0) == nil {
+		return nil, args.String(1), args.Error(2)
+	}
+	return args.Get(0).([]models.Post), args.String(1), args.Error(2)
+}
+
 type MockPostRepository struct {
 	mock.Mock
 }
@@ -179,6 +486,16 @@ func (m *MockPostRepository) GetPublishPosts(ctx context.Context) ([]models.Post
 	return args.Get(0).([]models.Post), args.Error(1)
 }
 
+func (m *MockPostRepository) GetByFollowedAuthors(ctx context.Context, followerID string, cursor *repository.PageCursor, limit int) ([]models.Post, error) {
+	args := m.Called(ctx, followerID, cursor, limit)
+	return args.Get(0).([]models.Post), args.Error(1)
+}
+
+func (m *MockPostRepository) CountPublishedByAuthor(ctx context.Context, authorID string) (int, error) {
+	args := m.Called(ctx, authorID)
+	return args.Int(0), args.Error(1)
+}
+
 func (m *MockPostRepository) Update(ctx context.Context, post *models.Post) error {
 	args := m.Called(ctx, post)
 	return args.Error(0)
@@ -189,9 +506,40 @@ func (m *MockPostRepository) Delete(ctx context.Context, postID string) error {
 	return args.Error(0)
 }
 
-func (m *MockPostRepository) CheckIdempotencyKey(ctx context.Context, authorID, idempotencyKey string) (bool, error) {
-	args := m.Called(ctx, authorID, idempotencyKey)
-	return args.Bool(0), args.Error(1)
+func (m *MockPostRepository) Restore(ctx context.Context, postID, authorID string) error {
+	args := m.Called(ctx, postID, authorID)
+	return args.Error(0)
+}
+
+func (m *MockPostRepository) GetDeletedByUserID(ctx context.Context, userID string) ([]models.Post, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]models.Post), args.Error(1)
+}
+
+func (m *MockPostRepository) GetDeletedBefore(ctx context.Context, before time.Time) ([]models.Post, error) {
+	args := m.Called(ctx, before)
+	return args.Get(0).([]models.Post), args.Error(1)
+}
+
+func (m *MockPostRepository) Purge(ctx context.Context, postID string) ([]string, error) {
+	args := m.Called(ctx, postID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockPostRepository) CreateIdempotent(ctx context.Context, post *models.Post, requestHash string, response repository.PostCreatedResponse, ttl time.Duration) (*models.IdempotencyKey, error) {
+	args := m.Called(ctx, post, requestHash, response, ttl)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.IdempotencyKey), args.Error(1)
+}
+
+func (m *MockPostRepository) DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(int64), args.Error(1)
 }
 
 func (m *MockPostRepository) Publish(ctx context.Context, postID string) error {
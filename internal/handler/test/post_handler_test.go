@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/go-playground/validator/v10"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -21,16 +23,18 @@ import (
 
 func TestGetPostsHandler(t *testing.T) {
 	tests := []struct {
-		name           string
-		contextValues  map[string]interface{}
-		mockSetup      func(*MockPostRepository)
-		expectedStatus int
+		name                 string
+		contextValues        map[string]interface{}
+		mockSetup            func(*MockPostRepository)
+		expectedStatus       int
+		expectedCacheControl string
 	}{
 		{
 			name: "Author получает свои посты",
 			contextValues: map[string]interface{}{
-				"userID": "123",
-				"role":   "Author",
+				"userID":    "123",
+				"role":      "Author",
+				"principal": models.Principal{Kind: models.PrincipalUser, UserID: "123", Role: "Author"},
 			},
 			mockSetup: func(repo *MockPostRepository) {
 				repo.On("GetByUserID", mock.Anything, "123").
@@ -46,13 +50,15 @@ func TestGetPostsHandler(t *testing.T) {
 						},
 					}, nil)
 			},
-			expectedStatus: http.StatusOK,
+			expectedStatus:       http.StatusOK,
+			expectedCacheControl: "private, no-cache",
 		},
 		{
 			name: "Reader получает опубликованные посты",
 			contextValues: map[string]interface{}{
-				"userID": "456",
-				"role":   "Reader",
+				"userID":    "456",
+				"role":      "Reader",
+				"principal": models.Principal{Kind: models.PrincipalUser, UserID: "456", Role: "Reader"},
 			},
 			mockSetup: func(repo *MockPostRepository) {
 				repo.On("GetPublishPosts", mock.Anything).
@@ -68,7 +74,20 @@ func TestGetPostsHandler(t *testing.T) {
 						},
 					}, nil)
 			},
-			expectedStatus: http.StatusOK,
+			expectedStatus:       http.StatusOK,
+			expectedCacheControl: "private, no-cache",
+		},
+		{
+			name: "Аноним получает опубликованные посты",
+			contextValues: map[string]interface{}{
+				"principal": models.Principal{Kind: models.PrincipalAnonymous},
+			},
+			mockSetup: func(repo *MockPostRepository) {
+				repo.On("GetPublishPosts", mock.Anything).
+					Return([]models.Post{{PostID: "post2", AuthorID: "123", Status: "Published"}}, nil)
+			},
+			expectedStatus:       http.StatusOK,
+			expectedCacheControl: "public, max-age=60",
 		},
 	}
 
@@ -81,8 +100,10 @@ func TestGetPostsHandler(t *testing.T) {
 			mockPostRepo := new(MockPostRepository)
 
 			tt.mockSetup(mockPostRepo)
+			mockPostService.On("AttachImages", mock.Anything, mock.Anything).Return(nil)
+			mockUserService.On("AttachAuthors", mock.Anything, mock.Anything).Return(nil)
 
-			cfg := &config.Config{}
+			cfg := &config.Config{AnonymousCacheMaxAge: time.Minute}
 			handler := &handlers.Handlers{
 				UserService: mockUserService,
 				UserRepo:    mockUserRepo,
@@ -111,6 +132,8 @@ func TestGetPostsHandler(t *testing.T) {
 				json.Unmarshal(rr.Body.Bytes(), &response)
 				assert.Contains(t, response, "posts")
 				assert.Contains(t, response, "pagination")
+				assert.Equal(t, tt.expectedCacheControl, rr.Header().Get("Cache-Control"))
+				assert.Equal(t, "Authorization", rr.Header().Get("Vary"))
 			}
 
 			mockPostRepo.AssertExpectations(t)
@@ -118,14 +141,155 @@ func TestGetPostsHandler(t *testing.T) {
 	}
 }
 
-func TestCreatePostHandler(t *testing.T) {
+func TestGetPostsHandler_IncludeAndFields(t *testing.T) {
+	posts := []models.Post{
+		{PostID: "post1", Title: "First", Content: "Content", AuthorID: "123", Status: "Published"},
+		{PostID: "post2", Title: "Second", Content: "Content", AuthorID: "123", Status: "Published"},
+		{PostID: "post3", Title: "Third", Content: "Content", AuthorID: "123", Status: "Published"},
+	}
+
 	tests := []struct {
 		name           string
-		requestBody    map[string]interface{}
-		contextValues  map[string]interface{}
-		mockSetup      func(*MockPostService)
+		url            string
+		expectImages   bool
 		expectedStatus int
-		shouldCallMock bool
+		checkResponse  func(*testing.T, map[string]interface{})
+	}{
+		{
+			name:           "Изображения встраиваются по умолчанию",
+			url:            "/api/posts",
+			expectImages:   true,
+			expectedStatus: http.StatusOK,
+			checkResponse: func(t *testing.T, response map[string]interface{}) {
+				first := response["posts"].([]interface{})[0].(map[string]interface{})
+				assert.Len(t, first["images"], 1)
+				author := first["author"].(map[string]interface{})
+				assert.Equal(t, "123", author["userId"])
+				assert.Equal(t, "http://storage/users/123/avatar/a_48.jpg", author["avatarUrls"].(map[string]interface{})["48"])
+			},
+		},
+		{
+			name:           "Пустой include отключает изображения",
+			url:            "/api/posts?include=",
+			expectImages:   false,
+			expectedStatus: http.StatusOK,
+			checkResponse: func(t *testing.T, response map[string]interface{}) {
+				first := response["posts"].([]interface{})[0].(map[string]interface{})
+				assert.NotContains(t, first, "images")
+			},
+		},
+		{
+			name:           "fields оставляет только перечисленные поля",
+			url:            "/api/posts?fields=postID,title",
+			expectImages:   false,
+			expectedStatus: http.StatusOK,
+			checkResponse: func(t *testing.T, response map[string]interface{}) {
+				first := response["posts"].([]interface{})[0].(map[string]interface{})
+				assert.Equal(t, map[string]interface{}{"postID": "post1", "title": "First"}, first)
+			},
+		},
+		{
+			name:           "fields с автором встраивает автора",
+			url:            "/api/posts?fields=postID,author",
+			expectImages:   false,
+			expectedStatus: http.StatusOK,
+			checkResponse: func(t *testing.T, response map[string]interface{}) {
+				first := response["posts"].([]interface{})[0].(map[string]interface{})
+				assert.Contains(t, first, "author")
+				assert.NotContains(t, first, "title")
+			},
+		},
+		{
+			name:           "Страница постов",
+			url:            "/api/posts?page=2&limit=2&include=",
+			expectImages:   false,
+			expectedStatus: http.StatusOK,
+			checkResponse: func(t *testing.T, response map[string]interface{}) {
+				assert.Len(t, response["posts"], 1)
+				pagination := response["pagination"].(map[string]interface{})
+				assert.Equal(t, float64(3), pagination["total"])
+				assert.Equal(t, float64(2), pagination["totalPages"])
+			},
+		},
+		{
+			name:           "Неизвестное значение include",
+			url:            "/api/posts?include=comments",
+			expectImages:   false,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockPostService := new(MockPostService)
+			mockPostRepo := new(MockPostRepository)
+			mockUserService := new(MockUserService)
+
+			mockUserService.On("AttachAuthors", mock.Anything, mock.Anything).
+				Run(func(args mock.Arguments) {
+					for i, post := range args.Get(1).([]models.Post) {
+						args.Get(1).([]models.Post)[i].Author = &models.PostAuthor{
+							UserID: post.AuthorID,
+							ProfileImages: models.ProfileImages{
+								AvatarURLs: map[string]string{"48": "http://storage/users/" + post.AuthorID + "/avatar/a_48.jpg"},
+							},
+						}
+					}
+				}).
+				Return(nil).Maybe()
+
+			pagePosts := append([]models.Post(nil), posts...)
+			mockPostRepo.On("GetPublishPosts", mock.Anything).Return(pagePosts, nil).Maybe()
+			if tt.expectImages {
+				mockPostService.On("AttachImages", mock.Anything, mock.Anything).
+					Run(func(args mock.Arguments) {
+						for i, post := range args.Get(1).([]models.Post) {
+							args.Get(1).([]models.Post)[i].Images = []models.Image{{ImageID: "img-" + post.PostID, PostID: post.PostID}}
+						}
+					}).
+					Return(nil).Once()
+			}
+
+			handler := &handlers.Handlers{
+				UserService: mockUserService,
+				PostService: mockPostService,
+				PostRepo:    mockPostRepo,
+				Cfg:         &config.Config{},
+				Validate:    validator.New(),
+			}
+
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			req = withUser(req, "456", "Reader")
+
+			rr := httptest.NewRecorder()
+			handler.GetPosts(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+
+			if tt.checkResponse != nil {
+				var response map[string]interface{}
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+				tt.checkResponse(t, response)
+			}
+
+			if !tt.expectImages {
+				mockPostService.AssertNotCalled(t, "AttachImages", mock.Anything, mock.Anything)
+			}
+			mockPostService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCreatePostHandler(t *testing.T) {
+	tests := []struct {
+		name             string
+		requestBody      map[string]interface{}
+		contextValues    map[string]interface{}
+		mockSetup        func(*MockPostService)
+		expectedStatus   int
+		shouldCallMock   bool
+		expectedReplayed bool
+		expectedBody     string
 	}{
 		{
 			name: "Успешное создание поста",
@@ -145,7 +309,7 @@ func TestCreatePostHandler(t *testing.T) {
 					Title:          "Test Post",
 					Content:        "Test Content",
 					IdempotencyKey: &key,
-				}).Return(&models.Post{
+				}, mock.Anything).Return(&models.Post{
 					PostID:         "post123",
 					Title:          "Test Post",
 					Content:        "Test Content",
@@ -154,11 +318,54 @@ func TestCreatePostHandler(t *testing.T) {
 					IdempotencyKey: &key,
 					CreatedAt:      time.Now(),
 					UpdatedAt:      time.Now(),
-				}, nil)
+				}, nil, nil)
 			},
 			expectedStatus: http.StatusCreated,
 			shouldCallMock: true,
 		},
+		{
+			name: "Повторный запрос с тем же ключом",
+			requestBody: map[string]interface{}{
+				"title":          "Test Post",
+				"content":        "Test Content",
+				"idempotencyKey": "key123",
+			},
+			contextValues: map[string]interface{}{
+				"userID": "123",
+				"role":   "Author",
+			},
+			mockSetup: func(service *MockPostService) {
+				key := "key123"
+				service.On("CreatePost", mock.Anything, mock.Anything, mock.Anything).Return(nil, &models.IdempotencyKey{
+					AuthorID:       "123",
+					Key:            key,
+					ResponseStatus: http.StatusCreated,
+					ResponseBody:   []byte(`{"postId":"post123","idempotencyKey":"key123","title":"Test Post","version":1}`),
+				}, nil)
+			},
+			expectedStatus:   http.StatusCreated,
+			expectedBody:     `{"postId":"post123","idempotencyKey":"key123","title":"Test Post","version":1}`,
+			shouldCallMock:   true,
+			expectedReplayed: true,
+		},
+		{
+			name: "Ключ использован с другим запросом",
+			requestBody: map[string]interface{}{
+				"title":          "Other Post",
+				"content":        "Other Content",
+				"idempotencyKey": "key123",
+			},
+			contextValues: map[string]interface{}{
+				"userID": "123",
+				"role":   "Author",
+			},
+			mockSetup: func(service *MockPostService) {
+				service.On("CreatePost", mock.Anything, mock.Anything, mock.Anything).
+					Return(nil, nil, errors.New("ключ идемпотентности уже использован с другим запросом"))
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+			shouldCallMock: true,
+		},
 		{
 			name: "Reader пытается создать пост",
 			requestBody: map[string]interface{}{
@@ -224,10 +431,21 @@ func TestCreatePostHandler(t *testing.T) {
 
 			assert.Equal(t, tt.expectedStatus, rr.Code)
 
+			if tt.expectedReplayed {
+				assert.Equal(t, "true", rr.Header().Get("Idempotent-Replayed"))
+				assert.Equal(t, `"1"`, rr.Header().Get("ETag"))
+			} else {
+				assert.Empty(t, rr.Header().Get("Idempotent-Replayed"))
+			}
+
 			if tt.shouldCallMock {
 				mockPostService.AssertExpectations(t)
 			} else {
-				mockPostService.AssertNotCalled(t, "CreatePost", mock.Anything, mock.Anything)
+				mockPostService.AssertNotCalled(t, "CreatePost", mock.Anything, mock.Anything, mock.Anything)
+			}
+
+			if tt.expectedBody != "" {
+				assert.Equal(t, tt.expectedBody, rr.Body.String())
 			}
 		})
 	}
@@ -257,6 +475,22 @@ func TestPublishPostHandler(t *testing.T) {
 			},
 			expectedStatus: http.StatusOK,
 		},
+		{
+			name:    "У изображения нет альтернативного текста",
+			urlPath: "/api/posts/post123/status",
+			requestBody: map[string]interface{}{
+				"status": "Published",
+			},
+			contextValues: map[string]interface{}{
+				"userID": "123",
+				"role":   "Author",
+			},
+			mockSetup: func(service *MockPostService) {
+				service.On("PublishPost", mock.Anything, "post123").
+					Return(errors.New("у изображений поста нет альтернативного текста"))
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
 		{
 			name:    "Reader пытается опубликовать пост",
 			urlPath: "/api/posts/post123/status",
@@ -339,7 +573,7 @@ func TestAddedImageHandler(t *testing.T) {
 					"post123",
 					"test.jpg",
 					mock.Anything,
-					mock.AnythingOfType("int64"),
+					repository.ImageDetails{},
 				).
 					Return(&models.Image{
 						ImageID:   "img123",
@@ -350,6 +584,63 @@ func TestAddedImageHandler(t *testing.T) {
 			},
 			expectedStatus: http.StatusCreated,
 		},
+		{
+			name:    "Файл не является изображением",
+			urlPath: "/api/posts/post123/images",
+			contextValues: map[string]interface{}{
+				"userID": "123",
+				"role":   "Author",
+			},
+			mockSetup: func(service *MockPostService, repo *MockPostRepository) {
+				repo.On("GetByID", mock.Anything, "post123").
+					Return(&models.Post{
+						PostID:   "post123",
+						AuthorID: "123",
+					}, nil)
+
+				service.On("AddedImage", mock.Anything, "post123", "test.jpg", mock.Anything, repository.ImageDetails{}).
+					Return(nil, errors.New("неподдерживаемый тип файла"))
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:    "Изображение слишком большого размера",
+			urlPath: "/api/posts/post123/images",
+			contextValues: map[string]interface{}{
+				"userID": "123",
+				"role":   "Author",
+			},
+			mockSetup: func(service *MockPostService, repo *MockPostRepository) {
+				repo.On("GetByID", mock.Anything, "post123").
+					Return(&models.Post{
+						PostID:   "post123",
+						AuthorID: "123",
+					}, nil)
+
+				service.On("AddedImage", mock.Anything, "post123", "test.jpg", mock.Anything, repository.ImageDetails{}).
+					Return(nil, errors.New("размеры изображения 20000x20000 превышают допустимые 8192x8192"))
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:    "Превышена квота хранилища",
+			urlPath: "/api/posts/post123/images",
+			contextValues: map[string]interface{}{
+				"userID": "123",
+				"role":   "Author",
+			},
+			mockSetup: func(service *MockPostService, repo *MockPostRepository) {
+				repo.On("GetByID", mock.Anything, "post123").
+					Return(&models.Post{
+						PostID:   "post123",
+						AuthorID: "123",
+					}, nil)
+
+				service.On("AddedImage", mock.Anything, "post123", "test.jpg", mock.Anything, repository.ImageDetails{}).
+					Return(nil, errors.New("превышена квота хранилища: не больше 1024 MB и 1000 изображений"))
+			},
+			expectedStatus: http.StatusForbidden,
+		},
 	}
 
 	for _, tt := range tests {
@@ -364,6 +655,7 @@ func TestAddedImageHandler(t *testing.T) {
 
 			cfg := &config.Config{
 				MaxUploadSize: 10 * 1024 * 1024, // 10MB
+				ImageMaxFiles: 10,
 			}
 			handler := &handlers.Handlers{
 				UserService: mockUserService,
@@ -403,13 +695,14 @@ func TestAddedImageHandler(t *testing.T) {
 			assert.Equal(t, tt.expectedStatus, rr.Code)
 
 			if tt.expectedStatus == http.StatusCreated {
-				var response map[string]interface{}
+				var response handlers.AddImagesResponse
 				err := json.Unmarshal(rr.Body.Bytes(), &response)
 				assert.NoError(t, err)
-				assert.Contains(t, response, "imageId")
-				assert.Contains(t, response, "imageUrl")
-				assert.Equal(t, "img123", response["imageId"])
-				assert.Equal(t, "post123", response["postId"])
+				assert.Len(t, response.Images, 1)
+				assert.Equal(t, "created", response.Images[0].Status)
+				assert.Equal(t, "img123", response.Images[0].Image.ImageID)
+				assert.Equal(t, "post123", response.Images[0].Image.PostID)
+				assert.Equal(t, "http://example.com/image.jpg", response.Images[0].Image.ImageUrl)
 			}
 
 			mockPostRepo.AssertExpectations(t)
@@ -417,3 +710,388 @@ func TestAddedImageHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdatePostHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		ifMatch        string
+		mockSetup      func(*MockPostService)
+		expectedStatus int
+		expectedETag   string
+	}{
+		{
+			name:    "Успешное обновление поста",
+			ifMatch: `"2"`,
+			mockSetup: func(service *MockPostService) {
+				service.On("UpdatePost", mock.Anything, repository.UpdatePostRequest{
+					PostID:  "post123",
+					Title:   "New Title",
+					Content: "New Content",
+					Version: 2,
+				}).Return(&models.Post{PostID: "post123", Version: 3}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedETag:   `"3"`,
+		},
+		{
+			name:           "Отсутствует If-Match",
+			ifMatch:        "",
+			mockSetup:      func(service *MockPostService) {},
+			expectedStatus: http.StatusPreconditionRequired,
+		},
+		{
+			name:           "Неверный формат If-Match",
+			ifMatch:        "abc",
+			mockSetup:      func(service *MockPostService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:    "Версия поста устарела",
+			ifMatch: `"1"`,
+			mockSetup: func(service *MockPostService) {
+				service.On("UpdatePost", mock.Anything, mock.Anything).
+					Return(nil, fmt.Errorf("версия поста устарела: текущая версия 2"))
+			},
+			expectedStatus: http.StatusPreconditionFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockPostService := new(MockPostService)
+			tt.mockSetup(mockPostService)
+
+			handler := &handlers.Handlers{
+				UserService: new(MockUserService),
+				UserRepo:    new(MockUserRepository),
+				AuthService: new(MockAuthService),
+				PostService: mockPostService,
+				PostRepo:    new(MockPostRepository),
+				Cfg:         &config.Config{},
+				Validate:    validator.New(),
+			}
+
+			body, _ := json.Marshal(map[string]string{"title": "New Title", "content": "New Content"})
+			req := httptest.NewRequest(http.MethodPut, "/api/posts/post123", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+			req = withUser(req, "123", "Author")
+
+			rr := httptest.NewRecorder()
+			handler.CreatePost(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, tt.expectedETag, rr.Header().Get("ETag"))
+			mockPostService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetPostHandler_ETag(t *testing.T) {
+	mockPostRepo := new(MockPostRepository)
+	mockPostRepo.On("GetByID", mock.Anything, "post123").
+		Return(&models.Post{PostID: "post123", AuthorID: "123", Status: "Published", Version: 4}, nil)
+
+	mockPostService := new(MockPostService)
+	mockPostService.On("AttachImages", mock.Anything, mock.Anything).Return(nil)
+
+	mockUserService := new(MockUserService)
+	mockUserService.On("AttachAuthors", mock.Anything, mock.Anything).Return(nil)
+
+	handler := &handlers.Handlers{
+		UserService: mockUserService,
+		PostService: mockPostService,
+		PostRepo:    mockPostRepo,
+		Cfg:         &config.Config{},
+		Validate:    validator.New(),
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/posts/post123", nil)
+	req = withUser(req, "456", "Reader")
+
+	rr := httptest.NewRecorder()
+	handler.CreatePost(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `"4"`, rr.Header().Get("ETag"))
+	mockPostRepo.AssertExpectations(t)
+}
+
+func TestGetPostHandler_Anonymous(t *testing.T) {
+	tests := []struct {
+		name                 string
+		post                 *models.Post
+		expectedStatus       int
+		expectedCacheControl string
+	}{
+		{
+			name:                 "Опубликованный пост",
+			post:                 &models.Post{PostID: "post123", AuthorID: "123", Status: "Published", Version: 1},
+			expectedStatus:       http.StatusOK,
+			expectedCacheControl: "public, max-age=30",
+		},
+		{
+			name:           "Черновик требует авторизации",
+			post:           &models.Post{PostID: "post123", AuthorID: "123", Status: "Draft", Version: 1},
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockPostRepo := new(MockPostRepository)
+			mockPostRepo.On("GetByID", mock.Anything, "post123").Return(tt.post, nil)
+
+			mockPostService := new(MockPostService)
+			mockPostService.On("AttachImages", mock.Anything, mock.Anything).Return(nil).Maybe()
+
+			mockUserService := new(MockUserService)
+			mockUserService.On("AttachAuthors", mock.Anything, mock.Anything).Return(nil).Maybe()
+
+			handler := &handlers.Handlers{
+				UserService: mockUserService,
+				PostService: mockPostService,
+				PostRepo:    mockPostRepo,
+				Cfg:         &config.Config{AnonymousCacheMaxAge: 30 * time.Second},
+				Validate:    validator.New(),
+			}
+
+			// a request without the principal is anonymous
+			req := httptest.NewRequest(http.MethodGet, "/api/posts/post123", nil)
+
+			rr := httptest.NewRecorder()
+			handler.CreatePost(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, tt.expectedCacheControl, rr.Header().Get("Cache-Control"))
+			mockPostRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestPatchPostHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		contentType    string
+		ifMatch        string
+		body           string
+		mockSetup      func(*MockPostService)
+		expectedStatus int
+	}{
+		{
+			name:        "Merge patch меняет только заголовок",
+			contentType: "application/merge-patch+json",
+			ifMatch:     `"2"`,
+			body:        `{"title": "Fixed Title"}`,
+			mockSetup: func(service *MockPostService) {
+				service.On("UpdatePost", mock.Anything, repository.UpdatePostRequest{
+					PostID:  "post123",
+					Title:   "Fixed Title",
+					Content: "Old Content",
+					Version: 2,
+				}).Return(&models.Post{PostID: "post123", Title: "Fixed Title", Content: "Old Content", Version: 3}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:        "JSON Patch с проверкой и заменой",
+			contentType: "application/json-patch+json",
+			ifMatch:     `"2"`,
+			body:        `[{"op": "test", "path": "/title", "value": "Old Title"}, {"op": "replace", "path": "/content", "value": "New Content"}]`,
+			mockSetup: func(service *MockPostService) {
+				service.On("UpdatePost", mock.Anything, repository.UpdatePostRequest{
+					PostID:  "post123",
+					Title:   "Old Title",
+					Content: "New Content",
+					Version: 2,
+				}).Return(&models.Post{PostID: "post123", Version: 3}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "JSON Patch с непройденной проверкой",
+			contentType:    "application/json-patch+json",
+			ifMatch:        `"2"`,
+			body:           `[{"op": "test", "path": "/title", "value": "Other"}]`,
+			mockSetup:      func(service *MockPostService) {},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "Удаление заголовка не проходит валидацию",
+			contentType:    "application/merge-patch+json",
+			ifMatch:        `"2"`,
+			body:           `{"title": null}`,
+			mockSetup:      func(service *MockPostService) {},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "Пустое содержание не проходит валидацию, как и при создании",
+			contentType:    "application/merge-patch+json",
+			ifMatch:        `"2"`,
+			body:           `{"content": ""}`,
+			mockSetup:      func(service *MockPostService) {},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "Изменение статуса запрещено",
+			contentType:    "application/merge-patch+json",
+			ifMatch:        `"2"`,
+			body:           `{"status": "Published"}`,
+			mockSetup:      func(service *MockPostService) {},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "Устаревшая версия",
+			contentType:    "application/merge-patch+json",
+			ifMatch:        `"1"`,
+			body:           `{"title": "Fixed Title"}`,
+			mockSetup:      func(service *MockPostService) {},
+			expectedStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name:        "Параллельное изменение между чтением и записью",
+			contentType: "application/merge-patch+json",
+			ifMatch:     `"2"`,
+			body:        `{"title": "Fixed Title"}`,
+			mockSetup: func(service *MockPostService) {
+				service.On("UpdatePost", mock.Anything, mock.Anything).
+					Return(nil, fmt.Errorf("версия поста устарела: пост был изменен другим запросом"))
+			},
+			expectedStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name:           "Отсутствует If-Match",
+			contentType:    "application/merge-patch+json",
+			body:           `{"title": "Fixed Title"}`,
+			mockSetup:      func(service *MockPostService) {},
+			expectedStatus: http.StatusPreconditionRequired,
+		},
+		{
+			name:           "Неподдерживаемый тип",
+			contentType:    "application/json",
+			ifMatch:        `"2"`,
+			body:           `{"title": "Fixed Title"}`,
+			mockSetup:      func(service *MockPostService) {},
+			expectedStatus: http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockPostService := new(MockPostService)
+			mockPostRepo := new(MockPostRepository)
+			tt.mockSetup(mockPostService)
+
+			mockPostRepo.On("GetByID", mock.Anything, "post123").
+				Return(&models.Post{
+					PostID:   "post123",
+					AuthorID: "123",
+					Title:    "Old Title",
+					Content:  "Old Content",
+					Status:   "Draft",
+					Version:  2,
+				}, nil).Maybe()
+
+			handler := &handlers.Handlers{
+				PostService: mockPostService,
+				PostRepo:    mockPostRepo,
+				Cfg:         &config.Config{},
+				Validate:    validator.New(),
+			}
+
+			req := httptest.NewRequest(http.MethodPatch, "/api/posts/post123", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+			req = withUser(req, "123", "Author")
+
+			rr := httptest.NewRecorder()
+			handler.CreatePost(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			mockPostService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestDeleteImageHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		userID         string
+		role           string
+		mockSetup      func(*MockPostService, *MockPostRepository)
+		expectedStatus int
+	}{
+		{
+			name:   "Успешное удаление изображения",
+			userID: "123",
+			role:   "Author",
+			mockSetup: func(service *MockPostService, repo *MockPostRepository) {
+				repo.On("GetByID", mock.Anything, "post123").Return(&models.Post{PostID: "post123", AuthorID: "123"}, nil)
+				service.On("DeleteImage", mock.Anything, "post123", "img123").Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Reader не может удалить изображение",
+			userID:         "456",
+			role:           "Reader",
+			mockSetup:      func(service *MockPostService, repo *MockPostRepository) {},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:   "Чужой пост",
+			userID: "456",
+			role:   "Author",
+			mockSetup: func(service *MockPostService, repo *MockPostRepository) {
+				repo.On("GetByID", mock.Anything, "post123").Return(&models.Post{PostID: "post123", AuthorID: "123"}, nil)
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:   "Пост не найден",
+			userID: "123",
+			role:   "Author",
+			mockSetup: func(service *MockPostService, repo *MockPostRepository) {
+				repo.On("GetByID", mock.Anything, "post123").Return(nil, errors.New("пост с ID post123 не найден"))
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:   "Изображение другого поста",
+			userID: "123",
+			role:   "Author",
+			mockSetup: func(service *MockPostService, repo *MockPostRepository) {
+				repo.On("GetByID", mock.Anything, "post123").Return(&models.Post{PostID: "post123", AuthorID: "123"}, nil)
+				service.On("DeleteImage", mock.Anything, "post123", "img123").Return(errors.New("изображение не найдено"))
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockPostService := new(MockPostService)
+			mockPostRepo := new(MockPostRepository)
+			tt.mockSetup(mockPostService, mockPostRepo)
+
+			handler := &handlers.Handlers{
+				PostService: mockPostService,
+				PostRepo:    mockPostRepo,
+				Cfg:         &config.Config{},
+				Validate:    validator.New(),
+			}
+
+			req := withUser(httptest.NewRequest(http.MethodDelete, "/api/posts/post123/images/img123", nil), tt.userID, tt.role)
+			rr := httptest.NewRecorder()
+			handler.DeleteImage(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			mockPostService.AssertExpectations(t)
+			mockPostRepo.AssertExpectations(t)
+		})
+	}
+}
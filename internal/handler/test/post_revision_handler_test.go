@@ -0,0 +1,206 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"microblogCPT/internal/config"
+	handlers "microblogCPT/internal/handler"
+	"microblogCPT/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newRevisionTestHandler(service *MockPostService, repo *MockPostRepository) *handlers.Handlers {
+	return &handlers.Handlers{
+		UserService: new(MockUserService),
+		UserRepo:    new(MockUserRepository),
+		AuthService: new(MockAuthService),
+		PostService: service,
+		PostRepo:    repo,
+		Cfg:         &config.Config{},
+		Validate:    validator.New(),
+	}
+}
+
+func withUser(req *http.Request, userID, role string) *http.Request {
+	ctx := context.WithValue(req.Context(), "userID", userID)
+	ctx = context.WithValue(ctx, "role", role)
+	ctx = context.WithValue(ctx, "principal", models.Principal{Kind: models.PrincipalUser, UserID: userID, Role: role})
+	return req.WithContext(ctx)
+}
+
+func TestGetPostRevisionsHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		userID         string
+		role           string
+		mockSetup      func(*MockPostService, *MockPostRepository)
+		expectedStatus int
+	}{
+		{
+			name:   "Автор получает историю поста",
+			userID: "123",
+			role:   "Author",
+			mockSetup: func(service *MockPostService, repo *MockPostRepository) {
+				repo.On("GetByID", mock.Anything, "post123").
+					Return(&models.Post{PostID: "post123", AuthorID: "123"}, nil)
+				service.On("GetRevisions", mock.Anything, "post123").
+					Return([]models.PostRevision{
+						{PostID: "post123", Revision: 2, Title: "New", CreatedAt: time.Now()},
+						{PostID: "post123", Revision: 1, Title: "Old", CreatedAt: time.Now()},
+					}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "Чужой автор не видит историю",
+			userID: "456",
+			role:   "Author",
+			mockSetup: func(service *MockPostService, repo *MockPostRepository) {
+				repo.On("GetByID", mock.Anything, "post123").
+					Return(&models.Post{PostID: "post123", AuthorID: "123"}, nil)
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Reader не видит историю",
+			userID:         "456",
+			role:           "Reader",
+			mockSetup:      func(service *MockPostService, repo *MockPostRepository) {},
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockPostService := new(MockPostService)
+			mockPostRepo := new(MockPostRepository)
+			tt.mockSetup(mockPostService, mockPostRepo)
+
+			handler := newRevisionTestHandler(mockPostService, mockPostRepo)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/posts/post123/revisions", nil)
+			req = withUser(req, tt.userID, tt.role)
+
+			rr := httptest.NewRecorder()
+			handler.GetPostRevisions(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+
+			if tt.expectedStatus == http.StatusOK {
+				var response handlers.RevisionsResponse
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+				assert.Len(t, response.Revisions, 2)
+			}
+
+			mockPostRepo.AssertExpectations(t)
+			mockPostService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetPostRevisionHandler_NotFound(t *testing.T) {
+	mockPostService := new(MockPostService)
+	mockPostRepo := new(MockPostRepository)
+
+	mockPostRepo.On("GetByID", mock.Anything, "post123").
+		Return(&models.Post{PostID: "post123", AuthorID: "123"}, nil)
+	mockPostService.On("GetRevision", mock.Anything, "post123", 9).
+		Return(nil, errors.New("ревизия 9 поста post123 не найдена"))
+
+	handler := newRevisionTestHandler(mockPostService, mockPostRepo)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/posts/post123/revisions/9", nil)
+	req = withUser(req, "123", "Author")
+
+	rr := httptest.NewRecorder()
+	handler.GetPostRevision(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	mockPostService.AssertExpectations(t)
+}
+
+func TestDiffPostRevisionsHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		url            string
+		mockSetup      func(*MockPostService, *MockPostRepository)
+		expectedStatus int
+	}{
+		{
+			name: "Успешное сравнение ревизий",
+			url:  "/api/posts/post123/revisions/diff?from=1&to=2",
+			mockSetup: func(service *MockPostService, repo *MockPostRepository) {
+				repo.On("GetByID", mock.Anything, "post123").
+					Return(&models.Post{PostID: "post123", AuthorID: "123"}, nil)
+				service.On("DiffRevisions", mock.Anything, "post123", 1, 2).
+					Return("--- revision 1\n+++ revision 2\n@@ -1,1 +1,1 @@\n-Old\n+New\n", nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Не указаны номера ревизий",
+			url:            "/api/posts/post123/revisions/diff?from=1",
+			mockSetup:      func(service *MockPostService, repo *MockPostRepository) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockPostService := new(MockPostService)
+			mockPostRepo := new(MockPostRepository)
+			tt.mockSetup(mockPostService, mockPostRepo)
+
+			handler := newRevisionTestHandler(mockPostService, mockPostRepo)
+
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			req = withUser(req, "123", "Author")
+
+			rr := httptest.NewRecorder()
+			handler.DiffPostRevisions(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+
+			if tt.expectedStatus == http.StatusOK {
+				var response handlers.RevisionDiffResponse
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+				assert.Contains(t, response.Diff, "+New")
+			}
+
+			mockPostService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestRestorePostRevisionHandler(t *testing.T) {
+	mockPostService := new(MockPostService)
+	mockPostRepo := new(MockPostRepository)
+
+	mockPostRepo.On("GetByID", mock.Anything, "post123").
+		Return(&models.Post{PostID: "post123", AuthorID: "123"}, nil)
+	mockPostService.On("RestoreRevision", mock.Anything, "post123", 1).
+		Return(&models.Post{PostID: "post123", AuthorID: "123", Title: "Old", Content: "Old Content"}, nil)
+
+	handler := newRevisionTestHandler(mockPostService, mockPostRepo)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/posts/post123/revisions/1/restore", nil)
+	req = withUser(req, "123", "Author")
+
+	rr := httptest.NewRecorder()
+	handler.RestorePostRevision(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response handlers.PostResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, "Old", response.Title)
+
+	mockPostService.AssertExpectations(t)
+}
@@ -0,0 +1,182 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"microblogCPT/internal/config"
+	handlers "microblogCPT/internal/handler"
+	"microblogCPT/internal/models"
+	"microblogCPT/internal/repository"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetPublicProfileHandler(t *testing.T) {
+	tests := []struct {
+		name             string
+		url              string
+		mockSetup        func(*MockUserService)
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{
+			name: "Публичный профиль",
+			url:  "/api/users/@Alice",
+			mockSetup: func(service *MockUserService) {
+				service.On("GetPublicProfile", mock.Anything, "alice").
+					Return(&models.PublicProfile{UserID: "123", Handle: "alice", DisplayName: "Алиса", Links: []string{}, PostCount: 3}, "", nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "Прежний handle перенаправляет",
+			url:  "/api/users/@old_alice",
+			mockSetup: func(service *MockUserService) {
+				service.On("GetPublicProfile", mock.Anything, "old_alice").Return(nil, "alice", nil)
+			},
+			expectedStatus:   http.StatusFound,
+			expectedLocation: "/api/users/@alice",
+		},
+		{
+			name: "Пользователь не найден",
+			url:  "/api/users/@nobody",
+			mockSetup: func(service *MockUserService) {
+				service.On("GetPublicProfile", mock.Anything, "nobody").
+					Return(nil, "", errors.New("пользователь @nobody не найден"))
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Без @",
+			url:            "/api/users/alice",
+			mockSetup:      func(service *MockUserService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUserService := new(MockUserService)
+			tt.mockSetup(mockUserService)
+
+			handler := &handlers.Handlers{
+				UserService: mockUserService,
+				Cfg:         &config.Config{},
+			}
+
+			// the profile is public, so the request has no user
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+
+			rr := httptest.NewRecorder()
+			handler.GetPublicProfile(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedLocation != "" {
+				assert.Equal(t, tt.expectedLocation, rr.Header().Get("Location"))
+			}
+			if tt.expectedStatus == http.StatusOK {
+				var response map[string]interface{}
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+				assert.Equal(t, "alice", response["handle"])
+				assert.Equal(t, float64(3), response["postCount"])
+				assert.NotContains(t, response, "email")
+			}
+			mockUserService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUpdateProfileHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		mockSetup      func(*MockUserService)
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name: "Успешное обновление профиля",
+			body: `{"handle": "@New_Name", "displayName": " Алиса ", "links": ["https://example.com"]}`,
+			mockSetup: func(service *MockUserService) {
+				service.On("UpdateProfile", mock.Anything, mock.MatchedBy(func(req repository.UpdateProfileRequest) bool {
+					return req.UserID == "123" && *req.Handle == "new_name" && *req.DisplayName == "Алиса"
+				})).Return(&models.User{UserID: "123", Email: "a@example.com", Handle: "new_name", DisplayName: "Алиса",
+					Links: []string{"https://example.com"}}, nil)
+				service.On("GetProfileImages", mock.Anything, "123").Return(&models.ProfileImages{}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Нет полей",
+			body:           `{}`,
+			mockSetup:      func(service *MockUserService) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Нет полей для обновления",
+		},
+		{
+			name:           "Неверный handle",
+			body:           `{"handle": "a b"}`,
+			mockSetup:      func(service *MockUserService) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Handle должен содержать",
+		},
+		{
+			name:           "Неверная ссылка",
+			body:           `{"links": ["javascript:alert(1)"]}`,
+			mockSetup:      func(service *MockUserService) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Неверная ссылка",
+		},
+		{
+			name: "Handle занят",
+			body: `{"handle": "taken"}`,
+			mockSetup: func(service *MockUserService) {
+				service.On("UpdateProfile", mock.Anything, mock.Anything).Return(nil, errors.New("handle уже занят"))
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name: "Handle меняется слишком часто",
+			body: `{"handle": "again"}`,
+			mockSetup: func(service *MockUserService) {
+				service.On("UpdateProfile", mock.Anything, mock.Anything).
+					Return(nil, errors.New("handle можно менять не чаще одного раза, следующая смена возможна после 2026-10-25T00:00:00Z"))
+			},
+			expectedStatus: http.StatusTooManyRequests,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUserService := new(MockUserService)
+			tt.mockSetup(mockUserService)
+
+			handler := &handlers.Handlers{
+				UserService: mockUserService,
+				Cfg:         &config.Config{},
+			}
+
+			req := httptest.NewRequest(http.MethodPatch, "/api/me/profile", strings.NewReader(tt.body))
+			req = withUser(req, "123", "Reader")
+
+			rr := httptest.NewRecorder()
+			handler.UpdateProfile(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedError != "" {
+				assert.Contains(t, rr.Body.String(), tt.expectedError)
+			}
+			if tt.expectedStatus == http.StatusOK {
+				var response map[string]interface{}
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+				assert.Equal(t, "new_name", response["handle"])
+				assert.Equal(t, "a@example.com", response["email"])
+			}
+			mockUserService.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"microblogCPT/internal/config"
+	handlers "microblogCPT/internal/handler"
+	"microblogCPT/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUserAvatarHandler(t *testing.T) {
+	avatar := &models.ProfileImages{AvatarURLs: map[string]string{
+		"48":  "http://storage/users/123/avatar/a_48.jpg",
+		"96":  "http://storage/users/123/avatar/a_96.jpg",
+		"256": "http://storage/users/123/avatar/a_256.jpg",
+	}}
+
+	tests := []struct {
+		name           string
+		method         string
+		parts          [][2]string
+		mockSetup      func(*MockUserService)
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:   "Успешная загрузка аватара",
+			method: http.MethodPut,
+			parts:  [][2]string{{"image", "me.png"}},
+			mockSetup: func(service *MockUserService) {
+				service.On("SetProfileImage", mock.Anything, "123", "avatar", "me.png", mock.Anything).
+					Return(avatar, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Нет файла",
+			method:         http.MethodPut,
+			parts:          [][2]string{{"altText", "me"}},
+			mockSetup:      func(service *MockUserService) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Не удалось получить файл",
+		},
+		{
+			name:   "WebP не поддерживается",
+			method: http.MethodPut,
+			parts:  [][2]string{{"image", "me.webp"}},
+			mockSetup: func(service *MockUserService) {
+				service.On("SetProfileImage", mock.Anything, "123", "avatar", "me.webp", mock.Anything).
+					Return(nil, errors.New("изображение профиля в формате WebP не поддерживается"))
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Разрешены: JPEG, PNG, GIF",
+		},
+		{
+			name:   "Поврежденное изображение",
+			method: http.MethodPut,
+			parts:  [][2]string{{"image", "me.png"}},
+			mockSetup: func(service *MockUserService) {
+				service.On("SetProfileImage", mock.Anything, "123", "avatar", "me.png", mock.Anything).
+					Return(nil, errors.New("не удалось прочитать изображение"))
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "не удалось прочитать изображение",
+		},
+		{
+			name:   "Удаление аватара",
+			method: http.MethodDelete,
+			mockSetup: func(service *MockUserService) {
+				service.On("DeleteProfileImage", mock.Anything, "123", "avatar").Return(nil)
+				service.On("GetProfileImages", mock.Anything, "123").Return(&models.ProfileImages{}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Неверный метод",
+			method:         http.MethodPost,
+			mockSetup:      func(service *MockUserService) {},
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUserService := new(MockUserService)
+			tt.mockSetup(mockUserService)
+
+			handler := &handlers.Handlers{
+				UserService: mockUserService,
+				Cfg:         &config.Config{MaxUploadSize: 1024 * 1024},
+			}
+
+			req := httptest.NewRequest(tt.method, "/api/me/avatar", nil)
+			if tt.parts != nil {
+				body, contentType := multipartImages(t, tt.parts)
+				req = httptest.NewRequest(tt.method, "/api/me/avatar", body)
+				req.Header.Set("Content-Type", contentType)
+			}
+			req = withUser(req, "123", "Reader")
+
+			rr := httptest.NewRecorder()
+			handler.UserAvatar(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedError != "" {
+				assert.True(t, strings.Contains(rr.Body.String(), tt.expectedError), rr.Body.String())
+			}
+			if tt.name == "Успешная загрузка аватара" {
+				var response models.ProfileImages
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+				assert.Equal(t, avatar.AvatarURLs, response.AvatarURLs)
+			}
+			mockUserService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUserBannerHandler(t *testing.T) {
+	mockUserService := new(MockUserService)
+	mockUserService.On("SetProfileImage", mock.Anything, "123", "banner", "cover.jpg", mock.Anything).
+		Return(&models.ProfileImages{BannerURL: "http://storage/users/123/banner/b.jpg"}, nil)
+
+	handler := &handlers.Handlers{
+		UserService: mockUserService,
+		Cfg:         &config.Config{MaxUploadSize: 1024 * 1024},
+	}
+
+	body, contentType := multipartImages(t, [][2]string{{"image", "cover.jpg"}})
+	req := httptest.NewRequest(http.MethodPut, "/api/me/banner", body)
+	req.Header.Set("Content-Type", contentType)
+	req = withUser(req, "123", "Author")
+
+	rr := httptest.NewRecorder()
+	handler.UserBanner(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, "http://storage/users/123/banner/b.jpg", response["bannerUrl"])
+	assert.NotContains(t, response, "avatarUrls")
+	mockUserService.AssertExpectations(t)
+}
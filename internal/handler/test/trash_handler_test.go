@@ -0,0 +1,152 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"microblogCPT/internal/config"
+	handlers "microblogCPT/internal/handler"
+	"microblogCPT/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDeletePostHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		userID         string
+		mockSetup      func(*MockPostService, *MockPostRepository)
+		expectedStatus int
+	}{
+		{
+			name:   "Автор перемещает пост в корзину",
+			userID: "123",
+			mockSetup: func(service *MockPostService, repo *MockPostRepository) {
+				repo.On("GetByID", mock.Anything, "post123").
+					Return(&models.Post{PostID: "post123", AuthorID: "123"}, nil)
+				service.On("DeletePost", mock.Anything, "post123").Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "Чужой пост удалить нельзя",
+			userID: "456",
+			mockSetup: func(service *MockPostService, repo *MockPostRepository) {
+				repo.On("GetByID", mock.Anything, "post123").
+					Return(&models.Post{PostID: "post123", AuthorID: "123"}, nil)
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:   "Пост уже в корзине",
+			userID: "123",
+			mockSetup: func(service *MockPostService, repo *MockPostRepository) {
+				repo.On("GetByID", mock.Anything, "post123").
+					Return(nil, errors.New("пост с ID post123 не найден"))
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockPostService := new(MockPostService)
+			mockPostRepo := new(MockPostRepository)
+			tt.mockSetup(mockPostService, mockPostRepo)
+
+			handler := &handlers.Handlers{
+				PostService: mockPostService,
+				PostRepo:    mockPostRepo,
+				Cfg:         &config.Config{},
+				Validate:    validator.New(),
+			}
+
+			req := httptest.NewRequest(http.MethodDelete, "/api/posts/post123", nil)
+			req = withUser(req, tt.userID, "Author")
+
+			rr := httptest.NewRecorder()
+			handler.CreatePost(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			mockPostService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetTrashHandler(t *testing.T) {
+	mockPostService := new(MockPostService)
+	deletedAt := time.Now()
+	mockPostService.On("GetTrash", mock.Anything, "123").
+		Return([]models.Post{{PostID: "post123", AuthorID: "123", DeletedAt: &deletedAt}}, nil)
+
+	handler := &handlers.Handlers{
+		PostService: mockPostService,
+		Cfg:         &config.Config{},
+		Validate:    validator.New(),
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/me/trash", nil)
+	req = withUser(req, "123", "Author")
+
+	rr := httptest.NewRecorder()
+	handler.GetTrash(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response handlers.TrashResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Len(t, response.Posts, 1)
+	assert.NotNil(t, response.Posts[0].DeletedAt)
+
+	mockPostService.AssertExpectations(t)
+}
+
+func TestRestorePostHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		mockSetup      func(*MockPostService)
+		expectedStatus int
+	}{
+		{
+			name: "Пост восстановлен",
+			mockSetup: func(service *MockPostService) {
+				service.On("RestorePost", mock.Anything, "post123", "123").Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "Пост не найден в корзине",
+			mockSetup: func(service *MockPostService) {
+				service.On("RestorePost", mock.Anything, "post123", "123").
+					Return(errors.New("пост не найден в корзине"))
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockPostService := new(MockPostService)
+			tt.mockSetup(mockPostService)
+
+			handler := &handlers.Handlers{
+				PostService: mockPostService,
+				Cfg:         &config.Config{},
+				Validate:    validator.New(),
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/posts/post123/restore", nil)
+			req = withUser(req, "123", "Author")
+
+			rr := httptest.NewRecorder()
+			handler.RestorePost(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			mockPostService.AssertExpectations(t)
+		})
+	}
+}
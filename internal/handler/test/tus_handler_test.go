@@ -0,0 +1,360 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"microblogCPT/internal/config"
+	handlers "microblogCPT/internal/handler"
+	"microblogCPT/internal/models"
+	"microblogCPT/internal/repository"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTusTestHandler(service *MockUploadService, repo *MockPostRepository) *handlers.Handlers {
+	return &handlers.Handlers{
+		UploadService: service,
+		PostRepo:      repo,
+		Cfg:           &config.Config{TusMaxSize: 500 * 1024 * 1024},
+	}
+}
+
+func TestTusOptionsHandler(t *testing.T) {
+	handler := newTusTestHandler(new(MockUploadService), new(MockPostRepository))
+
+	req := httptest.NewRequest(http.MethodOptions, "/api/uploads/", nil)
+	rr := httptest.NewRecorder()
+	handler.TusUploads(rr, req)
+
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, "1.0.0", rr.Header().Get("Tus-Version"))
+	assert.Equal(t, "creation,termination", rr.Header().Get("Tus-Extension"))
+	assert.Equal(t, "524288000", rr.Header().Get("Tus-Max-Size"))
+}
+
+func TestTusCreateHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		role           string
+		headers        map[string]string
+		mockSetup      func(*MockUploadService)
+		expectedStatus int
+	}{
+		{
+			name: "Успешное создание загрузки",
+			role: "Author",
+			headers: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Length":   "10485760",
+				"Upload-Metadata": "filename cGhvdG8ucG5n,filetype aW1hZ2UvcG5n",
+			},
+			mockSetup: func(service *MockUploadService) {
+				service.On("CreateUpload", mock.Anything, repository.CreateTusUploadRequest{
+					AuthorID:    "123",
+					FileName:    "photo.png",
+					ContentType: "image/png",
+					Length:      10485760,
+				}).Return(&models.TusUpload{
+					UploadID:  "upload123",
+					Length:    10485760,
+					ExpiresAt: time.Now().Add(24 * time.Hour),
+				}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name: "Неподдерживаемая версия протокола",
+			role: "Author",
+			headers: map[string]string{
+				"Tus-Resumable": "0.2.2",
+				"Upload-Length": "1024",
+			},
+			mockSetup:      func(service *MockUploadService) {},
+			expectedStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name: "Читатель не может загружать файлы",
+			role: "Reader",
+			headers: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Length":   "1024",
+				"Upload-Metadata": "filename cGhvdG8ucG5n,filetype aW1hZ2UvcG5n",
+			},
+			mockSetup:      func(service *MockUploadService) {},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name: "Нет заголовка Upload-Length",
+			role: "Author",
+			headers: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Metadata": "filename cGhvdG8ucG5n,filetype aW1hZ2UvcG5n",
+			},
+			mockSetup:      func(service *MockUploadService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "Файл слишком большой",
+			role: "Author",
+			headers: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Length":   "1073741824",
+				"Upload-Metadata": "filename cGhvdG8ucG5n,filetype aW1hZ2UvcG5n",
+			},
+			mockSetup:      func(service *MockUploadService) {},
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name: "Неподдерживаемый тип файла",
+			role: "Author",
+			headers: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Length":   "1024",
+				"Upload-Metadata": "filename c2NyaXB0LnNo,filetype dGV4dC94LXNoZWxsc2NyaXB0",
+			},
+			mockSetup:      func(service *MockUploadService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUploadService := new(MockUploadService)
+			tt.mockSetup(mockUploadService)
+
+			handler := newTusTestHandler(mockUploadService, new(MockPostRepository))
+
+			req := httptest.NewRequest(http.MethodPost, "/api/uploads/", nil)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			req = withUser(req, "123", tt.role)
+
+			rr := httptest.NewRecorder()
+			handler.TusUploads(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, "1.0.0", rr.Header().Get("Tus-Resumable"))
+
+			if tt.expectedStatus == http.StatusCreated {
+				assert.Equal(t, "/api/uploads/upload123", rr.Header().Get("Location"))
+			}
+
+			mockUploadService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestTusHeadHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		mockSetup      func(*MockUploadService)
+		expectedStatus int
+		expectedOffset string
+	}{
+		{
+			name: "Текущее смещение загрузки",
+			mockSetup: func(service *MockUploadService) {
+				service.On("GetUpload", mock.Anything, "upload123", "123").
+					Return(&models.TusUpload{UploadID: "upload123", Length: 2048, Offset: 1024}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedOffset: "1024",
+		},
+		{
+			name: "Загрузка не найдена",
+			mockSetup: func(service *MockUploadService) {
+				service.On("GetUpload", mock.Anything, "upload123", "123").
+					Return(nil, errors.New("загрузка не найдена"))
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUploadService := new(MockUploadService)
+			tt.mockSetup(mockUploadService)
+
+			handler := newTusTestHandler(mockUploadService, new(MockPostRepository))
+
+			req := httptest.NewRequest(http.MethodHead, "/api/uploads/upload123", nil)
+			req.Header.Set("Tus-Resumable", "1.0.0")
+			req = withUser(req, "123", "Author")
+
+			rr := httptest.NewRecorder()
+			handler.TusUploads(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, tt.expectedOffset, rr.Header().Get("Upload-Offset"))
+			mockUploadService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestTusPatchHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		contentType    string
+		offset         string
+		mockSetup      func(*MockUploadService)
+		expectedStatus int
+		expectedOffset string
+	}{
+		{
+			name:        "Успешная запись части",
+			contentType: "application/offset+octet-stream",
+			offset:      "1024",
+			mockSetup: func(service *MockUploadService) {
+				service.On("WriteChunk", mock.Anything, "upload123", "123", int64(1024), mock.Anything).
+					Return(&models.TusUpload{UploadID: "upload123", Length: 4096, Offset: 2048}, nil)
+			},
+			expectedStatus: http.StatusNoContent,
+			expectedOffset: "2048",
+		},
+		{
+			name:           "Неверный Content-Type",
+			contentType:    "application/json",
+			offset:         "0",
+			mockSetup:      func(service *MockUploadService) {},
+			expectedStatus: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:           "Нет заголовка Upload-Offset",
+			contentType:    "application/offset+octet-stream",
+			mockSetup:      func(service *MockUploadService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "Смещение не совпадает",
+			contentType: "application/offset+octet-stream",
+			offset:      "0",
+			mockSetup: func(service *MockUploadService) {
+				service.On("WriteChunk", mock.Anything, "upload123", "123", int64(0), mock.Anything).
+					Return(nil, errors.New("неверное смещение загрузки: ожидается 1024"))
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:        "Загрузка уже выполняется",
+			contentType: "application/offset+octet-stream",
+			offset:      "1024",
+			mockSetup: func(service *MockUploadService) {
+				service.On("WriteChunk", mock.Anything, "upload123", "123", int64(1024), mock.Anything).
+					Return(nil, errors.New("загрузка уже выполняется"))
+			},
+			expectedStatus: http.StatusLocked,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUploadService := new(MockUploadService)
+			tt.mockSetup(mockUploadService)
+
+			handler := newTusTestHandler(mockUploadService, new(MockPostRepository))
+
+			req := httptest.NewRequest(http.MethodPatch, "/api/uploads/upload123", bytes.NewReader(make([]byte, 1024)))
+			req.Header.Set("Tus-Resumable", "1.0.0")
+			req.Header.Set("Content-Type", tt.contentType)
+			if tt.offset != "" {
+				req.Header.Set("Upload-Offset", tt.offset)
+			}
+			req = withUser(req, "123", "Author")
+
+			rr := httptest.NewRecorder()
+			handler.TusUploads(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedOffset != "" {
+				assert.Equal(t, tt.expectedOffset, rr.Header().Get("Upload-Offset"))
+			}
+			mockUploadService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestTusDeleteHandler(t *testing.T) {
+	mockUploadService := new(MockUploadService)
+	mockUploadService.On("TerminateUpload", mock.Anything, "upload123", "123").Return(nil)
+
+	handler := newTusTestHandler(mockUploadService, new(MockPostRepository))
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/uploads/upload123", nil)
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	req = withUser(req, "123", "Author")
+
+	rr := httptest.NewRecorder()
+	handler.TusUploads(rr, req)
+
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	mockUploadService.AssertExpectations(t)
+}
+
+func TestAttachTusUploadHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		mockSetup      func(*MockUploadService)
+		expectedStatus int
+	}{
+		{
+			name: "Успешное добавление изображения",
+			mockSetup: func(service *MockUploadService) {
+				service.On("AttachUpload", mock.Anything, "upload123", "123", "post123", repository.ImageDetails{}).
+					Return(&models.Image{
+						ImageID:   "img123",
+						PostID:    "post123",
+						ImageURL:  "http://minio/images/posts/post123/photo.png?X-Amz-Signature=abc",
+						CreatedAt: time.Now(),
+					}, &models.TusUpload{
+						UploadID:    "upload123",
+						FileName:    "photo.png",
+						ContentType: "image/png",
+						Length:      10485760,
+					}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name: "Загрузка еще не завершена",
+			mockSetup: func(service *MockUploadService) {
+				service.On("AttachUpload", mock.Anything, "upload123", "123", "post123", repository.ImageDetails{}).
+					Return(nil, nil, errors.New("загрузка еще не завершена"))
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name: "Загрузка не найдена",
+			mockSetup: func(service *MockUploadService) {
+				service.On("AttachUpload", mock.Anything, "upload123", "123", "post123", repository.ImageDetails{}).
+					Return(nil, nil, errors.New("загрузка не найдена"))
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUploadService := new(MockUploadService)
+			mockPostRepo := new(MockPostRepository)
+			mockPostRepo.On("GetByID", mock.Anything, "post123").
+				Return(&models.Post{PostID: "post123", AuthorID: "123"}, nil)
+			tt.mockSetup(mockUploadService)
+
+			handler := newTusTestHandler(mockUploadService, mockPostRepo)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/posts/post123/images/tus/upload123", nil)
+			req = withUser(req, "123", "Author")
+
+			rr := httptest.NewRecorder()
+			handler.AttachTusUpload(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			mockUploadService.AssertExpectations(t)
+		})
+	}
+}
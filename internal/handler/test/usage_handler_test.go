@@ -0,0 +1,66 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	handlers "microblogCPT/internal/handler"
+	"microblogCPT/internal/models"
+	"microblogCPT/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetUsageHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		mockSetup      func(*MockUsageService)
+		expectedStatus int
+		expectedBytes  int64
+	}{
+		{
+			name: "Использование с квотой",
+			mockSetup: func(usageService *MockUsageService) {
+				usageService.On("GetUsage", mock.Anything, "123").Return(&service.UsageReport{
+					Usage: &models.StorageUsage{UserID: "123", Role: "Author", Bytes: 3072, Objects: 2},
+					Quota: &models.StorageQuota{MaxBytes: 1 << 30, MaxObjects: 1000},
+					Posts: []models.PostStorageUsage{{PostID: "post1", Bytes: 3072, Objects: 2}},
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBytes:  3072,
+		},
+		{
+			name: "Ошибка сервиса",
+			mockSetup: func(usageService *MockUsageService) {
+				usageService.On("GetUsage", mock.Anything, "123").Return(nil, errors.New("database error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUsageService := new(MockUsageService)
+			tt.mockSetup(mockUsageService)
+
+			handler := &handlers.Handlers{UsageService: mockUsageService}
+
+			req := withUser(httptest.NewRequest(http.MethodGet, "/api/me/usage", nil), "123", "Author")
+			rr := httptest.NewRecorder()
+			handler.GetUsage(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedStatus == http.StatusOK {
+				var response handlers.UsageResponse
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+				assert.Equal(t, tt.expectedBytes, response.Bytes)
+				assert.Equal(t, 1000, response.Quota.MaxObjects)
+				assert.Len(t, response.Posts, 1)
+			}
+			mockUsageService.AssertExpectations(t)
+		})
+	}
+}
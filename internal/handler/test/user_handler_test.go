@@ -66,6 +66,8 @@ func TestGetCurrentUserHandler(t *testing.T) {
 			mockPostRepo := new(MockPostRepository)
 
 			tt.mockSetup(mockUserRepo)
+			mockUserService.On("GetProfileImages", mock.Anything, mock.Anything).
+				Return(&models.ProfileImages{}, nil).Maybe()
 
 			cfg := &config.Config{}
 			handler := &handlers.Handlers{
@@ -102,6 +104,7 @@ func TestGetUserHandler(t *testing.T) {
 		contextValues  map[string]interface{}
 		mockSetup      func(*MockUserRepository)
 		expectedStatus int
+		expectedEmail  string
 	}{
 		{
 			name:    "Автор получает другого пользователя",
@@ -136,6 +139,7 @@ func TestGetUserHandler(t *testing.T) {
 					}, nil)
 			},
 			expectedStatus: http.StatusOK,
+			expectedEmail:  "test@example.com",
 		},
 		{
 			name:    "Reader пытается получить другого пользователя",
@@ -158,6 +162,8 @@ func TestGetUserHandler(t *testing.T) {
 			mockPostRepo := new(MockPostRepository)
 
 			tt.mockSetup(mockUserRepo)
+			mockUserService.On("GetProfileImages", mock.Anything, mock.Anything).
+				Return(&models.ProfileImages{}, nil).Maybe()
 
 			cfg := &config.Config{}
 			handler := &handlers.Handlers{
@@ -182,6 +188,16 @@ func TestGetUserHandler(t *testing.T) {
 			handler.GetUser(rr, req)
 
 			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedStatus == http.StatusOK {
+				// the email is shown only to the user itself
+				var response map[string]interface{}
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+				if tt.expectedEmail == "" {
+					assert.NotContains(t, response, "email")
+				} else {
+					assert.Equal(t, tt.expectedEmail, response["email"])
+				}
+			}
 			mockUserRepo.AssertExpectations(t)
 		})
 	}
@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"microblogCPT/internal/repository"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// resumable uploads follow tus 1.0.0: the core protocol with the creation and termination extensions
+const (
+	tusVersion          = "1.0.0"
+	tusExtensions       = "creation,termination"
+	tusUploadsPath      = "/api/uploads/"
+	tusChunkContentType = "application/offset+octet-stream"
+)
+
+// TusUploads serves /api/uploads/ and /api/uploads/{id}
+func (h *Handlers) TusUploads(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+
+	uploadID := strings.TrimPrefix(r.URL.Path, tusUploadsPath)
+	if strings.Contains(uploadID, "/") {
+		WriteError(w, "Неверный URL", http.StatusBadRequest)
+		return
+	}
+
+	// OPTIONS describes the server and is the only request without the version header
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Tus-Version", tusVersion)
+		w.Header().Set("Tus-Extension", tusExtensions)
+		w.Header().Set("Tus-Max-Size", strconv.FormatInt(h.Cfg.TusMaxSize, 10))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		WriteError(w, "Неподдерживаемая версия tus", http.StatusPreconditionFailed)
+		return
+	}
+
+	// checking the user's role
+	userRole, ok := r.Context().Value("role").(string)
+	if !ok || userRole != "Author" {
+		WriteError(w, "Доступ запрещен", http.StatusForbidden)
+		return
+	}
+
+	if uploadID == "" {
+		if r.Method != http.MethodPost {
+			WriteError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.createTusUpload(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodHead:
+		h.headTusUpload(w, r, uploadID)
+	case http.MethodPatch:
+		h.patchTusUpload(w, r, uploadID)
+	case http.MethodDelete:
+		h.deleteTusUpload(w, r, uploadID)
+	default:
+		WriteError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handlers) createTusUpload(w http.ResponseWriter, r *http.Request) {
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		WriteError(w, "Неверный заголовок Upload-Length", http.StatusBadRequest)
+		return
+	}
+
+	if length > h.Cfg.TusMaxSize {
+		WriteError(w, "Файл слишком большой", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	metadata, err := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		WriteError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// the upload becomes an image of a post, so only image types are accepted
+	if !allowedImageTypes[metadata["filetype"]] {
+		WriteError(w, "Неподдерживаемый тип файла. Разрешены: JPEG, PNG, GIF, WebP", http.StatusBadRequest)
+		return
+	}
+
+	authorID, _ := r.Context().Value("userID").(string)
+
+	upload, err := h.UploadService.CreateUpload(r.Context(), repository.CreateTusUploadRequest{
+		AuthorID:    authorID,
+		FileName:    metadata["filename"],
+		ContentType: metadata["filetype"],
+		Length:      length,
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "размер файла превышает") {
+			WriteError(w, err.Error(), http.StatusRequestEntityTooLarge)
+		} else if isQuotaExceeded(err) {
+			WriteError(w, err.Error(), http.StatusForbidden)
+		} else {
+			WriteError(w, "Ошибка создания загрузки", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Location", tusUploadsPath+upload.UploadID)
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (h *Handlers) headTusUpload(w http.ResponseWriter, r *http.Request, uploadID string) {
+	authorID, _ := r.Context().Value("userID").(string)
+
+	upload, err := h.UploadService.GetUpload(r.Context(), uploadID, authorID)
+	if err != nil {
+		if strings.Contains(err.Error(), "не найдена") {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// a HEAD response has no body
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handlers) patchTusUpload(w http.ResponseWriter, r *http.Request, uploadID string) {
+	if r.Header.Get("Content-Type") != tusChunkContentType {
+		WriteError(w, "Ожидается Content-Type "+tusChunkContentType, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		WriteError(w, "Неверный заголовок Upload-Offset", http.StatusBadRequest)
+		return
+	}
+
+	authorID, _ := r.Context().Value("userID").(string)
+
+	upload, err := h.UploadService.WriteChunk(r.Context(), uploadID, authorID, offset, r.Body)
+	if err != nil {
+		if strings.Contains(err.Error(), "не найдена") {
+			WriteError(w, "Загрузка не найдена", http.StatusNotFound)
+		} else if strings.Contains(err.Error(), "неверное смещение") || strings.Contains(err.Error(), "смещение загрузки изменилось") {
+			WriteError(w, "Смещение не совпадает с сохраненным", http.StatusConflict)
+		} else if strings.Contains(err.Error(), "уже выполняется") {
+			WriteError(w, "Загрузка уже выполняется", http.StatusLocked)
+		} else {
+			if upload != nil {
+				w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+			}
+			WriteError(w, "Ошибка записи загрузки", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handlers) deleteTusUpload(w http.ResponseWriter, r *http.Request, uploadID string) {
+	authorID, _ := r.Context().Value("userID").(string)
+
+	err := h.UploadService.TerminateUpload(r.Context(), uploadID, authorID)
+	if err != nil {
+		if strings.Contains(err.Error(), "не найдена") {
+			WriteError(w, "Загрузка не найдена", http.StatusNotFound)
+		} else {
+			WriteError(w, "Ошибка удаления загрузки", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AttachTusUpload adds the finished resumable upload to the images of the post
+func (h *Handlers) AttachTusUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		WriteError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// check url
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) < 7 || pathParts[4] != "images" || pathParts[5] != "tus" {
+		WriteError(w, "Неверный URL", http.StatusBadRequest)
+		return
+	}
+	postID := pathParts[3]
+	uploadID := pathParts[6]
+
+	authorID, ok := h.checkImageAccess(w, r, postID)
+	if !ok {
+		return
+	}
+
+	details, err := decodeImageDetails(r)
+	if err != nil {
+		WriteError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	image, upload, err := h.UploadService.AttachUpload(r.Context(), uploadID, authorID, postID, details)
+	if err != nil {
+		if strings.Contains(err.Error(), "не найдена") {
+			WriteError(w, "Загрузка не найдена", http.StatusNotFound)
+		} else if strings.Contains(err.Error(), "не завершена") {
+			WriteError(w, "Загрузка еще не завершена", http.StatusConflict)
+		} else if isQuotaExceeded(err) {
+			WriteError(w, err.Error(), http.StatusForbidden)
+		} else if strings.Contains(err.Error(), "не совпадает") || isInvalidImage(err) {
+			WriteError(w, err.Error(), http.StatusUnprocessableEntity)
+		} else {
+			WriteError(w, "Ошибка добавления изображения", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// forming the response
+	response := newImageResponse(image, upload.FileName, upload.Length)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// parseTusMetadata decodes Upload-Metadata: comma separated pairs of a key and a base64 value
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+
+	for _, pair := range splitList(header) {
+		key, encoded, _ := strings.Cut(pair, " ")
+
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, errors.New("Неверный заголовок Upload-Metadata")
+		}
+		metadata[key] = string(value)
+	}
+
+	return metadata, nil
+}
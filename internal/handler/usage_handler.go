@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"encoding/json"
+	"microblogCPT/internal/models"
+	"net/http"
+	"strings"
+)
+
+type UsageResponse struct {
+	Bytes   int64                     `json:"bytes"`
+	Objects int                       `json:"objects"`
+	Quota   *models.StorageQuota      `json:"quota"`
+	Posts   []models.PostStorageUsage `json:"posts"`
+}
+
+// GetUsage returns the space taken by the images of the current user, its quota and the usage of every post
+func (h *Handlers) GetUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value("userID").(string)
+	if !ok {
+		WriteError(w, "Требуется аутентификация", http.StatusUnauthorized)
+		return
+	}
+
+	report, err := h.UsageService.GetUsage(r.Context(), userID)
+	if err != nil {
+		if strings.Contains(err.Error(), "не найден") {
+			WriteError(w, "Пользователь не найден", http.StatusNotFound)
+		} else {
+			WriteError(w, "Ошибка получения использования хранилища", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	response := UsageResponse{
+		Bytes:   report.Usage.Bytes,
+		Objects: report.Usage.Objects,
+		Quota:   report.Quota,
+		Posts:   report.Posts,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
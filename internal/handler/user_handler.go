@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"microblogCPT/internal/models"
 	"microblogCPT/internal/repository"
 	"net/http"
 	"regexp"
@@ -9,10 +10,16 @@ import (
 	"strings"
 )
 
+// UserResponse describes the account, the email is left out when another user asks
 type UserResponse struct {
-	UserId string `json:"userId"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
+	UserId      string   `json:"userId"`
+	Email       string   `json:"email,omitempty"`
+	Role        string   `json:"role"`
+	Handle      string   `json:"handle"`
+	DisplayName string   `json:"displayName"`
+	Bio         string   `json:"bio"`
+	Links       []string `json:"links"`
+	models.ProfileImages
 }
 
 type MessageResponse struct {
@@ -50,12 +57,14 @@ func (h *Handlers) GetUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response := UserResponse{
-		UserId: userID,
-		Email:  user.Email,
-		Role:   user.Role,
+	images, err := h.UserService.GetProfileImages(r.Context(), userID)
+	if err != nil {
+		WriteError(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
+	response := newUserResponse(user, images, userID == currentUserID)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
@@ -183,13 +192,15 @@ func (h *Handlers) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// forming the response
-	response := UserResponse{
-		UserId: userID,
-		Email:  user.Email,
-		Role:   user.Role,
+	images, err := h.UserService.GetProfileImages(r.Context(), userID)
+	if err != nil {
+		WriteError(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
+	// forming the response
+	response := newUserResponse(user, images, true)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
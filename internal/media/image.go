@@ -0,0 +1,163 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// sniffLen is the number of bytes http.DetectContentType looks at
+const sniffLen = 512
+
+// Limits bounds the dimensions of an accepted image. The pixel count guards against decompression bombs:
+// a small file that declares a huge canvas
+type Limits struct {
+	MaxWidth  int
+	MaxHeight int
+	MaxPixels int
+}
+
+// ImageInfo describes an image detected from its content
+type ImageInfo struct {
+	MimeType string
+	Width    int
+	Height   int
+}
+
+// extensions lists the file extensions allowed for each supported type
+var extensions = map[string][]string{
+	"image/jpeg": {".jpg", ".jpeg"},
+	"image/png":  {".png"},
+	"image/gif":  {".gif"},
+	"image/webp": {".webp"},
+}
+
+// Extension returns the canonical file extension of the type
+func Extension(mimeType string) string {
+	if exts, ok := extensions[mimeType]; ok {
+		return exts[0]
+	}
+	return ""
+}
+
+// Inspect detects the image type from the magic bytes, reads the dimensions from the image header
+// and checks them against the limits. Only the header is decoded, so the pixels are never allocated.
+// The returned reader yields the whole file including the bytes consumed by the inspection
+func Inspect(file io.Reader, fileName string, limits Limits) (*ImageInfo, io.Reader, error) {
+	var consumed bytes.Buffer
+	tee := io.TeeReader(file, &consumed)
+
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(tee, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, nil, fmt.Errorf("ошибка чтения файла: %w", err)
+	}
+	head = head[:n]
+
+	mimeType := http.DetectContentType(head)
+	exts, ok := extensions[mimeType]
+	if !ok {
+		return nil, nil, errors.New("неподдерживаемый тип файла")
+	}
+
+	// a file without an extension gets one from its content later, a wrong one is rejected
+	ext := strings.ToLower(filepath.Ext(fileName))
+	if ext != "" && !contains(exts, ext) {
+		return nil, nil, fmt.Errorf("расширение файла %s не совпадает с типом изображения %s", ext, mimeType)
+	}
+
+	width, height, err := decodeDimensions(mimeType, io.MultiReader(bytes.NewReader(head), tee))
+	if err != nil {
+		return nil, nil, errors.New("не удалось прочитать изображение")
+	}
+
+	if err := limits.check(width, height); err != nil {
+		return nil, nil, err
+	}
+
+	info := &ImageInfo{MimeType: mimeType, Width: width, Height: height}
+	return info, io.MultiReader(&consumed, file), nil
+}
+
+func (l Limits) check(width, height int) error {
+	if width <= 0 || height <= 0 {
+		return errors.New("не удалось прочитать изображение")
+	}
+
+	if (l.MaxWidth > 0 && width > l.MaxWidth) || (l.MaxHeight > 0 && height > l.MaxHeight) {
+		return fmt.Errorf("размеры изображения %dx%d превышают допустимые %dx%d", width, height, l.MaxWidth, l.MaxHeight)
+	}
+
+	if l.MaxPixels > 0 && int64(width)*int64(height) > int64(l.MaxPixels) {
+		return fmt.Errorf("размеры изображения %dx%d превышают допустимые %d пикселей", width, height, l.MaxPixels)
+	}
+
+	return nil
+}
+
+func decodeDimensions(mimeType string, r io.Reader) (int, int, error) {
+	// the standard library has no WebP decoder, its header is simple enough to read directly
+	if mimeType == "image/webp" {
+		return webpDimensions(r)
+	}
+
+	config, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return 0, 0, err
+	}
+	return config.Width, config.Height, nil
+}
+
+// webpDimensions reads the canvas size from the first chunk of a RIFF WebP file:
+// VP8 (lossy), VP8L (lossless) or VP8X (extended)
+func webpDimensions(r io.Reader) (int, int, error) {
+	header := make([]byte, 30)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, 0, err
+	}
+
+	switch string(header[12:16]) {
+	case "VP8 ":
+		// the key frame starts with a start code 9d 01 2a followed by 14-bit width and height
+		if !bytes.Equal(header[23:26], []byte{0x9d, 0x01, 0x2a}) {
+			return 0, 0, errors.New("неверный заголовок VP8")
+		}
+		width := int(binary.LittleEndian.Uint16(header[26:28]) & 0x3fff)
+		height := int(binary.LittleEndian.Uint16(header[28:30]) & 0x3fff)
+		return width, height, nil
+	case "VP8L":
+		// the signature byte 2f is followed by 14-bit width-1 and height-1
+		if header[20] != 0x2f {
+			return 0, 0, errors.New("неверный заголовок VP8L")
+		}
+		bits := binary.LittleEndian.Uint32(header[21:25])
+		width := int(bits&0x3fff) + 1
+		height := int((bits>>14)&0x3fff) + 1
+		return width, height, nil
+	case "VP8X":
+		// 24-bit canvas width-1 and height-1
+		width := int(uint32(header[24])|uint32(header[25])<<8|uint32(header[26])<<16) + 1
+		height := int(uint32(header[27])|uint32(header[28])<<8|uint32(header[29])<<16) + 1
+		return width, height, nil
+	}
+
+	return 0, 0, errors.New("неизвестный формат WebP")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,448 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"sort"
+	"strings"
+)
+
+// MetadataOptions configures how the metadata of an uploaded image is handled
+type MetadataOptions struct {
+	// Strip removes EXIF, XMP, IPTC and text metadata, with GPS coordinates and camera serial numbers
+	Strip bool
+	// Keep lists the fields preserved when stripping: copyright, artist, description
+	Keep []string
+	// Quality is used when a JPEG has to be re-encoded to apply its orientation
+	Quality int
+}
+
+// metadataField is a preserved field: its EXIF tag and its PNG text keyword
+type metadataField struct {
+	tag     uint16
+	keyword string
+}
+
+var metadataFields = map[string]metadataField{
+	"description": {tag: 0x010e, keyword: "Description"},
+	"artist":      {tag: 0x013b, keyword: "Author"},
+	"copyright":   {tag: 0x8298, keyword: "Copyright"},
+}
+
+const exifOrientationTag = 0x0112
+
+// exifHeader starts the APP1 segment of a JPEG with EXIF data
+var exifHeader = []byte("Exif\x00\x00")
+
+// Sanitize removes the metadata of the image and returns the new content together with the image info,
+// whose dimensions change if a JPEG is turned upright by its EXIF orientation. GIF files are returned as is
+func Sanitize(data []byte, info *ImageInfo, opts MetadataOptions) ([]byte, *ImageInfo, error) {
+	if !opts.Strip {
+		return data, info, nil
+	}
+
+	var (
+		result []byte
+		err    error
+	)
+	sanitized := *info
+
+	switch info.MimeType {
+	case "image/jpeg":
+		result, err = sanitizeJPEG(data, &sanitized, opts)
+	case "image/png":
+		result, err = sanitizePNG(data, opts)
+	case "image/webp":
+		result, err = sanitizeWebP(data, opts)
+	default:
+		return data, info, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("не удалось удалить метаданные: %w", err)
+	}
+
+	return result, &sanitized, nil
+}
+
+// keptFields returns the preserved fields by their EXIF tag
+func keptFields(opts MetadataOptions) map[uint16]metadataField {
+	fields := map[uint16]metadataField{}
+	for _, name := range opts.Keep {
+		if field, ok := metadataFields[strings.ToLower(strings.TrimSpace(name))]; ok {
+			fields[field.tag] = field
+		}
+	}
+	return fields
+}
+
+// sanitizeJPEG keeps the segments needed to display the image (JFIF, ICC profile, Adobe) and drops
+// EXIF, XMP, IPTC and comments. The compressed data is copied as is unless the image has to be rotated
+func sanitizeJPEG(data []byte, info *ImageInfo, opts MetadataOptions) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return nil, errors.New("неверный заголовок JPEG")
+	}
+
+	var (
+		kept        [][]byte
+		iccProfile  [][]byte
+		exifTags    map[uint16]string
+		orientation = 1
+		pos         = 2
+	)
+
+	for {
+		if pos+4 > len(data) || data[pos] != 0xff {
+			return nil, errors.New("неверная структура JPEG")
+		}
+		marker := data[pos+1]
+
+		// fill bytes before a marker
+		if marker == 0xff {
+			pos++
+			continue
+		}
+
+		// the entropy-coded data follows the start of scan, there is no metadata after it
+		if marker == 0xda {
+			break
+		}
+
+		length := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, errors.New("неверная длина сегмента JPEG")
+		}
+		segment := data[pos:end]
+		payload := data[pos+4 : end]
+
+		switch {
+		case marker == 0xe1 && bytes.HasPrefix(payload, exifHeader):
+			exifTags, orientation = parseExif(payload[len(exifHeader):], keptFields(opts))
+		case marker == 0xe2:
+			iccProfile = append(iccProfile, segment)
+			kept = append(kept, segment)
+		case marker == 0xe0 || marker == 0xee:
+			kept = append(kept, segment)
+		case marker >= 0xe1 && marker <= 0xef, marker == 0xfe:
+			// XMP, IPTC, other application data and comments
+		default:
+			kept = append(kept, segment)
+		}
+
+		pos = end
+	}
+
+	var exifSegment []byte
+	if len(exifTags) > 0 {
+		tiff := buildExif(exifTags)
+		exifSegment = make([]byte, 4, 4+len(exifHeader)+len(tiff))
+		exifSegment[0], exifSegment[1] = 0xff, 0xe1
+		binary.BigEndian.PutUint16(exifSegment[2:], uint16(2+len(exifHeader)+len(tiff)))
+		exifSegment = append(exifSegment, exifHeader...)
+		exifSegment = append(exifSegment, tiff...)
+	}
+
+	// the orientation tag is gone with the EXIF, so the pixels are turned upright instead
+	if orientation > 1 && orientation <= 8 {
+		src, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+
+		upright := Orient(src, orientation)
+		encoded, err := EncodeJPEG(upright, opts.Quality)
+		if err != nil {
+			return nil, err
+		}
+
+		info.Width, info.Height = upright.Bounds().Dx(), upright.Bounds().Dy()
+
+		// the encoder writes its own tables, only the color profile and the preserved fields are carried over
+		out := append([]byte{}, encoded[:2]...)
+		out = append(out, exifSegment...)
+		for _, segment := range iccProfile {
+			out = append(out, segment...)
+		}
+		return append(out, encoded[2:]...), nil
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:2]...)
+
+	// JFIF expects its APP0 segment right after the start of image
+	if len(kept) > 0 && kept[0][1] == 0xe0 {
+		out = append(out, kept[0]...)
+		kept = kept[1:]
+	}
+	out = append(out, exifSegment...)
+	for _, segment := range kept {
+		out = append(out, segment...)
+	}
+	return append(out, data[pos:]...), nil
+}
+
+// parseExif reads the orientation and the preserved text fields from IFD0 of a TIFF structure
+func parseExif(tiff []byte, fields map[uint16]metadataField) (map[uint16]string, int) {
+	tags := map[uint16]string{}
+	orientation := 1
+
+	if len(tiff) < 8 {
+		return tags, orientation
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return tags, orientation
+	}
+
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd+2 > len(tiff) {
+		return tags, orientation
+	}
+
+	count := int(order.Uint16(tiff[ifd : ifd+2]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			break
+		}
+
+		tag := order.Uint16(tiff[entry : entry+2])
+		valueType := order.Uint16(tiff[entry+2 : entry+4])
+		valueCount := int(order.Uint32(tiff[entry+4 : entry+8]))
+
+		// SHORT
+		if tag == exifOrientationTag && valueType == 3 {
+			orientation = int(order.Uint16(tiff[entry+8 : entry+10]))
+			continue
+		}
+
+		// ASCII, stored inline when it fits into four bytes
+		if _, ok := fields[tag]; !ok || valueType != 2 || valueCount == 0 {
+			continue
+		}
+		start := entry + 8
+		if valueCount > 4 {
+			start = int(order.Uint32(tiff[entry+8 : entry+12]))
+		}
+		if start < 0 || start+valueCount > len(tiff) {
+			continue
+		}
+		tags[tag] = strings.TrimRight(string(tiff[start:start+valueCount]), "\x00")
+	}
+
+	return tags, orientation
+}
+
+// buildExif writes a little-endian TIFF structure with a single IFD of text fields
+func buildExif(tags map[uint16]string) []byte {
+	keys := make([]uint16, 0, len(tags))
+	for tag := range tags {
+		keys = append(keys, tag)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	order := binary.LittleEndian
+	ifdSize := 2 + len(keys)*12 + 4
+	out := make([]byte, 8+ifdSize)
+	copy(out, "II")
+	order.PutUint16(out[2:], 42)
+	order.PutUint32(out[4:], 8)
+	order.PutUint16(out[8:], uint16(len(keys)))
+
+	for i, tag := range keys {
+		value := append([]byte(tags[tag]), 0)
+		entry := 10 + i*12
+
+		order.PutUint16(out[entry:], tag)
+		order.PutUint16(out[entry+2:], 2)
+		order.PutUint32(out[entry+4:], uint32(len(value)))
+		if len(value) <= 4 {
+			copy(out[entry+8:], value)
+			continue
+		}
+
+		order.PutUint32(out[entry+8:], uint32(len(out)))
+		out = append(out, value...)
+		// values start on a word boundary
+		if len(out)%2 == 1 {
+			out = append(out, 0)
+		}
+	}
+
+	return out
+}
+
+// Orient turns the image upright according to the EXIF orientation from 1 to 8
+func Orient(src image.Image, orientation int) *image.RGBA {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	flat := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(flat, flat.Bounds(), src, bounds.Min, draw.Src)
+
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = width-1-x, y
+			case 3:
+				dx, dy = width-1-x, height-1-y
+			case 4:
+				dx, dy = x, height-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = height-1-y, x
+			case 7:
+				dx, dy = height-1-y, width-1-x
+			case 8:
+				dx, dy = y, width-1-x
+			default:
+				dx, dy = x, y
+			}
+
+			copy(dst.Pix[dy*dst.Stride+dx*4:dy*dst.Stride+dx*4+4], flat.Pix[y*flat.Stride+x*4:y*flat.Stride+x*4+4])
+		}
+	}
+
+	return dst
+}
+
+// pngSignature starts every PNG file
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// sanitizePNG drops the EXIF, time and text chunks, text chunks of the preserved fields are kept
+func sanitizePNG(data []byte, opts MetadataOptions) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errors.New("неверный заголовок PNG")
+	}
+
+	keywords := map[string]bool{}
+	for _, field := range keptFields(opts) {
+		keywords[field.keyword] = true
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, pngSignature...)
+
+	pos := len(pngSignature)
+	for pos < len(data) {
+		if pos+8 > len(data) {
+			return nil, errors.New("неверная структура PNG")
+		}
+		length := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		chunkType := string(data[pos+4 : pos+8])
+		end := pos + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, errors.New("неверная длина блока PNG")
+		}
+
+		drop := false
+		switch chunkType {
+		case "eXIf", "tIME":
+			drop = true
+		case "tEXt", "zTXt", "iTXt":
+			// the keyword ends with a zero byte
+			keyword, _, _ := bytes.Cut(data[pos+8:end-4], []byte{0})
+			drop = !keywords[string(keyword)]
+		}
+		if !drop {
+			out = append(out, data[pos:end]...)
+		}
+
+		pos = end
+		if chunkType == "IEND" {
+			break
+		}
+	}
+
+	return out, nil
+}
+
+// VP8X flags of the metadata chunks
+const (
+	webpFlagEXIF = 0x08
+	webpFlagXMP  = 0x04
+)
+
+// sanitizeWebP drops the XMP chunk and rebuilds the EXIF chunk from the preserved fields only
+func sanitizeWebP(data []byte, opts MetadataOptions) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errors.New("неверный заголовок WebP")
+	}
+
+	fields := keptFields(opts)
+	var chunks [][]byte
+	var exifTags map[uint16]string
+	vp8x := -1
+
+	pos := 12
+	for pos+8 <= len(data) {
+		fourCC := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		end := pos + 8 + size + size%2
+		if size < 0 || pos+8+size > len(data) {
+			return nil, errors.New("неверная длина блока WebP")
+		}
+		if end > len(data) {
+			end = len(data)
+		}
+
+		switch fourCC {
+		case "EXIF":
+			exifTags, _ = parseExif(bytes.TrimPrefix(data[pos+8:pos+8+size], exifHeader), fields)
+		case "XMP ":
+		default:
+			if fourCC == "VP8X" {
+				vp8x = len(chunks)
+			}
+			chunks = append(chunks, append([]byte{}, data[pos:end]...))
+		}
+
+		pos = end
+	}
+
+	// the simple format has no place for metadata, so the fields are only kept in the extended one
+	if vp8x >= 0 {
+		chunks[vp8x][8] &^= webpFlagEXIF | webpFlagXMP
+		if len(exifTags) > 0 {
+			tiff := buildExif(exifTags)
+			chunk := make([]byte, 8, 8+len(tiff)+1)
+			copy(chunk, "EXIF")
+			binary.LittleEndian.PutUint32(chunk[4:], uint32(len(tiff)))
+			chunk = append(chunk, tiff...)
+			if len(tiff)%2 == 1 {
+				chunk = append(chunk, 0)
+			}
+			chunks = append(chunks, chunk)
+			chunks[vp8x][8] |= webpFlagEXIF
+		}
+	}
+
+	out := make([]byte, 12, len(data))
+	copy(out, data[:12])
+	for _, chunk := range chunks {
+		out = append(out, chunk...)
+	}
+	binary.LittleEndian.PutUint32(out[4:8], uint32(len(out)-8))
+
+	return out, nil
+}
@@ -0,0 +1,104 @@
+package media
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+)
+
+// Decode reads the pixels of a JPEG, PNG or GIF image. WebP can not be decoded with the standard library
+func Decode(r io.Reader) (image.Image, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось декодировать изображение: %w", err)
+	}
+	return img, nil
+}
+
+// Resize scales the image down to the width keeping the aspect ratio. Every pixel of the result is
+// the average of the source pixels it covers, a box filter that is good enough for downscaling.
+// Transparent areas are put on a white background, since the variants are encoded as JPEG
+func Resize(src image.Image, width int) *image.RGBA {
+	bounds := src.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+
+	height := (srcHeight*width + srcWidth/2) / srcWidth
+	if height < 1 {
+		height = 1
+	}
+
+	flat := image.NewRGBA(image.Rect(0, 0, srcWidth, srcHeight))
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), src, bounds.Min, draw.Over)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := span(y, height, srcHeight)
+
+		for x := 0; x < width; x++ {
+			x0, x1 := span(x, width, srcWidth)
+
+			var r, g, b, a, count uint64
+			for sy := y0; sy < y1; sy++ {
+				row := flat.Pix[sy*flat.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					pixel := row[sx*4 : sx*4+4]
+					r += uint64(pixel[0])
+					g += uint64(pixel[1])
+					b += uint64(pixel[2])
+					a += uint64(pixel[3])
+					count++
+				}
+			}
+
+			offset := y*dst.Stride + x*4
+			dst.Pix[offset] = uint8(r / count)
+			dst.Pix[offset+1] = uint8(g / count)
+			dst.Pix[offset+2] = uint8(b / count)
+			dst.Pix[offset+3] = uint8(a / count)
+		}
+	}
+
+	return dst
+}
+
+// Crop cuts the largest centered part of the image with the aspect ratio ratioW:ratioH
+func Crop(src image.Image, ratioW, ratioH int) *image.RGBA {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	if width*ratioH > height*ratioW {
+		width = max(height*ratioW/ratioH, 1)
+	} else {
+		height = max(width*ratioH/ratioW, 1)
+	}
+
+	offset := image.Pt(bounds.Min.X+(bounds.Dx()-width)/2, bounds.Min.Y+(bounds.Dy()-height)/2)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), src, offset, draw.Src)
+	return dst
+}
+
+// span returns the source range covered by the destination pixel i out of n, never empty
+func span(i, n, srcSize int) (int, int) {
+	start := i * srcSize / n
+	end := (i + 1) * srcSize / n
+	if end <= start {
+		end = start + 1
+	}
+	return start, end
+}
+
+// EncodeJPEG encodes the image with the quality from 1 to 100
+func EncodeJPEG(img image.Image, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, fmt.Errorf("ошибка кодирования JPEG: %w", err)
+	}
+	return buf.Bytes(), nil
+}
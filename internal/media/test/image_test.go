@@ -0,0 +1,126 @@
+package test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"microblogCPT/internal/media"
+	"testing"
+)
+
+func pngBytes(t *testing.T, width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	img.Set(0, 0, color.RGBA{R: 255, A: 255})
+
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+// webpBytes builds the header of a lossless WebP with the given canvas size
+func webpBytes(width, height int) []byte {
+	data := make([]byte, 30)
+	copy(data[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(data[4:8], 22)
+	copy(data[8:12], "WEBP")
+	copy(data[12:16], "VP8L")
+	binary.LittleEndian.PutUint32(data[16:20], 10)
+	data[20] = 0x2f
+	binary.LittleEndian.PutUint32(data[21:25], uint32(width-1)|uint32(height-1)<<14)
+	return data
+}
+
+func TestInspect(t *testing.T) {
+	limits := media.Limits{MaxWidth: 100, MaxHeight: 100, MaxPixels: 5000}
+
+	tests := []struct {
+		name           string
+		data           []byte
+		fileName       string
+		expectedMime   string
+		expectedWidth  int
+		expectedHeight int
+		errorMsg       string
+	}{
+		{
+			name:           "PNG изображение",
+			data:           pngBytes(t, 40, 20),
+			fileName:       "photo.png",
+			expectedMime:   "image/png",
+			expectedWidth:  40,
+			expectedHeight: 20,
+		},
+		{
+			name:           "Файл без расширения",
+			data:           pngBytes(t, 10, 10),
+			fileName:       "photo",
+			expectedMime:   "image/png",
+			expectedWidth:  10,
+			expectedHeight: 10,
+		},
+		{
+			name:           "WebP изображение",
+			data:           webpBytes(64, 32),
+			fileName:       "photo.webp",
+			expectedMime:   "image/webp",
+			expectedWidth:  64,
+			expectedHeight: 32,
+		},
+		{
+			name:     "Текст под видом изображения",
+			data:     []byte("#!/bin/sh\necho hello\n"),
+			fileName: "photo.png",
+			errorMsg: "неподдерживаемый тип файла",
+		},
+		{
+			name:     "Расширение не совпадает с содержимым",
+			data:     pngBytes(t, 10, 10),
+			fileName: "photo.jpg",
+			errorMsg: "не совпадает с типом",
+		},
+		{
+			name:     "Ширина больше допустимой",
+			data:     pngBytes(t, 200, 10),
+			fileName: "photo.png",
+			errorMsg: "размеры изображения",
+		},
+		{
+			name:     "Слишком много пикселей",
+			data:     webpBytes(100, 100),
+			fileName: "photo.webp",
+			errorMsg: "5000 пикселей",
+		},
+		{
+			name:     "Поврежденный заголовок",
+			data:     pngBytes(t, 10, 10)[:20],
+			fileName: "photo.png",
+			errorMsg: "не удалось прочитать изображение",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			info, file, err := media.Inspect(bytes.NewReader(tc.data), tc.fileName, limits)
+
+			if tc.errorMsg != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.errorMsg)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedMime, info.MimeType)
+			assert.Equal(t, tc.expectedWidth, info.Width)
+			assert.Equal(t, tc.expectedHeight, info.Height)
+
+			// the inspection must not lose the bytes it has read
+			content, err := io.ReadAll(file)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.data, content)
+		})
+	}
+}
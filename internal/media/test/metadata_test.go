@@ -0,0 +1,267 @@
+package test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"microblogCPT/internal/media"
+	"testing"
+)
+
+// tiffEntry is a field of the test EXIF: SHORT when text is empty, ASCII otherwise
+type tiffEntry struct {
+	tag   uint16
+	short uint16
+	text  string
+}
+
+// bigEndianTiff builds a big-endian TIFF structure with one IFD
+func bigEndianTiff(entries []tiffEntry) []byte {
+	order := binary.BigEndian
+	out := make([]byte, 8+2+len(entries)*12+4)
+	copy(out, "MM")
+	order.PutUint16(out[2:], 42)
+	order.PutUint32(out[4:], 8)
+	order.PutUint16(out[8:], uint16(len(entries)))
+
+	for i, e := range entries {
+		entry := 10 + i*12
+		order.PutUint16(out[entry:], e.tag)
+		if e.text == "" {
+			order.PutUint16(out[entry+2:], 3)
+			order.PutUint32(out[entry+4:], 1)
+			order.PutUint16(out[entry+8:], e.short)
+			continue
+		}
+
+		value := append([]byte(e.text), 0)
+		order.PutUint16(out[entry+2:], 2)
+		order.PutUint32(out[entry+4:], uint32(len(value)))
+		order.PutUint32(out[entry+8:], uint32(len(out)))
+		out = append(out, value...)
+	}
+
+	return out
+}
+
+func jpegSegment(marker byte, payload []byte) []byte {
+	segment := []byte{0xff, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// photoWithExif encodes a 40x20 JPEG with the orientation, a camera serial number, a copyright and XMP
+func photoWithExif(t *testing.T, orientation uint16) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 40; x++ {
+			img.Set(x, y, color.RGBA{R: 200, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&buf, img, nil))
+	encoded := buf.Bytes()
+
+	exif := append([]byte("Exif\x00\x00"), bigEndianTiff([]tiffEntry{
+		{tag: 0x0112, short: orientation},
+		{tag: 0x8298, text: "ACME Photo 2026"},
+		{tag: 0xa431, text: "SERIAL-0042"},
+	})...)
+	xmp := append([]byte("http://ns.adobe.com/xap/1.0/\x00"), []byte("<x:xmpmeta>GPS 55.75 37.61</x:xmpmeta>")...)
+
+	out := append([]byte{}, encoded[:2]...)
+	out = append(out, jpegSegment(0xe1, exif)...)
+	out = append(out, jpegSegment(0xe1, xmp)...)
+	out = append(out, jpegSegment(0xfe, []byte("shot on SecretCam"))...)
+	return append(out, encoded[2:]...)
+}
+
+func TestSanitize_JPEG(t *testing.T) {
+	tests := []struct {
+		name           string
+		orientation    uint16
+		keep           []string
+		expectedWidth  int
+		expectedHeight int
+		keepsCopyright bool
+	}{
+		{
+			name:           "Метаданные удаляются без перекодирования",
+			orientation:    1,
+			expectedWidth:  40,
+			expectedHeight: 20,
+		},
+		{
+			name:           "Поворот по EXIF",
+			orientation:    6,
+			expectedWidth:  20,
+			expectedHeight: 40,
+		},
+		{
+			name:           "Сохранение авторских прав",
+			orientation:    1,
+			keep:           []string{"copyright"},
+			expectedWidth:  40,
+			expectedHeight: 20,
+			keepsCopyright: true,
+		},
+		{
+			name:           "Сохранение авторских прав при повороте",
+			orientation:    8,
+			keep:           []string{"copyright"},
+			expectedWidth:  20,
+			expectedHeight: 40,
+			keepsCopyright: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			data := photoWithExif(t, tc.orientation)
+			info := &media.ImageInfo{MimeType: "image/jpeg", Width: 40, Height: 20}
+
+			result, sanitized, err := media.Sanitize(data, info, media.MetadataOptions{Strip: true, Keep: tc.keep, Quality: 90})
+
+			assert.NoError(t, err)
+			assert.NotContains(t, string(result), "SERIAL-0042")
+			assert.NotContains(t, string(result), "GPS")
+			assert.NotContains(t, string(result), "SecretCam")
+			assert.Equal(t, tc.keepsCopyright, bytes.Contains(result, []byte("ACME Photo 2026")))
+
+			assert.Equal(t, tc.expectedWidth, sanitized.Width)
+			assert.Equal(t, tc.expectedHeight, sanitized.Height)
+
+			config, err := jpeg.DecodeConfig(bytes.NewReader(result))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedWidth, config.Width)
+			assert.Equal(t, tc.expectedHeight, config.Height)
+		})
+	}
+}
+
+func TestSanitize_Disabled(t *testing.T) {
+	data := photoWithExif(t, 6)
+	info := &media.ImageInfo{MimeType: "image/jpeg", Width: 40, Height: 20}
+
+	result, sanitized, err := media.Sanitize(data, info, media.MetadataOptions{Strip: false})
+
+	assert.NoError(t, err)
+	assert.Equal(t, data, result)
+	assert.Equal(t, 40, sanitized.Width)
+}
+
+func pngChunk(chunkType string, payload []byte) []byte {
+	chunk := make([]byte, 8, 12+len(payload))
+	binary.BigEndian.PutUint32(chunk, uint32(len(payload)))
+	copy(chunk[4:], chunkType)
+	chunk = append(chunk, payload...)
+	// the checksum is not verified by the sanitizer
+	return append(chunk, 0, 0, 0, 0)
+}
+
+func TestSanitize_PNG(t *testing.T) {
+	original := pngBytes(t, 4, 4)
+
+	// text chunks go right after IHDR: signature (8) + IHDR (25)
+	data := append([]byte{}, original[:33]...)
+	data = append(data, pngChunk("tEXt", []byte("Copyright\x00ACME Photo 2026"))...)
+	data = append(data, pngChunk("tEXt", []byte("Comment\x00GPS 55.75 37.61"))...)
+	data = append(data, pngChunk("eXIf", []byte("MM\x00\x2aSERIAL-0042"))...)
+	data = append(data, original[33:]...)
+
+	info := &media.ImageInfo{MimeType: "image/png", Width: 4, Height: 4}
+	result, _, err := media.Sanitize(data, info, media.MetadataOptions{Strip: true, Keep: []string{"copyright"}})
+
+	assert.NoError(t, err)
+	assert.Contains(t, string(result), "ACME Photo 2026")
+	assert.NotContains(t, string(result), "GPS")
+	assert.NotContains(t, string(result), "SERIAL-0042")
+	assert.Equal(t, original, bytes.Replace(result, pngChunk("tEXt", []byte("Copyright\x00ACME Photo 2026")), nil, 1))
+}
+
+func webpChunk(fourCC string, payload []byte) []byte {
+	chunk := make([]byte, 8, 9+len(payload))
+	copy(chunk, fourCC)
+	binary.LittleEndian.PutUint32(chunk[4:], uint32(len(payload)))
+	chunk = append(chunk, payload...)
+	if len(payload)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+func TestSanitize_WebP(t *testing.T) {
+	vp8x := make([]byte, 10)
+	vp8x[0] = 0x08 | 0x04
+
+	body := []byte("WEBP")
+	body = append(body, webpChunk("VP8X", vp8x)...)
+	body = append(body, webpChunk("VP8L", webpBytes(8, 8)[20:])...)
+	body = append(body, webpChunk("EXIF", bigEndianTiff([]tiffEntry{
+		{tag: 0x8298, text: "ACME Photo 2026"},
+		{tag: 0xa431, text: "SERIAL-0042"},
+	}))...)
+	body = append(body, webpChunk("XMP ", []byte("<x:xmpmeta>GPS 55.75 37.61</x:xmpmeta>"))...)
+
+	data := []byte("RIFF\x00\x00\x00\x00")
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(body)))
+	data = append(data, body...)
+
+	info := &media.ImageInfo{MimeType: "image/webp", Width: 8, Height: 8}
+
+	t.Run("Удаление всех метаданных", func(t *testing.T) {
+		result, _, err := media.Sanitize(data, info, media.MetadataOptions{Strip: true})
+
+		assert.NoError(t, err)
+		assert.NotContains(t, string(result), "SERIAL-0042")
+		assert.NotContains(t, string(result), "ACME")
+		assert.NotContains(t, string(result), "GPS")
+		assert.Equal(t, uint32(len(result)-8), binary.LittleEndian.Uint32(result[4:8]))
+		assert.Equal(t, byte(0), result[20]&(0x08|0x04))
+	})
+
+	t.Run("Сохранение авторских прав", func(t *testing.T) {
+		result, _, err := media.Sanitize(data, info, media.MetadataOptions{Strip: true, Keep: []string{"copyright"}})
+
+		assert.NoError(t, err)
+		assert.Contains(t, string(result), "ACME Photo 2026")
+		assert.NotContains(t, string(result), "SERIAL-0042")
+		assert.Equal(t, byte(0x08), result[20]&(0x08|0x04))
+	})
+}
+
+func TestOrient(t *testing.T) {
+	marked := color.RGBA{R: 255, A: 255}
+
+	// a 4x2 image with the top left pixel marked
+	src := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	src.Set(0, 0, marked)
+
+	tests := []struct {
+		orientation int
+		width       int
+		height      int
+		x, y        int
+	}{
+		{orientation: 1, width: 4, height: 2, x: 0, y: 0},
+		{orientation: 2, width: 4, height: 2, x: 3, y: 0},
+		{orientation: 3, width: 4, height: 2, x: 3, y: 1},
+		{orientation: 4, width: 4, height: 2, x: 0, y: 1},
+		{orientation: 5, width: 2, height: 4, x: 0, y: 0},
+		{orientation: 6, width: 2, height: 4, x: 1, y: 0},
+		{orientation: 7, width: 2, height: 4, x: 1, y: 3},
+		{orientation: 8, width: 2, height: 4, x: 0, y: 3},
+	}
+
+	for _, tc := range tests {
+		dst := media.Orient(src, tc.orientation)
+
+		assert.Equal(t, tc.width, dst.Bounds().Dx(), "orientation %d", tc.orientation)
+		assert.Equal(t, tc.height, dst.Bounds().Dy(), "orientation %d", tc.orientation)
+		assert.Equal(t, marked, dst.RGBAAt(tc.x, tc.y), "orientation %d", tc.orientation)
+	}
+}
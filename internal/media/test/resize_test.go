@@ -0,0 +1,75 @@
+package test
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"microblogCPT/internal/media"
+	"testing"
+)
+
+func TestResize(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 400; x++ {
+			src.Set(x, y, color.RGBA{R: 200, G: 100, B: 50, A: 255})
+		}
+	}
+
+	resized := media.Resize(src, 100)
+
+	// the aspect ratio is kept and a flat color stays the same
+	assert.Equal(t, 100, resized.Bounds().Dx())
+	assert.Equal(t, 50, resized.Bounds().Dy())
+	assert.Equal(t, color.RGBA{R: 200, G: 100, B: 50, A: 255}, resized.RGBAAt(50, 25))
+}
+
+func TestResize_TransparentBackground(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 20, 20))
+
+	resized := media.Resize(src, 10)
+
+	// JPEG has no alpha channel, so transparent pixels become white
+	assert.Equal(t, color.RGBA{R: 255, G: 255, B: 255, A: 255}, resized.RGBAAt(5, 5))
+}
+
+func TestCrop(t *testing.T) {
+	// the left and the right quarters are red, the middle is blue
+	src := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 400; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= 100 && x < 300 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			src.Set(x, y, c)
+		}
+	}
+
+	square := media.Crop(src, 1, 1)
+
+	// the centered square keeps only the middle
+	assert.Equal(t, 200, square.Bounds().Dx())
+	assert.Equal(t, 200, square.Bounds().Dy())
+	assert.Equal(t, color.RGBA{B: 255, A: 255}, square.RGBAAt(0, 0))
+	assert.Equal(t, color.RGBA{B: 255, A: 255}, square.RGBAAt(199, 199))
+
+	// a wide ratio cuts the top and the bottom instead
+	banner := media.Crop(src, 3, 1)
+	assert.Equal(t, 400, banner.Bounds().Dx())
+	assert.Equal(t, 133, banner.Bounds().Dy())
+}
+
+func TestEncodeJPEG(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 64, 32))
+
+	data, err := media.EncodeJPEG(src, 80)
+
+	assert.NoError(t, err)
+	config, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, 64, config.Width)
+	assert.Equal(t, 32, config.Height)
+}
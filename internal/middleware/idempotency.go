@@ -0,0 +1,252 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	"log"
+	handlers "microblogCPT/internal/handler"
+	"microblogCPT/internal/models"
+	"microblogCPT/internal/repository"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+	idempotencyLockTimeout   = time.Minute
+	// maxIdempotentBodySize limits the request read before the handler and the response kept for a key,
+	// the uploads are hashed while the handler reads them and are not limited here
+	maxIdempotentBodySize = 1 << 20
+)
+
+// IdempotencyMiddleware makes POST, PATCH and DELETE requests with the Idempotency-Key header safe to retry.
+// The response is stored per user, or per client address for the anonymous requests, method, path and key
+// and is replayed to the repeated requests, a concurrent duplicate waits until the first request finishes
+func IdempotencyMiddleware(store repository.IdempotencyRepository, ttl time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(idempotencyKeyHeader)
+			if key == "" || !isIdempotencyMethod(r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if len(key) > maxIdempotencyKeyLength {
+				handlers.WriteError(w, "Слишком длинный Idempotency-Key", http.StatusBadRequest)
+				return
+			}
+
+			request := &models.IdempotentRequest{
+				Principal: idempotencyPrincipal(r),
+				Method:    r.Method,
+				Path:      r.URL.Path,
+				Key:       key,
+				ExpiresAt: time.Now().Add(idempotencyLockTimeout),
+			}
+
+			// the upload is hashed while the handler reads it, its hash stays empty until the response is stored,
+			// so a concurrent duplicate waits for the result and is compared with it after reading its own body
+			upload := isUploadRequest(r)
+			var uploadBody *hashingBody
+			if upload {
+				uploadBody = newHashingBody(r.Body)
+				r.Body = uploadBody
+			} else {
+				// the body is read to compare the repeated request with the original one
+				body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodySize))
+				if err != nil {
+					var tooLarge *http.MaxBytesError
+					if errors.As(err, &tooLarge) {
+						handlers.WriteError(w, "Запрос с Idempotency-Key не может быть больше 1 МБ", http.StatusRequestEntityTooLarge)
+					} else {
+						handlers.WriteError(w, "Ошибка чтения запроса", http.StatusBadRequest)
+					}
+					return
+				}
+				r.Body = io.NopCloser(bytes.NewReader(body))
+
+				hash := sha256.Sum256(body)
+				request.RequestHash = hex.EncodeToString(hash[:])
+			}
+
+			existing, err := store.Acquire(r.Context(), request)
+			if err != nil {
+				if r.Context().Err() == nil {
+					handlers.WriteError(w, "Ошибка проверки Idempotency-Key: "+err.Error(), http.StatusInternalServerError)
+				}
+				return
+			}
+
+			if existing != nil {
+				if upload {
+					if _, err := io.Copy(io.Discard, uploadBody); err != nil {
+						handlers.WriteError(w, "Ошибка чтения запроса", http.StatusBadRequest)
+						return
+					}
+					request.RequestHash = uploadBody.Sum()
+				}
+
+				if existing.RequestHash != request.RequestHash {
+					handlers.WriteError(w, "Idempotency-Key уже использован с другим запросом", http.StatusUnprocessableEntity)
+					return
+				}
+				replayResponse(w, existing)
+				return
+			}
+
+			// the result is saved even if the client has gone away
+			storeCtx := context.WithoutCancel(r.Context())
+			recorder := &responseRecorder{ResponseWriter: w}
+
+			defer func() {
+				if p := recover(); p != nil {
+					store.Release(storeCtx, request)
+					panic(p)
+				}
+			}()
+
+			next.ServeHTTP(recorder, r)
+
+			// an upload the handler did not read to the end can not be compared with a repeated one
+			hashed := true
+			if upload {
+				hashed = uploadBody.Finish()
+				request.RequestHash = uploadBody.Sum()
+			}
+
+			// server errors and responses too large to keep are not stored so that the request can be retried
+			if !hashed || recorder.status == 0 || recorder.status >= http.StatusInternalServerError || recorder.overflow {
+				if err := store.Release(storeCtx, request); err != nil {
+					log.Printf("Ошибка освобождения Idempotency-Key: %v", err)
+				}
+				return
+			}
+
+			request.ResponseStatus = recorder.status
+			request.ResponseHeaders, _ = json.Marshal(recorder.header)
+			request.ResponseBody = recorder.body.Bytes()
+			request.ExpiresAt = time.Now().Add(ttl)
+
+			if err := store.Complete(storeCtx, request); err != nil {
+				log.Printf("Ошибка сохранения ответа для Idempotency-Key: %v", err)
+			}
+		})
+	}
+}
+
+func isIdempotencyMethod(method string) bool {
+	return method == http.MethodPost || method == http.MethodPatch || method == http.MethodDelete
+}
+
+// idempotencyPrincipal scopes the keys by the user, the anonymous callers, such as the registration,
+// are scoped by their address so that they do not share one key space
+func idempotencyPrincipal(r *http.Request) string {
+	principal := handlers.PrincipalFromContext(r.Context())
+	if principal.IsAnonymous() {
+		return "address:" + clientAddress(r)
+	}
+	return principal.UserID
+}
+
+// isUploadRequest reports whether the request streams a file: the tus chunks, the multipart image uploads,
+// the avatar and the banner, and the media urls. Their bodies are too large to keep in memory
+func isUploadRequest(r *http.Request) bool {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/api/uploads/"), strings.HasPrefix(r.URL.Path, "/media/"):
+		return true
+	case r.URL.Path == "/api/me/avatar", r.URL.Path == "/api/me/banner":
+		return true
+	}
+
+	// /api/posts/{id}/images
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/posts/"), "/")
+	return strings.HasPrefix(r.URL.Path, "/api/posts/") && len(parts) == 2 && parts[1] == "images"
+}
+
+// hashingBody hashes the request body while the handler reads it
+type hashingBody struct {
+	io.ReadCloser
+	hash hash.Hash
+	eof  bool
+}
+
+func newHashingBody(body io.ReadCloser) *hashingBody {
+	return &hashingBody{ReadCloser: body, hash: sha256.New()}
+}
+
+func (b *hashingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.hash.Write(p[:n])
+	if err == io.EOF {
+		b.eof = true
+	}
+	return n, err
+}
+
+// Finish hashes the tail the handler left unread, such as the end of a multipart body,
+// and reports whether the whole body was hashed
+func (b *hashingBody) Finish() bool {
+	if !b.eof {
+		io.Copy(io.Discard, io.LimitReader(b, maxIdempotentBodySize))
+	}
+	return b.eof
+}
+
+func (b *hashingBody) Sum() string {
+	return hex.EncodeToString(b.hash.Sum(nil))
+}
+
+func replayResponse(w http.ResponseWriter, stored *models.IdempotentRequest) {
+	var header http.Header
+	if len(stored.ResponseHeaders) > 0 {
+		json.Unmarshal(stored.ResponseHeaders, &header)
+	}
+
+	for name, values := range header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(idempotentReplayedHeader, "true")
+
+	w.WriteHeader(stored.ResponseStatus)
+	w.Write(stored.ResponseBody)
+}
+
+// responseRecorder passes the response to the client and keeps a copy of it up to maxIdempotentBodySize
+type responseRecorder struct {
+	http.ResponseWriter
+	status   int
+	header   http.Header
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+		r.header = r.ResponseWriter.Header().Clone()
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.WriteHeader(http.StatusOK)
+	}
+	if !r.overflow && r.body.Len()+len(data) > maxIdempotentBodySize {
+		r.overflow = true
+		r.body.Reset()
+	}
+	if !r.overflow {
+		r.body.Write(data)
+	}
+	return r.ResponseWriter.Write(data)
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"microblogCPT/internal/config"
 	handlers "microblogCPT/internal/handler"
+	"microblogCPT/internal/models"
 	"microblogCPT/internal/service"
 	"net/http"
 	"strings"
@@ -43,8 +44,28 @@ func AuthMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
 				}
 			}
 
+			// media urls carry their own signature
+			if strings.HasPrefix(r.URL.Path, "/media/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// tus clients discover the server capabilities before they authenticate
+			if isTusDiscovery(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
 			// Extracting the token from the header
 			authHeader := r.Header.Get("Authorization")
+
+			// the published content is read without a token, a request with one is still checked
+			if authHeader == "" && isAnonymousRead(r) {
+				anonymous := models.Principal{Kind: models.PrincipalAnonymous}
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), "principal", anonymous)))
+				return
+			}
+
 			if authHeader == "" {
 				handlers.WriteError(w, "Требуется авторизация", http.StatusUnauthorized)
 				return
@@ -94,6 +115,11 @@ func AuthMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
 				ctx = context.WithValue(ctx, "userID", userID)
 				ctx = context.WithValue(ctx, "email", email)
 				ctx = context.WithValue(ctx, "role", role)
+				ctx = context.WithValue(ctx, "principal", models.Principal{
+					Kind:   models.PrincipalUser,
+					UserID: userID,
+					Role:   role,
+				})
 
 				// Passing the updated context on
 				next.ServeHTTP(w, r.WithContext(ctx))
@@ -150,10 +176,13 @@ func RoleMiddleware(allowedRoles ...string) func(http.Handler) http.Handler {
 func CORSMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match, Idempotency-Key, "+
+			"Tus-Resumable, Upload-Length, Upload-Offset, Upload-Metadata")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, Idempotent-Replayed, Location, "+
+			"Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size, Upload-Offset, Upload-Length, Upload-Expires")
 
-		if r.Method == "OPTIONS" {
+		if r.Method == "OPTIONS" && !isTusDiscovery(r) {
 			w.WriteHeader(http.StatusOK)
 			return
 		}
@@ -175,3 +204,37 @@ func Chain(h http.Handler, middlewares ...Middleware) http.Handler {
 	}
 	return h
 }
+
+// isTusDiscovery reports whether the request is a tus OPTIONS request rather than a CORS preflight
+func isTusDiscovery(r *http.Request) bool {
+	return r.Method == http.MethodOptions &&
+		strings.HasPrefix(r.URL.Path, "/api/uploads/") &&
+		r.Header.Get("Access-Control-Request-Method") == ""
+}
+
+// isAnonymousRead reports whether the request reads the public content: the list of the posts, a post,
+// its images, its comments and the public profiles. The handlers hide the drafts from the anonymous visitors
+func isAnonymousRead(r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+
+	if r.URL.Path == "/api/posts" || strings.HasPrefix(r.URL.Path, "/api/users/@") {
+		return true
+	}
+
+	// /api/posts/{id}, /api/posts/{id}/images, /api/posts/{id}/images/{imageId} and /api/posts/{id}/comments
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/posts/"), "/")
+	if !strings.HasPrefix(r.URL.Path, "/api/posts/") || parts[0] == "" {
+		return false
+	}
+	switch len(parts) {
+	case 1:
+		return true
+	case 2:
+		return parts[1] == "images" || parts[1] == "comments"
+	case 3:
+		return parts[1] == "images" && parts[2] != ""
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	handlers "microblogCPT/internal/handler"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// AnonymousRateLimitMiddleware limits the requests of the anonymous visitors to limit per window for every
+// client address. The signed-in users are not counted, a limit of 0 turns the middleware off.
+// It has to run after the auth middleware that puts the principal into the context
+func AnonymousRateLimitMiddleware(limit int, window time.Duration) func(http.Handler) http.Handler {
+	limiter := newRateLimiter(limit, window, time.Now)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if limit <= 0 || !handlers.PrincipalFromContext(r.Context()).IsAnonymous() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			remaining, retryAfter, ok := limiter.allow(clientAddress(r))
+
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+			if !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int((retryAfter+time.Second-1)/time.Second)))
+				handlers.WriteError(w, "Слишком много запросов, повторите позже или войдите в систему",
+					http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientAddress is the IP address of the client without the port. The forwarding headers are not trusted,
+// behind a proxy it is the proxy that has to limit the clients
+func clientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// rateLimiter counts the requests of every key in fixed windows
+type rateLimiter struct {
+	limit     int
+	window    time.Duration
+	now       func() time.Time
+	mu        sync.Mutex
+	windows   map[string]*rateWindow
+	lastSweep time.Time
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+func newRateLimiter(limit int, window time.Duration, now func() time.Time) *rateLimiter {
+	return &rateLimiter{
+		limit:     limit,
+		window:    window,
+		now:       now,
+		windows:   make(map[string]*rateWindow),
+		lastSweep: now(),
+	}
+}
+
+// allow counts the request of the key and returns the requests left in the current window,
+// a rejected request gets the time until the window ends
+func (l *rateLimiter) allow(key string) (int, time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+
+	// the finished windows are dropped once per window so that the map does not grow with the addresses
+	if now.Sub(l.lastSweep) >= l.window {
+		for k, w := range l.windows {
+			if now.Sub(w.start) >= l.window {
+				delete(l.windows, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	current, ok := l.windows[key]
+	if !ok || now.Sub(current.start) >= l.window {
+		current = &rateWindow{start: now}
+		l.windows[key] = current
+	}
+
+	if current.count >= l.limit {
+		return 0, current.start.Add(l.window).Sub(now), false
+	}
+
+	current.count++
+	return l.limit - current.count, 0, true
+}
@@ -0,0 +1,69 @@
+package test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"microblogCPT/internal/config"
+	handlers "microblogCPT/internal/handler"
+	"microblogCPT/internal/middleware"
+	"microblogCPT/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthMiddleware_AnonymousReads(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		expectedStatus int
+	}{
+		{name: "Список постов", method: http.MethodGet, path: "/api/posts", expectedStatus: http.StatusOK},
+		{name: "Пост", method: http.MethodGet, path: "/api/posts/post123", expectedStatus: http.StatusOK},
+		{name: "Изображения поста", method: http.MethodGet, path: "/api/posts/post123/images", expectedStatus: http.StatusOK},
+		{name: "Изображение поста", method: http.MethodGet, path: "/api/posts/post123/images/img1", expectedStatus: http.StatusOK},
+		{name: "Комментарии поста", method: http.MethodGet, path: "/api/posts/post123/comments", expectedStatus: http.StatusOK},
+		{name: "Новый комментарий", method: http.MethodPost, path: "/api/posts/post123/comments", expectedStatus: http.StatusUnauthorized},
+		{name: "Публичный профиль", method: http.MethodGet, path: "/api/users/@alice", expectedStatus: http.StatusOK},
+		{name: "Ревизии поста", method: http.MethodGet, path: "/api/posts/post123/revisions", expectedStatus: http.StatusUnauthorized},
+		{name: "Лента подписок", method: http.MethodGet, path: "/api/feed/home", expectedStatus: http.StatusUnauthorized},
+		{name: "Создание поста", method: http.MethodPost, path: "/api/posts/", expectedStatus: http.StatusUnauthorized},
+		{name: "Удаление поста", method: http.MethodDelete, path: "/api/posts/post123", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var principal models.Principal
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				principal = handlers.PrincipalFromContext(r.Context())
+				w.WriteHeader(http.StatusOK)
+			})
+
+			handler := middleware.AuthMiddleware(&config.Config{JWTSecretKey: "secret"})(next)
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, models.PrincipalAnonymous, principal.Kind)
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware_InvalidTokenOnPublicRead(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	handler := middleware.AuthMiddleware(&config.Config{JWTSecretKey: "secret"})(next)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/posts", nil)
+	req.Header.Set("Authorization", "Bearer invalid")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
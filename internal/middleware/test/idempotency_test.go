@@ -0,0 +1,346 @@
+package test
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"microblogCPT/internal/middleware"
+	"microblogCPT/internal/models"
+	"microblogCPT/internal/repository"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newIdempotentRequest(method, path, key, body, userID string) *http.Request {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	ctx := context.WithValue(req.Context(), "userID", userID)
+	if userID != "" {
+		ctx = context.WithValue(ctx, "principal", models.Principal{Kind: models.PrincipalUser, UserID: userID, Role: "Author"})
+	}
+	return req.WithContext(ctx)
+}
+
+func TestIdempotencyMiddleware_ReplaysResponse(t *testing.T) {
+	var calls int32
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("ETag", `"1"`)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"postID":"post123"}`))
+	})
+
+	handler := middleware.IdempotencyMiddleware(repository.NewMemoryIdempotencyRepository(), time.Hour)(next)
+
+	first := httptest.NewRecorder()
+	handler.ServeHTTP(first, newIdempotentRequest(http.MethodPost, "/api/posts/", "key123", `{"title":"Test"}`, "123"))
+
+	second := httptest.NewRecorder()
+	handler.ServeHTTP(second, newIdempotentRequest(http.MethodPost, "/api/posts/", "key123", `{"title":"Test"}`, "123"))
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assert.Equal(t, http.StatusCreated, second.Code)
+	assert.Equal(t, first.Body.String(), second.Body.String())
+	assert.Equal(t, `"1"`, second.Header().Get("ETag"))
+	assert.Equal(t, "true", second.Header().Get("Idempotent-Replayed"))
+	assert.Empty(t, first.Header().Get("Idempotent-Replayed"))
+}
+
+func TestIdempotencyMiddleware_KeyScope(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		key           string
+		body          string
+		userID        string
+		expectedCalls int32
+		expectedCode  int
+	}{
+		{
+			name:          "Другой пользователь",
+			method:        http.MethodPost,
+			path:          "/api/posts/",
+			key:           "key123",
+			body:          `{"title":"Test"}`,
+			userID:        "456",
+			expectedCalls: 2,
+			expectedCode:  http.StatusCreated,
+		},
+		{
+			name:          "Другой путь",
+			method:        http.MethodPost,
+			path:          "/api/posts/post123/status",
+			key:           "key123",
+			body:          `{"title":"Test"}`,
+			userID:        "123",
+			expectedCalls: 2,
+			expectedCode:  http.StatusCreated,
+		},
+		{
+			name:          "Запрос без ключа",
+			method:        http.MethodPost,
+			path:          "/api/posts/",
+			key:           "",
+			body:          `{"title":"Test"}`,
+			userID:        "123",
+			expectedCalls: 2,
+			expectedCode:  http.StatusCreated,
+		},
+		{
+			name:          "Тот же ключ с другим телом",
+			method:        http.MethodPost,
+			path:          "/api/posts/",
+			key:           "key123",
+			body:          `{"title":"Other"}`,
+			userID:        "123",
+			expectedCalls: 1,
+			expectedCode:  http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&calls, 1)
+				w.WriteHeader(http.StatusCreated)
+			})
+
+			handler := middleware.IdempotencyMiddleware(repository.NewMemoryIdempotencyRepository(), time.Hour)(next)
+
+			handler.ServeHTTP(httptest.NewRecorder(), newIdempotentRequest(http.MethodPost, "/api/posts/", "key123", `{"title":"Test"}`, "123"))
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, newIdempotentRequest(tt.method, tt.path, tt.key, tt.body, tt.userID))
+
+			assert.Equal(t, tt.expectedCode, rr.Code)
+			assert.Equal(t, tt.expectedCalls, atomic.LoadInt32(&calls))
+		})
+	}
+}
+
+func TestIdempotencyMiddleware_ServerErrorIsNotStored(t *testing.T) {
+	var calls int32
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	handler := middleware.IdempotencyMiddleware(repository.NewMemoryIdempotencyRepository(), time.Hour)(next)
+
+	first := httptest.NewRecorder()
+	handler.ServeHTTP(first, newIdempotentRequest(http.MethodDelete, "/api/posts/post123", "key123", "", "123"))
+
+	second := httptest.NewRecorder()
+	handler.ServeHTTP(second, newIdempotentRequest(http.MethodDelete, "/api/posts/post123", "key123", "", "123"))
+
+	assert.Equal(t, http.StatusInternalServerError, first.Code)
+	assert.Equal(t, http.StatusOK, second.Code)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestIdempotencyMiddleware_ConcurrentDuplicatesWait(t *testing.T) {
+	var calls int32
+	started := make(chan struct{})
+	finish := make(chan struct{})
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		close(started)
+		<-finish
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	})
+
+	handler := middleware.IdempotencyMiddleware(repository.NewMemoryIdempotencyRepository(), time.Hour)(next)
+
+	responses := make([]*httptest.ResponseRecorder, 3)
+	var wg sync.WaitGroup
+
+	responses[0] = httptest.NewRecorder()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		handler.ServeHTTP(responses[0], newIdempotentRequest(http.MethodPost, "/api/posts/", "key123", "body", "123"))
+	}()
+	<-started
+
+	for i := 1; i < len(responses); i++ {
+		responses[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func(rr *httptest.ResponseRecorder) {
+			defer wg.Done()
+			handler.ServeHTTP(rr, newIdempotentRequest(http.MethodPost, "/api/posts/", "key123", "body", "123"))
+		}(responses[i])
+	}
+
+	// the duplicates are waiting for the first request
+	time.Sleep(50 * time.Millisecond)
+	close(finish)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	for _, rr := range responses {
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.Equal(t, "created", rr.Body.String())
+	}
+}
+
+func TestIdempotencyMiddleware_GetIsIgnored(t *testing.T) {
+	var calls int32
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	handler := middleware.IdempotencyMiddleware(repository.NewMemoryIdempotencyRepository(), time.Hour)(next)
+
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, newIdempotentRequest(http.MethodGet, "/api/posts", "key123", "", "123"))
+		assert.Empty(t, rr.Header().Get("Idempotent-Replayed"))
+	}
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestIdempotencyMiddleware_TooLargeBody(t *testing.T) {
+	var calls int32
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	handler := middleware.IdempotencyMiddleware(repository.NewMemoryIdempotencyRepository(), time.Hour)(next)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newIdempotentRequest(http.MethodPost, "/api/posts/", "key123", strings.Repeat("a", 1<<20+1), "123"))
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&calls))
+}
+
+func TestIdempotencyMiddleware_Anonymous(t *testing.T) {
+	var calls int32
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"userID":"123"}`))
+	})
+
+	handler := middleware.IdempotencyMiddleware(repository.NewMemoryIdempotencyRepository(), time.Hour)(next)
+
+	register := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := newIdempotentRequest(http.MethodPost, "/api/auth/register", "key123", `{"email":"test@example.com"}`, "")
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	first := register("192.0.2.1:1234")
+	second := register("192.0.2.1:5678")
+	other := register("192.0.2.2:1234")
+
+	// the anonymous keys are scoped by the client address, not by the port
+	assert.Equal(t, http.StatusCreated, first.Code)
+	assert.Equal(t, "true", second.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, first.Body.String(), second.Body.String())
+	assert.Empty(t, other.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestIdempotencyMiddleware_Uploads(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{name: "Загрузка изображений", method: http.MethodPost, path: "/api/posts/post123/images", body: "image"},
+		{name: "Часть tus-загрузки", method: http.MethodPatch, path: "/api/uploads/upload123", body: "chunk"},
+		{name: "Аватар больше 1 МБ", method: http.MethodPost, path: "/api/me/avatar", body: strings.Repeat("a", 2<<20)},
+		{name: "Обложка", method: http.MethodPost, path: "/api/me/banner", body: "banner"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&calls, 1)
+				body, _ := io.ReadAll(r.Body)
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(strconv.Itoa(len(body))))
+			})
+
+			handler := middleware.IdempotencyMiddleware(repository.NewMemoryIdempotencyRepository(), time.Hour)(next)
+
+			first := httptest.NewRecorder()
+			handler.ServeHTTP(first, newIdempotentRequest(tt.method, tt.path, "key123", tt.body, "123"))
+
+			second := httptest.NewRecorder()
+			handler.ServeHTTP(second, newIdempotentRequest(tt.method, tt.path, "key123", tt.body, "123"))
+
+			other := httptest.NewRecorder()
+			handler.ServeHTTP(other, newIdempotentRequest(tt.method, tt.path, "key123", tt.body+"b", "123"))
+
+			assert.Equal(t, http.StatusCreated, first.Code)
+			assert.Equal(t, strconv.Itoa(len(tt.body)), first.Body.String())
+			assert.Equal(t, first.Body.String(), second.Body.String())
+			assert.Equal(t, "true", second.Header().Get("Idempotent-Replayed"))
+			assert.Equal(t, http.StatusUnprocessableEntity, other.Code)
+			assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+		})
+	}
+}
+
+func TestIdempotencyMiddleware_UnreadUploadIsNotStored(t *testing.T) {
+	var calls int32
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+	})
+
+	handler := middleware.IdempotencyMiddleware(repository.NewMemoryIdempotencyRepository(), time.Hour)(next)
+
+	// the handler rejects the file without reading it, the rest is too long to hash after the response
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, newIdempotentRequest(http.MethodPost, "/api/me/avatar", "key123", strings.Repeat("a", 2<<20), "123"))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+		assert.Empty(t, rr.Header().Get("Idempotent-Replayed"))
+	}
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestIdempotencyMiddleware_LargeResponseIsNotStored(t *testing.T) {
+	var calls int32
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(strings.Repeat("a", 1<<20+1)))
+	})
+
+	handler := middleware.IdempotencyMiddleware(repository.NewMemoryIdempotencyRepository(), time.Hour)(next)
+
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, newIdempotentRequest(http.MethodPost, "/api/posts/", "key123", "body", "123"))
+		assert.Equal(t, 1<<20+1, rr.Body.Len())
+	}
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
@@ -0,0 +1,63 @@
+package test
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"microblogCPT/internal/middleware"
+	"microblogCPT/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newPrincipalRequest(remoteAddr string, principal models.Principal) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/api/posts", nil)
+	req.RemoteAddr = remoteAddr
+	return req.WithContext(context.WithValue(req.Context(), "principal", principal))
+}
+
+func TestAnonymousRateLimitMiddleware(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := middleware.AnonymousRateLimitMiddleware(2, time.Hour)(next)
+
+	anonymous := models.Principal{Kind: models.PrincipalAnonymous}
+	user := models.Principal{Kind: models.PrincipalUser, UserID: "123", Role: "Reader"}
+
+	for i, expectedRemaining := range []string{"1", "0"} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, newPrincipalRequest("10.0.0.1:1234", anonymous))
+		assert.Equal(t, http.StatusOK, rr.Code, "запрос %d", i+1)
+		assert.Equal(t, expectedRemaining, rr.Header().Get("X-RateLimit-Remaining"))
+	}
+
+	// the limit is counted per address, not per connection
+	limited := httptest.NewRecorder()
+	handler.ServeHTTP(limited, newPrincipalRequest("10.0.0.1:5678", anonymous))
+	assert.Equal(t, http.StatusTooManyRequests, limited.Code)
+	assert.Equal(t, "3600", limited.Header().Get("Retry-After"))
+
+	other := httptest.NewRecorder()
+	handler.ServeHTTP(other, newPrincipalRequest("10.0.0.2:1234", anonymous))
+	assert.Equal(t, http.StatusOK, other.Code)
+
+	signedIn := httptest.NewRecorder()
+	handler.ServeHTTP(signedIn, newPrincipalRequest("10.0.0.1:1234", user))
+	assert.Equal(t, http.StatusOK, signedIn.Code)
+	assert.Empty(t, signedIn.Header().Get("X-RateLimit-Limit"))
+}
+
+func TestAnonymousRateLimitMiddleware_Disabled(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := middleware.AnonymousRateLimitMiddleware(0, time.Hour)(next)
+
+	for i := 0; i < 5; i++ {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, newPrincipalRequest("10.0.0.1:1234", models.Principal{Kind: models.PrincipalAnonymous}))
+		assert.Equal(t, http.StatusOK, rr.Code)
+	}
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"github.com/lib/pq"
 	"time"
 )
 
@@ -11,23 +12,254 @@ type User struct {
 	Role                   string    `json:"role" db:"role"`
 	RefreshToken           string    `json:"refreshToken" db:"refresh_token"`
 	RefreshTokenExpiryTime time.Time `json:"refreshTokenExpiryTime" db:"refresh_token_expiry_time"`
+	// Handle is the unique lowercase name of the public profile, shown as @handle
+	Handle      string         `json:"handle" db:"handle"`
+	DisplayName string         `json:"displayName" db:"display_name"`
+	Bio         string         `json:"bio" db:"bio"`
+	Links       pq.StringArray `json:"links" db:"links"`
+	// HandleChangedAt is the time of the last handle change, the changes are rate-limited
+	HandleChangedAt *time.Time `json:"-" db:"handle_changed_at"`
+}
+
+// PrincipalKind tells whether a request is made by a signed-in user or by an anonymous visitor
+type PrincipalKind string
+
+const (
+	PrincipalUser      PrincipalKind = "user"
+	PrincipalAnonymous PrincipalKind = "anonymous"
+)
+
+// Principal is the one who makes a request, the auth middleware puts it into the request context.
+// An anonymous principal has no user ID and no role and may only read the published content
+type Principal struct {
+	Kind   PrincipalKind
+	UserID string
+	Role   string
+}
+
+// IsAnonymous reports whether the request was made without a token, a zero Principal is anonymous
+func (p Principal) IsAnonymous() bool {
+	return p.Kind != PrincipalUser
+}
+
+// PublicProfile is the profile of the user shown to everyone, it never contains the email
+type PublicProfile struct {
+	UserID      string   `json:"userId"`
+	Handle      string   `json:"handle"`
+	DisplayName string   `json:"displayName"`
+	Bio         string   `json:"bio"`
+	Links       []string `json:"links"`
+	ProfileImages
+	PostCount      int `json:"postCount"`
+	FollowerCount  int `json:"followerCount"`
+	FollowingCount int `json:"followingCount"`
+}
+
+// FollowUser is a user in the list of the followers or the followings of another user
+type FollowUser struct {
+	UserID      string `json:"userId" db:"user_id"`
+	Handle      string `json:"handle" db:"handle"`
+	DisplayName string `json:"displayName" db:"display_name"`
+	ProfileImages
+	FollowedAt time.Time `json:"followedAt" db:"followed_at"`
+}
+
+// FollowStatus is the relation of the current user to another one after a follow or an unfollow
+type FollowStatus struct {
+	Following     bool `json:"following"`
+	FollowerCount int  `json:"followerCount"`
 }
 
 type Post struct {
-	PostID         string    `json:"postID" db:"post_id"`
-	AuthorID       string    `json:"authorID" db:"author_id"`
-	IdempotencyKey *string   `json:"idempotencyKey,omitempty" db:"idempotency_key"`
-	Title          string    `json:"title" db:"title"`
-	Content        string    `json:"content" db:"content"`
-	Status         string    `json:"status" db:"status"`
-	CreatedAt      time.Time `json:"createdAt" db:"created_at"`
-	UpdatedAt      time.Time `json:"updatedAt" db:"updated_at"`
-	Images         []Image   `json:"images,omitempty" db:"-"`
+	PostID         string      `json:"postID" db:"post_id"`
+	AuthorID       string      `json:"authorID" db:"author_id"`
+	IdempotencyKey *string     `json:"idempotencyKey,omitempty" db:"idempotency_key"`
+	Title          string      `json:"title" db:"title"`
+	Content        string      `json:"content" db:"content"`
+	Status         string      `json:"status" db:"status"`
+	Version        int         `json:"version" db:"version"`
+	CreatedAt      time.Time   `json:"createdAt" db:"created_at"`
+	UpdatedAt      time.Time   `json:"updatedAt" db:"updated_at"`
+	PublishedAt    *time.Time  `json:"publishedAt,omitempty" db:"published_at"`
+	DeletedAt      *time.Time  `json:"deletedAt,omitempty" db:"deleted_at"`
+	Images         []Image     `json:"images,omitempty" db:"-"`
+	Author         *PostAuthor `json:"author,omitempty" db:"-"`
+}
+
+// Comment is a comment on a post, a reply has the ID of the comment it answers in ParentID.
+// A hidden or deleted comment keeps its place in the thread, the list shows it without the content and the author
+type Comment struct {
+	CommentID string      `json:"commentID" db:"comment_id"`
+	PostID    string      `json:"postID" db:"post_id"`
+	ParentID  *string     `json:"parentID,omitempty" db:"parent_id"`
+	AuthorID  string      `json:"authorID,omitempty" db:"author_id"`
+	Content   string      `json:"content" db:"content"`
+	Hidden    bool        `json:"hidden" db:"hidden"`
+	CreatedAt time.Time   `json:"createdAt" db:"created_at"`
+	UpdatedAt time.Time   `json:"updatedAt" db:"updated_at"`
+	DeletedAt *time.Time  `json:"deletedAt,omitempty" db:"deleted_at"`
+	Author    *PostAuthor `json:"author,omitempty" db:"-"`
+	// Replies holds the answers to the comment in the tree view of the list
+	Replies []Comment `json:"replies,omitempty" db:"-"`
+}
+
+// PostAuthor is the information about the author embedded in the post responses
+type PostAuthor struct {
+	UserID      string `json:"userId"`
+	Handle      string `json:"handle,omitempty"`
+	DisplayName string `json:"displayName,omitempty"`
+	ProfileImages
+}
+
+// ProfileImages holds the urls of the avatar by its size in pixels and the url of the banner
+type ProfileImages struct {
+	AvatarURLs map[string]string `json:"avatarUrls,omitempty"`
+	BannerURL  string            `json:"bannerUrl,omitempty"`
+}
+
+// UserImage is a stored avatar size or the banner of a user
+type UserImage struct {
+	UserID    string    `db:"user_id"`
+	Kind      string    `db:"kind"`
+	Size      int       `db:"size"`
+	ObjectKey string    `db:"object_key"`
+	CreatedAt time.Time `db:"created_at"`
 }
 
 type Image struct {
 	ImageID   string    `json:"imageID" db:"image_id"`
 	PostID    string    `json:"postID" db:"post_id"`
-	ImageURL  string    `json:"imageUrl" db:"image_url"`
+	ObjectKey string    `json:"-" db:"object_key"`
+	ImageURL  string    `json:"imageUrl" db:"-"`
+	MimeType  string    `json:"mimeType" db:"mime_type"`
+	Width     int       `json:"width" db:"width"`
+	Height    int       `json:"height" db:"height"`
+	Size      int64     `json:"size" db:"size"`
 	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+	// AltText describes the image for screen readers
+	AltText string `json:"altText" db:"alt_text"`
+	Caption string `json:"caption" db:"caption"`
+	// Position orders the images of the post, the first one is 0
+	Position int `json:"position" db:"position"`
+	// VariantsStatus tracks the generation of the resized copies: pending, processing, ready, skipped or failed
+	VariantsStatus string `json:"-" db:"variants_status"`
+	// VariantsClaimedAt is the time the image was last claimed by the generator, VariantsAttempts counts the claims
+	VariantsClaimedAt *time.Time     `json:"-" db:"variants_claimed_at"`
+	VariantsAttempts  int            `json:"-" db:"variants_attempts"`
+	Variants          []ImageVariant `json:"variants,omitempty" db:"-"`
+	// BlobHash is the SHA-256 of the content, images with the same content share the object of the blob
+	BlobHash *string `json:"-" db:"blob_hash"`
+	// Deduplicated reports that the upload reused an object already in the storage
+	Deduplicated bool `json:"deduplicated" db:"-"`
+}
+
+// ImageVariant is a resized copy of an image, the variants of an image form its srcset
+type ImageVariant struct {
+	ImageID   string    `json:"-" db:"image_id"`
+	ObjectKey string    `json:"-" db:"object_key"`
+	URL       string    `json:"url" db:"-"`
+	MimeType  string    `json:"mimeType" db:"mime_type"`
+	Width     int       `json:"width" db:"width"`
+	Height    int       `json:"height" db:"height"`
+	Size      int64     `json:"size" db:"size"`
+	CreatedAt time.Time `json:"-" db:"created_at"`
+	// BlobHash is set instead of ImageID for the variants of a blob, they are shared by all of its images
+	BlobHash *string `json:"-" db:"blob_hash"`
+}
+
+// VariantSource is an original waiting for its resized copies: an image that owns its object, or the blob
+// of deduplicated images whose variants are generated once and shared by all of its images
+type VariantSource struct {
+	ImageID          *string `db:"image_id"`
+	BlobHash         *string `db:"blob_hash"`
+	ObjectKey        string  `db:"object_key"`
+	VariantsAttempts int     `db:"variants_attempts"`
+}
+
+// ImageUpload is an image that the client uploads straight to the storage, it becomes an Image on completion
+type ImageUpload struct {
+	UploadID    string    `json:"uploadID" db:"upload_id"`
+	PostID      string    `json:"postID" db:"post_id"`
+	AuthorID    string    `json:"authorID" db:"author_id"`
+	ObjectKey   string    `json:"-" db:"object_key"`
+	FileName    string    `json:"fileName" db:"file_name"`
+	ContentType string    `json:"contentType" db:"content_type"`
+	Size        int64     `json:"size" db:"size"`
+	CreatedAt   time.Time `json:"createdAt" db:"created_at"`
+	ExpiresAt   time.Time `json:"expiresAt" db:"expires_at"`
+}
+
+// StorageUsage is the space taken by the images of the user
+type StorageUsage struct {
+	UserID    string    `json:"userId" db:"user_id"`
+	Role      string    `json:"-" db:"role"`
+	Bytes     int64     `json:"bytes" db:"bytes"`
+	Objects   int       `json:"objects" db:"objects"`
+	UpdatedAt time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+// PostStorageUsage is the space taken by the images of the post
+type PostStorageUsage struct {
+	PostID    string    `json:"postId" db:"post_id"`
+	AuthorID  string    `json:"-" db:"author_id"`
+	Bytes     int64     `json:"bytes" db:"bytes"`
+	Objects   int       `json:"objects" db:"objects"`
+	UpdatedAt time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+// StorageQuota limits the images of a user, a zero value means no limit
+type StorageQuota struct {
+	MaxBytes   int64 `json:"maxBytes"`
+	MaxObjects int   `json:"maxObjects"`
+}
+
+// TusUpload is a resumable upload, its bytes are collected in a multipart upload of the storage.
+// Pending keeps the tail that is still too small to become a part
+type TusUpload struct {
+	UploadID        string         `json:"uploadID" db:"upload_id"`
+	AuthorID        string         `json:"authorID" db:"author_id"`
+	ObjectKey       string         `json:"-" db:"object_key"`
+	StorageUploadID string         `json:"-" db:"storage_upload_id"`
+	FileName        string         `json:"fileName" db:"file_name"`
+	ContentType     string         `json:"contentType" db:"content_type"`
+	Length          int64          `json:"length" db:"length"`
+	Offset          int64          `json:"offset" db:"upload_offset"`
+	PartETags       pq.StringArray `json:"-" db:"part_etags"`
+	Pending         []byte         `json:"-" db:"pending"`
+	Completed       bool           `json:"completed" db:"completed"`
+	CreatedAt       time.Time      `json:"createdAt" db:"created_at"`
+	ExpiresAt       time.Time      `json:"expiresAt" db:"expires_at"`
+}
+
+type PostRevision struct {
+	PostID    string    `json:"postID" db:"post_id"`
+	Revision  int       `json:"revision" db:"revision"`
+	Title     string    `json:"title" db:"title"`
+	Content   string    `json:"content" db:"content"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
+type IdempotencyKey struct {
+	AuthorID       string    `json:"authorID" db:"author_id"`
+	Key            string    `json:"idempotencyKey" db:"idempotency_key"`
+	RequestHash    string    `json:"requestHash" db:"request_hash"`
+	ResponseStatus int       `json:"responseStatus" db:"response_status"`
+	ResponseBody   []byte    `json:"responseBody" db:"response_body"`
+	CreatedAt      time.Time `json:"createdAt" db:"created_at"`
+	ExpiresAt      time.Time `json:"expiresAt" db:"expires_at"`
+}
+
+// IdempotentRequest is a mutating request sent with the Idempotency-Key header and its stored response,
+// ResponseStatus stays zero while the request is being executed
+type IdempotentRequest struct {
+	Principal       string    `json:"principal" db:"principal"`
+	Method          string    `json:"method" db:"method"`
+	Path            string    `json:"path" db:"path"`
+	Key             string    `json:"idempotencyKey" db:"idempotency_key"`
+	RequestHash     string    `json:"requestHash" db:"request_hash"`
+	ResponseStatus  int       `json:"responseStatus" db:"response_status"`
+	ResponseHeaders []byte    `json:"responseHeaders" db:"response_headers"`
+	ResponseBody    []byte    `json:"responseBody" db:"response_body"`
+	CreatedAt       time.Time `json:"createdAt" db:"created_at"`
+	ExpiresAt       time.Time `json:"expiresAt" db:"expires_at"`
 }
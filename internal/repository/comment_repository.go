@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"microblogCPT/internal/models"
+)
+
+type CreateCommentRequest struct {
+	PostID   string  `json:"-"`
+	ParentID *string `json:"parentID"`
+	AuthorID string  `json:"-"`
+	Content  string  `json:"content"`
+}
+
+// UpdateCommentRequest changes the content of the comment or hides it, the fields left nil are kept
+type UpdateCommentRequest struct {
+	PostID    string  `json:"-"`
+	CommentID string  `json:"-"`
+	UserID    string  `json:"-"`
+	Content   *string `json:"content"`
+	Hidden    *bool   `json:"hidden"`
+}
+
+type CommentRepositoryImpl struct {
+	db *sqlx.DB
+}
+
+func NewCommentRepository(db *sqlx.DB) *CommentRepositoryImpl {
+	return &CommentRepositoryImpl{db: db}
+}
+
+func (r *CommentRepositoryImpl) Create(ctx context.Context, req CreateCommentRequest) (*models.Comment, error) {
+	query := `
+		INSERT INTO comments (post_id, parent_id, author_id, content)
+		VALUES ($1, $2, $3, $4)
+		RETURNING *
+	`
+
+	var comment models.Comment
+	err := r.db.GetContext(ctx, &comment, query, req.PostID, req.ParentID, req.AuthorID, req.Content)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при создании комментария: %w", err)
+	}
+
+	return &comment, nil
+}
+
+func (r *CommentRepositoryImpl) GetByID(ctx context.Context, commentID string) (*models.Comment, error) {
+	query := `SELECT * FROM comments WHERE comment_id = $1`
+
+	var comment models.Comment
+	err := r.db.GetContext(ctx, &comment, query, commentID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("комментарий с ID %s не найден", commentID)
+		}
+		return nil, fmt.Errorf("ошибка при получении комментария: %w", err)
+	}
+
+	return &comment, nil
+}
+
+// Update sets the content and the hidden flag that are not nil, only a new content changes updated_at
+func (r *CommentRepositoryImpl) Update(ctx context.Context, commentID string, content *string, hidden *bool) (*models.Comment, error) {
+	query := `
+		UPDATE comments
+		SET content = COALESCE($2, content),
+		    hidden = COALESCE($3, hidden),
+		    updated_at = CASE WHEN $2::text IS NULL THEN updated_at ELSE CURRENT_TIMESTAMP END
+		WHERE comment_id = $1 AND deleted_at IS NULL
+		RETURNING *
+	`
+
+	var comment models.Comment
+	err := r.db.GetContext(ctx, &comment, query, commentID, content, hidden)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("комментарий с ID %s не найден", commentID)
+		}
+		return nil, fmt.Errorf("ошибка при обновлении комментария: %w", err)
+	}
+
+	return &comment, nil
+}
+
+// Delete removes the comment. A comment with replies is only marked as deleted and loses its content,
+// so that the replies stay in their thread
+func (r *CommentRepositoryImpl) Delete(ctx context.Context, commentID string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE comments SET content = '', deleted_at = CURRENT_TIMESTAMP
+		WHERE comment_id = $1 AND EXISTS(SELECT 1 FROM comments WHERE parent_id = $1)
+	`, commentID)
+	if err != nil {
+		return fmt.Errorf("ошибка при удалении комментария: %w", err)
+	}
+
+	if marked, _ := result.RowsAffected(); marked == 0 {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM comments WHERE comment_id = $1`, commentID); err != nil {
+			return fmt.Errorf("ошибка при удалении комментария: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка при подтверждении транзакции: %w", err)
+	}
+
+	return nil
+}
+
+// GetByPost returns a page of all the comments of the post, oldest first
+func (r *CommentRepositoryImpl) GetByPost(ctx context.Context, postID string, cursor *PageCursor, limit int) ([]models.Comment, error) {
+	return r.page(ctx, postID, false, cursor, limit)
+}
+
+// GetRootsByPost returns a page of the top-level comments of the post, oldest first
+func (r *CommentRepositoryImpl) GetRootsByPost(ctx context.Context, postID string, cursor *PageCursor, limit int) ([]models.Comment, error) {
+	return r.page(ctx, postID, true, cursor, limit)
+}
+
+func (r *CommentRepositoryImpl) page(ctx context.Context, postID string, rootsOnly bool, cursor *PageCursor, limit int) ([]models.Comment, error) {
+	query := `SELECT * FROM comments WHERE post_id = $1`
+	args := []interface{}{postID}
+
+	if rootsOnly {
+		query += ` AND parent_id IS NULL`
+	}
+	if cursor != nil {
+		query += ` AND (created_at, comment_id) > ($2, $3)`
+		args = append(args, cursor.Time, cursor.ID)
+	}
+	query += fmt.Sprintf(` ORDER BY created_at, comment_id LIMIT $%d`, len(args)+1)
+	args = append(args, limit)
+
+	comments := []models.Comment{}
+	err := r.db.SelectContext(ctx, &comments, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении комментариев: %w", err)
+	}
+
+	return comments, nil
+}
+
+// GetReplies returns all the replies to the comments at any depth, oldest first
+func (r *CommentRepositoryImpl) GetReplies(ctx context.Context, commentIDs []string) ([]models.Comment, error) {
+	if len(commentIDs) == 0 {
+		return []models.Comment{}, nil
+	}
+
+	query := `
+		WITH RECURSIVE thread AS (
+			SELECT * FROM comments WHERE parent_id = ANY($1)
+			UNION ALL
+			SELECT c.* FROM comments c JOIN thread t ON c.parent_id = t.comment_id
+		)
+		SELECT * FROM thread ORDER BY created_at, comment_id
+	`
+
+	comments := []models.Comment{}
+	err := r.db.SelectContext(ctx, &comments, query, pq.Array(commentIDs))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении ответов на комментарии: %w", err)
+	}
+
+	return comments, nil
+}
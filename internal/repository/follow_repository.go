@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"microblogCPT/internal/models"
+	"time"
+)
+
+// PageCursor points at the last item of a page, the next page starts after it.
+// The items are ordered by the time and the id
+type PageCursor struct {
+	Time time.Time
+	ID   string
+}
+
+type FollowRepositoryImpl struct {
+	db *sqlx.DB
+}
+
+func NewFollowRepository(db *sqlx.DB) *FollowRepositoryImpl {
+	return &FollowRepositoryImpl{db: db}
+}
+
+// Follow subscribes the follower to the followee, following twice is not an error
+func (r *FollowRepositoryImpl) Follow(ctx context.Context, followerID, followeeID string) error {
+	query := `
+		INSERT INTO follows (follower_id, followee_id)
+		VALUES ($1, $2)
+		ON CONFLICT (follower_id, followee_id) DO NOTHING
+	`
+
+	_, err := r.db.ExecContext(ctx, query, followerID, followeeID)
+	if err != nil {
+		return fmt.Errorf("ошибка при создании подписки: %w", err)
+	}
+
+	return nil
+}
+
+// Unfollow removes the subscription, a missing one is not an error
+func (r *FollowRepositoryImpl) Unfollow(ctx context.Context, followerID, followeeID string) error {
+	query := `DELETE FROM follows WHERE follower_id = $1 AND followee_id = $2`
+
+	_, err := r.db.ExecContext(ctx, query, followerID, followeeID)
+	if err != nil {
+		return fmt.Errorf("ошибка при удалении подписки: %w", err)
+	}
+
+	return nil
+}
+
+// GetFollowers returns a page of the users following the user
+func (r *FollowRepositoryImpl) GetFollowers(ctx context.Context, userID string, cursor *PageCursor, limit int) ([]models.FollowUser, error) {
+	return r.list(ctx, "follower_id", "followee_id", userID, cursor, limit)
+}
+
+// GetFollowing returns a page of the users the user follows
+func (r *FollowRepositoryImpl) GetFollowing(ctx context.Context, userID string, cursor *PageCursor, limit int) ([]models.FollowUser, error) {
+	return r.list(ctx, "followee_id", "follower_id", userID, cursor, limit)
+}
+
+// list reads the users in the column listed of the follows where the column owner is the user
+func (r *FollowRepositoryImpl) list(ctx context.Context, listed, owner, userID string, cursor *PageCursor, limit int) ([]models.FollowUser, error) {
+	query := `
+		SELECT u.user_id, u.handle, u.display_name, f.created_at AS followed_at
+		FROM follows f
+		JOIN users u ON u.user_id = f.` + listed + `
+		WHERE f.` + owner + ` = $1`
+	args := []interface{}{userID}
+
+	if cursor != nil {
+		query += ` AND (f.created_at, f.` + listed + `) < ($2, $3)`
+		args = append(args, cursor.Time, cursor.ID)
+	}
+	query += fmt.Sprintf(` ORDER BY f.created_at DESC, f.%s DESC LIMIT $%d`, listed, len(args)+1)
+	args = append(args, limit)
+
+	users := []models.FollowUser{}
+	err := r.db.SelectContext(ctx, &users, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении подписок: %w", err)
+	}
+
+	return users, nil
+}
+
+// GetCounts returns the number of the followers of the user and of the users it follows
+func (r *FollowRepositoryImpl) GetCounts(ctx context.Context, userID string) (int, int, error) {
+	query := `
+		SELECT
+			(SELECT COUNT(*) FROM follows WHERE followee_id = $1) AS followers,
+			(SELECT COUNT(*) FROM follows WHERE follower_id = $1) AS following
+	`
+
+	var counts struct {
+		Followers int `db:"followers"`
+		Following int `db:"following"`
+	}
+	err := r.db.GetContext(ctx, &counts, query, userID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("ошибка при подсчете подписок: %w", err)
+	}
+
+	return counts.Followers, counts.Following, nil
+}
+
+// IsFollowing reports whether the follower follows the followee
+func (r *FollowRepositoryImpl) IsFollowing(ctx context.Context, followerID, followeeID string) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM follows WHERE follower_id = $1 AND followee_id = $2)`
+
+	var following bool
+	err := r.db.GetContext(ctx, &following, query, followerID, followeeID)
+	if err != nil {
+		return false, fmt.Errorf("ошибка при проверке подписки: %w", err)
+	}
+
+	return following, nil
+}
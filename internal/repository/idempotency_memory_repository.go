@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"microblogCPT/internal/models"
+	"sync"
+	"time"
+)
+
+type memoryIdempotencyEntry struct {
+	request models.IdempotentRequest
+	// done is closed when the request holding the key completes or releases it
+	done chan struct{}
+}
+
+// MemoryIdempotencyRepository keeps the keys in the process memory,
+// it suits a single instance of the server and tests
+type MemoryIdempotencyRepository struct {
+	mu      sync.Mutex
+	entries map[string]*memoryIdempotencyEntry
+}
+
+func NewMemoryIdempotencyRepository() *MemoryIdempotencyRepository {
+	return &MemoryIdempotencyRepository{entries: make(map[string]*memoryIdempotencyEntry)}
+}
+
+func memoryIdempotencyKey(request *models.IdempotentRequest) string {
+	return request.Principal + "\x00" + request.Method + "\x00" + request.Path + "\x00" + request.Key
+}
+
+func (r *MemoryIdempotencyRepository) Acquire(ctx context.Context, request *models.IdempotentRequest) (*models.IdempotentRequest, error) {
+	key := memoryIdempotencyKey(request)
+
+	for {
+		r.mu.Lock()
+
+		entry, ok := r.entries[key]
+		if ok && entry.request.ExpiresAt.Before(time.Now()) {
+			r.remove(key, entry)
+			ok = false
+		}
+
+		if !ok {
+			stored := *request
+			stored.CreatedAt = time.Now()
+			r.entries[key] = &memoryIdempotencyEntry{request: stored, done: make(chan struct{})}
+			r.mu.Unlock()
+			return nil, nil
+		}
+
+		if entry.request.RequestHash != request.RequestHash || entry.request.ResponseStatus != 0 {
+			existing := entry.request
+			r.mu.Unlock()
+			return &existing, nil
+		}
+
+		// the request with the same key is still running
+		done := entry.done
+		r.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-done:
+		}
+	}
+}
+
+func (r *MemoryIdempotencyRepository) Complete(ctx context.Context, request *models.IdempotentRequest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.entries[memoryIdempotencyKey(request)]
+	if !ok || entry.request.ResponseStatus != 0 {
+		return nil
+	}
+
+	entry.request.RequestHash = request.RequestHash
+	entry.request.ResponseStatus = request.ResponseStatus
+	entry.request.ResponseHeaders = request.ResponseHeaders
+	entry.request.ResponseBody = request.ResponseBody
+	entry.request.ExpiresAt = request.ExpiresAt
+	close(entry.done)
+
+	return nil
+}
+
+func (r *MemoryIdempotencyRepository) Release(ctx context.Context, request *models.IdempotentRequest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := memoryIdempotencyKey(request)
+	if entry, ok := r.entries[key]; ok && entry.request.ResponseStatus == 0 {
+		r.remove(key, entry)
+	}
+
+	return nil
+}
+
+func (r *MemoryIdempotencyRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deleted int64
+	now := time.Now()
+	for key, entry := range r.entries {
+		if entry.request.ExpiresAt.Before(now) {
+			r.remove(key, entry)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+// remove deletes the entry and wakes up the requests waiting for it, the caller holds the mutex
+func (r *MemoryIdempotencyRepository) remove(key string, entry *memoryIdempotencyEntry) {
+	delete(r.entries, key)
+	if entry.request.ResponseStatus == 0 {
+		close(entry.done)
+	}
+}
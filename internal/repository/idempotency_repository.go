@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"microblogCPT/internal/models"
+	"time"
+)
+
+// idempotencyPollInterval is how often a request waits for the result of a concurrent request with the same key
+const idempotencyPollInterval = 100 * time.Millisecond
+
+type IdempotencyRepositoryImpl struct {
+	db *sqlx.DB
+}
+
+func NewIdempotencyRepository(db *sqlx.DB) *IdempotencyRepositoryImpl {
+	return &IdempotencyRepositoryImpl{db: db}
+}
+
+func (r *IdempotencyRepositoryImpl) Acquire(ctx context.Context, request *models.IdempotentRequest) (*models.IdempotentRequest, error) {
+	for {
+		// an expired key, or a lock abandoned by a crashed request, can be used again
+		_, err := r.db.ExecContext(ctx, `
+			DELETE FROM idempotency_keys
+			WHERE principal = $1 AND method = $2 AND path = $3 AND idempotency_key = $4
+			AND expires_at < CURRENT_TIMESTAMP
+		`, request.Principal, request.Method, request.Path, request.Key)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при проверке idempotency key: %w", err)
+		}
+
+		result, err := r.db.ExecContext(ctx, `
+			INSERT INTO idempotency_keys (principal, method, path, idempotency_key, request_hash, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (principal, method, path, idempotency_key) DO NOTHING
+		`, request.Principal, request.Method, request.Path, request.Key, request.RequestHash, request.ExpiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при сохранении idempotency key: %w", err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при проверке сохраненных строк: %w", err)
+		}
+
+		if rowsAffected == 1 {
+			return nil, nil
+		}
+
+		var existing models.IdempotentRequest
+		err = r.db.GetContext(ctx, &existing, `
+			SELECT * FROM idempotency_keys
+			WHERE principal = $1 AND method = $2 AND path = $3 AND idempotency_key = $4
+		`, request.Principal, request.Method, request.Path, request.Key)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("ошибка при получении idempotency key: %w", err)
+		}
+
+		// the key was released in the meantime, try to take it again
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+
+		if existing.RequestHash != request.RequestHash || existing.ResponseStatus != 0 {
+			return &existing, nil
+		}
+
+		// the request with the same key is still running
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(idempotencyPollInterval):
+		}
+	}
+}
+
+func (r *IdempotencyRepositoryImpl) Complete(ctx context.Context, request *models.IdempotentRequest) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE idempotency_keys
+		SET response_status = $1, response_headers = $2, response_body = $3, expires_at = $4, request_hash = $5
+		WHERE principal = $6 AND method = $7 AND path = $8 AND idempotency_key = $9
+	`, request.ResponseStatus, request.ResponseHeaders, request.ResponseBody, request.ExpiresAt, request.RequestHash,
+		request.Principal, request.Method, request.Path, request.Key)
+	if err != nil {
+		return fmt.Errorf("ошибка при сохранении ответа: %w", err)
+	}
+
+	return nil
+}
+
+func (r *IdempotencyRepositoryImpl) Release(ctx context.Context, request *models.IdempotentRequest) error {
+	_, err := r.db.ExecContext(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE principal = $1 AND method = $2 AND path = $3 AND idempotency_key = $4 AND response_status = 0
+	`, request.Principal, request.Method, request.Path, request.Key)
+	if err != nil {
+		return fmt.Errorf("ошибка при освобождении idempotency key: %w", err)
+	}
+
+	return nil
+}
+
+func (r *IdempotencyRepositoryImpl) DeleteExpired(ctx context.Context) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at < CURRENT_TIMESTAMP`)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при удалении устаревших idempotency key: %w", err)
+	}
+
+	return result.RowsAffected()
+}
@@ -2,10 +2,12 @@ package repository
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"microblogCPT/internal/models"
 	"time"
 )
@@ -14,19 +16,43 @@ type ImageRepositoryImpl struct {
 	db *sqlx.DB
 }
 
+// errBlobNotFound is returned by Create when the image refers to a blob that is not stored,
+// the content has to be uploaded then
+var errBlobNotFound = errors.New("блоб изображения не найден")
+
 type CreateImageRequest struct {
-	PostID   string `json:"post_id"`
-	ImageURL string `json:"image_url"`
+	PostID    string `json:"post_id"`
+	ObjectKey string `json:"object_key"`
+}
+
+// ImageDetails are the texts of the image given with the upload
+type ImageDetails struct {
+	AltText string `json:"altText"`
+	Caption string `json:"caption"`
+}
+
+// UpdateImageRequest changes the image of the post, nil fields are left as they are
+type UpdateImageRequest struct {
+	PostID   string  `json:"-"`
+	ImageID  string  `json:"-"`
+	AltText  *string `json:"altText"`
+	Caption  *string `json:"caption"`
+	Position *int    `json:"position"`
 }
 
 func NewImageRepository(db *sqlx.DB) *ImageRepositoryImpl {
 	return &ImageRepositoryImpl{db: db}
 }
 
-func (r *ImageRepositoryImpl) Create(ctx context.Context, image *models.Image) error {
+// Create adds the image after the other images of the post and counts it in the usage of the post and of its author in one transaction.
+// The image is refused when the usage of the author goes over the quota of the author role.
+// An image with a BlobHash is also counted in its blob, see addBlobReference
+func (r *ImageRepositoryImpl) Create(ctx context.Context, image *models.Image, quotas map[string]models.StorageQuota) error {
 	query := `
-		INSERT INTO images (image_id, post_id, image_url, created_at)
-		VALUES (:image_id, :post_id, :image_url, :created_at)
+		INSERT INTO images (image_id, post_id, object_key, mime_type, width, height, size, created_at, blob_hash,
+			alt_text, caption, position)
+		VALUES (:image_id, :post_id, :object_key, :mime_type, :width, :height, :size, :created_at, :blob_hash,
+			:alt_text, :caption, :position)
 	`
 
 	// create id
@@ -39,28 +65,62 @@ func (r *ImageRepositoryImpl) Create(ctx context.Context, image *models.Image) e
 		image.CreatedAt = time.Now()
 	}
 
-	_, err := r.db.NamedExecContext(ctx, query, image)
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	if image.BlobHash != nil {
+		if err := addBlobReference(ctx, tx, image); err != nil {
+			return err
+		}
+	}
+
+	// a new image goes after the others
+	err = tx.GetContext(ctx, &image.Position, `SELECT COALESCE(MAX(position) + 1, 0) FROM images WHERE post_id = $1`, image.PostID)
+	if err != nil {
+		return fmt.Errorf("ошибка при создании изображения: %w", err)
+	}
+
+	_, err = tx.NamedExecContext(ctx, query, image)
 	if err != nil {
 		return fmt.Errorf("ошибка при создании изображения: %w", err)
 	}
 
+	usage, err := addStorageUsage(ctx, tx, image.PostID, image.Size, 1)
+	if err != nil {
+		return err
+	}
+
+	if quota, ok := quotas[usage.Role]; ok && QuotaExceeded(usage, quota) {
+		return QuotaError(quota)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка при подтверждении транзакции: %w", err)
+	}
+
 	return nil
 }
 
 func (r *ImageRepositoryImpl) GetByImageID(ctx context.Context, imageID string) (*models.Image, error) {
-	query := `SELECT * FROM images WHERE image_id = $1 ORDER BY created_at`
+	query := `SELECT * FROM images WHERE image_id = $1`
 
-	var image *models.Image
-	err := r.db.SelectContext(ctx, &image, query, imageID)
+	var image models.Image
+	err := r.db.GetContext(ctx, &image, query, imageID)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("изображение не найдено")
+		}
 		return nil, fmt.Errorf("ошибка получения изображения: %w", err)
 	}
 
-	return image, nil
+	return &image, nil
 }
 
 func (r *ImageRepositoryImpl) GetByPostID(ctx context.Context, postID string) ([]*models.Image, error) {
-	query := `SELECT * FROM images WHERE post_id = $1 ORDER BY created_at`
+	query := `SELECT * FROM images WHERE post_id = $1 ORDER BY position, created_at`
 
 	var images []*models.Image
 	err := r.db.SelectContext(ctx, &images, query, postID)
@@ -71,33 +131,389 @@ func (r *ImageRepositoryImpl) GetByPostID(ctx context.Context, postID string) ([
 	return images, nil
 }
 
-func (r *ImageRepositoryImpl) Delete(ctx context.Context, imageID string) error {
-	query := `DELETE FROM images WHERE image_id = $1`
+// GetByPostIDs loads the images of several posts with one query and groups them by post
+func (r *ImageRepositoryImpl) GetByPostIDs(ctx context.Context, postIDs []string) (map[string][]models.Image, error) {
+	imagesByPost := make(map[string][]models.Image, len(postIDs))
+	if len(postIDs) == 0 {
+		return imagesByPost, nil
+	}
+
+	query := `SELECT * FROM images WHERE post_id = ANY($1) ORDER BY position, created_at`
 
-	result, err := r.db.ExecContext(ctx, query, imageID)
+	var images []models.Image
+	err := r.db.SelectContext(ctx, &images, query, pq.Array(postIDs))
 	if err != nil {
-		return fmt.Errorf("ошибка при удалении изображения: %w", err)
+		return nil, fmt.Errorf("ошибка при получении изображений: %w", err)
+	}
+
+	for _, image := range images {
+		imagesByPost[image.PostID] = append(imagesByPost[image.PostID], image)
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	return imagesByPost, nil
+}
+
+// UpdateDetails changes the alt text and the caption of the image, nil values are kept
+func (r *ImageRepositoryImpl) UpdateDetails(ctx context.Context, imageID string, altText, caption *string) (*models.Image, error) {
+	query := `
+		UPDATE images SET
+			alt_text = COALESCE($2, alt_text),
+			caption = COALESCE($3, caption)
+		WHERE image_id = $1
+		RETURNING *
+	`
+
+	var image models.Image
+	err := r.db.GetContext(ctx, &image, query, imageID, altText, caption)
 	if err != nil {
-		return fmt.Errorf("ошибка при проверке удаленных строк: %w", err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("изображение не найдено")
+		}
+		return nil, fmt.Errorf("ошибка при обновлении изображения: %w", err)
 	}
 
-	if rowsAffected == 0 {
-		return errors.New("изображение не найдено")
+	return &image, nil
+}
+
+// Reorder gives the images of the post the positions of their ids in the list
+func (r *ImageRepositoryImpl) Reorder(ctx context.Context, postID string, imageIDs []string) error {
+	query := `
+		UPDATE images SET position = ordered.position - 1
+		FROM unnest($2::uuid[]) WITH ORDINALITY AS ordered(image_id, position)
+		WHERE images.image_id = ordered.image_id AND images.post_id = $1
+	`
+
+	_, err := r.db.ExecContext(ctx, query, postID, pq.Array(imageIDs))
+	if err != nil {
+		return fmt.Errorf("ошибка при изменении порядка изображений: %w", err)
 	}
 
 	return nil
 }
 
-func (r *ImageRepositoryImpl) DeleteByPostID(ctx context.Context, postID string) error {
-	query := `DELETE FROM images WHERE post_id = $1`
+// ClaimPendingVariants marks a batch of images and a batch of blobs waiting for variants as processing and
+// returns them. Only the images that own their object are queued, the images of a blob share its variants.
+// Rows locked by another instance are skipped, so every original is processed once. The rows claimed
+// before staleBefore and still processing were left by a worker that stopped, they are claimed again.
+// Every claim counts as an attempt
+func (r *ImageRepositoryImpl) ClaimPendingVariants(ctx context.Context, limit int, staleBefore time.Time) ([]models.VariantSource, error) {
+	query := `
+		WITH claimed_images AS (
+			UPDATE images SET
+				variants_status = 'processing',
+				variants_claimed_at = CURRENT_TIMESTAMP,
+				variants_attempts = variants_attempts + 1
+			WHERE image_id IN (
+				SELECT image_id FROM images
+				WHERE blob_hash IS NULL AND (variants_status = 'pending'
+				   OR (variants_status = 'processing' AND variants_claimed_at < $2))
+				ORDER BY created_at
+				LIMIT $1
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING image_id::text AS image_id, NULL::text AS blob_hash, object_key, variants_attempts
+		), claimed_blobs AS (
+			UPDATE image_blobs SET
+				variants_status = 'processing',
+				variants_claimed_at = CURRENT_TIMESTAMP,
+				variants_attempts = variants_attempts + 1
+			WHERE hash IN (
+				SELECT hash FROM image_blobs
+				WHERE variants_status = 'pending'
+				   OR (variants_status = 'processing' AND variants_claimed_at < $2)
+				ORDER BY created_at
+				LIMIT $1
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING NULL::text AS image_id, hash::text AS blob_hash, object_key, variants_attempts
+		)
+		SELECT * FROM claimed_images
+		UNION ALL SELECT * FROM claimed_blobs
+	`
 
-	_, err := r.db.ExecContext(ctx, query, postID)
+	sources := []models.VariantSource{}
+	err := r.db.SelectContext(ctx, &sources, query, limit, staleBefore)
 	if err != nil {
-		return fmt.Errorf("ошибка при удалении изображений поста: %w", err)
+		return nil, fmt.Errorf("ошибка при получении изображений без вариантов: %w", err)
+	}
+
+	return sources, nil
+}
+
+func (r *ImageRepositoryImpl) SetVariantsStatus(ctx context.Context, source models.VariantSource, status string) error {
+	query := `UPDATE images SET variants_status = $1 WHERE image_id = $2`
+	id := source.ImageID
+	if source.BlobHash != nil {
+		query = `UPDATE image_blobs SET variants_status = $1 WHERE hash = $2`
+		id = source.BlobHash
+	}
+
+	_, err := r.db.ExecContext(ctx, query, status, *id)
+	if err != nil {
+		return fmt.Errorf("ошибка при обновлении статуса вариантов: %w", err)
+	}
+
+	return nil
+}
+
+// ReleaseVariantClaims puts the claimed images and blobs that were not processed back to the queue,
+// the claim is not counted as an attempt
+func (r *ImageRepositoryImpl) ReleaseVariantClaims(ctx context.Context, sources []models.VariantSource) error {
+	var imageIDs, hashes []string
+	for _, source := range sources {
+		if source.BlobHash != nil {
+			hashes = append(hashes, *source.BlobHash)
+		} else {
+			imageIDs = append(imageIDs, *source.ImageID)
+		}
+	}
+
+	queue := []struct {
+		table, key string
+		ids        []string
+	}{
+		{"images", "image_id", imageIDs},
+		{"image_blobs", "hash", hashes},
+	}
+
+	for _, q := range queue {
+		if len(q.ids) == 0 {
+			continue
+		}
+
+		query := `
+			UPDATE ` + q.table + ` SET
+				variants_status = 'pending',
+				variants_claimed_at = NULL,
+				variants_attempts = GREATEST(variants_attempts - 1, 0)
+			WHERE ` + q.key + ` = ANY($1) AND variants_status = 'processing'
+		`
+
+		if _, err := r.db.ExecContext(ctx, query, pq.Array(q.ids)); err != nil {
+			return fmt.Errorf("ошибка при возврате изображений в очередь вариантов: %w", err)
+		}
 	}
 
 	return nil
 }
+
+// GetCreatedBefore returns the images created before the time, the reconciliation skips the newer ones
+func (r *ImageRepositoryImpl) GetCreatedBefore(ctx context.Context, before time.Time) ([]models.Image, error) {
+	query := `SELECT * FROM images WHERE created_at < $1 ORDER BY created_at`
+
+	images := []models.Image{}
+	err := r.db.SelectContext(ctx, &images, query, before)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении изображений: %w", err)
+	}
+
+	return images, nil
+}
+
+// ListObjectKeys returns the keys of all objects referenced by the database: the images, their blobs,
+// their variants, the uploads that are not attached yet and the profile images of the users
+func (r *ImageRepositoryImpl) ListObjectKeys(ctx context.Context) ([]string, error) {
+	query := `
+		SELECT object_key FROM images
+		UNION ALL SELECT object_key FROM image_blobs
+		UNION ALL SELECT object_key FROM image_variants
+		UNION ALL SELECT object_key FROM image_uploads
+		UNION ALL SELECT object_key FROM tus_uploads
+		UNION ALL SELECT object_key FROM user_images
+	`
+
+	keys := []string{}
+	err := r.db.SelectContext(ctx, &keys, query)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении ключей объектов: %w", err)
+	}
+
+	return keys, nil
+}
+
+// SetSize corrects the size of the image, the usage counters are rebuilt afterwards
+func (r *ImageRepositoryImpl) SetSize(ctx context.Context, imageID string, size int64) error {
+	query := `UPDATE images SET size = $1 WHERE image_id = $2`
+
+	_, err := r.db.ExecContext(ctx, query, size, imageID)
+	if err != nil {
+		return fmt.Errorf("ошибка при обновлении размера изображения: %w", err)
+	}
+
+	return nil
+}
+
+// Delete removes the image and takes it out of the usage of the post and of its author.
+// It returns the keys of the objects no image refers to anymore, the caller removes them after the commit
+func (r *ImageRepositoryImpl) Delete(ctx context.Context, imageID string) ([]string, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	deleted, released, err := deleteImages(ctx, tx, "image_id = $1", imageID)
+	if err != nil {
+		return nil, err
+	}
+	if deleted == 0 {
+		return nil, errors.New("изображение не найдено")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка при подтверждении транзакции: %w", err)
+	}
+
+	return released, nil
+}
+
+// DeleteByPostID removes the images of the post and returns the keys of the released objects
+func (r *ImageRepositoryImpl) DeleteByPostID(ctx context.Context, postID string) ([]string, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, released, err := deleteImages(ctx, tx, "post_id = $1", postID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка при подтверждении транзакции: %w", err)
+	}
+
+	return released, nil
+}
+
+// deleteImages removes the images matching the condition inside the transaction, takes them out of the usage
+// and out of their blobs. It returns the number of removed images and the keys of the objects that are
+// not referenced anymore: the objects of the images without a blob, the objects of the blobs that lost
+// their last image, and the variants of both
+func deleteImages(ctx context.Context, tx *sqlx.Tx, condition string, arg string) (int, []string, error) {
+	// the variants are removed explicitly, so their keys are known before the cascade
+	var variants []models.ImageVariant
+	err := tx.SelectContext(ctx, &variants, `
+		DELETE FROM image_variants
+		WHERE image_id IN (SELECT image_id FROM images WHERE `+condition+`)
+		RETURNING image_id, object_key
+	`, arg)
+	if err != nil {
+		return 0, nil, fmt.Errorf("ошибка при удалении вариантов изображений: %w", err)
+	}
+
+	var images []models.Image
+	err = tx.SelectContext(ctx, &images, `
+		DELETE FROM images WHERE `+condition+`
+		RETURNING image_id, post_id, object_key, size, blob_hash
+	`, arg)
+	if err != nil {
+		return 0, nil, fmt.Errorf("ошибка при удалении изображений: %w", err)
+	}
+
+	variantKeys := make(map[string][]string, len(images))
+	for _, variant := range variants {
+		variantKeys[variant.ImageID] = append(variantKeys[variant.ImageID], variant.ObjectKey)
+	}
+
+	released := []string{}
+	var postIDs []string
+	bytes := make(map[string]int64)
+	objects := make(map[string]int)
+	for _, image := range images {
+		if _, ok := objects[image.PostID]; !ok {
+			postIDs = append(postIDs, image.PostID)
+		}
+		bytes[image.PostID] += image.Size
+		objects[image.PostID]++
+
+		// the object of a blob and the variants made from it stay while other images use them
+		if image.BlobHash != nil {
+			last, blobVariantKeys, err := releaseBlob(ctx, tx, *image.BlobHash)
+			if err != nil {
+				return 0, nil, err
+			}
+			if !last {
+				continue
+			}
+			released = append(released, blobVariantKeys...)
+		}
+
+		released = append(released, image.ObjectKey)
+		released = append(released, variantKeys[image.ImageID]...)
+	}
+
+	for _, postID := range postIDs {
+		if _, err := addStorageUsage(ctx, tx, postID, -bytes[postID], -objects[postID]); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	return len(images), released, nil
+}
+
+// addBlobReference counts the image in the blob of its content. An image with an object key stores
+// a new blob under that key, and when the blob is already there the image takes the key of the blob,
+// so the caller removes the object it wrote. An image without the key only refers to a stored blob
+// and gets errBlobNotFound when there is none
+func addBlobReference(ctx context.Context, tx *sqlx.Tx, image *models.Image) error {
+	var objectKey string
+	var err error
+
+	if image.ObjectKey == "" {
+		err = tx.GetContext(ctx, &objectKey, `
+			UPDATE image_blobs SET ref_count = ref_count + 1
+			WHERE hash = $1
+			RETURNING object_key
+		`, *image.BlobHash)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errBlobNotFound
+		}
+	} else {
+		err = tx.GetContext(ctx, &objectKey, `
+			INSERT INTO image_blobs AS b (hash, object_key, mime_type, size, ref_count, created_at)
+			VALUES ($1, $2, $3, $4, 1, $5)
+			ON CONFLICT (hash) DO UPDATE SET ref_count = b.ref_count + 1
+			RETURNING b.object_key
+		`, *image.BlobHash, image.ObjectKey, image.MimeType, image.Size, image.CreatedAt)
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка при сохранении блоба изображения: %w", err)
+	}
+
+	image.ObjectKey = objectKey
+	return nil
+}
+
+// releaseBlob takes one image out of the blob and removes the blob with its last image.
+// It reports whether the blob was removed, then its object is not referenced anymore,
+// and returns the keys of the variants of the removed blob
+func releaseBlob(ctx context.Context, tx *sqlx.Tx, hash string) (bool, []string, error) {
+	var refCount int
+	err := tx.GetContext(ctx, &refCount, `
+		UPDATE image_blobs SET ref_count = ref_count - 1
+		WHERE hash = $1
+		RETURNING ref_count
+	`, hash)
+	if err != nil {
+		return false, nil, fmt.Errorf("ошибка при освобождении блоба изображения: %w", err)
+	}
+
+	if refCount > 0 {
+		return false, nil, nil
+	}
+
+	// the variants are removed explicitly, so their keys are known before the cascade
+	variantKeys := []string{}
+	err = tx.SelectContext(ctx, &variantKeys, `DELETE FROM image_variants WHERE blob_hash = $1 RETURNING object_key`, hash)
+	if err != nil {
+		return false, nil, fmt.Errorf("ошибка при удалении вариантов блоба изображения: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM image_blobs WHERE hash = $1`, hash); err != nil {
+		return false, nil, fmt.Errorf("ошибка при освобождении блоба изображения: %w", err)
+	}
+
+	return true, variantKeys, nil
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"microblogCPT/internal/models"
+	"time"
+)
+
+type ImageUploadRepositoryImpl struct {
+	db *sqlx.DB
+}
+
+type CreateImageUploadRequest struct {
+	PostID      string `json:"post_id"`
+	AuthorID    string `json:"author_id"`
+	FileName    string `json:"file_name"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+func NewImageUploadRepository(db *sqlx.DB) *ImageUploadRepositoryImpl {
+	return &ImageUploadRepositoryImpl{db: db}
+}
+
+func (r *ImageUploadRepositoryImpl) Create(ctx context.Context, upload *models.ImageUpload) error {
+	query := `
+		INSERT INTO image_uploads
+		(upload_id, post_id, author_id, object_key, file_name, content_type, size, created_at, expires_at)
+		VALUES
+		(:upload_id, :post_id, :author_id, :object_key, :file_name, :content_type, :size, :created_at, :expires_at)
+	`
+
+	// create id
+	if upload.UploadID == "" {
+		upload.UploadID = uuid.New().String()
+	}
+
+	// create time created
+	if upload.CreatedAt.IsZero() {
+		upload.CreatedAt = time.Now()
+	}
+
+	_, err := r.db.NamedExecContext(ctx, query, upload)
+	if err != nil {
+		return fmt.Errorf("ошибка при создании загрузки: %w", err)
+	}
+
+	return nil
+}
+
+func (r *ImageUploadRepositoryImpl) GetByID(ctx context.Context, uploadID string) (*models.ImageUpload, error) {
+	query := `SELECT * FROM image_uploads WHERE upload_id = $1`
+
+	var upload models.ImageUpload
+	err := r.db.GetContext(ctx, &upload, query, uploadID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("загрузка не найдена")
+		}
+		return nil, fmt.Errorf("ошибка при получении загрузки: %w", err)
+	}
+
+	return &upload, nil
+}
+
+// GetExpired returns the uploads that were not completed before their url expired
+func (r *ImageUploadRepositoryImpl) GetExpired(ctx context.Context, before time.Time) ([]models.ImageUpload, error) {
+	query := `SELECT * FROM image_uploads WHERE expires_at < $1 ORDER BY expires_at`
+
+	uploads := []models.ImageUpload{}
+	err := r.db.SelectContext(ctx, &uploads, query, before)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении устаревших загрузок: %w", err)
+	}
+
+	return uploads, nil
+}
+
+func (r *ImageUploadRepositoryImpl) Delete(ctx context.Context, uploadID string) error {
+	query := `DELETE FROM image_uploads WHERE upload_id = $1`
+
+	_, err := r.db.ExecContext(ctx, query, uploadID)
+	if err != nil {
+		return fmt.Errorf("ошибка при удалении загрузки: %w", err)
+	}
+
+	return nil
+}
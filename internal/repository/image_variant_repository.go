@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"microblogCPT/internal/models"
+	"time"
+)
+
+type ImageVariantRepositoryImpl struct {
+	db *sqlx.DB
+}
+
+func NewImageVariantRepository(db *sqlx.DB) *ImageVariantRepositoryImpl {
+	return &ImageVariantRepositoryImpl{db: db}
+}
+
+// Create stores the variant of an image, or of a blob when BlobHash is set
+func (r *ImageVariantRepositoryImpl) Create(ctx context.Context, variant *models.ImageVariant) error {
+	conflict := `(image_id, mime_type, width) WHERE image_id IS NOT NULL`
+	if variant.BlobHash != nil {
+		conflict = `(blob_hash, mime_type, width) WHERE blob_hash IS NOT NULL`
+	}
+
+	query := `
+		INSERT INTO image_variants (image_id, blob_hash, object_key, mime_type, width, height, size, created_at)
+		VALUES (CAST(NULLIF(:image_id, '') AS uuid), :blob_hash, :object_key, :mime_type, :width, :height, :size, :created_at)
+		ON CONFLICT ` + conflict + ` DO UPDATE
+		SET object_key = EXCLUDED.object_key, height = EXCLUDED.height, size = EXCLUDED.size
+	`
+
+	// create time created
+	if variant.CreatedAt.IsZero() {
+		variant.CreatedAt = time.Now()
+	}
+
+	_, err := r.db.NamedExecContext(ctx, query, variant)
+	if err != nil {
+		return fmt.Errorf("ошибка при создании варианта изображения: %w", err)
+	}
+
+	return nil
+}
+
+// GetByImageIDs loads the variants of several images with one query, the images of a blob get the variants
+// of the blob. Each list goes from the narrowest
+func (r *ImageVariantRepositoryImpl) GetByImageIDs(ctx context.Context, imageIDs []string) (map[string][]models.ImageVariant, error) {
+	variantsByImage := make(map[string][]models.ImageVariant, len(imageIDs))
+	if len(imageIDs) == 0 {
+		return variantsByImage, nil
+	}
+
+	query := `
+		SELECT v.image_id, v.object_key, v.mime_type, v.width, v.height, v.size, v.created_at
+		FROM image_variants v WHERE v.image_id = ANY($1)
+		UNION ALL
+		SELECT i.image_id, v.object_key, v.mime_type, v.width, v.height, v.size, v.created_at
+		FROM images i JOIN image_variants v ON v.blob_hash = i.blob_hash WHERE i.image_id = ANY($1)
+		ORDER BY width, mime_type
+	`
+
+	var variants []models.ImageVariant
+	err := r.db.SelectContext(ctx, &variants, query, pq.Array(imageIDs))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении вариантов изображений: %w", err)
+	}
+
+	for _, variant := range variants {
+		variantsByImage[variant.ImageID] = append(variantsByImage[variant.ImageID], variant)
+	}
+
+	return variantsByImage, nil
+}
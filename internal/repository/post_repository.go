@@ -13,6 +13,10 @@ import (
 	"github.com/jmoiron/sqlx"
 )
 
+// notDeleted is the shared scope of active posts, every query that reads or changes
+// active posts must include it so that posts in the trash stay hidden
+const notDeleted = "deleted_at IS NULL"
+
 type PostRepositoryImpl struct {
 	DB *sqlx.DB
 }
@@ -24,17 +28,22 @@ type CreatePostRequest struct {
 	Content        string  `json:"content"`
 }
 
+// PostCreatedResponse renders the response sent for the created post. It is stored with the idempotency key
+// and replayed as is to the retries
+type PostCreatedResponse func(post *models.Post) (int, []byte, error)
+
 type UpdatePostRequest struct {
 	PostID  string `json:"post_id"`
 	Title   string `json:"title"`
 	Content string `json:"content"`
+	Version int    `json:"version"`
 }
 
 func NewPostRepository(db *sqlx.DB) *PostRepositoryImpl {
 	return &PostRepositoryImpl{DB: db}
 }
 
-func (r *PostRepositoryImpl) Create(ctx context.Context, post *models.Post, imagesURL []string) error {
+func (r *PostRepositoryImpl) Create(ctx context.Context, post *models.Post, objectKeys []string) error {
 	query := `
         INSERT INTO posts 
         (post_id, author_id, idempotency_key, title, content, status, created_at, updated_at)
@@ -44,16 +53,112 @@ func (r *PostRepositoryImpl) Create(ctx context.Context, post *models.Post, imag
 
 	// recording images in DB
 	imageRepositoryImpl := ImageRepositoryImpl{db: r.DB}
-	for _, imageURL := range imagesURL {
+	for _, objectKey := range objectKeys {
 
 		image := models.Image{
-			PostID:   post.PostID,
-			ImageURL: imageURL,
+			PostID:    post.PostID,
+			ObjectKey: objectKey,
+		}
+
+		imageRepositoryImpl.Create(ctx, &image, nil)
+	}
+
+	return insertPost(ctx, r.DB, query, post)
+}
+
+// CreateIdempotent creates the post and reserves its idempotency key for the author in one transaction,
+// together with the response rendered for the created post.
+// If the key is already taken, the post is not created and the stored record of the key is returned instead
+func (r *PostRepositoryImpl) CreateIdempotent(ctx context.Context, post *models.Post, requestHash string, response PostCreatedResponse, ttl time.Duration) (*models.IdempotencyKey, error) {
+	tx, err := r.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	// an expired key can be used again
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM post_idempotency_keys
+		WHERE author_id = $1 AND idempotency_key = $2 AND expires_at < CURRENT_TIMESTAMP
+	`, post.AuthorID, *post.IdempotencyKey)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при проверке idempotency key: %w", err)
+	}
+
+	// a concurrent request with the same key waits here until the first one finishes
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO post_idempotency_keys (author_id, idempotency_key, request_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (author_id, idempotency_key) DO NOTHING
+	`, post.AuthorID, *post.IdempotencyKey, requestHash, time.Now().Add(ttl))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при сохранении idempotency key: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при проверке сохраненных строк: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		var existingKey models.IdempotencyKey
+		err = tx.GetContext(ctx, &existingKey, `
+			SELECT * FROM post_idempotency_keys
+			WHERE author_id = $1 AND idempotency_key = $2
+		`, post.AuthorID, *post.IdempotencyKey)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при получении idempotency key: %w", err)
 		}
 
-		imageRepositoryImpl.Create(ctx, &image)
+		return &existingKey, nil
+	}
+
+	query := `
+        INSERT INTO posts 
+        (post_id, author_id, idempotency_key, title, content, status, created_at, updated_at)
+        VALUES 
+        (:post_id, :author_id, :idempotency_key, :title, :content, :status, :created_at, :updated_at)
+    `
+
+	if err := insertPost(ctx, tx, query, post); err != nil {
+		return nil, err
+	}
+
+	// the response is rendered once the post has its id and times, retries get exactly the same one
+	responseStatus, responseBody, err := response(post)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при сохранении ответа: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE post_idempotency_keys
+		SET response_status = $1, response_body = $2
+		WHERE author_id = $3 AND idempotency_key = $4
+	`, responseStatus, responseBody, post.AuthorID, *post.IdempotencyKey)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при сохранении ответа: %w", err)
 	}
 
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка при создании поста: %w", err)
+	}
+
+	return nil, nil
+}
+
+// DeleteExpiredIdempotencyKeys removes the keys whose time to live has ended
+func (r *PostRepositoryImpl) DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	query := `DELETE FROM post_idempotency_keys WHERE expires_at < CURRENT_TIMESTAMP`
+
+	result, err := r.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при удалении устаревших idempotency key: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+func insertPost(ctx context.Context, db sqlx.ExtContext, query string, post *models.Post) error {
 	// create id
 	if post.PostID == "" {
 		post.PostID = uuid.New().String()
@@ -64,7 +169,10 @@ func (r *PostRepositoryImpl) Create(ctx context.Context, post *models.Post, imag
 	post.CreatedAt = now
 	post.UpdatedAt = now
 
-	_, err := r.DB.NamedExecContext(ctx, query, post)
+	// a new post always starts with the first version
+	post.Version = 1
+
+	_, err := sqlx.NamedExecContext(ctx, db, query, post)
 	if err != nil {
 		if strings.Contains(err.Error(), "duplicate key value") &&
 			strings.Contains(err.Error(), "idempotency_key") {
@@ -79,8 +187,7 @@ func (r *PostRepositoryImpl) Create(ctx context.Context, post *models.Post, imag
 func (r *PostRepositoryImpl) GetByID(ctx context.Context, postID string) (*models.Post, error) {
 	query := `
         SELECT * FROM posts 
-        WHERE post_id = $1
-    `
+        WHERE post_id = $1 AND ` + notDeleted
 
 	var post models.Post
 	err := r.DB.GetContext(ctx, &post, query, postID)
@@ -97,7 +204,7 @@ func (r *PostRepositoryImpl) GetByID(ctx context.Context, postID string) (*model
 func (r *PostRepositoryImpl) GetByUserID(ctx context.Context, userID string) ([]models.Post, error) {
 	query := `
         SELECT * FROM posts 
-        WHERE author_id = $1
+        WHERE author_id = $1 AND ` + notDeleted + `
         ORDER BY created_at DESC
     `
 
@@ -113,10 +220,48 @@ func (r *PostRepositoryImpl) GetByUserID(ctx context.Context, userID string) ([]
 	return posts, nil
 }
 
+// CountPublishedByAuthor returns the number of the published posts of the author that are not in the trash
+func (r *PostRepositoryImpl) CountPublishedByAuthor(ctx context.Context, authorID string) (int, error) {
+	query := `SELECT COUNT(*) FROM posts WHERE author_id = $1 AND status = 'Published' AND ` + notDeleted
+
+	var count int
+	err := r.DB.GetContext(ctx, &count, query, authorID)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при подсчете постов: %w", err)
+	}
+
+	return count, nil
+}
+
+// GetByFollowedAuthors reads the timeline on request: the posts of the followed authors are merged
+// by the index on (author_id, published_at, post_id) of the published posts
+func (r *PostRepositoryImpl) GetByFollowedAuthors(ctx context.Context, followerID string, cursor *PageCursor, limit int) ([]models.Post, error) {
+	query := `
+		SELECT p.* FROM posts p
+		JOIN follows f ON f.followee_id = p.author_id
+		WHERE f.follower_id = $1 AND p.status = 'Published' AND p.` + notDeleted
+	args := []interface{}{followerID}
+
+	if cursor != nil {
+		query += ` AND (p.published_at, p.post_id) < ($2, $3)`
+		args = append(args, cursor.Time, cursor.ID)
+	}
+	query += fmt.Sprintf(` ORDER BY p.published_at DESC, p.post_id DESC LIMIT $%d`, len(args)+1)
+	args = append(args, limit)
+
+	posts := []models.Post{}
+	err := r.DB.SelectContext(ctx, &posts, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении ленты: %w", err)
+	}
+
+	return posts, nil
+}
+
 func (r *PostRepositoryImpl) GetPublishPosts(ctx context.Context) ([]models.Post, error) {
 	query := `
         SELECT * FROM posts 
-        WHERE status = 'Published'
+        WHERE status = 'Published' AND ` + notDeleted + `
         ORDER BY created_at DESC
     `
 
@@ -124,7 +269,7 @@ func (r *PostRepositoryImpl) GetPublishPosts(ctx context.Context) ([]models.Post
 	err := r.DB.SelectContext(ctx, &posts, query)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("пост пользователя %s не найден")
+			return nil, fmt.Errorf("опубликованные посты не найдены")
 		}
 		return nil, fmt.Errorf("ошибка при получении поста: %w", err)
 	}
@@ -142,18 +287,30 @@ func (r *PostRepositoryImpl) Update(ctx context.Context, post *models.Post) erro
 		return errors.New("нельзя изменить автора поста")
 	}
 
+	if existingPost.Version != post.Version {
+		return fmt.Errorf("версия поста устарела: текущая версия %d", existingPost.Version)
+	}
+
+	// the version condition protects against a concurrent update between the read and the write
 	query := `
 		UPDATE posts SET
 			title = :title,
 			content = :content,
 			status = :status,
-			updated_at = :updated_at
-		WHERE post_id = :post_id AND author_id = :author_id
-	`
+			updated_at = :updated_at,
+			version = version + 1
+		WHERE post_id = :post_id AND author_id = :author_id AND version = :version AND ` + notDeleted
 
 	post.UpdatedAt = time.Now()
 
-	result, err := r.DB.NamedExecContext(ctx, query, post)
+	// the update and its revision are written in one transaction
+	tx, err := r.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.NamedExecContext(ctx, query, post)
 	if err != nil {
 		return fmt.Errorf("ошибка при обновлении поста: %w", err)
 	}
@@ -164,14 +321,58 @@ func (r *PostRepositoryImpl) Update(ctx context.Context, post *models.Post) erro
 	}
 
 	if rowsAffected == 0 {
-		return errors.New("пост не найден или у вас нет прав на его изменение")
+		return errors.New("версия поста устарела: пост был изменен другим запросом")
+	}
+
+	// the row is locked by the update, so the revision number is safe to compute
+	var lastRevision int
+	err = tx.GetContext(ctx, &lastRevision,
+		`SELECT COALESCE(MAX(revision), 0) FROM post_revisions WHERE post_id = $1`, post.PostID)
+	if err != nil {
+		return fmt.Errorf("ошибка при получении ревизий поста: %w", err)
+	}
+
+	// the first update also saves the original version of the post
+	if lastRevision == 0 {
+		lastRevision++
+		err = insertRevision(ctx, tx, &models.PostRevision{
+			PostID:    existingPost.PostID,
+			Revision:  lastRevision,
+			Title:     existingPost.Title,
+			Content:   existingPost.Content,
+			CreatedAt: existingPost.UpdatedAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err = insertRevision(ctx, tx, &models.PostRevision{
+		PostID:    post.PostID,
+		Revision:  lastRevision + 1,
+		Title:     post.Title,
+		Content:   post.Content,
+		CreatedAt: post.UpdatedAt,
+	})
+	if err != nil {
+		return err
 	}
 
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка при сохранении обновления поста: %w", err)
+	}
+
+	post.Version++
+
 	return nil
 }
 
+// Delete moves the post to the trash, the post and its images are kept until the purge
 func (r *PostRepositoryImpl) Delete(ctx context.Context, postID string) error {
-	query := `DELETE FROM posts WHERE post_id = $1`
+	query := `
+		UPDATE posts SET
+			deleted_at = CURRENT_TIMESTAMP
+		WHERE post_id = $1 AND ` + notDeleted
 
 	result, err := r.DB.ExecContext(ctx, query, postID)
 	if err != nil {
@@ -187,55 +388,124 @@ func (r *PostRepositoryImpl) Delete(ctx context.Context, postID string) error {
 		return errors.New("пост не найден")
 	}
 
-	imageRepositoryImpl := ImageRepositoryImpl{r.DB}
-	err = imageRepositoryImpl.DeleteByPostID(ctx, postID)
-	if err != nil {
-		return err
-	}
-
 	return nil
 }
 
-func (r *PostRepositoryImpl) Publish(ctx context.Context, postID string) error {
+func (r *PostRepositoryImpl) Restore(ctx context.Context, postID, authorID string) error {
 	query := `
 		UPDATE posts SET
-			status = 'Published',
-			updated_at = CURRENT_TIMESTAMP
-		WHERE post_id = $1 AND status = 'Draft'
+			deleted_at = NULL
+		WHERE post_id = $1 AND author_id = $2 AND deleted_at IS NOT NULL
 	`
 
-	result, err := r.DB.ExecContext(ctx, query, postID)
+	result, err := r.DB.ExecContext(ctx, query, postID, authorID)
 	if err != nil {
-		return fmt.Errorf("ошибка при публикации поста: %w", err)
+		return fmt.Errorf("ошибка при восстановлении поста: %w", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("ошибка при проверке обновленных строк: %w", err)
+		return fmt.Errorf("ошибка при проверке восстановленных строк: %w", err)
 	}
 
 	if rowsAffected == 0 {
-		return errors.New("пост не найден или уже опубликован")
+		return errors.New("пост не найден в корзине")
 	}
 
 	return nil
 }
 
-func (r *PostRepositoryImpl) CheckIdempotencyKey(ctx context.Context, authorID, idempotencyKey string) (bool, error) {
-	if idempotencyKey == "" {
-		return true, nil
+func (r *PostRepositoryImpl) GetDeletedByUserID(ctx context.Context, userID string) ([]models.Post, error) {
+	query := `
+        SELECT * FROM posts 
+        WHERE author_id = $1 AND deleted_at IS NOT NULL
+        ORDER BY deleted_at DESC
+    `
+
+	posts := []models.Post{}
+	err := r.DB.SelectContext(ctx, &posts, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении корзины: %w", err)
 	}
 
+	return posts, nil
+}
+
+func (r *PostRepositoryImpl) GetDeletedBefore(ctx context.Context, before time.Time) ([]models.Post, error) {
 	query := `
-		SELECT COUNT(*) FROM posts 
-		WHERE author_id = $1 AND idempotency_key = $2
-	`
+        SELECT * FROM posts 
+        WHERE deleted_at IS NOT NULL AND deleted_at < $1
+        ORDER BY deleted_at
+    `
 
-	var count int
-	err := r.DB.GetContext(ctx, &count, query, authorID, idempotencyKey)
+	var posts []models.Post
+	err := r.DB.SelectContext(ctx, &posts, query, before)
 	if err != nil {
-		return false, fmt.Errorf("ошибка при проверке idempotency key: %w", err)
+		return nil, fmt.Errorf("ошибка при получении удаленных постов: %w", err)
 	}
 
-	return count == 0, nil
+	return posts, nil
+}
+
+// Purge removes the post for good. The images go first in the same transaction,
+// so they are taken out of the storage usage of the author and out of their blobs.
+// It returns the keys of the objects no image refers to anymore
+func (r *PostRepositoryImpl) Purge(ctx context.Context, postID string) ([]string, error) {
+	query := `DELETE FROM posts WHERE post_id = $1`
+
+	tx, err := r.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, released, err := deleteImages(ctx, tx, "post_id = $1", postID)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := tx.ExecContext(ctx, query, postID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при удалении поста: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при проверке удаленных строк: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return nil, errors.New("пост не найден")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка при подтверждении транзакции: %w", err)
+	}
+
+	return released, nil
+}
+
+func (r *PostRepositoryImpl) Publish(ctx context.Context, postID string) error {
+	query := `
+		UPDATE posts SET
+			status = 'Published',
+			published_at = CURRENT_TIMESTAMP,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE post_id = $1 AND status = 'Draft' AND ` + notDeleted
+
+	result, err := r.DB.ExecContext(ctx, query, postID)
+	if err != nil {
+		return fmt.Errorf("ошибка при публикации поста: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка при проверке обновленных строк: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("пост не найден или уже опубликован")
+	}
+
+	return nil
 }
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"microblogCPT/internal/models"
+)
+
+type PostRevisionRepositoryImpl struct {
+	db *sqlx.DB
+}
+
+func NewPostRevisionRepository(db *sqlx.DB) *PostRevisionRepositoryImpl {
+	return &PostRevisionRepositoryImpl{db: db}
+}
+
+func (r *PostRevisionRepositoryImpl) GetByPostID(ctx context.Context, postID string) ([]models.PostRevision, error) {
+	query := `
+		SELECT * FROM post_revisions
+		WHERE post_id = $1
+		ORDER BY revision DESC
+	`
+
+	revisions := []models.PostRevision{}
+	err := r.db.SelectContext(ctx, &revisions, query, postID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении ревизий поста: %w", err)
+	}
+
+	return revisions, nil
+}
+
+func (r *PostRevisionRepositoryImpl) GetByRevision(ctx context.Context, postID string, revision int) (*models.PostRevision, error) {
+	query := `
+		SELECT * FROM post_revisions
+		WHERE post_id = $1 AND revision = $2
+	`
+
+	var postRevision models.PostRevision
+	err := r.db.GetContext(ctx, &postRevision, query, postID, revision)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("ревизия %d поста %s не найдена", revision, postID)
+		}
+		return nil, fmt.Errorf("ошибка при получении ревизии поста: %w", err)
+	}
+
+	return &postRevision, nil
+}
+
+// insertRevision records a revision inside the transaction of the post update
+func insertRevision(ctx context.Context, tx *sqlx.Tx, revision *models.PostRevision) error {
+	query := `
+		INSERT INTO post_revisions (post_id, revision, title, content, created_at)
+		VALUES (:post_id, :revision, :title, :content, :created_at)
+	`
+
+	_, err := tx.NamedExecContext(ctx, query, revision)
+	if err != nil {
+		return fmt.Errorf("ошибка при сохранении ревизии поста: %w", err)
+	}
+
+	return nil
+}
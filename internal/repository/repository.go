@@ -11,30 +11,123 @@ type UserRepository interface {
 	CreateUser(ctx context.Context, user *models.User, password string) error
 	GetUserByID(ctx context.Context, userID string) (*models.User, error)
 	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	GetUserByHandle(ctx context.Context, handle string) (*models.User, error)
+	GetUsersByIDs(ctx context.Context, userIDs []string) ([]models.User, error)
+	GetHandleRedirect(ctx context.Context, handle string) (string, error)
+	UpdateProfile(ctx context.Context, user *models.User, previousHandle string, changeInterval time.Duration, redirectUntil time.Time) error
 	UpdateUser(ctx context.Context, user *models.User) error
-	DeleteUser(ctx context.Context, userID string) error
+	// DeleteUser returns the keys of the stored objects released by the removed account
+	DeleteUser(ctx context.Context, userID string) ([]string, error)
 	VerifyPassword(ctx context.Context, email, password string) (*models.User, error)
 	UpdateRefreshToken(ctx context.Context, userID, refreshToken string, expiryTime time.Time) error
 	GetUserByRefreshToken(ctx context.Context, refreshToken string) (*models.User, error)
 }
 
 type PostRepository interface {
-	Create(ctx context.Context, post *models.Post, imagesURL []string) error
+	Create(ctx context.Context, post *models.Post, objectKeys []string) error
 	GetByID(ctx context.Context, postID string) (*models.Post, error)
 	GetByUserID(ctx context.Context, userID string) ([]models.Post, error)
 	GetPublishPosts(ctx context.Context) ([]models.Post, error)
+	CountPublishedByAuthor(ctx context.Context, authorID string) (int, error)
+	// GetByFollowedAuthors returns a page of the published posts of the authors the user follows, newest first
+	GetByFollowedAuthors(ctx context.Context, followerID string, cursor *PageCursor, limit int) ([]models.Post, error)
 	Update(ctx context.Context, post *models.Post) error
 	Delete(ctx context.Context, postID string) error
+	Restore(ctx context.Context, postID, authorID string) error
+	GetDeletedByUserID(ctx context.Context, userID string) ([]models.Post, error)
+	GetDeletedBefore(ctx context.Context, before time.Time) ([]models.Post, error)
+	Purge(ctx context.Context, postID string) ([]string, error)
 	Publish(ctx context.Context, postID string) error
-	CheckIdempotencyKey(ctx context.Context, authorID, idempotencyKey string) (bool, error)
+	CreateIdempotent(ctx context.Context, post *models.Post, requestHash string, response PostCreatedResponse, ttl time.Duration) (*models.IdempotencyKey, error)
+	DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error)
 }
 
 type ImageRepository interface {
-	Create(ctx context.Context, image *models.Image) error
+	Create(ctx context.Context, image *models.Image, quotas map[string]models.StorageQuota) error
 	GetByImageID(ctx context.Context, imageID string) (*models.Image, error)
 	GetByPostID(ctx context.Context, postID string) ([]*models.Image, error)
-	Delete(ctx context.Context, imageID string) error
-	DeleteByPostID(ctx context.Context, postID string) error
+	GetByPostIDs(ctx context.Context, postIDs []string) (map[string][]models.Image, error)
+	ClaimPendingVariants(ctx context.Context, limit int, staleBefore time.Time) ([]models.VariantSource, error)
+	SetVariantsStatus(ctx context.Context, source models.VariantSource, status string) error
+	ReleaseVariantClaims(ctx context.Context, sources []models.VariantSource) error
+	GetCreatedBefore(ctx context.Context, before time.Time) ([]models.Image, error)
+	ListObjectKeys(ctx context.Context) ([]string, error)
+	SetSize(ctx context.Context, imageID string, size int64) error
+	UpdateDetails(ctx context.Context, imageID string, altText, caption *string) (*models.Image, error)
+	Reorder(ctx context.Context, postID string, imageIDs []string) error
+	Delete(ctx context.Context, imageID string) ([]string, error)
+	DeleteByPostID(ctx context.Context, postID string) ([]string, error)
+}
+
+type ImageVariantRepository interface {
+	Create(ctx context.Context, variant *models.ImageVariant) error
+	GetByImageIDs(ctx context.Context, imageIDs []string) (map[string][]models.ImageVariant, error)
+}
+
+type ImageUploadRepository interface {
+	Create(ctx context.Context, upload *models.ImageUpload) error
+	GetByID(ctx context.Context, uploadID string) (*models.ImageUpload, error)
+	GetExpired(ctx context.Context, before time.Time) ([]models.ImageUpload, error)
+	Delete(ctx context.Context, uploadID string) error
+}
+
+type TusUploadRepository interface {
+	Create(ctx context.Context, upload *models.TusUpload) error
+	GetByID(ctx context.Context, uploadID string) (*models.TusUpload, error)
+	UpdateProgress(ctx context.Context, upload *models.TusUpload, previousOffset int64) error
+	GetExpired(ctx context.Context, before time.Time) ([]models.TusUpload, error)
+	Delete(ctx context.Context, uploadID string) error
+}
+
+// StorageUsageRepository reads the usage counters, they are changed together with the images by ImageRepository
+type StorageUsageRepository interface {
+	GetByUserID(ctx context.Context, userID string) (*models.StorageUsage, error)
+	GetPostsByUserID(ctx context.Context, userID string) ([]models.PostStorageUsage, error)
+	Recompute(ctx context.Context) error
+}
+
+type PostRevisionRepository interface {
+	GetByPostID(ctx context.Context, postID string) ([]models.PostRevision, error)
+	GetByRevision(ctx context.Context, postID string, revision int) (*models.PostRevision, error)
+}
+
+// IdempotencyRepository stores the responses of requests sent with the Idempotency-Key header
+type IdempotencyRepository interface {
+	// Acquire reserves the key for the request and returns nil, or returns the stored record of the key.
+	// While the key is held by a concurrent request with the same body, Acquire waits for its result
+	Acquire(ctx context.Context, request *models.IdempotentRequest) (*models.IdempotentRequest, error)
+	// Complete stores the response and the hash of the request, the hash of an upload is known only when it is read
+	Complete(ctx context.Context, request *models.IdempotentRequest) error
+	Release(ctx context.Context, request *models.IdempotentRequest) error
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+// UserImageRepository stores the avatars and the banners of the users
+type UserImageRepository interface {
+	// Replace swaps the images of the kind for the new ones and returns the keys of the replaced objects
+	Replace(ctx context.Context, userID, kind string, images []models.UserImage) ([]string, error)
+	Delete(ctx context.Context, userID, kind string) ([]string, error)
+	GetByUserIDs(ctx context.Context, userIDs []string) (map[string][]models.UserImage, error)
+}
+
+type FollowRepository interface {
+	Follow(ctx context.Context, followerID, followeeID string) error
+	Unfollow(ctx context.Context, followerID, followeeID string) error
+	GetFollowers(ctx context.Context, userID string, cursor *PageCursor, limit int) ([]models.FollowUser, error)
+	GetFollowing(ctx context.Context, userID string, cursor *PageCursor, limit int) ([]models.FollowUser, error)
+	GetCounts(ctx context.Context, userID string) (followers int, following int, err error)
+	IsFollowing(ctx context.Context, followerID, followeeID string) (bool, error)
+}
+
+// CommentRepository stores the comments of the posts and their threads
+type CommentRepository interface {
+	Create(ctx context.Context, req CreateCommentRequest) (*models.Comment, error)
+	GetByID(ctx context.Context, commentID string) (*models.Comment, error)
+	Update(ctx context.Context, commentID string, content *string, hidden *bool) (*models.Comment, error)
+	Delete(ctx context.Context, commentID string) error
+	GetByPost(ctx context.Context, postID string, cursor *PageCursor, limit int) ([]models.Comment, error)
+	GetRootsByPost(ctx context.Context, postID string, cursor *PageCursor, limit int) ([]models.Comment, error)
+	GetReplies(ctx context.Context, commentIDs []string) ([]models.Comment, error)
 }
 
 type TablesRepository interface {
@@ -42,17 +135,35 @@ type TablesRepository interface {
 }
 
 type Repository struct {
-	User   UserRepository
-	Post   PostRepository
-	Image  ImageRepository
-	Tables TablesRepository
+	User        UserRepository
+	Post        PostRepository
+	Image       ImageRepository
+	Variant     ImageVariantRepository
+	Upload      ImageUploadRepository
+	Tus         TusUploadRepository
+	Usage       StorageUsageRepository
+	Revision    PostRevisionRepository
+	Idempotency IdempotencyRepository
+	UserImage   UserImageRepository
+	Follow      FollowRepository
+	Comment     CommentRepository
+	Tables      TablesRepository
 }
 
 func NewRepository(db *sqlx.DB) *Repository {
 	return &Repository{
-		User:   NewUserRepository(db),
-		Post:   NewPostRepository(db),
-		Image:  NewImageRepository(db),
-		Tables: NewTablesRepository(db), // Инициализируем
+		User:        NewUserRepository(db),
+		Post:        NewPostRepository(db),
+		Image:       NewImageRepository(db),
+		Variant:     NewImageVariantRepository(db),
+		Upload:      NewImageUploadRepository(db),
+		Tus:         NewTusUploadRepository(db),
+		Usage:       NewStorageUsageRepository(db),
+		Revision:    NewPostRevisionRepository(db),
+		Idempotency: NewIdempotencyRepository(db),
+		UserImage:   NewUserImageRepository(db),
+		Follow:      NewFollowRepository(db),
+		Comment:     NewCommentRepository(db),
+		Tables:      NewTablesRepository(db), // Инициализируем
 	}
 }
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"microblogCPT/internal/models"
+)
+
+type StorageUsageRepositoryImpl struct {
+	db *sqlx.DB
+}
+
+func NewStorageUsageRepository(db *sqlx.DB) *StorageUsageRepositoryImpl {
+	return &StorageUsageRepositoryImpl{db: db}
+}
+
+// GetByUserID returns the usage of the user together with the role that selects the quota,
+// a user without images has a zero usage
+func (r *StorageUsageRepositoryImpl) GetByUserID(ctx context.Context, userID string) (*models.StorageUsage, error) {
+	query := `
+		SELECT u.user_id, u.role,
+			COALESCE(s.bytes, 0) AS bytes,
+			COALESCE(s.objects, 0) AS objects,
+			COALESCE(s.updated_at, CURRENT_TIMESTAMP) AS updated_at
+		FROM users u
+		LEFT JOIN user_storage_usage s ON s.user_id = u.user_id
+		WHERE u.user_id = $1
+	`
+
+	var usage models.StorageUsage
+	err := r.db.GetContext(ctx, &usage, query, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("пользователь не найден")
+		}
+		return nil, fmt.Errorf("ошибка при получении использования хранилища: %w", err)
+	}
+
+	return &usage, nil
+}
+
+// GetPostsByUserID returns the usage of the posts of the user, the largest first
+func (r *StorageUsageRepositoryImpl) GetPostsByUserID(ctx context.Context, userID string) ([]models.PostStorageUsage, error) {
+	query := `SELECT * FROM post_storage_usage WHERE author_id = $1 AND objects > 0 ORDER BY bytes DESC, post_id`
+
+	usage := []models.PostStorageUsage{}
+	err := r.db.SelectContext(ctx, &usage, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении использования хранилища: %w", err)
+	}
+
+	return usage, nil
+}
+
+// Recompute rebuilds the counters from the images table. The counters are locked for the rebuild,
+// so an image added meanwhile is counted once: either by the rebuild or by its own update after it
+func (r *StorageUsageRepositoryImpl) Recompute(ctx context.Context) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		`LOCK TABLE user_storage_usage, post_storage_usage IN EXCLUSIVE MODE`,
+		`DELETE FROM post_storage_usage`,
+		`DELETE FROM user_storage_usage`,
+		`INSERT INTO post_storage_usage (post_id, author_id, bytes, objects, updated_at)
+			SELECT i.post_id, p.author_id, SUM(i.size), COUNT(*), CURRENT_TIMESTAMP
+			FROM images i JOIN posts p ON p.post_id = i.post_id
+			GROUP BY i.post_id, p.author_id`,
+		`INSERT INTO user_storage_usage (user_id, bytes, objects, updated_at)
+			SELECT author_id, SUM(bytes), SUM(objects), CURRENT_TIMESTAMP
+			FROM post_storage_usage
+			GROUP BY author_id`,
+	}
+
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("ошибка при пересчете использования хранилища: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка при подтверждении транзакции: %w", err)
+	}
+
+	return nil
+}
+
+// addStorageUsage changes the usage of the post and of its author inside the transaction of the images
+// and returns the new usage of the author. The row of the author stays locked until the end of the transaction,
+// so concurrent uploads of one user are counted one after another
+func addStorageUsage(ctx context.Context, tx *sqlx.Tx, postID string, bytes int64, objects int) (*models.StorageUsage, error) {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO post_storage_usage (post_id, author_id, bytes, objects, updated_at)
+		SELECT post_id, author_id, $2, $3, CURRENT_TIMESTAMP FROM posts WHERE post_id = $1
+		ON CONFLICT (post_id) DO UPDATE SET
+			bytes = post_storage_usage.bytes + EXCLUDED.bytes,
+			objects = post_storage_usage.objects + EXCLUDED.objects,
+			updated_at = EXCLUDED.updated_at
+	`, postID, bytes, objects)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при обновлении использования хранилища: %w", err)
+	}
+
+	var usage models.StorageUsage
+	err = tx.GetContext(ctx, &usage, `
+		INSERT INTO user_storage_usage AS s (user_id, bytes, objects, updated_at)
+		SELECT author_id, $2, $3, CURRENT_TIMESTAMP FROM posts WHERE post_id = $1
+		ON CONFLICT (user_id) DO UPDATE SET
+			bytes = s.bytes + EXCLUDED.bytes,
+			objects = s.objects + EXCLUDED.objects,
+			updated_at = EXCLUDED.updated_at
+		RETURNING s.user_id, s.bytes, s.objects, s.updated_at,
+			(SELECT role FROM users WHERE user_id = s.user_id) AS role
+	`, postID, bytes, objects)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при обновлении использования хранилища: %w", err)
+	}
+
+	return &usage, nil
+}
+
+// QuotaError describes the exceeded quota for the client
+func QuotaError(quota models.StorageQuota) error {
+	return fmt.Errorf("превышена квота хранилища: не больше %d MB и %d изображений",
+		quota.MaxBytes/(1024*1024), quota.MaxObjects)
+}
+
+// QuotaExceeded reports whether the usage is over the quota, a zero limit is not checked
+func QuotaExceeded(usage *models.StorageUsage, quota models.StorageQuota) bool {
+	return (quota.MaxBytes > 0 && usage.Bytes > quota.MaxBytes) ||
+		(quota.MaxObjects > 0 && usage.Objects > quota.MaxObjects)
+}
@@ -0,0 +1,148 @@
+package testRepository
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"microblogCPT/internal/repository"
+	"testing"
+	"time"
+)
+
+var commentColumns = []string{"comment_id", "post_id", "parent_id", "author_id", "content", "hidden", "created_at", "updated_at", "deleted_at"}
+
+func TestCommentRepositoryImpl_Create(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	parentID := "c1"
+	createdAt := time.Now()
+	mock.ExpectQuery(`INSERT INTO comments \(post_id, parent_id, author_id, content\)\s+VALUES \(\$1, \$2, \$3, \$4\)\s+RETURNING \*`).
+		WithArgs("post1", &parentID, "user1", "Текст").
+		WillReturnRows(sqlmock.NewRows(commentColumns).
+			AddRow("c2", "post1", parentID, "user1", "Текст", false, createdAt, createdAt, nil))
+
+	repo := repository.NewCommentRepository(db)
+	comment, err := repo.Create(context.Background(), repository.CreateCommentRequest{
+		PostID: "post1", ParentID: &parentID, AuthorID: "user1", Content: "Текст",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "c2", comment.CommentID)
+	assert.Equal(t, "c1", *comment.ParentID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCommentRepositoryImpl_Update(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	hidden := true
+	createdAt := time.Now()
+	mock.ExpectQuery(`UPDATE comments\s+SET content = COALESCE\(\$2, content\),\s+hidden = COALESCE\(\$3, hidden\),.*WHERE comment_id = \$1 AND deleted_at IS NULL`).
+		WithArgs("c1", nil, &hidden).
+		WillReturnRows(sqlmock.NewRows(commentColumns).
+			AddRow("c1", "post1", nil, "user1", "Текст", true, createdAt, createdAt, nil))
+
+	repo := repository.NewCommentRepository(db)
+	comment, err := repo.Update(context.Background(), "c1", nil, &hidden)
+
+	assert.NoError(t, err)
+	assert.True(t, comment.Hidden)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCommentRepositoryImpl_Delete(t *testing.T) {
+	tests := []struct {
+		name       string
+		hasReplies bool
+	}{
+		{name: "С ответами остается в ветке", hasReplies: true},
+		{name: "Без ответов удаляется", hasReplies: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := setupMockDB(t)
+
+			mock.ExpectBegin()
+			marked := int64(0)
+			if tt.hasReplies {
+				marked = 1
+			}
+			mock.ExpectExec(`UPDATE comments SET content = '', deleted_at = CURRENT_TIMESTAMP\s+WHERE comment_id = \$1 AND EXISTS\(SELECT 1 FROM comments WHERE parent_id = \$1\)`).
+				WithArgs("c1").
+				WillReturnResult(sqlmock.NewResult(0, marked))
+			if !tt.hasReplies {
+				mock.ExpectExec(`DELETE FROM comments WHERE comment_id = \$1`).
+					WithArgs("c1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+			mock.ExpectCommit()
+
+			repo := repository.NewCommentRepository(db)
+
+			assert.NoError(t, repo.Delete(context.Background(), "c1"))
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestCommentRepositoryImpl_GetPages(t *testing.T) {
+	createdAt := time.Now()
+	cursor := &repository.PageCursor{Time: createdAt, ID: "c1"}
+
+	t.Run("Все комментарии после курсора", func(t *testing.T) {
+		db, mock := setupMockDB(t)
+
+		mock.ExpectQuery(`SELECT \* FROM comments WHERE post_id = \$1 AND \(created_at, comment_id\) > \(\$2, \$3\) ORDER BY created_at, comment_id LIMIT \$4`).
+			WithArgs("post1", createdAt, "c1", 21).
+			WillReturnRows(sqlmock.NewRows(commentColumns).
+				AddRow("c2", "post1", "c1", "user1", "Ответ", false, createdAt, createdAt, nil))
+
+		repo := repository.NewCommentRepository(db)
+		comments, err := repo.GetByPost(context.Background(), "post1", cursor, 21)
+
+		assert.NoError(t, err)
+		assert.Len(t, comments, 1)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Верхний уровень", func(t *testing.T) {
+		db, mock := setupMockDB(t)
+
+		mock.ExpectQuery(`SELECT \* FROM comments WHERE post_id = \$1 AND parent_id IS NULL ORDER BY created_at, comment_id LIMIT \$2`).
+			WithArgs("post1", 21).
+			WillReturnRows(sqlmock.NewRows(commentColumns).
+				AddRow("c1", "post1", nil, "user1", "Первый", false, createdAt, createdAt, nil))
+
+		repo := repository.NewCommentRepository(db)
+		comments, err := repo.GetRootsByPost(context.Background(), "post1", nil, 21)
+
+		assert.NoError(t, err)
+		assert.Len(t, comments, 1)
+		assert.Nil(t, comments[0].ParentID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestCommentRepositoryImpl_GetReplies(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	createdAt := time.Now()
+	mock.ExpectQuery(`WITH RECURSIVE thread AS \(\s+SELECT \* FROM comments WHERE parent_id = ANY\(\$1\)\s+UNION ALL`).
+		WillReturnRows(sqlmock.NewRows(commentColumns).
+			AddRow("c2", "post1", "c1", "user2", "Ответ", false, createdAt, createdAt, nil).
+			AddRow("c3", "post1", "c2", "user1", "Ответ на ответ", false, createdAt, createdAt, nil))
+
+	repo := repository.NewCommentRepository(db)
+
+	replies, err := repo.GetReplies(context.Background(), []string{"c1"})
+	assert.NoError(t, err)
+	assert.Len(t, replies, 2)
+
+	// no roots, no query
+	replies, err = repo.GetReplies(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.Empty(t, replies)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
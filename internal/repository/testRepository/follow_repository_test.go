@@ -0,0 +1,107 @@
+package testRepository
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"microblogCPT/internal/repository"
+	"testing"
+	"time"
+)
+
+func TestFollowRepositoryImpl_Follow(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	mock.ExpectExec(`INSERT INTO follows \(follower_id, followee_id\)\s+VALUES \(\$1, \$2\)\s+ON CONFLICT \(follower_id, followee_id\) DO NOTHING`).
+		WithArgs("user1", "user2").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM follows WHERE follower_id = \$1 AND followee_id = \$2`).
+		WithArgs("user1", "user2").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	repo := repository.NewFollowRepository(db)
+
+	assert.NoError(t, repo.Follow(context.Background(), "user1", "user2"))
+	assert.NoError(t, repo.Unfollow(context.Background(), "user1", "user2"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFollowRepositoryImpl_GetFollowers(t *testing.T) {
+	followedAt := time.Now()
+
+	tests := []struct {
+		name      string
+		cursor    *repository.PageCursor
+		setupMock func(mock sqlmock.Sqlmock)
+	}{
+		{
+			name: "Первая страница",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`JOIN users u ON u.user_id = f.follower_id\s+WHERE f.followee_id = \$1 ORDER BY f.created_at DESC, f.follower_id DESC LIMIT \$2`).
+					WithArgs("user2", 3).
+					WillReturnRows(sqlmock.NewRows([]string{"user_id", "handle", "display_name", "followed_at"}).
+						AddRow("user1", "alice", "Алиса", followedAt))
+			},
+		},
+		{
+			name:   "Страница после курсора",
+			cursor: &repository.PageCursor{Time: followedAt, ID: "user3"},
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`WHERE f.followee_id = \$1 AND \(f.created_at, f.follower_id\) < \(\$2, \$3\) ORDER BY .* LIMIT \$4`).
+					WithArgs("user2", followedAt, "user3", 3).
+					WillReturnRows(sqlmock.NewRows([]string{"user_id", "handle", "display_name", "followed_at"}).
+						AddRow("user1", "alice", "Алиса", followedAt))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := setupMockDB(t)
+			tt.setupMock(mock)
+
+			repo := repository.NewFollowRepository(db)
+
+			users, err := repo.GetFollowers(context.Background(), "user2", tt.cursor, 3)
+
+			assert.NoError(t, err)
+			assert.Len(t, users, 1)
+			assert.Equal(t, "alice", users[0].Handle)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestFollowRepositoryImpl_GetFollowing(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	mock.ExpectQuery(`JOIN users u ON u.user_id = f.followee_id\s+WHERE f.follower_id = \$1`).
+		WithArgs("user1", 20).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "handle", "display_name", "followed_at"}))
+
+	repo := repository.NewFollowRepository(db)
+
+	users, err := repo.GetFollowing(context.Background(), "user1", nil, 20)
+
+	assert.NoError(t, err)
+	assert.Empty(t, users)
+	assert.NotNil(t, users)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFollowRepositoryImpl_GetCounts(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	mock.ExpectQuery(`SELECT\s+\(SELECT COUNT\(\*\) FROM follows WHERE followee_id = \$1\) AS followers`).
+		WithArgs("user1").
+		WillReturnRows(sqlmock.NewRows([]string{"followers", "following"}).AddRow(5, 2))
+
+	repo := repository.NewFollowRepository(db)
+
+	followers, following, err := repo.GetCounts(context.Background(), "user1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, 5, followers)
+	assert.Equal(t, 2, following)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,170 @@
+package testRepository
+
+import (
+	"context"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"microblogCPT/internal/models"
+	"microblogCPT/internal/repository"
+	"testing"
+	"time"
+)
+
+func newTestIdempotentRequest() *models.IdempotentRequest {
+	return &models.IdempotentRequest{
+		Principal:   "test-user-id",
+		Method:      "POST",
+		Path:        "/api/posts/",
+		Key:         "test-key",
+		RequestHash: "test-hash",
+		ExpiresAt:   time.Now().Add(time.Minute),
+	}
+}
+
+func idempotencyRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{
+		"principal", "method", "path", "idempotency_key", "request_hash", "response_status",
+		"response_headers", "response_body", "created_at", "expires_at",
+	})
+}
+
+func TestIdempotencyRepositoryImpl_Acquire(t *testing.T) {
+	tests := []struct {
+		name           string
+		setupMock      func(mock sqlmock.Sqlmock)
+		expectExisting bool
+		expectStatus   int
+		expectError    bool
+		errorMsg       string
+	}{
+		{
+			name: "Новый ключ резервируется",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`DELETE FROM idempotency_keys WHERE principal = \$1 AND method = \$2 AND path = \$3 AND idempotency_key = \$4 AND expires_at < CURRENT_TIMESTAMP`).
+					WithArgs("test-user-id", "POST", "/api/posts/", "test-key").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(`INSERT INTO idempotency_keys`).
+					WithArgs("test-user-id", "POST", "/api/posts/", "test-key", "test-hash", sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			expectExisting: false,
+		},
+		{
+			name: "Сохраненный ответ возвращается",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`DELETE FROM idempotency_keys`).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(`INSERT INTO idempotency_keys`).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(`SELECT \* FROM idempotency_keys`).
+					WithArgs("test-user-id", "POST", "/api/posts/", "test-key").
+					WillReturnRows(idempotencyRows().AddRow("test-user-id", "POST", "/api/posts/", "test-key", "test-hash",
+						201, []byte(`{}`), []byte(`created`), time.Now(), time.Now().Add(time.Hour)))
+			},
+			expectExisting: true,
+			expectStatus:   201,
+		},
+		{
+			name: "Выполняющийся запрос ожидается",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`DELETE FROM idempotency_keys`).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(`INSERT INTO idempotency_keys`).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(`SELECT \* FROM idempotency_keys`).
+					WillReturnRows(idempotencyRows().AddRow("test-user-id", "POST", "/api/posts/", "test-key", "test-hash",
+						0, nil, nil, time.Now(), time.Now().Add(time.Minute)))
+				mock.ExpectExec(`DELETE FROM idempotency_keys`).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(`INSERT INTO idempotency_keys`).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(`SELECT \* FROM idempotency_keys`).
+					WillReturnRows(idempotencyRows().AddRow("test-user-id", "POST", "/api/posts/", "test-key", "test-hash",
+						200, []byte(`{}`), []byte(`ok`), time.Now(), time.Now().Add(time.Hour)))
+			},
+			expectExisting: true,
+			expectStatus:   200,
+		},
+		{
+			name: "Ошибка базы данных",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`DELETE FROM idempotency_keys`).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(`INSERT INTO idempotency_keys`).
+					WillReturnError(fmt.Errorf("database error"))
+			},
+			expectError: true,
+			errorMsg:    "ошибка при сохранении idempotency key",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock := setupMockDB(t)
+			tc.setupMock(mock)
+
+			repo := repository.NewIdempotencyRepository(db)
+
+			existing, err := repo.Acquire(context.Background(), newTestIdempotentRequest())
+
+			if tc.expectError {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.errorMsg)
+			} else if tc.expectExisting {
+				assert.NoError(t, err)
+				assert.NotNil(t, existing)
+				assert.Equal(t, tc.expectStatus, existing.ResponseStatus)
+			} else {
+				assert.NoError(t, err)
+				assert.Nil(t, existing)
+			}
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestIdempotencyRepositoryImpl_CompleteAndRelease(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	request := newTestIdempotentRequest()
+	request.ResponseStatus = 201
+	request.ResponseHeaders = []byte(`{}`)
+	request.ResponseBody = []byte(`created`)
+
+	mock.ExpectExec(`UPDATE idempotency_keys SET response_status = \$1, response_headers = \$2, response_body = \$3, expires_at = \$4, request_hash = \$5`).
+		WithArgs(201, []byte(`{}`), []byte(`created`), sqlmock.AnyArg(), request.RequestHash, "test-user-id", "POST", "/api/posts/", "test-key").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM idempotency_keys WHERE principal = \$1 AND method = \$2 AND path = \$3 AND idempotency_key = \$4 AND response_status = 0`).
+		WithArgs("test-user-id", "POST", "/api/posts/", "test-key").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	repo := repository.NewIdempotencyRepository(db)
+
+	assert.NoError(t, repo.Complete(context.Background(), request))
+	assert.NoError(t, repo.Release(context.Background(), request))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMemoryIdempotencyRepository_Expired(t *testing.T) {
+	repo := repository.NewMemoryIdempotencyRepository()
+
+	request := newTestIdempotentRequest()
+	existing, err := repo.Acquire(context.Background(), request)
+	assert.NoError(t, err)
+	assert.Nil(t, existing)
+
+	request.ResponseStatus = 201
+	request.ExpiresAt = time.Now().Add(-time.Second)
+	assert.NoError(t, repo.Complete(context.Background(), request))
+
+	deleted, err := repo.DeleteExpired(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	// the expired key can be taken again
+	existing, err = repo.Acquire(context.Background(), newTestIdempotentRequest())
+	assert.NoError(t, err)
+	assert.Nil(t, existing)
+}
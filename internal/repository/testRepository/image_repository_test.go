@@ -0,0 +1,545 @@
+package testRepository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"microblogCPT/internal/models"
+	"microblogCPT/internal/repository"
+	"testing"
+	"time"
+)
+
+func TestImageRepositoryImpl_GetByPostIDs(t *testing.T) {
+	tests := []struct {
+		name        string
+		postIDs     []string
+		setupMock   func(mock sqlmock.Sqlmock)
+		expectCount map[string]int
+		expectError bool
+		errorMsg    string
+	}{
+		{
+			name:    "Изображения нескольких постов одним запросом",
+			postIDs: []string{"post1", "post2", "post3"},
+			setupMock: func(mock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"image_id", "post_id", "object_key", "created_at"}).
+					AddRow("img1", "post1", "posts/post1/2026/10/1.jpg", time.Now()).
+					AddRow("img2", "post2", "posts/post1/2026/10/2.jpg", time.Now()).
+					AddRow("img3", "post1", "posts/post1/2026/10/3.jpg", time.Now())
+				mock.ExpectQuery(`SELECT \* FROM images WHERE post_id = ANY\(\$1\) ORDER BY position, created_at`).
+					WithArgs(pq.Array([]string{"post1", "post2", "post3"})).
+					WillReturnRows(rows)
+			},
+			expectCount: map[string]int{"post1": 2, "post2": 1, "post3": 0},
+		},
+		{
+			name:        "Пустой список без запроса",
+			postIDs:     []string{},
+			setupMock:   func(mock sqlmock.Sqlmock) {},
+			expectCount: map[string]int{},
+		},
+		{
+			name:    "Ошибка базы данных",
+			postIDs: []string{"post1"},
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM images`).
+					WillReturnError(fmt.Errorf("database error"))
+			},
+			expectError: true,
+			errorMsg:    "ошибка при получении изображений",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock := setupMockDB(t)
+			tc.setupMock(mock)
+
+			repo := repository.NewImageRepository(db)
+
+			imagesByPost, err := repo.GetByPostIDs(context.Background(), tc.postIDs)
+
+			if tc.expectError {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.errorMsg)
+			} else {
+				assert.NoError(t, err)
+				for postID, count := range tc.expectCount {
+					assert.Len(t, imagesByPost[postID], count)
+				}
+			}
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestImageRepositoryImpl_ClaimPendingVariants(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	staleBefore := time.Now().Add(-10 * time.Minute)
+	rows := sqlmock.NewRows([]string{"image_id", "blob_hash", "object_key", "variants_attempts"}).
+		AddRow("img1", nil, "posts/post1/2026/10/1.jpg", 2).
+		AddRow(nil, "ab12", "blobs/ab/ab12.jpg", 1)
+	mock.ExpectQuery(`UPDATE images SET\s+variants_status = 'processing',\s+variants_claimed_at = CURRENT_TIMESTAMP,\s+variants_attempts = variants_attempts \+ 1.*`+
+		`WHERE blob_hash IS NULL AND \(variants_status = 'pending'\s+OR \(variants_status = 'processing' AND variants_claimed_at < \$2\)\).*FOR UPDATE SKIP LOCKED.*`+
+		`UPDATE image_blobs SET\s+variants_status = 'processing'.*FOR UPDATE SKIP LOCKED.*`+
+		`SELECT \* FROM claimed_images\s+UNION ALL SELECT \* FROM claimed_blobs`).
+		WithArgs(10, staleBefore).
+		WillReturnRows(rows)
+
+	repo := repository.NewImageRepository(db)
+
+	sources, err := repo.ClaimPendingVariants(context.Background(), 10, staleBefore)
+
+	assert.NoError(t, err)
+	assert.Len(t, sources, 2)
+	assert.Equal(t, "img1", *sources[0].ImageID)
+	assert.Nil(t, sources[0].BlobHash)
+	assert.Equal(t, 2, sources[0].VariantsAttempts)
+	assert.Nil(t, sources[1].ImageID)
+	assert.Equal(t, "ab12", *sources[1].BlobHash)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestImageRepositoryImpl_SetVariantsStatus(t *testing.T) {
+	imageID, hash := "img1", "ab12"
+
+	tests := []struct {
+		name   string
+		source models.VariantSource
+		query  string
+		key    string
+	}{
+		{
+			name:   "Изображение",
+			source: models.VariantSource{ImageID: &imageID},
+			query:  `UPDATE images SET variants_status = \$1 WHERE image_id = \$2`,
+			key:    imageID,
+		},
+		{
+			name:   "Блоб",
+			source: models.VariantSource{BlobHash: &hash},
+			query:  `UPDATE image_blobs SET variants_status = \$1 WHERE hash = \$2`,
+			key:    hash,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock := setupMockDB(t)
+
+			mock.ExpectExec(tc.query).
+				WithArgs("ready", tc.key).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			repo := repository.NewImageRepository(db)
+
+			err := repo.SetVariantsStatus(context.Background(), tc.source, "ready")
+
+			assert.NoError(t, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestImageRepositoryImpl_ReleaseVariantClaims(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	img1, img2, hash := "img1", "img2", "ab12"
+	mock.ExpectExec(`UPDATE images SET\s+variants_status = 'pending',\s+variants_claimed_at = NULL,\s+variants_attempts = GREATEST\(variants_attempts - 1, 0\)\s+` +
+		`WHERE image_id = ANY\(\$1\) AND variants_status = 'processing'`).
+		WithArgs(pq.Array([]string{"img1", "img2"})).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`UPDATE image_blobs SET\s+variants_status = 'pending'.*WHERE hash = ANY\(\$1\) AND variants_status = 'processing'`).
+		WithArgs(pq.Array([]string{"ab12"})).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	repo := repository.NewImageRepository(db)
+
+	err := repo.ReleaseVariantClaims(context.Background(), []models.VariantSource{
+		{ImageID: &img1}, {BlobHash: &hash}, {ImageID: &img2},
+	})
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestImageRepositoryImpl_GetByImageID(t *testing.T) {
+	tests := []struct {
+		name        string
+		setupMock   func(mock sqlmock.Sqlmock)
+		expectError bool
+		errorMsg    string
+	}{
+		{
+			name: "Успешное получение изображения",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"image_id", "post_id", "object_key", "created_at"}).
+					AddRow("img1", "post1", "posts/post1/2026/10/1.jpg", time.Now())
+				mock.ExpectQuery(`SELECT \* FROM images WHERE image_id = \$1`).
+					WithArgs("img1").
+					WillReturnRows(rows)
+			},
+		},
+		{
+			name: "Изображение не найдено",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM images WHERE image_id = \$1`).
+					WithArgs("img1").
+					WillReturnError(sql.ErrNoRows)
+			},
+			expectError: true,
+			errorMsg:    "изображение не найдено",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock := setupMockDB(t)
+			tc.setupMock(mock)
+
+			repo := repository.NewImageRepository(db)
+
+			image, err := repo.GetByImageID(context.Background(), "img1")
+
+			if tc.expectError {
+				assert.Error(t, err)
+				assert.Nil(t, image)
+				assert.Contains(t, err.Error(), tc.errorMsg)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "posts/post1/2026/10/1.jpg", image.ObjectKey)
+			}
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestImageRepositoryImpl_ListObjectKeys(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	rows := sqlmock.NewRows([]string{"object_key"}).
+		AddRow("posts/post1/2026/10/1.jpg").
+		AddRow("posts/post1/2026/10/1_w320.jpg").
+		AddRow("uploads/upload1")
+	mock.ExpectQuery(`SELECT object_key FROM images\s+UNION ALL SELECT object_key FROM image_blobs.*UNION ALL SELECT object_key FROM user_images`).
+		WillReturnRows(rows)
+
+	repo := repository.NewImageRepository(db)
+
+	keys, err := repo.ListObjectKeys(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"posts/post1/2026/10/1.jpg", "posts/post1/2026/10/1_w320.jpg", "uploads/upload1"}, keys)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func expectStorageUsage(mock sqlmock.Sqlmock, postID string, bytes int64, objects int, total int64, totalObjects int) {
+	mock.ExpectExec(`INSERT INTO post_storage_usage`).
+		WithArgs(postID, bytes, objects).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO user_storage_usage`).
+		WithArgs(postID, bytes, objects).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "bytes", "objects", "updated_at", "role"}).
+			AddRow("author1", total, totalObjects, time.Now(), "Author"))
+}
+
+// expectNextPosition expects the lookup of the position for a new image of the post
+func expectNextPosition(mock sqlmock.Sqlmock, postID string, position int) {
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(position\) \+ 1, 0\) FROM images WHERE post_id = \$1`).
+		WithArgs(postID).
+		WillReturnRows(sqlmock.NewRows([]string{"position"}).AddRow(position))
+}
+
+func TestImageRepositoryImpl_Create(t *testing.T) {
+	quotas := map[string]models.StorageQuota{"Author": {MaxBytes: 10000, MaxObjects: 10}}
+
+	tests := []struct {
+		name        string
+		setupMock   func(mock sqlmock.Sqlmock)
+		expectError bool
+		errorMsg    string
+	}{
+		{
+			name: "Изображение в пределах квоты",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectNextPosition(mock, "post1", 2)
+				mock.ExpectExec(`INSERT INTO images`).WillReturnResult(sqlmock.NewResult(0, 1))
+				expectStorageUsage(mock, "post1", 2048, 1, 6000, 3)
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "Превышен объем квоты",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectNextPosition(mock, "post1", 2)
+				mock.ExpectExec(`INSERT INTO images`).WillReturnResult(sqlmock.NewResult(0, 1))
+				expectStorageUsage(mock, "post1", 2048, 1, 12000, 3)
+				mock.ExpectRollback()
+			},
+			expectError: true,
+			errorMsg:    "превышена квота хранилища",
+		},
+		{
+			name: "Превышено число изображений",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectNextPosition(mock, "post1", 2)
+				mock.ExpectExec(`INSERT INTO images`).WillReturnResult(sqlmock.NewResult(0, 1))
+				expectStorageUsage(mock, "post1", 2048, 1, 6000, 11)
+				mock.ExpectRollback()
+			},
+			expectError: true,
+			errorMsg:    "превышена квота хранилища",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock := setupMockDB(t)
+			tc.setupMock(mock)
+
+			repo := repository.NewImageRepository(db)
+
+			image := &models.Image{PostID: "post1", ObjectKey: "posts/post1/2026/10/1.jpg", Size: 2048}
+			err := repo.Create(context.Background(), image, quotas)
+
+			if tc.expectError {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.errorMsg)
+			} else {
+				assert.NoError(t, err)
+				assert.NotEmpty(t, image.ImageID)
+				assert.Equal(t, 2, image.Position)
+			}
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestImageRepositoryImpl_CreateWithBlob(t *testing.T) {
+	hash := "ab12"
+
+	tests := []struct {
+		name        string
+		objectKey   string
+		setupMock   func(mock sqlmock.Sqlmock)
+		expectKey   string
+		expectError bool
+		errorMsg    string
+	}{
+		{
+			name:      "Ссылка на сохраненный блоб",
+			objectKey: "",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`UPDATE image_blobs SET ref_count = ref_count \+ 1`).
+					WithArgs(hash).
+					WillReturnRows(sqlmock.NewRows([]string{"object_key"}).AddRow("blobs/ab/ab12-1.jpg"))
+				expectNextPosition(mock, "post1", 2)
+				mock.ExpectExec(`INSERT INTO images`).WillReturnResult(sqlmock.NewResult(0, 1))
+				expectStorageUsage(mock, "post1", 2048, 1, 6000, 3)
+				mock.ExpectCommit()
+			},
+			expectKey: "blobs/ab/ab12-1.jpg",
+		},
+		{
+			name:      "Блоб не сохранен",
+			objectKey: "",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`UPDATE image_blobs SET ref_count = ref_count \+ 1`).
+					WithArgs(hash).
+					WillReturnError(sql.ErrNoRows)
+				mock.ExpectRollback()
+			},
+			expectError: true,
+			errorMsg:    "блоб изображения не найден",
+		},
+		{
+			name:      "Новый блоб",
+			objectKey: "blobs/ab/ab12-2.jpg",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`INSERT INTO image_blobs`).
+					WithArgs(hash, "blobs/ab/ab12-2.jpg", "image/jpeg", int64(2048), sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"object_key"}).AddRow("blobs/ab/ab12-2.jpg"))
+				expectNextPosition(mock, "post1", 2)
+				mock.ExpectExec(`INSERT INTO images`).WillReturnResult(sqlmock.NewResult(0, 1))
+				expectStorageUsage(mock, "post1", 2048, 1, 6000, 3)
+				mock.ExpectCommit()
+			},
+			expectKey: "blobs/ab/ab12-2.jpg",
+		},
+		{
+			name:      "Блоб сохранен другой загрузкой",
+			objectKey: "blobs/ab/ab12-3.jpg",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`INSERT INTO image_blobs`).
+					WithArgs(hash, "blobs/ab/ab12-3.jpg", "image/jpeg", int64(2048), sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"object_key"}).AddRow("blobs/ab/ab12-1.jpg"))
+				expectNextPosition(mock, "post1", 2)
+				mock.ExpectExec(`INSERT INTO images`).WillReturnResult(sqlmock.NewResult(0, 1))
+				expectStorageUsage(mock, "post1", 2048, 1, 6000, 3)
+				mock.ExpectCommit()
+			},
+			expectKey: "blobs/ab/ab12-1.jpg",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock := setupMockDB(t)
+			tc.setupMock(mock)
+
+			repo := repository.NewImageRepository(db)
+
+			image := &models.Image{PostID: "post1", ObjectKey: tc.objectKey, MimeType: "image/jpeg", Size: 2048, BlobHash: &hash}
+			err := repo.Create(context.Background(), image, nil)
+
+			if tc.expectError {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.errorMsg)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectKey, image.ObjectKey)
+			}
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestImageRepositoryImpl_UpdateDetails(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	altText := "Логотип компании"
+	mock.ExpectQuery(`UPDATE images SET\s+alt_text = COALESCE\(\$2, alt_text\),\s+caption = COALESCE\(\$3, caption\)`).
+		WithArgs("img1", &altText, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"image_id", "post_id", "object_key", "alt_text", "caption", "position"}).
+			AddRow("img1", "post1", "posts/post1/1.jpg", altText, "Подпись", 1))
+
+	repo := repository.NewImageRepository(db)
+
+	image, err := repo.UpdateDetails(context.Background(), "img1", &altText, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, altText, image.AltText)
+	assert.Equal(t, "Подпись", image.Caption)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestImageRepositoryImpl_Reorder(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	mock.ExpectExec(`UPDATE images SET position = ordered.position - 1\s+FROM unnest\(\$2::uuid\[\]\) WITH ORDINALITY`).
+		WithArgs("post1", pq.Array([]string{"img2", "img1"})).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	repo := repository.NewImageRepository(db)
+
+	err := repo.Reorder(context.Background(), "post1", []string{"img2", "img1"})
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestImageRepositoryImpl_Delete(t *testing.T) {
+	tests := []struct {
+		name      string
+		blobHash  interface{}
+		setupBlob func(mock sqlmock.Sqlmock)
+		released  []string
+	}{
+		{
+			name:      "Изображение без блоба",
+			blobHash:  nil,
+			setupBlob: func(mock sqlmock.Sqlmock) {},
+			released:  []string{"posts/post1/1.jpg", "posts/post1/1_w320.jpg"},
+		},
+		{
+			name:     "Блоб используется другими изображениями",
+			blobHash: "ab12",
+			setupBlob: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`UPDATE image_blobs SET ref_count = ref_count - 1`).
+					WithArgs("ab12").
+					WillReturnRows(sqlmock.NewRows([]string{"ref_count"}).AddRow(2))
+			},
+			released: []string{},
+		},
+		{
+			name:     "Последнее изображение блоба",
+			blobHash: "ab12",
+			setupBlob: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`UPDATE image_blobs SET ref_count = ref_count - 1`).
+					WithArgs("ab12").
+					WillReturnRows(sqlmock.NewRows([]string{"ref_count"}).AddRow(0))
+				mock.ExpectQuery(`DELETE FROM image_variants WHERE blob_hash = \$1 RETURNING object_key`).
+					WithArgs("ab12").
+					WillReturnRows(sqlmock.NewRows([]string{"object_key"}).AddRow("blobs/ab/ab12_w320.jpg"))
+				mock.ExpectExec(`DELETE FROM image_blobs WHERE hash = \$1`).
+					WithArgs("ab12").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			released: []string{"blobs/ab/ab12_w320.jpg", "posts/post1/1.jpg", "posts/post1/1_w320.jpg"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock := setupMockDB(t)
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(`DELETE FROM image_variants`).
+				WithArgs("img1").
+				WillReturnRows(sqlmock.NewRows([]string{"image_id", "object_key"}).
+					AddRow("img1", "posts/post1/1_w320.jpg"))
+			mock.ExpectQuery(`DELETE FROM images WHERE image_id = \$1`).
+				WithArgs("img1").
+				WillReturnRows(sqlmock.NewRows([]string{"image_id", "post_id", "object_key", "size", "blob_hash"}).
+					AddRow("img1", "post1", "posts/post1/1.jpg", 2048, tc.blobHash))
+			tc.setupBlob(mock)
+			expectStorageUsage(mock, "post1", -2048, -1, 4000, 2)
+			mock.ExpectCommit()
+
+			repo := repository.NewImageRepository(db)
+
+			released, err := repo.Delete(context.Background(), "img1")
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.released, released)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestImageRepositoryImpl_DeleteNotFound(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`DELETE FROM image_variants`).
+		WithArgs("img1").
+		WillReturnRows(sqlmock.NewRows([]string{"image_id", "object_key"}))
+	mock.ExpectQuery(`DELETE FROM images WHERE image_id = \$1`).
+		WithArgs("img1").
+		WillReturnRows(sqlmock.NewRows([]string{"image_id", "post_id", "object_key", "size", "blob_hash"}))
+	mock.ExpectRollback()
+
+	repo := repository.NewImageRepository(db)
+
+	_, err := repo.Delete(context.Background(), "img1")
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "изображение не найдено")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
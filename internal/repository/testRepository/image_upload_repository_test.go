@@ -0,0 +1,116 @@
+package testRepository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"microblogCPT/internal/models"
+	"microblogCPT/internal/repository"
+	"testing"
+	"time"
+)
+
+func imageUploadRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{
+		"upload_id", "post_id", "author_id", "object_key", "file_name", "content_type", "size", "created_at", "expires_at",
+	})
+}
+
+func TestImageUploadRepositoryImpl_Create(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	mock.ExpectExec(`INSERT INTO image_uploads`).
+		WithArgs(sqlmock.AnyArg(), "test-post-id", "test-author-id", "posts/test-post-id/2026/10/photo.png",
+			"photo.png", "image/png", int64(2048), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	repo := repository.NewImageUploadRepository(db)
+
+	upload := &models.ImageUpload{
+		PostID:      "test-post-id",
+		AuthorID:    "test-author-id",
+		ObjectKey:   "posts/test-post-id/2026/10/photo.png",
+		FileName:    "photo.png",
+		ContentType: "image/png",
+		Size:        2048,
+		ExpiresAt:   time.Now().Add(15 * time.Minute),
+	}
+
+	err := repo.Create(context.Background(), upload)
+
+	assert.NoError(t, err)
+	assert.NotEmpty(t, upload.UploadID)
+	assert.False(t, upload.CreatedAt.IsZero())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestImageUploadRepositoryImpl_GetByID(t *testing.T) {
+	tests := []struct {
+		name        string
+		setupMock   func(mock sqlmock.Sqlmock)
+		expectError bool
+		errorMsg    string
+	}{
+		{
+			name: "Успешное получение загрузки",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM image_uploads WHERE upload_id = \$1`).
+					WithArgs("test-upload-id").
+					WillReturnRows(imageUploadRows().AddRow("test-upload-id", "test-post-id", "test-author-id",
+						"posts/test-post-id/2026/10/photo.png", "photo.png", "image/png", 2048, time.Now(), time.Now()))
+			},
+		},
+		{
+			name: "Загрузка не найдена",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM image_uploads WHERE upload_id = \$1`).
+					WithArgs("test-upload-id").
+					WillReturnError(sql.ErrNoRows)
+			},
+			expectError: true,
+			errorMsg:    "загрузка не найдена",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock := setupMockDB(t)
+			tc.setupMock(mock)
+
+			repo := repository.NewImageUploadRepository(db)
+
+			upload, err := repo.GetByID(context.Background(), "test-upload-id")
+
+			if tc.expectError {
+				assert.Error(t, err)
+				assert.Nil(t, upload)
+				assert.Contains(t, err.Error(), tc.errorMsg)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, int64(2048), upload.Size)
+				assert.Equal(t, "posts/test-post-id/2026/10/photo.png", upload.ObjectKey)
+			}
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestImageUploadRepositoryImpl_GetExpired(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	before := time.Now()
+	mock.ExpectQuery(`SELECT \* FROM image_uploads WHERE expires_at < \$1 ORDER BY expires_at`).
+		WithArgs(before).
+		WillReturnRows(imageUploadRows().AddRow("test-upload-id", "test-post-id", "test-author-id",
+			"posts/test-post-id/2026/10/photo.png", "photo.png", "image/png", 2048, time.Now(), before.Add(-time.Minute)))
+
+	repo := repository.NewImageUploadRepository(db)
+
+	uploads, err := repo.GetExpired(context.Background(), before)
+
+	assert.NoError(t, err)
+	assert.Len(t, uploads, 1)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,85 @@
+package testRepository
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"microblogCPT/internal/models"
+	"microblogCPT/internal/repository"
+	"testing"
+	"time"
+)
+
+func TestImageVariantRepositoryImpl_Create(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	mock.ExpectExec(`INSERT INTO image_variants .* ON CONFLICT \(image_id, mime_type, width\) WHERE image_id IS NOT NULL DO UPDATE`).
+		WithArgs("img1", nil, "posts/post1/2026/10/1_w320.jpg", "image/jpeg", 320, 240, int64(15000), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	repo := repository.NewImageVariantRepository(db)
+
+	variant := &models.ImageVariant{
+		ImageID:   "img1",
+		ObjectKey: "posts/post1/2026/10/1_w320.jpg",
+		MimeType:  "image/jpeg",
+		Width:     320,
+		Height:    240,
+		Size:      15000,
+	}
+
+	err := repo.Create(context.Background(), variant)
+
+	assert.NoError(t, err)
+	assert.False(t, variant.CreatedAt.IsZero())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestImageVariantRepositoryImpl_CreateForBlob(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	hash := "ab12"
+	mock.ExpectExec(`INSERT INTO image_variants .* ON CONFLICT \(blob_hash, mime_type, width\) WHERE blob_hash IS NOT NULL DO UPDATE`).
+		WithArgs("", hash, "blobs/ab/ab12_w320.jpg", "image/jpeg", 320, 240, int64(15000), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	repo := repository.NewImageVariantRepository(db)
+
+	variant := &models.ImageVariant{
+		BlobHash:  &hash,
+		ObjectKey: "blobs/ab/ab12_w320.jpg",
+		MimeType:  "image/jpeg",
+		Width:     320,
+		Height:    240,
+		Size:      15000,
+	}
+
+	err := repo.Create(context.Background(), variant)
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestImageVariantRepositoryImpl_GetByImageIDs(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	rows := sqlmock.NewRows([]string{"image_id", "object_key", "mime_type", "width", "height", "size", "created_at"}).
+		AddRow("img1", "posts/post1/2026/10/1_w320.jpg", "image/jpeg", 320, 240, 15000, time.Now()).
+		AddRow("img2", "posts/post1/2026/10/2_w320.jpg", "image/jpeg", 320, 180, 12000, time.Now()).
+		AddRow("img1", "posts/post1/2026/10/1_w640.jpg", "image/jpeg", 640, 480, 45000, time.Now())
+	mock.ExpectQuery(`FROM image_variants v WHERE v.image_id = ANY\(\$1\)\s+UNION ALL.*` +
+		`JOIN image_variants v ON v.blob_hash = i.blob_hash WHERE i.image_id = ANY\(\$1\)\s+ORDER BY width, mime_type`).
+		WithArgs(pq.Array([]string{"img1", "img2"})).
+		WillReturnRows(rows)
+
+	repo := repository.NewImageVariantRepository(db)
+
+	variantsByImage, err := repo.GetByImageIDs(context.Background(), []string{"img1", "img2"})
+
+	assert.NoError(t, err)
+	assert.Len(t, variantsByImage["img1"], 2)
+	assert.Len(t, variantsByImage["img2"], 1)
+	assert.Equal(t, 640, variantsByImage["img1"][1].Width)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -181,6 +181,7 @@ func TestPostRepositoryImpl_Create(t *testing.T) {
 				assert.NoError(t, err)
 				assert.NotEmpty(t, tc.post.CreatedAt)
 				assert.NotEmpty(t, tc.post.UpdatedAt)
+				assert.Equal(t, 1, tc.post.Version)
 				if tc.post.PostID == "" {
 					_, uuidErr := uuid.Parse(tc.post.PostID)
 					assert.NoError(t, uuidErr)
@@ -328,6 +329,7 @@ func TestPostRepositoryImpl_Update(t *testing.T) {
 					WillReturnRows(rows)
 
 				// Mock for UPDATE
+				mock.ExpectBegin()
 				mock.ExpectExec(`UPDATE posts SET`).
 					WithArgs(
 						post.Title,
@@ -336,11 +338,106 @@ func TestPostRepositoryImpl_Update(t *testing.T) {
 						sqlmock.AnyArg(), // updated_at
 						post.PostID,
 						post.AuthorID,
+						post.Version,
 					).
 					WillReturnResult(sqlmock.NewResult(0, 1))
+
+				// the first update saves the original version and the new one
+				mock.ExpectQuery(`SELECT COALESCE\(MAX\(revision\), 0\) FROM post_revisions WHERE post_id = \$1`).
+					WithArgs(post.PostID).
+					WillReturnRows(sqlmock.NewRows([]string{"coalesce"}).AddRow(0))
+				mock.ExpectExec(`INSERT INTO post_revisions`).
+					WithArgs(post.PostID, 1, "Old Title", "Old Content", sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`INSERT INTO post_revisions`).
+					WithArgs(post.PostID, 2, post.Title, post.Content, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
 			},
 			expectError: false,
 		},
+		{
+			name: "Успешное обновление поста с историей",
+			post: &models.Post{
+				PostID:   "test-post-id",
+				AuthorID: "test-author-id",
+				Title:    "Updated Title",
+				Content:  "Updated Content",
+				Status:   "Draft",
+			},
+			setupMock: func(mock sqlmock.Sqlmock, post *models.Post) {
+				rows := sqlmock.NewRows([]string{
+					"post_id", "author_id", "idempotency_key", "title",
+					"content", "status", "created_at", "updated_at",
+				}).
+					AddRow(
+						post.PostID,
+						post.AuthorID,
+						"test-key",
+						"Old Title",
+						"Old Content",
+						"Draft",
+						time.Now(),
+						time.Now(),
+					)
+				mock.ExpectQuery(`SELECT \* FROM posts WHERE post_id = \$1`).
+					WithArgs(post.PostID).
+					WillReturnRows(rows)
+
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE posts SET`).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(`SELECT COALESCE\(MAX\(revision\), 0\) FROM post_revisions WHERE post_id = \$1`).
+					WithArgs(post.PostID).
+					WillReturnRows(sqlmock.NewRows([]string{"coalesce"}).AddRow(4))
+				mock.ExpectExec(`INSERT INTO post_revisions`).
+					WithArgs(post.PostID, 5, post.Title, post.Content, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			expectError: false,
+		},
+		{
+			name: "Ошибка при сохранении ревизии",
+			post: &models.Post{
+				PostID:   "test-post-id",
+				AuthorID: "test-author-id",
+				Title:    "Updated Title",
+				Content:  "Updated Content",
+				Status:   "Draft",
+			},
+			setupMock: func(mock sqlmock.Sqlmock, post *models.Post) {
+				rows := sqlmock.NewRows([]string{
+					"post_id", "author_id", "idempotency_key", "title",
+					"content", "status", "created_at", "updated_at",
+				}).
+					AddRow(
+						post.PostID,
+						post.AuthorID,
+						"test-key",
+						"Old Title",
+						"Old Content",
+						"Draft",
+						time.Now(),
+						time.Now(),
+					)
+				mock.ExpectQuery(`SELECT \* FROM posts WHERE post_id = \$1`).
+					WithArgs(post.PostID).
+					WillReturnRows(rows)
+
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE posts SET`).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(`SELECT COALESCE\(MAX\(revision\), 0\) FROM post_revisions WHERE post_id = \$1`).
+					WithArgs(post.PostID).
+					WillReturnRows(sqlmock.NewRows([]string{"coalesce"}).AddRow(2))
+				mock.ExpectExec(`INSERT INTO post_revisions`).
+					WillReturnError(fmt.Errorf("database error"))
+				mock.ExpectRollback()
+			},
+			expectError: true,
+			errorMsg:    "ошибка при сохранении ревизии поста",
+		},
 		{
 			name: "Ошибка - пост не найден",
 			post: &models.Post{
@@ -417,11 +514,46 @@ func TestPostRepositoryImpl_Update(t *testing.T) {
 					WithArgs(post.PostID).
 					WillReturnRows(rows)
 
+				mock.ExpectBegin()
 				mock.ExpectExec(`UPDATE posts SET`).
 					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
 			},
 			expectError: true,
-			errorMsg:    "пост не найден или у вас нет прав на его изменение",
+			errorMsg:    "версия поста устарела",
+		},
+		{
+			name: "Ошибка - устаревшая версия поста",
+			post: &models.Post{
+				PostID:   "test-post-id",
+				AuthorID: "test-author-id",
+				Title:    "Updated Title",
+				Content:  "Updated Content",
+				Status:   "Draft",
+				Version:  2,
+			},
+			setupMock: func(mock sqlmock.Sqlmock, post *models.Post) {
+				rows := sqlmock.NewRows([]string{
+					"post_id", "author_id", "idempotency_key", "title",
+					"content", "status", "version", "created_at", "updated_at",
+				}).
+					AddRow(
+						post.PostID,
+						post.AuthorID,
+						"test-key",
+						"Old Title",
+						"Old Content",
+						"Draft",
+						3,
+						time.Now(),
+						time.Now(),
+					)
+				mock.ExpectQuery(`SELECT \* FROM posts WHERE post_id = \$1`).
+					WithArgs(post.PostID).
+					WillReturnRows(rows)
+			},
+			expectError: true,
+			errorMsg:    "версия поста устарела: текущая версия 3",
 		},
 		{
 			name: "Ошибка базы данных при обновлении",
@@ -451,8 +583,10 @@ func TestPostRepositoryImpl_Update(t *testing.T) {
 					WithArgs(post.PostID).
 					WillReturnRows(rows)
 
+				mock.ExpectBegin()
 				mock.ExpectExec(`UPDATE posts SET`).
 					WillReturnError(fmt.Errorf("database error"))
+				mock.ExpectRollback()
 			},
 			expectError: true,
 			errorMsg:    "ошибка при обновлении поста",
@@ -477,6 +611,7 @@ func TestPostRepositoryImpl_Update(t *testing.T) {
 			} else {
 				assert.NoError(t, err)
 				assert.NotEmpty(t, tc.post.UpdatedAt)
+				assert.Equal(t, 1, tc.post.Version)
 			}
 
 			assert.NoError(t, mock.ExpectationsWereMet())
@@ -491,28 +626,232 @@ func TestPostRepositoryImpl_Delete(t *testing.T) {
 		setupMock   func(mock sqlmock.Sqlmock)
 		expectError bool
 		errorMsg    string
+	}{
+		{
+			name:   "Пост перемещен в корзину",
+			postID: "test-post-id",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`UPDATE posts SET deleted_at = CURRENT_TIMESTAMP WHERE post_id = \$1 AND deleted_at IS NULL`).
+					WithArgs("test-post-id").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			expectError: false,
+		},
+		{
+			name:   "Пост не найден или уже в корзине",
+			postID: "test-post-id",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`UPDATE posts SET deleted_at = CURRENT_TIMESTAMP`).
+					WithArgs("test-post-id").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			expectError: true,
+			errorMsg:    "пост не найден",
+		},
+		{
+			name:   "Ошибка базы данных",
+			postID: "test-post-id",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`UPDATE posts SET deleted_at = CURRENT_TIMESTAMP`).
+					WithArgs("test-post-id").
+					WillReturnError(fmt.Errorf("database error"))
+			},
+			expectError: true,
+			errorMsg:    "ошибка при удалении поста",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock := setupMockDB(t)
+			tc.setupMock(mock)
+
+			repo := repository.NewPostRepository(db)
+
+			ctx := context.Background()
+			err := repo.Delete(ctx, tc.postID)
+
+			if tc.expectError {
+				assert.Error(t, err)
+				if tc.errorMsg != "" {
+					assert.Contains(t, err.Error(), tc.errorMsg)
+				}
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestPostRepositoryImpl_Restore(t *testing.T) {
+	tests := []struct {
+		name        string
+		setupMock   func(mock sqlmock.Sqlmock)
+		expectError bool
+		errorMsg    string
+	}{
+		{
+			name: "Пост восстановлен из корзины",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`UPDATE posts SET deleted_at = NULL WHERE post_id = \$1 AND author_id = \$2 AND deleted_at IS NOT NULL`).
+					WithArgs("test-post-id", "test-author-id").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			expectError: false,
+		},
+		{
+			name: "Пост не найден в корзине",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`UPDATE posts SET deleted_at = NULL`).
+					WithArgs("test-post-id", "test-author-id").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			expectError: true,
+			errorMsg:    "пост не найден в корзине",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock := setupMockDB(t)
+			tc.setupMock(mock)
+
+			repo := repository.NewPostRepository(db)
+
+			err := repo.Restore(context.Background(), "test-post-id", "test-author-id")
+
+			if tc.expectError {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.errorMsg)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestPostRepositoryImpl_GetDeletedBefore(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	before := time.Now().Add(-30 * 24 * time.Hour)
+	rows := sqlmock.NewRows([]string{"post_id", "author_id", "title", "content", "status", "deleted_at"}).
+		AddRow("test-post-id", "test-author-id", "Title", "Content", "Draft", before.Add(-time.Hour))
+	mock.ExpectQuery(`SELECT \* FROM posts WHERE deleted_at IS NOT NULL AND deleted_at < \$1`).
+		WithArgs(before).
+		WillReturnRows(rows)
+
+	repo := repository.NewPostRepository(db)
+
+	posts, err := repo.GetDeletedBefore(context.Background(), before)
+
+	assert.NoError(t, err)
+	assert.Len(t, posts, 1)
+	assert.NotNil(t, posts[0].DeletedAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostRepositoryImpl_GetByFollowedAuthors(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	publishedAt := time.Now()
+	// a draft written long ago and published just now is ordered by its publication
+	rows := sqlmock.NewRows([]string{"post_id", "author_id", "title", "content", "status", "created_at", "published_at"}).
+		AddRow("post2", "author1", "Title", "Content", "Published", publishedAt.Add(-72*time.Hour), publishedAt.Add(-time.Minute))
+	mock.ExpectQuery(`SELECT p.\* FROM posts p\s+JOIN follows f ON f.followee_id = p.author_id\s+`+
+		`WHERE f.follower_id = \$1 AND p.status = 'Published' AND p.deleted_at IS NULL `+
+		`AND \(p.published_at, p.post_id\) < \(\$2, \$3\) ORDER BY p.published_at DESC, p.post_id DESC LIMIT \$4`).
+		WithArgs("reader1", publishedAt, "post1", 21).
+		WillReturnRows(rows)
+
+	repo := repository.NewPostRepository(db)
+
+	posts, err := repo.GetByFollowedAuthors(context.Background(), "reader1",
+		&repository.PageCursor{Time: publishedAt, ID: "post1"}, 21)
+
+	assert.NoError(t, err)
+	assert.Len(t, posts, 1)
+	assert.Equal(t, "post2", posts[0].PostID)
+	assert.Equal(t, publishedAt.Add(-time.Minute), *posts[0].PublishedAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostRepositoryImpl_Purge(t *testing.T) {
+	tests := []struct {
+		name        string
+		postID      string
+		setupMock   func(mock sqlmock.Sqlmock)
+		released    []string
+		expectError bool
+		errorMsg    string
 	}{
 		{
 			name:   "Успешное удаление поста",
 			postID: "test-post-id",
 			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`DELETE FROM image_variants`).
+					WithArgs("test-post-id").
+					WillReturnRows(sqlmock.NewRows([]string{"image_id", "object_key"}).
+						AddRow("img1", "posts/test-post-id/1_w320.jpg"))
+				mock.ExpectQuery(`DELETE FROM images WHERE post_id = \$1`).
+					WithArgs("test-post-id").
+					WillReturnRows(sqlmock.NewRows([]string{"image_id", "post_id", "object_key", "size", "blob_hash"}).
+						AddRow("img1", "test-post-id", "posts/test-post-id/1.jpg", 1024, nil).
+						AddRow("img2", "test-post-id", "blobs/ab/ab-1.jpg", 2048, "ab"))
+				mock.ExpectQuery(`UPDATE image_blobs SET ref_count = ref_count - 1`).
+					WithArgs("ab").
+					WillReturnRows(sqlmock.NewRows([]string{"ref_count"}).AddRow(1))
+				mock.ExpectExec(`INSERT INTO post_storage_usage`).
+					WithArgs("test-post-id", int64(-3072), -2).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(`INSERT INTO user_storage_usage`).
+					WithArgs("test-post-id", int64(-3072), -2).
+					WillReturnRows(sqlmock.NewRows([]string{"user_id", "bytes", "objects", "updated_at", "role"}).
+						AddRow("test-author-id", 0, 0, time.Now(), "Author"))
 				mock.ExpectExec(`DELETE FROM posts WHERE post_id = \$1`).
 					WithArgs("test-post-id").
 					WillReturnResult(sqlmock.NewResult(0, 1))
-
-				mock.ExpectExec(`DELETE FROM images WHERE post_id = \$1`).
+				mock.ExpectCommit()
+			},
+			// the blob is still used by another image
+			released:    []string{"posts/test-post-id/1.jpg", "posts/test-post-id/1_w320.jpg"},
+			expectError: false,
+		},
+		{
+			name:   "Пост без изображений",
+			postID: "test-post-id",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`DELETE FROM image_variants`).
+					WithArgs("test-post-id").
+					WillReturnRows(sqlmock.NewRows([]string{"image_id", "object_key"}))
+				mock.ExpectQuery(`DELETE FROM images WHERE post_id = \$1`).
+					WithArgs("test-post-id").
+					WillReturnRows(sqlmock.NewRows([]string{"image_id", "post_id", "object_key", "size", "blob_hash"}))
+				mock.ExpectExec(`DELETE FROM posts WHERE post_id = \$1`).
 					WithArgs("test-post-id").
-					WillReturnResult(sqlmock.NewResult(0, 2))
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
 			},
+			released:    []string{},
 			expectError: false,
 		},
 		{
 			name:   "Ошибка при удалении изображений",
 			postID: "test-post-id",
 			setupMock: func(mock sqlmock.Sqlmock) {
-				mock.ExpectExec(`DELETE FROM posts WHERE post_id = \$1`).
+				mock.ExpectBegin()
+				mock.ExpectQuery(`DELETE FROM image_variants`).
+					WithArgs("test-post-id").
+					WillReturnRows(sqlmock.NewRows([]string{"image_id", "object_key"}))
+				mock.ExpectQuery(`DELETE FROM images WHERE post_id = \$1`).
 					WithArgs("test-post-id").
 					WillReturnError(fmt.Errorf("image deletion error"))
+				mock.ExpectRollback()
 			},
 			expectError: true,
 			errorMsg:    "image deletion error",
@@ -527,7 +866,7 @@ func TestPostRepositoryImpl_Delete(t *testing.T) {
 			repo := repository.NewPostRepository(db)
 
 			ctx := context.Background()
-			err := repo.Delete(ctx, tc.postID)
+			released, err := repo.Purge(ctx, tc.postID)
 
 			if tc.expectError {
 				assert.Error(t, err)
@@ -536,6 +875,7 @@ func TestPostRepositoryImpl_Delete(t *testing.T) {
 				}
 			} else {
 				assert.NoError(t, err)
+				assert.Equal(t, tc.released, released)
 			}
 
 			assert.NoError(t, mock.ExpectationsWereMet())
@@ -555,7 +895,7 @@ func TestPostRepositoryImpl_Publish(t *testing.T) {
 			name:   "Успешная публикация поста",
 			postID: "test-post-id",
 			setupMock: func(mock sqlmock.Sqlmock) {
-				mock.ExpectExec(`UPDATE posts SET`).
+				mock.ExpectExec(`UPDATE posts SET\s+status = 'Published',\s+published_at = CURRENT_TIMESTAMP`).
 					WithArgs("test-post-id").
 					WillReturnResult(sqlmock.NewResult(0, 1))
 			},
@@ -609,62 +949,66 @@ func TestPostRepositoryImpl_Publish(t *testing.T) {
 	}
 }
 
-func TestPostRepositoryImpl_CheckIdempotencyKey(t *testing.T) {
+func TestPostRepositoryImpl_CreateIdempotent(t *testing.T) {
 	tests := []struct {
-		name            string
-		authorID        string
-		idempotencyKey  string
-		setupMock       func(mock sqlmock.Sqlmock)
-		expectedAllowed bool
-		expectError     bool
-		errorMsg        string
+		name          string
+		setupMock     func(mock sqlmock.Sqlmock)
+		expectExisted bool
+		expectError   bool
+		errorMsg      string
 	}{
 		{
-			name:            "Пустой idempotency key разрешен",
-			authorID:        "test-author-id",
-			idempotencyKey:  "",
-			setupMock:       func(mock sqlmock.Sqlmock) {},
-			expectedAllowed: true,
-			expectError:     false,
-		},
-		{
-			name:           "Idempotency key не используется",
-			authorID:       "test-author-id",
-			idempotencyKey: "unique-key",
+			name: "Новый ключ создает пост и сохраняет ответ",
 			setupMock: func(mock sqlmock.Sqlmock) {
-				rows := sqlmock.NewRows([]string{"count"}).AddRow(0)
-				mock.ExpectQuery(`SELECT COUNT\(\*\) FROM posts WHERE author_id = \$1 AND idempotency_key = \$2`).
-					WithArgs("test-author-id", "unique-key").
-					WillReturnRows(rows)
+				mock.ExpectBegin()
+				mock.ExpectExec(`DELETE FROM post_idempotency_keys WHERE author_id = \$1 AND idempotency_key = \$2 AND expires_at < CURRENT_TIMESTAMP`).
+					WithArgs("test-author-id", "test-key").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(`INSERT INTO post_idempotency_keys`).
+					WithArgs("test-author-id", "test-key", "test-hash", sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`INSERT INTO posts`).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE post_idempotency_keys SET response_status = \$1, response_body = \$2`).
+					WithArgs(201, []byte(`{"title":"Test Title"}`), "test-author-id", "test-key").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
 			},
-			expectedAllowed: true,
-			expectError:     false,
+			expectExisted: false,
 		},
 		{
-			name:           "Idempotency key уже использован",
-			authorID:       "test-author-id",
-			idempotencyKey: "duplicate-key",
+			name: "Повторный ключ возвращает сохраненную запись",
 			setupMock: func(mock sqlmock.Sqlmock) {
-				rows := sqlmock.NewRows([]string{"count"}).AddRow(1)
-				mock.ExpectQuery(`SELECT COUNT\(\*\) FROM posts WHERE author_id = \$1 AND idempotency_key = \$2`).
-					WithArgs("test-author-id", "duplicate-key").
+				mock.ExpectBegin()
+				mock.ExpectExec(`DELETE FROM post_idempotency_keys`).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(`INSERT INTO post_idempotency_keys`).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				rows := sqlmock.NewRows([]string{
+					"author_id", "idempotency_key", "request_hash", "response_status",
+					"response_body", "created_at", "expires_at",
+				}).AddRow("test-author-id", "test-key", "test-hash", 201, []byte(`{"postID":"original-post-id"}`), time.Now(), time.Now().Add(time.Hour))
+				mock.ExpectQuery(`SELECT \* FROM post_idempotency_keys WHERE author_id = \$1 AND idempotency_key = \$2`).
+					WithArgs("test-author-id", "test-key").
 					WillReturnRows(rows)
+				mock.ExpectRollback()
 			},
-			expectedAllowed: false,
-			expectError:     false,
+			expectExisted: true,
 		},
 		{
-			name:           "Ошибка базы данных",
-			authorID:       "test-author-id",
-			idempotencyKey: "test-key",
+			name: "Ошибка при создании поста",
 			setupMock: func(mock sqlmock.Sqlmock) {
-				mock.ExpectQuery(`SELECT COUNT\(\*\) FROM posts WHERE author_id = \$1 AND idempotency_key = \$2`).
-					WithArgs("test-author-id", "test-key").
+				mock.ExpectBegin()
+				mock.ExpectExec(`DELETE FROM post_idempotency_keys`).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(`INSERT INTO post_idempotency_keys`).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`INSERT INTO posts`).
 					WillReturnError(fmt.Errorf("database error"))
+				mock.ExpectRollback()
 			},
-			expectedAllowed: false,
-			expectError:     true,
-			errorMsg:        "ошибка при проверке idempotency key",
+			expectError: true,
+			errorMsg:    "ошибка при создании поста",
 		},
 	}
 
@@ -675,17 +1019,33 @@ func TestPostRepositoryImpl_CheckIdempotencyKey(t *testing.T) {
 
 			repo := repository.NewPostRepository(db)
 
-			ctx := context.Background()
-			allowed, err := repo.CheckIdempotencyKey(ctx, tc.authorID, tc.idempotencyKey)
+			post := &models.Post{
+				AuthorID:       "test-author-id",
+				IdempotencyKey: stringPtr("test-key"),
+				Title:          "Test Title",
+				Content:        "Test Content",
+				Status:         "Draft",
+			}
+
+			// the stored response is the one rendered by the caller for the created post
+			response := func(post *models.Post) (int, []byte, error) {
+				return 201, []byte(`{"title":"` + post.Title + `"}`), nil
+			}
+
+			existingKey, err := repo.CreateIdempotent(context.Background(), post, "test-hash", response, time.Hour)
 
 			if tc.expectError {
 				assert.Error(t, err)
-				if tc.errorMsg != "" {
-					assert.Contains(t, err.Error(), tc.errorMsg)
-				}
+				assert.Contains(t, err.Error(), tc.errorMsg)
+			} else if tc.expectExisted {
+				assert.NoError(t, err)
+				assert.NotNil(t, existingKey)
+				assert.Equal(t, "test-hash", existingKey.RequestHash)
+				assert.Equal(t, 201, existingKey.ResponseStatus)
 			} else {
 				assert.NoError(t, err)
-				assert.Equal(t, tc.expectedAllowed, allowed)
+				assert.Nil(t, existingKey)
+				assert.NotEmpty(t, post.PostID)
 			}
 
 			assert.NoError(t, mock.ExpectationsWereMet())
@@ -697,3 +1057,18 @@ func TestPostRepositoryImpl_CheckIdempotencyKey(t *testing.T) {
 func stringPtr(s string) *string {
 	return &s
 }
+
+func TestPostRepositoryImpl_DeleteExpiredIdempotencyKeys(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	mock.ExpectExec(`DELETE FROM post_idempotency_keys WHERE expires_at < CURRENT_TIMESTAMP`).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	repo := repository.NewPostRepository(db)
+
+	deleted, err := repo.DeleteExpiredIdempotencyKeys(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), deleted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,140 @@
+package testRepository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"microblogCPT/internal/repository"
+	"testing"
+	"time"
+)
+
+func TestPostRevisionRepositoryImpl_GetByPostID(t *testing.T) {
+	tests := []struct {
+		name        string
+		postID      string
+		setupMock   func(mock sqlmock.Sqlmock)
+		expectCount int
+		expectError bool
+		errorMsg    string
+	}{
+		{
+			name:   "Успешное получение ревизий",
+			postID: "test-post-id",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"post_id", "revision", "title", "content", "created_at"}).
+					AddRow("test-post-id", 2, "New Title", "New Content", time.Now()).
+					AddRow("test-post-id", 1, "Old Title", "Old Content", time.Now())
+				mock.ExpectQuery(`SELECT \* FROM post_revisions WHERE post_id = \$1 ORDER BY revision DESC`).
+					WithArgs("test-post-id").
+					WillReturnRows(rows)
+			},
+			expectCount: 2,
+			expectError: false,
+		},
+		{
+			name:   "Пост без ревизий",
+			postID: "test-post-id",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"post_id", "revision", "title", "content", "created_at"})
+				mock.ExpectQuery(`SELECT \* FROM post_revisions`).
+					WithArgs("test-post-id").
+					WillReturnRows(rows)
+			},
+			expectCount: 0,
+			expectError: false,
+		},
+		{
+			name:   "Ошибка базы данных",
+			postID: "test-post-id",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM post_revisions`).
+					WithArgs("test-post-id").
+					WillReturnError(fmt.Errorf("database error"))
+			},
+			expectError: true,
+			errorMsg:    "ошибка при получении ревизий поста",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock := setupMockDB(t)
+			tc.setupMock(mock)
+
+			repo := repository.NewPostRevisionRepository(db)
+
+			revisions, err := repo.GetByPostID(context.Background(), tc.postID)
+
+			if tc.expectError {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.errorMsg)
+			} else {
+				assert.NoError(t, err)
+				assert.NotNil(t, revisions)
+				assert.Len(t, revisions, tc.expectCount)
+			}
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestPostRevisionRepositoryImpl_GetByRevision(t *testing.T) {
+	tests := []struct {
+		name        string
+		revision    int
+		setupMock   func(mock sqlmock.Sqlmock)
+		expectError bool
+		errorMsg    string
+	}{
+		{
+			name:     "Успешное получение ревизии",
+			revision: 1,
+			setupMock: func(mock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"post_id", "revision", "title", "content", "created_at"}).
+					AddRow("test-post-id", 1, "Old Title", "Old Content", time.Now())
+				mock.ExpectQuery(`SELECT \* FROM post_revisions WHERE post_id = \$1 AND revision = \$2`).
+					WithArgs("test-post-id", 1).
+					WillReturnRows(rows)
+			},
+			expectError: false,
+		},
+		{
+			name:     "Ревизия не найдена",
+			revision: 7,
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM post_revisions WHERE post_id = \$1 AND revision = \$2`).
+					WithArgs("test-post-id", 7).
+					WillReturnError(sql.ErrNoRows)
+			},
+			expectError: true,
+			errorMsg:    "ревизия 7 поста test-post-id не найдена",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock := setupMockDB(t)
+			tc.setupMock(mock)
+
+			repo := repository.NewPostRevisionRepository(db)
+
+			revision, err := repo.GetByRevision(context.Background(), "test-post-id", tc.revision)
+
+			if tc.expectError {
+				assert.Error(t, err)
+				assert.Nil(t, revision)
+				assert.Contains(t, err.Error(), tc.errorMsg)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.revision, revision.Revision)
+				assert.Equal(t, "Old Title", revision.Title)
+			}
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package testRepository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"microblogCPT/internal/models"
+	"microblogCPT/internal/repository"
+	"testing"
+	"time"
+)
+
+func TestStorageUsageRepositoryImpl_GetByUserID(t *testing.T) {
+	tests := []struct {
+		name        string
+		setupMock   func(mock sqlmock.Sqlmock)
+		expectError bool
+		errorMsg    string
+	}{
+		{
+			name: "Успешное получение использования",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT u.user_id, u.role.*FROM users u\s+LEFT JOIN user_storage_usage`).
+					WithArgs("user1").
+					WillReturnRows(sqlmock.NewRows([]string{"user_id", "role", "bytes", "objects", "updated_at"}).
+						AddRow("user1", "Author", 4096, 2, time.Now()))
+			},
+		},
+		{
+			name: "Пользователь не найден",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT u.user_id, u.role`).
+					WithArgs("user1").
+					WillReturnError(sql.ErrNoRows)
+			},
+			expectError: true,
+			errorMsg:    "пользователь не найден",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock := setupMockDB(t)
+			tc.setupMock(mock)
+
+			repo := repository.NewStorageUsageRepository(db)
+
+			usage, err := repo.GetByUserID(context.Background(), "user1")
+
+			if tc.expectError {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.errorMsg)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "Author", usage.Role)
+				assert.Equal(t, int64(4096), usage.Bytes)
+				assert.Equal(t, 2, usage.Objects)
+			}
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestStorageUsageRepositoryImpl_Recompute(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`LOCK TABLE user_storage_usage, post_storage_usage IN EXCLUSIVE MODE`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM post_storage_usage`).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(`DELETE FROM user_storage_usage`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO post_storage_usage .* FROM images i JOIN posts p`).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(`INSERT INTO user_storage_usage .* FROM post_storage_usage`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	repo := repository.NewStorageUsageRepository(db)
+
+	assert.NoError(t, repo.Recompute(context.Background()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestQuotaExceeded(t *testing.T) {
+	quota := models.StorageQuota{MaxBytes: 1000, MaxObjects: 2}
+
+	assert.False(t, repository.QuotaExceeded(&models.StorageUsage{Bytes: 1000, Objects: 2}, quota))
+	assert.True(t, repository.QuotaExceeded(&models.StorageUsage{Bytes: 1001, Objects: 1}, quota))
+	assert.True(t, repository.QuotaExceeded(&models.StorageUsage{Bytes: 10, Objects: 3}, quota))
+	assert.False(t, repository.QuotaExceeded(&models.StorageUsage{Bytes: 1 << 40, Objects: 1 << 20}, models.StorageQuota{}))
+}
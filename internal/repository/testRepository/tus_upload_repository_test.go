@@ -0,0 +1,127 @@
+package testRepository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"microblogCPT/internal/models"
+	"microblogCPT/internal/repository"
+	"testing"
+	"time"
+)
+
+func tusUploadRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{
+		"upload_id", "author_id", "object_key", "storage_upload_id", "file_name", "content_type", "length",
+		"upload_offset", "part_etags", "pending", "completed", "created_at", "expires_at",
+	})
+}
+
+func TestTusUploadRepositoryImpl_GetByID(t *testing.T) {
+	tests := []struct {
+		name        string
+		setupMock   func(mock sqlmock.Sqlmock)
+		expectError bool
+		errorMsg    string
+	}{
+		{
+			name: "Успешное получение загрузки",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM tus_uploads WHERE upload_id = \$1`).
+					WithArgs("test-upload-id").
+					WillReturnRows(tusUploadRows().AddRow("test-upload-id", "test-author-id", "uploads/test-upload-id",
+						"multipart-id", "video.png", "image/png", 10485760, 5242880, "{etag1}", []byte{}, false,
+						time.Now(), time.Now()))
+			},
+		},
+		{
+			name: "Загрузка не найдена",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM tus_uploads WHERE upload_id = \$1`).
+					WithArgs("test-upload-id").
+					WillReturnError(sql.ErrNoRows)
+			},
+			expectError: true,
+			errorMsg:    "загрузка не найдена",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock := setupMockDB(t)
+			tc.setupMock(mock)
+
+			repo := repository.NewTusUploadRepository(db)
+
+			upload, err := repo.GetByID(context.Background(), "test-upload-id")
+
+			if tc.expectError {
+				assert.Error(t, err)
+				assert.Nil(t, upload)
+				assert.Contains(t, err.Error(), tc.errorMsg)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, int64(5242880), upload.Offset)
+				assert.Equal(t, pq.StringArray{"etag1"}, upload.PartETags)
+			}
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestTusUploadRepositoryImpl_UpdateProgress(t *testing.T) {
+	tests := []struct {
+		name        string
+		setupMock   func(mock sqlmock.Sqlmock)
+		expectError bool
+		errorMsg    string
+	}{
+		{
+			name: "Успешное сохранение смещения",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`UPDATE tus_uploads`).
+					WithArgs(int64(5242880), sqlmock.AnyArg(), sqlmock.AnyArg(), false, "test-upload-id", int64(0)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name: "Смещение изменил другой запрос",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`UPDATE tus_uploads`).
+					WithArgs(int64(5242880), sqlmock.AnyArg(), sqlmock.AnyArg(), false, "test-upload-id", int64(0)).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			expectError: true,
+			errorMsg:    "смещение загрузки изменилось",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock := setupMockDB(t)
+			tc.setupMock(mock)
+
+			repo := repository.NewTusUploadRepository(db)
+
+			upload := &models.TusUpload{
+				UploadID:  "test-upload-id",
+				Offset:    5242880,
+				PartETags: pq.StringArray{"etag1"},
+			}
+
+			err := repo.UpdateProgress(context.Background(), upload, 0)
+
+			if tc.expectError {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.errorMsg)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package testRepository
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"microblogCPT/internal/models"
+	"microblogCPT/internal/repository"
+	"testing"
+	"time"
+)
+
+func TestUserImageRepositoryImpl_Replace(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`DELETE FROM user_images WHERE user_id = \$1 AND kind = \$2 RETURNING object_key`).
+		WithArgs("user1", "avatar").
+		WillReturnRows(sqlmock.NewRows([]string{"object_key"}).
+			AddRow("users/user1/avatar/old_48.jpg").
+			AddRow("users/user1/avatar/old_96.jpg"))
+	mock.ExpectExec(`INSERT INTO user_images`).
+		WithArgs("user1", "avatar", 48, "users/user1/avatar/new_48.jpg", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO user_images`).
+		WithArgs("user1", "avatar", 96, "users/user1/avatar/new_96.jpg", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	repo := repository.NewUserImageRepository(db)
+
+	oldKeys, err := repo.Replace(context.Background(), "user1", "avatar", []models.UserImage{
+		{Size: 48, ObjectKey: "users/user1/avatar/new_48.jpg"},
+		{Size: 96, ObjectKey: "users/user1/avatar/new_96.jpg"},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"users/user1/avatar/old_48.jpg", "users/user1/avatar/old_96.jpg"}, oldKeys)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserImageRepositoryImpl_ReplaceRollback(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`DELETE FROM user_images`).
+		WithArgs("user1", "banner").
+		WillReturnRows(sqlmock.NewRows([]string{"object_key"}))
+	mock.ExpectExec(`INSERT INTO user_images`).
+		WillReturnError(assert.AnError)
+	mock.ExpectRollback()
+
+	repo := repository.NewUserImageRepository(db)
+
+	_, err := repo.Replace(context.Background(), "user1", "banner", []models.UserImage{
+		{Size: 1500, ObjectKey: "users/user1/banner/new.jpg"},
+	})
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "ошибка при сохранении изображения профиля")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserImageRepositoryImpl_Delete(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	mock.ExpectQuery(`DELETE FROM user_images WHERE user_id = \$1 AND kind = \$2 RETURNING object_key`).
+		WithArgs("user1", "banner").
+		WillReturnRows(sqlmock.NewRows([]string{"object_key"}).AddRow("users/user1/banner/b.jpg"))
+
+	repo := repository.NewUserImageRepository(db)
+
+	keys, err := repo.Delete(context.Background(), "user1", "banner")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"users/user1/banner/b.jpg"}, keys)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserImageRepositoryImpl_GetByUserIDs(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	rows := sqlmock.NewRows([]string{"user_id", "kind", "size", "object_key", "created_at"}).
+		AddRow("user1", "avatar", 48, "users/user1/avatar/a_48.jpg", time.Now()).
+		AddRow("user1", "banner", 1500, "users/user1/banner/b.jpg", time.Now()).
+		AddRow("user2", "avatar", 48, "users/user2/avatar/c_48.jpg", time.Now())
+	mock.ExpectQuery(`SELECT \* FROM user_images WHERE user_id = ANY\(\$1\)`).
+		WillReturnRows(rows)
+
+	repo := repository.NewUserImageRepository(db)
+
+	imagesByUser, err := repo.GetByUserIDs(context.Background(), []string{"user1", "user2"})
+
+	assert.NoError(t, err)
+	assert.Len(t, imagesByUser["user1"], 2)
+	assert.Len(t, imagesByUser["user2"], 1)
+	assert.Equal(t, "users/user2/avatar/c_48.jpg", imagesByUser["user2"][0].ObjectKey)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserImageRepositoryImpl_GetByUserIDsEmpty(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	repo := repository.NewUserImageRepository(db)
+
+	imagesByUser, err := repo.GetByUserIDs(context.Background(), nil)
+
+	assert.NoError(t, err)
+	assert.Empty(t, imagesByUser)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/crypto/bcrypt"
@@ -40,8 +41,8 @@ func TestUserRepository_CreateUser(t *testing.T) {
 
 	t.Run("Успешное создание пользователя", func(t *testing.T) {
 		mock.ExpectExec(`
-			INSERT INTO users (user_id, email, password_hash, role, refresh_token, refresh_token_expiry_time)
-			VALUES (?, ?, ?, ?, ?, ?)
+			INSERT INTO users (user_id, email, password_hash, role, refresh_token, refresh_token_expiry_time, handle)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
 		`).
 			WithArgs(
 				sqlmock.AnyArg(), // user_id
@@ -50,6 +51,7 @@ func TestUserRepository_CreateUser(t *testing.T) {
 				role,
 				"refresh_token",
 				time.Time{},
+				sqlmock.AnyArg(), // handle
 			).
 			WillReturnResult(sqlmock.NewResult(1, 1))
 
@@ -58,6 +60,8 @@ func TestUserRepository_CreateUser(t *testing.T) {
 		assert.NoError(t, err)
 		assert.NotEmpty(t, user.UserID)
 		assert.NotEqual(t, password, user.PasswordHash)
+		assert.Equal(t, repository.NewHandle(user.UserID), user.Handle)
+		assert.Len(t, user.Handle, 16)
 
 		err = mock.ExpectationsWereMet()
 		assert.NoError(t, err)
@@ -72,8 +76,8 @@ func TestUserRepository_CreateUser(t *testing.T) {
 		}
 
 		mock.ExpectExec(`
-			INSERT INTO users (user_id, email, password_hash, role, refresh_token, refresh_token_expiry_time)
-			VALUES (?, ?, ?, ?, ?, ?)
+			INSERT INTO users (user_id, email, password_hash, role, refresh_token, refresh_token_expiry_time, handle)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
 		`).
 			WithArgs(
 				sqlmock.AnyArg(),
@@ -82,6 +86,7 @@ func TestUserRepository_CreateUser(t *testing.T) {
 				role,
 				"refresh_token",
 				time.Time{},
+				sqlmock.AnyArg(),
 			).
 			WillReturnError(errors.New("duplicate key value violates unique constraint"))
 
@@ -399,36 +404,224 @@ func TestUserRepository_UpdateUser(t *testing.T) {
 }
 
 func TestUserRepository_DeleteUser(t *testing.T) {
-	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
-	require.NoError(t, err)
-	defer db.Close()
-
-	sqlxDB := sqlx.NewDb(db, "sqlmock")
-	repo := repository.NewUserRepository(sqlxDB)
-
-	ctx := context.Background()
 	userID := uuid.New().String()
+	imageCondition := `DELETE FROM images WHERE post_id IN \(SELECT post_id FROM posts WHERE author_id = \$1\)`
 
 	t.Run("Успешное удаление пользователя", func(t *testing.T) {
-		mock.ExpectExec(`DELETE FROM users WHERE user_id = $1`).
+		db, mock := setupMockDB(t)
+		repo := repository.NewUserRepository(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`DELETE FROM image_variants`).
+			WithArgs(userID).
+			WillReturnRows(sqlmock.NewRows([]string{"image_id", "object_key"}).
+				AddRow("img1", "posts/post1/1_w320.jpg"))
+		mock.ExpectQuery(imageCondition).
+			WithArgs(userID).
+			WillReturnRows(sqlmock.NewRows([]string{"image_id", "post_id", "object_key", "size", "blob_hash"}).
+				AddRow("img1", "post1", "posts/post1/1.jpg", 1024, nil).
+				AddRow("img2", "post1", "blobs/ab/ab-1.jpg", 2048, "ab"))
+		mock.ExpectQuery(`UPDATE image_blobs SET ref_count = ref_count - 1`).
+			WithArgs("ab").
+			WillReturnRows(sqlmock.NewRows([]string{"ref_count"}).AddRow(0))
+		mock.ExpectQuery(`DELETE FROM image_variants WHERE blob_hash = \$1`).
+			WithArgs("ab").
+			WillReturnRows(sqlmock.NewRows([]string{"object_key"}).AddRow("blobs/ab/ab-1_w320.jpg"))
+		mock.ExpectExec(`DELETE FROM image_blobs`).
+			WithArgs("ab").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO post_storage_usage`).
+			WithArgs("post1", int64(-3072), -2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`INSERT INTO user_storage_usage`).
+			WithArgs("post1", int64(-3072), -2).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id", "bytes", "objects", "updated_at", "role"}).
+				AddRow(userID, 0, 0, time.Now(), "Author"))
+		mock.ExpectQuery(`DELETE FROM user_images WHERE user_id = \$1 RETURNING object_key`).
+			WithArgs(userID).
+			WillReturnRows(sqlmock.NewRows([]string{"object_key"}).AddRow("users/" + userID + "/avatar/1.jpg"))
+		mock.ExpectExec(`DELETE FROM users WHERE user_id = \$1`).
 			WithArgs(userID).
 			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
 
-		err := repo.DeleteUser(ctx, userID)
+		released, err := repo.DeleteUser(context.Background(), userID)
 
 		assert.NoError(t, err)
+		// the blob lost its last image, so its object and variant go as well
+		assert.ElementsMatch(t, []string{
+			"posts/post1/1.jpg", "posts/post1/1_w320.jpg", "blobs/ab/ab-1.jpg", "blobs/ab/ab-1_w320.jpg", "users/" + userID + "/avatar/1.jpg",
+		}, released)
+		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 
 	t.Run("Пользователь не найден при удалении", func(t *testing.T) {
-		mock.ExpectExec(`DELETE FROM users WHERE user_id = $1`).
+		db, mock := setupMockDB(t)
+		repo := repository.NewUserRepository(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`DELETE FROM image_variants`).
+			WithArgs(userID).
+			WillReturnRows(sqlmock.NewRows([]string{"image_id", "object_key"}))
+		mock.ExpectQuery(imageCondition).
+			WithArgs(userID).
+			WillReturnRows(sqlmock.NewRows([]string{"image_id", "post_id", "object_key", "size", "blob_hash"}))
+		mock.ExpectQuery(`DELETE FROM user_images`).
+			WithArgs(userID).
+			WillReturnRows(sqlmock.NewRows([]string{"object_key"}))
+		mock.ExpectExec(`DELETE FROM users WHERE user_id = \$1`).
 			WithArgs(userID).
 			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
 
-		err := repo.DeleteUser(ctx, userID)
+		_, err := repo.DeleteUser(context.Background(), userID)
 
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "не найден")
+		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 }
 
+func TestUserRepository_UpdateProfile(t *testing.T) {
+	changedAt := time.Now()
+	redirectUntil := changedAt.Add(720 * time.Hour)
+
+	tests := []struct {
+		name           string
+		user           *models.User
+		previousHandle string
+		setupMock      func(mock sqlmock.Sqlmock)
+		errorMsg       string
+	}{
+		{
+			name:           "Смена handle сохраняет перенаправление",
+			user:           &models.User{UserID: "user1", Handle: "new_name", Bio: "bio", HandleChangedAt: &changedAt},
+			previousHandle: "old_name",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT handle_changed_at FROM users WHERE user_id = \$1 FOR UPDATE`).
+					WithArgs("user1").
+					WillReturnRows(sqlmock.NewRows([]string{"handle_changed_at"}).AddRow(nil))
+				mock.ExpectExec(`DELETE FROM user_handle_redirects\s+WHERE handle = \$1 AND \(user_id = \$2 OR expires_at <= CURRENT_TIMESTAMP\)`).
+					WithArgs("new_name", "user1").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM user_handle_redirects WHERE handle = \$1\)`).
+					WithArgs("new_name").
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				mock.ExpectExec(`INSERT INTO user_handle_redirects`).
+					WithArgs("old_name", "user1", redirectUntil).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE users\s+SET handle = \?, display_name = \?, bio = \?, links = \?`).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name:           "Handle перенаправляет на другого пользователя",
+			user:           &models.User{UserID: "user1", Handle: "taken"},
+			previousHandle: "old_name",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT handle_changed_at FROM users WHERE user_id = \$1 FOR UPDATE`).
+					WithArgs("user1").
+					WillReturnRows(sqlmock.NewRows([]string{"handle_changed_at"}).AddRow(nil))
+				mock.ExpectExec(`DELETE FROM user_handle_redirects`).
+					WithArgs("taken", "user1").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(`SELECT EXISTS`).
+					WithArgs("taken").
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+				mock.ExpectRollback()
+			},
+			errorMsg: "handle уже занят",
+		},
+		{
+			name:           "Handle занят другим пользователем",
+			user:           &models.User{UserID: "user1", Handle: "taken"},
+			previousHandle: "old_name",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT handle_changed_at FROM users WHERE user_id = \$1 FOR UPDATE`).
+					WithArgs("user1").
+					WillReturnRows(sqlmock.NewRows([]string{"handle_changed_at"}).AddRow(nil))
+				mock.ExpectExec(`DELETE FROM user_handle_redirects`).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(`SELECT EXISTS`).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				mock.ExpectExec(`INSERT INTO user_handle_redirects`).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE users`).
+					WillReturnError(&pq.Error{Code: "23505"})
+				mock.ExpectRollback()
+			},
+			errorMsg: "handle уже занят",
+		},
+		{
+			name:           "Handle менялся недавно",
+			user:           &models.User{UserID: "user1", Handle: "new_name", HandleChangedAt: &changedAt},
+			previousHandle: "old_name",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT handle_changed_at FROM users WHERE user_id = \$1 FOR UPDATE`).
+					WithArgs("user1").
+					WillReturnRows(sqlmock.NewRows([]string{"handle_changed_at"}).AddRow(changedAt.Add(-time.Hour)))
+				mock.ExpectRollback()
+			},
+			errorMsg: "handle можно менять не чаще одного раза",
+		},
+		{
+			name:           "Без смены handle обновляются только поля",
+			user:           &models.User{UserID: "user1", Handle: "same", DisplayName: "Имя"},
+			previousHandle: "same",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE users`).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := setupMockDB(t)
+			tt.setupMock(mock)
+
+			repo := repository.NewUserRepository(db)
+
+			err := repo.UpdateProfile(context.Background(), tt.user, tt.previousHandle, 168*time.Hour, redirectUntil)
+
+			if tt.errorMsg != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorMsg)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUserRepository_GetHandleRedirect(t *testing.T) {
+	db, mock := setupMockDB(t)
+
+	mock.ExpectQuery(`SELECT u.handle FROM user_handle_redirects h\s+JOIN users u`).
+		WithArgs("old_name").
+		WillReturnRows(sqlmock.NewRows([]string{"handle"}).AddRow("new_name"))
+	mock.ExpectQuery(`SELECT u.handle FROM user_handle_redirects h`).
+		WithArgs("expired").
+		WillReturnError(sql.ErrNoRows)
+
+	repo := repository.NewUserRepository(db)
+
+	current, err := repo.GetHandleRedirect(context.Background(), "old_name")
+	assert.NoError(t, err)
+	assert.Equal(t, "new_name", current)
+
+	_, err = repo.GetHandleRedirect(context.Background(), "expired")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "не найден")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 //go test ./internal/repository/testRepository/... -v
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"microblogCPT/internal/models"
+	"time"
+)
+
+type TusUploadRepositoryImpl struct {
+	db *sqlx.DB
+}
+
+type CreateTusUploadRequest struct {
+	AuthorID    string `json:"author_id"`
+	FileName    string `json:"file_name"`
+	ContentType string `json:"content_type"`
+	Length      int64  `json:"length"`
+}
+
+func NewTusUploadRepository(db *sqlx.DB) *TusUploadRepositoryImpl {
+	return &TusUploadRepositoryImpl{db: db}
+}
+
+func (r *TusUploadRepositoryImpl) Create(ctx context.Context, upload *models.TusUpload) error {
+	query := `
+		INSERT INTO tus_uploads
+		(upload_id, author_id, object_key, storage_upload_id, file_name, content_type, length,
+		 upload_offset, part_etags, pending, completed, created_at, expires_at)
+		VALUES
+		(:upload_id, :author_id, :object_key, :storage_upload_id, :file_name, :content_type, :length,
+		 :upload_offset, :part_etags, :pending, :completed, :created_at, :expires_at)
+	`
+
+	// create time created
+	if upload.CreatedAt.IsZero() {
+		upload.CreatedAt = time.Now()
+	}
+	if upload.PartETags == nil {
+		upload.PartETags = []string{}
+	}
+
+	_, err := r.db.NamedExecContext(ctx, query, upload)
+	if err != nil {
+		return fmt.Errorf("ошибка при создании загрузки: %w", err)
+	}
+
+	return nil
+}
+
+func (r *TusUploadRepositoryImpl) GetByID(ctx context.Context, uploadID string) (*models.TusUpload, error) {
+	query := `SELECT * FROM tus_uploads WHERE upload_id = $1`
+
+	var upload models.TusUpload
+	err := r.db.GetContext(ctx, &upload, query, uploadID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("загрузка не найдена")
+		}
+		return nil, fmt.Errorf("ошибка при получении загрузки: %w", err)
+	}
+
+	return &upload, nil
+}
+
+// UpdateProgress saves the received bytes of the upload if nobody has moved its offset since previousOffset
+func (r *TusUploadRepositoryImpl) UpdateProgress(ctx context.Context, upload *models.TusUpload, previousOffset int64) error {
+	query := `
+		UPDATE tus_uploads
+		SET upload_offset = $1, part_etags = $2, pending = $3, completed = $4
+		WHERE upload_id = $5 AND upload_offset = $6
+	`
+
+	result, err := r.db.ExecContext(ctx, query,
+		upload.Offset, upload.PartETags, upload.Pending, upload.Completed, upload.UploadID, previousOffset)
+	if err != nil {
+		return fmt.Errorf("ошибка при сохранении загрузки: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка при проверке сохраненных строк: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("смещение загрузки изменилось")
+	}
+
+	return nil
+}
+
+// GetExpired returns the uploads that were not finished or attached in time
+func (r *TusUploadRepositoryImpl) GetExpired(ctx context.Context, before time.Time) ([]models.TusUpload, error) {
+	query := `SELECT * FROM tus_uploads WHERE expires_at < $1 ORDER BY expires_at`
+
+	uploads := []models.TusUpload{}
+	err := r.db.SelectContext(ctx, &uploads, query, before)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении устаревших загрузок: %w", err)
+	}
+
+	return uploads, nil
+}
+
+func (r *TusUploadRepositoryImpl) Delete(ctx context.Context, uploadID string) error {
+	query := `DELETE FROM tus_uploads WHERE upload_id = $1`
+
+	_, err := r.db.ExecContext(ctx, query, uploadID)
+	if err != nil {
+		return fmt.Errorf("ошибка при удалении загрузки: %w", err)
+	}
+
+	return nil
+}
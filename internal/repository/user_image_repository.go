@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"microblogCPT/internal/models"
+	"time"
+)
+
+type UserImageRepositoryImpl struct {
+	db *sqlx.DB
+}
+
+func NewUserImageRepository(db *sqlx.DB) *UserImageRepositoryImpl {
+	return &UserImageRepositoryImpl{db: db}
+}
+
+// Replace removes the previous images of the kind and stores the new ones in one transaction
+func (r *UserImageRepositoryImpl) Replace(ctx context.Context, userID, kind string, images []models.UserImage) ([]string, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	oldKeys := []string{}
+	query := `DELETE FROM user_images WHERE user_id = $1 AND kind = $2 RETURNING object_key`
+	if err := tx.SelectContext(ctx, &oldKeys, query, userID, kind); err != nil {
+		return nil, fmt.Errorf("ошибка при удалении изображений профиля: %w", err)
+	}
+
+	insert := `
+		INSERT INTO user_images (user_id, kind, size, object_key, created_at)
+		VALUES (:user_id, :kind, :size, :object_key, :created_at)
+	`
+	for i := range images {
+		images[i].UserID = userID
+		images[i].Kind = kind
+		if images[i].CreatedAt.IsZero() {
+			images[i].CreatedAt = time.Now()
+		}
+
+		if _, err := tx.NamedExecContext(ctx, insert, images[i]); err != nil {
+			return nil, fmt.Errorf("ошибка при сохранении изображения профиля: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка при подтверждении транзакции: %w", err)
+	}
+
+	return oldKeys, nil
+}
+
+// Delete removes the images of the kind and returns the keys of their objects
+func (r *UserImageRepositoryImpl) Delete(ctx context.Context, userID, kind string) ([]string, error) {
+	query := `DELETE FROM user_images WHERE user_id = $1 AND kind = $2 RETURNING object_key`
+
+	keys := []string{}
+	if err := r.db.SelectContext(ctx, &keys, query, userID, kind); err != nil {
+		return nil, fmt.Errorf("ошибка при удалении изображений профиля: %w", err)
+	}
+
+	return keys, nil
+}
+
+// GetByUserIDs loads the profile images of several users with one query, the avatar sizes go from the smallest
+func (r *UserImageRepositoryImpl) GetByUserIDs(ctx context.Context, userIDs []string) (map[string][]models.UserImage, error) {
+	imagesByUser := make(map[string][]models.UserImage, len(userIDs))
+	if len(userIDs) == 0 {
+		return imagesByUser, nil
+	}
+
+	query := `SELECT * FROM user_images WHERE user_id = ANY($1) ORDER BY kind, size`
+
+	var images []models.UserImage
+	if err := r.db.SelectContext(ctx, &images, query, pq.Array(userIDs)); err != nil {
+		return nil, fmt.Errorf("ошибка при получении изображений профиля: %w", err)
+	}
+
+	for _, image := range images {
+		imagesByUser[image.UserID] = append(imagesByUser[image.UserID], image)
+	}
+
+	return imagesByUser, nil
+}
@@ -7,8 +7,10 @@ import (
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 	"microblogCPT/internal/models"
+	"strings"
 	"time"
 )
 
@@ -28,6 +30,23 @@ type UpdateUserRequest struct {
 	Role   string `json:"role"`
 }
 
+// UpdateProfileRequest changes the public profile of the user, the fields left out are kept
+type UpdateProfileRequest struct {
+	UserID      string    `json:"-"`
+	Handle      *string   `json:"handle"`
+	DisplayName *string   `json:"displayName"`
+	Bio         *string   `json:"bio"`
+	Links       *[]string `json:"links"`
+}
+
+// errHandleTaken is returned when the handle belongs to another user or redirects to one
+var errHandleTaken = errors.New("handle уже занят")
+
+// NewHandle generates the handle of a new user from its id, the migration fills the existing users the same way
+func NewHandle(userID string) string {
+	return "user" + strings.ReplaceAll(userID, "-", "")[:12]
+}
+
 func NewUserRepository(db *sqlx.DB) UserRepository {
 	return &userRepository{db: db}
 }
@@ -42,10 +61,11 @@ func (r *userRepository) CreateUser(ctx context.Context, user *models.User, pass
 	// create user id
 	user.UserID = uuid.New().String()
 	user.PasswordHash = string(hashedPassword)
+	user.Handle = NewHandle(user.UserID)
 
 	query := `
-		INSERT INTO users (user_id, email, password_hash, role, refresh_token, refresh_token_expiry_time)
-		VALUES (:user_id, :email, :password_hash, :role, :refresh_token, :refresh_token_expiry_time)
+		INSERT INTO users (user_id, email, password_hash, role, refresh_token, refresh_token_expiry_time, handle)
+		VALUES (:user_id, :email, :password_hash, :role, :refresh_token, :refresh_token_expiry_time, :handle)
 	`
 
 	_, err = r.db.NamedExecContext(ctx, query, user)
@@ -72,6 +92,145 @@ func (r *userRepository) GetUserByID(ctx context.Context, userID string) (*model
 	return &user, nil
 }
 
+func (r *userRepository) GetUserByHandle(ctx context.Context, handle string) (*models.User, error) {
+	var user models.User
+
+	query := `SELECT * FROM users WHERE handle = $1`
+
+	err := r.db.GetContext(ctx, &user, query, handle)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("пользователь @%s не найден", handle)
+		}
+		return nil, fmt.Errorf("ошибка при получении пользователя по handle: %w", err)
+	}
+
+	return &user, nil
+}
+
+// GetUsersByIDs loads several users with one query, the missing ones are skipped
+func (r *userRepository) GetUsersByIDs(ctx context.Context, userIDs []string) ([]models.User, error) {
+	users := []models.User{}
+	if len(userIDs) == 0 {
+		return users, nil
+	}
+
+	query := `SELECT * FROM users WHERE user_id = ANY($1)`
+
+	err := r.db.SelectContext(ctx, &users, query, pq.Array(userIDs))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении пользователей: %w", err)
+	}
+
+	return users, nil
+}
+
+// GetHandleRedirect returns the current handle of the user who had the handle before, while its redirect lasts
+func (r *userRepository) GetHandleRedirect(ctx context.Context, handle string) (string, error) {
+	query := `
+		SELECT u.handle FROM user_handle_redirects h
+		JOIN users u ON u.user_id = h.user_id
+		WHERE h.handle = $1 AND h.expires_at > CURRENT_TIMESTAMP
+	`
+
+	var current string
+	err := r.db.GetContext(ctx, &current, query, handle)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("пользователь @%s не найден", handle)
+		}
+		return "", fmt.Errorf("ошибка при получении перенаправления handle: %w", err)
+	}
+
+	return current, nil
+}
+
+// UpdateProfile stores the profile fields of the user. When the handle changes, the previous one redirects
+// to the user until redirectUntil. The new handle may be a previous handle of the same user or an expired one,
+// a handle that still redirects to another user is taken. The handle is changed at most once per changeInterval
+func (r *userRepository) UpdateProfile(ctx context.Context, user *models.User, previousHandle string, changeInterval time.Duration, redirectUntil time.Time) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	if user.Handle != previousHandle {
+		// the row of the user stays locked, so a concurrent change of the handle waits and then sees this one
+		var changedAt *time.Time
+		query := `SELECT handle_changed_at FROM users WHERE user_id = $1 FOR UPDATE`
+		if err := tx.GetContext(ctx, &changedAt, query, user.UserID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("пользователь с ID %s не найден", user.UserID)
+			}
+			return fmt.Errorf("ошибка при проверке смены handle: %w", err)
+		}
+		if changedAt != nil {
+			if next := changedAt.Add(changeInterval); time.Now().Before(next) {
+				return fmt.Errorf("handle можно менять не чаще одного раза, следующая смена возможна после %s",
+					next.Format(time.RFC3339))
+			}
+		}
+
+		query = `
+			DELETE FROM user_handle_redirects
+			WHERE handle = $1 AND (user_id = $2 OR expires_at <= CURRENT_TIMESTAMP)
+		`
+		if _, err := tx.ExecContext(ctx, query, user.Handle, user.UserID); err != nil {
+			return fmt.Errorf("ошибка при освобождении handle: %w", err)
+		}
+
+		var redirected bool
+		query = `SELECT EXISTS(SELECT 1 FROM user_handle_redirects WHERE handle = $1)`
+		if err := tx.GetContext(ctx, &redirected, query, user.Handle); err != nil {
+			return fmt.Errorf("ошибка при проверке handle: %w", err)
+		}
+		if redirected {
+			return errHandleTaken
+		}
+
+		query = `
+			INSERT INTO user_handle_redirects (handle, user_id, expires_at)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (handle) DO UPDATE SET user_id = EXCLUDED.user_id, expires_at = EXCLUDED.expires_at
+		`
+		if _, err := tx.ExecContext(ctx, query, previousHandle, user.UserID, redirectUntil); err != nil {
+			return fmt.Errorf("ошибка при сохранении перенаправления handle: %w", err)
+		}
+	}
+
+	query := `
+		UPDATE users
+		SET handle = :handle, display_name = :display_name, bio = :bio, links = :links,
+			handle_changed_at = :handle_changed_at
+		WHERE user_id = :user_id
+	`
+
+	result, err := tx.NamedExecContext(ctx, query, user)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return errHandleTaken
+		}
+		return fmt.Errorf("ошибка при обновлении профиля: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка при проверке обновленных строк: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("пользователь с ID %s не найден", user.UserID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка при подтверждении транзакции: %w", err)
+	}
+
+	return nil
+}
+
 func (r *userRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	var user models.User
 
@@ -127,24 +286,46 @@ func (r *userRepository) UpdateUser(ctx context.Context, user *models.User) erro
 	return nil
 }
 
-func (r *userRepository) DeleteUser(ctx context.Context, userID string) error {
-	query := `DELETE FROM users WHERE user_id = $1`
+// DeleteUser removes the account in one transaction with the images of its posts, the same way a purged post
+// loses them, and with its profile images. It returns the keys of the objects that are not referenced anymore
+func (r *userRepository) DeleteUser(ctx context.Context, userID string) ([]string, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	// the posts go with the user by the cascade, their images are released from the blobs first
+	_, released, err := deleteImages(ctx, tx, "post_id IN (SELECT post_id FROM posts WHERE author_id = $1)", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var profileKeys []string
+	err = tx.SelectContext(ctx, &profileKeys, `DELETE FROM user_images WHERE user_id = $1 RETURNING object_key`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при удалении изображений профиля: %w", err)
+	}
 
-	result, err := r.db.ExecContext(ctx, query, userID)
+	result, err := tx.ExecContext(ctx, `DELETE FROM users WHERE user_id = $1`, userID)
 	if err != nil {
-		return fmt.Errorf("ошибка при удалении пользователя: %w", err)
+		return nil, fmt.Errorf("ошибка при удалении пользователя: %w", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("ошибка при проверке удаленных строк: %w", err)
+		return nil, fmt.Errorf("ошибка при проверке удаленных строк: %w", err)
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("пользователь с ID %s не найден", userID)
+		return nil, fmt.Errorf("пользователь с ID %s не найден", userID)
 	}
 
-	return nil
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка при подтверждении транзакции: %w", err)
+	}
+
+	return append(released, profileKeys...), nil
 }
 
 func (r *userRepository) UpdateRefreshToken(ctx context.Context, userID, refreshToken string, expiryTime time.Time) error {
@@ -0,0 +1,258 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"microblogCPT/internal/models"
+	"microblogCPT/internal/repository"
+	"microblogCPT/internal/storage"
+)
+
+const (
+	CommentViewFlat = "flat"
+	CommentViewTree = "tree"
+)
+
+var (
+	errCommentsClosed = errors.New("комментировать можно только опубликованные посты")
+	errCommentDenied  = errors.New("доступ запрещен")
+)
+
+type CommentService interface {
+	CreateComment(ctx context.Context, req repository.CreateCommentRequest) (*models.Comment, error)
+	// UpdateComment lets the author of the comment change its content and the author of the post hide it
+	UpdateComment(ctx context.Context, req repository.UpdateCommentRequest) (*models.Comment, error)
+	// DeleteComment is allowed to the author of the comment and to the author of the post
+	DeleteComment(ctx context.Context, postID, commentID, userID string) error
+	// GetComments returns a page of the comments seen by the viewer, empty for an anonymous one, and the cursor
+	// of the next page. In the tree view the page holds the top-level comments with all their replies
+	GetComments(ctx context.Context, postID, viewerID, view, cursor string, limit int) ([]models.Comment, string, error)
+}
+
+type commentService struct {
+	commentRepo   repository.CommentRepository
+	postRepo      repository.PostRepository
+	userRepo      repository.UserRepository
+	userImageRepo repository.UserImageRepository
+	storage       storage.Storage
+}
+
+func NewCommentService(commentRepo repository.CommentRepository, postRepo repository.PostRepository, userRepo repository.UserRepository, userImageRepo repository.UserImageRepository, storage storage.Storage) CommentService {
+	return &commentService{
+		commentRepo:   commentRepo,
+		postRepo:      postRepo,
+		userRepo:      userRepo,
+		userImageRepo: userImageRepo,
+		storage:       storage,
+	}
+}
+
+func (c *commentService) CreateComment(ctx context.Context, req repository.CreateCommentRequest) (*models.Comment, error) {
+	post, err := c.postRepo.GetByID(ctx, req.PostID)
+	if err != nil {
+		return nil, err
+	}
+
+	if post.Status != "Published" {
+		return nil, errCommentsClosed
+	}
+
+	if req.ParentID != nil {
+		parent, err := c.commentRepo.GetByID(ctx, *req.ParentID)
+		if err != nil || parent.PostID != post.PostID {
+			return nil, errors.New("неверный parentID: комментарий не найден в этом посте")
+		}
+		if parent.DeletedAt != nil || parent.Hidden {
+			return nil, errors.New("нельзя ответить на скрытый или удаленный комментарий")
+		}
+	}
+
+	comment, err := c.commentRepo.Create(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return comment, c.attachAuthors(ctx, []*models.Comment{comment})
+}
+
+func (c *commentService) UpdateComment(ctx context.Context, req repository.UpdateCommentRequest) (*models.Comment, error) {
+	post, comment, err := c.postComment(ctx, req.PostID, req.CommentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Content != nil {
+		if comment.AuthorID != req.UserID {
+			return nil, errCommentDenied
+		}
+		if post.Status != "Published" {
+			return nil, errCommentsClosed
+		}
+	}
+
+	// only the author of the post moderates the comments on it
+	if req.Hidden != nil && post.AuthorID != req.UserID {
+		return nil, errCommentDenied
+	}
+
+	comment, err = c.commentRepo.Update(ctx, comment.CommentID, req.Content, req.Hidden)
+	if err != nil {
+		return nil, err
+	}
+
+	return comment, c.attachAuthors(ctx, []*models.Comment{comment})
+}
+
+func (c *commentService) DeleteComment(ctx context.Context, postID, commentID, userID string) error {
+	post, comment, err := c.postComment(ctx, postID, commentID)
+	if err != nil {
+		return err
+	}
+
+	if comment.AuthorID != userID && post.AuthorID != userID {
+		return errCommentDenied
+	}
+
+	return c.commentRepo.Delete(ctx, comment.CommentID)
+}
+
+// postComment loads the post and its comment, a deleted comment or one of another post is not found
+func (c *commentService) postComment(ctx context.Context, postID, commentID string) (*models.Post, *models.Comment, error) {
+	post, err := c.postRepo.GetByID(ctx, postID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	comment, err := c.commentRepo.GetByID(ctx, commentID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if comment.PostID != post.PostID || comment.DeletedAt != nil {
+		return nil, nil, fmt.Errorf("комментарий с ID %s не найден", commentID)
+	}
+
+	return post, comment, nil
+}
+
+func (c *commentService) GetComments(ctx context.Context, postID, viewerID, view, cursor string, limit int) ([]models.Comment, string, error) {
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	post, err := c.postRepo.GetByID(ctx, postID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if post.Status != "Published" && post.AuthorID != viewerID {
+		return nil, "", errCommentDenied
+	}
+
+	// one extra comment tells whether there is a next page
+	page := c.commentRepo.GetByPost
+	if view == CommentViewTree {
+		page = c.commentRepo.GetRootsByPost
+	}
+	comments, err := page(ctx, postID, after, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if len(comments) > limit {
+		comments = comments[:limit]
+		last := comments[limit-1]
+		next = encodeCursor(last.CreatedAt, last.CommentID)
+	}
+
+	var replies []models.Comment
+	if view == CommentViewTree {
+		rootIDs := make([]string, 0, len(comments))
+		for _, comment := range comments {
+			rootIDs = append(rootIDs, comment.CommentID)
+		}
+		if replies, err = c.commentRepo.GetReplies(ctx, rootIDs); err != nil {
+			return nil, "", err
+		}
+	}
+
+	visible := make([]*models.Comment, 0, len(comments)+len(replies))
+	for _, list := range [][]models.Comment{comments, replies} {
+		for i := range list {
+			if maskComment(&list[i], post, viewerID) {
+				visible = append(visible, &list[i])
+			}
+		}
+	}
+	if err := c.attachAuthors(ctx, visible); err != nil {
+		return nil, "", err
+	}
+
+	if view == CommentViewTree {
+		buildThreads(comments, replies)
+	}
+
+	return comments, next, nil
+}
+
+// maskComment removes the content and the author of a deleted comment and of a hidden one that the viewer
+// may not see: the hidden comments are shown to the author of the post and to their own authors.
+// It reports whether the comment stays visible
+func maskComment(comment *models.Comment, post *models.Post, viewerID string) bool {
+	if comment.DeletedAt == nil && (!comment.Hidden || post.AuthorID == viewerID || comment.AuthorID == viewerID) {
+		return true
+	}
+
+	comment.Content = ""
+	comment.AuthorID = ""
+	return false
+}
+
+// buildThreads puts the replies under the comments they answer, in the order of the replies
+func buildThreads(roots, replies []models.Comment) {
+	children := make(map[string][]models.Comment)
+	for _, reply := range replies {
+		children[*reply.ParentID] = append(children[*reply.ParentID], reply)
+	}
+
+	var attach func(comment *models.Comment)
+	attach = func(comment *models.Comment) {
+		comment.Replies = children[comment.CommentID]
+		for i := range comment.Replies {
+			attach(&comment.Replies[i])
+		}
+	}
+
+	for i := range roots {
+		attach(&roots[i])
+	}
+}
+
+func (c *commentService) attachAuthors(ctx context.Context, comments []*models.Comment) error {
+	authorIDs := []string{}
+	seen := make(map[string]bool, len(comments))
+	for _, comment := range comments {
+		if !seen[comment.AuthorID] {
+			seen[comment.AuthorID] = true
+			authorIDs = append(authorIDs, comment.AuthorID)
+		}
+	}
+
+	if len(authorIDs) == 0 {
+		return nil
+	}
+
+	authors, err := loadAuthors(ctx, c.userRepo, c.userImageRepo, c.storage, authorIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, comment := range comments {
+		comment.Author = authors[comment.AuthorID]
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"microblogCPT/internal/repository"
+	"strings"
+	"time"
+)
+
+var errInvalidCursor = errors.New("неверный курсор")
+
+// encodeCursor hides the position of the last item of the page from the client
+func encodeCursor(at time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(at.UTC().Format(time.RFC3339Nano) + "|" + id))
+}
+
+// decodeCursor reads the cursor of the next page, an empty cursor starts from the newest item
+func decodeCursor(cursor string) (*repository.PageCursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	value, id, ok := strings.Cut(string(data), "|")
+	if !ok || id == "" {
+		return nil, errInvalidCursor
+	}
+
+	at, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	return &repository.PageCursor{Time: at, ID: id}, nil
+}
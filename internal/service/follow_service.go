@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"microblogCPT/internal/models"
+	"microblogCPT/internal/repository"
+	"microblogCPT/internal/storage"
+)
+
+type FollowService interface {
+	Follow(ctx context.Context, followerID, handle string) (*models.FollowStatus, error)
+	Unfollow(ctx context.Context, followerID, handle string) (*models.FollowStatus, error)
+	// GetFollowers and GetFollowing return a page of the users and the cursor of the next page, empty on the last one
+	GetFollowers(ctx context.Context, handle, cursor string, limit int) ([]models.FollowUser, string, error)
+	GetFollowing(ctx context.Context, handle, cursor string, limit int) ([]models.FollowUser, string, error)
+}
+
+type followService struct {
+	followRepo    repository.FollowRepository
+	userRepo      repository.UserRepository
+	userImageRepo repository.UserImageRepository
+	storage       storage.Storage
+}
+
+func NewFollowService(followRepo repository.FollowRepository, userRepo repository.UserRepository, userImageRepo repository.UserImageRepository, storage storage.Storage) FollowService {
+	return &followService{
+		followRepo:    followRepo,
+		userRepo:      userRepo,
+		userImageRepo: userImageRepo,
+		storage:       storage,
+	}
+}
+
+func (f *followService) Follow(ctx context.Context, followerID, handle string) (*models.FollowStatus, error) {
+	followee, err := f.userRepo.GetUserByHandle(ctx, handle)
+	if err != nil {
+		return nil, err
+	}
+
+	if followee.UserID == followerID {
+		return nil, errors.New("нельзя подписаться на себя")
+	}
+
+	if err := f.followRepo.Follow(ctx, followerID, followee.UserID); err != nil {
+		return nil, err
+	}
+
+	return f.status(ctx, followerID, followee.UserID)
+}
+
+func (f *followService) Unfollow(ctx context.Context, followerID, handle string) (*models.FollowStatus, error) {
+	followee, err := f.userRepo.GetUserByHandle(ctx, handle)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.followRepo.Unfollow(ctx, followerID, followee.UserID); err != nil {
+		return nil, err
+	}
+
+	return f.status(ctx, followerID, followee.UserID)
+}
+
+func (f *followService) status(ctx context.Context, followerID, followeeID string) (*models.FollowStatus, error) {
+	following, err := f.followRepo.IsFollowing(ctx, followerID, followeeID)
+	if err != nil {
+		return nil, err
+	}
+
+	followers, _, err := f.followRepo.GetCounts(ctx, followeeID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.FollowStatus{Following: following, FollowerCount: followers}, nil
+}
+
+func (f *followService) GetFollowers(ctx context.Context, handle, cursor string, limit int) ([]models.FollowUser, string, error) {
+	return f.list(ctx, handle, cursor, limit, f.followRepo.GetFollowers)
+}
+
+func (f *followService) GetFollowing(ctx context.Context, handle, cursor string, limit int) ([]models.FollowUser, string, error) {
+	return f.list(ctx, handle, cursor, limit, f.followRepo.GetFollowing)
+}
+
+type followPageFunc func(ctx context.Context, userID string, cursor *repository.PageCursor, limit int) ([]models.FollowUser, error)
+
+// list reads one extra user to tell whether the page is the last one, and fills the avatars of the page
+func (f *followService) list(ctx context.Context, handle, cursor string, limit int, page followPageFunc) ([]models.FollowUser, string, error) {
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	user, err := f.userRepo.GetUserByHandle(ctx, handle)
+	if err != nil {
+		return nil, "", err
+	}
+
+	users, err := page(ctx, user.UserID, after, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if len(users) > limit {
+		users = users[:limit]
+		last := users[limit-1]
+		next = encodeCursor(last.FollowedAt, last.UserID)
+	}
+
+	userIDs := make([]string, 0, len(users))
+	for _, listed := range users {
+		userIDs = append(userIDs, listed.UserID)
+	}
+
+	imagesByUser, err := f.userImageRepo.GetByUserIDs(ctx, userIDs)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for i := range users {
+		images, err := profileImageURLs(ctx, f.storage, imagesByUser[users[i].UserID])
+		if err != nil {
+			return nil, "", err
+		}
+		users[i].ProfileImages = *images
+	}
+
+	return users, next, nil
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"microblogCPT/internal/config"
+	"microblogCPT/internal/media"
+	"microblogCPT/internal/models"
+	"microblogCPT/internal/repository"
+	"microblogCPT/internal/storage"
+	"strings"
+)
+
+// imageContent is an image ready to be stored: the SHA-256 of its content, its size
+// and the way to write it under a key when the content is new
+type imageContent struct {
+	info *media.ImageInfo
+	hash string
+	size int64
+	save func(ctx context.Context, objectName string) error
+}
+
+// bytesContent hashes an image that was read into memory
+func bytesContent(store storage.Storage, data []byte, info *media.ImageInfo) *imageContent {
+	sum := sha256.Sum256(data)
+	return &imageContent{
+		info: info,
+		hash: hex.EncodeToString(sum[:]),
+		size: int64(len(data)),
+		save: func(ctx context.Context, objectName string) error {
+			return store.SaveImage(ctx, objectName, info.MimeType, bytes.NewReader(data), int64(len(data)))
+		},
+	}
+}
+
+// storedContent prepares an object that the client uploaded past the API. When metadata is stripped
+// the image is read into memory to be sanitized, otherwise the object is only streamed through the hash
+// and copied when its content is new
+func storedContent(ctx context.Context, store storage.Storage, srcKey string, info *media.ImageInfo, size int64, cfg *config.Config) (*imageContent, error) {
+	object, err := store.OpenImage(ctx, srcKey)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	if cfg.ImageStripMetadata {
+		data, info, err := sanitizeImage(object, info, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return bytesContent(store, data, info), nil
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, object); err != nil {
+		return nil, fmt.Errorf("ошибка чтения файла: %w", err)
+	}
+
+	return &imageContent{
+		info: info,
+		hash: hex.EncodeToString(hash.Sum(nil)),
+		size: size,
+		save: func(ctx context.Context, objectName string) error {
+			return store.CopyImage(ctx, srcKey, objectName)
+		},
+	}, nil
+}
+
+// createBlobImage adds the image with the content. Content that is already stored is only referenced,
+// otherwise it is written under a new blob key. Image.Deduplicated reports which of the two happened.
+// The usage of the author counts the full size in both cases
+func createBlobImage(ctx context.Context, imageRepo repository.ImageRepository, store storage.Storage, cfg *config.Config, image *models.Image, content *imageContent) error {
+	image.MimeType = content.info.MimeType
+	image.Width = content.info.Width
+	image.Height = content.info.Height
+	image.Size = content.size
+	image.BlobHash = &content.hash
+	image.ObjectKey = ""
+
+	err := imageRepo.Create(ctx, image, cfg.StorageQuotas)
+	if err == nil {
+		image.Deduplicated = true
+		return nil
+	}
+	if !strings.Contains(err.Error(), "блоб изображения не найден") {
+		return err
+	}
+
+	objectName := storage.NewBlobObjectName(content.hash, "image"+media.Extension(content.info.MimeType))
+	if err := content.save(ctx, objectName); err != nil {
+		return err
+	}
+
+	image.ObjectKey = objectName
+	if err := imageRepo.Create(ctx, image, cfg.StorageQuotas); err != nil {
+		store.DeleteImage(ctx, objectName)
+		return err
+	}
+
+	// the same content was stored by another upload meanwhile, the image took its object
+	if image.ObjectKey != objectName {
+		image.Deduplicated = true
+		if err := store.DeleteImage(ctx, objectName); err != nil {
+			fmt.Printf("Предупреждение: не удалось удалить из хранилища: %v\n", err)
+		}
+	}
+
+	return nil
+}
+
+// deleteReleasedObjects removes the objects that the database released, a failure leaves an orphan
+// for the reconciliation. It returns the last error
+func deleteReleasedObjects(ctx context.Context, store storage.Storage, objectNames []string) error {
+	var lastErr error
+	for _, objectName := range objectNames {
+		if err := store.DeleteImage(ctx, objectName); err != nil {
+			fmt.Printf("Предупреждение: не удалось удалить из хранилища: %v\n", err)
+			lastErr = err
+		}
+	}
+
+	return lastErr
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"microblogCPT/internal/models"
+	"microblogCPT/internal/repository"
+	"strings"
+)
+
+// UpdateImage changes the texts of the image and moves it to the new position in the post
+func (p *postService) UpdateImage(ctx context.Context, req repository.UpdateImageRequest) (*models.Image, error) {
+	image, err := p.imageRepo.GetByImageID(ctx, req.ImageID)
+	if err != nil {
+		return nil, err
+	}
+	if image.PostID != req.PostID {
+		return nil, errors.New("изображение не найдено")
+	}
+
+	if req.AltText != nil || req.Caption != nil {
+		image, err = p.imageRepo.UpdateDetails(ctx, req.ImageID, req.AltText, req.Caption)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if req.Position != nil {
+		images, err := p.imageRepo.GetByPostID(ctx, req.PostID)
+		if err != nil {
+			return nil, err
+		}
+
+		// the image is taken out of the list and put back at the position, the others shift
+		imageIDs := make([]string, 0, len(images))
+		for _, other := range images {
+			if other.ImageID != req.ImageID {
+				imageIDs = append(imageIDs, other.ImageID)
+			}
+		}
+		position := min(max(*req.Position, 0), len(imageIDs))
+		imageIDs = append(imageIDs[:position], append([]string{req.ImageID}, imageIDs[position:]...)...)
+
+		if err := p.imageRepo.Reorder(ctx, req.PostID, imageIDs); err != nil {
+			return nil, err
+		}
+		image.Position = position
+	}
+
+	image.ImageURL, err = p.storage.ImageURL(ctx, image.ObjectKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return image, nil
+}
+
+// ReorderImages puts the images of the post in the order of the list, which has to name every image once
+func (p *postService) ReorderImages(ctx context.Context, postID string, imageIDs []string) ([]*models.Image, error) {
+	images, err := p.imageRepo.GetByPostID(ctx, postID)
+	if err != nil {
+		return nil, err
+	}
+
+	listed := make(map[string]bool, len(imageIDs))
+	for _, imageID := range imageIDs {
+		listed[imageID] = true
+	}
+	if len(listed) != len(imageIDs) || len(imageIDs) != len(images) {
+		return nil, errors.New("список должен содержать каждое изображение поста один раз")
+	}
+
+	positions := make(map[string]int, len(imageIDs))
+	for i, imageID := range imageIDs {
+		positions[imageID] = i
+	}
+	ordered := make([]*models.Image, len(images))
+	for _, image := range images {
+		position, ok := positions[image.ImageID]
+		if !ok {
+			return nil, errors.New("список должен содержать каждое изображение поста один раз")
+		}
+		image.Position = position
+		ordered[position] = image
+	}
+
+	if err := p.imageRepo.Reorder(ctx, postID, imageIDs); err != nil {
+		return nil, err
+	}
+
+	for _, image := range ordered {
+		image.ImageURL, err = p.storage.ImageURL(ctx, image.ObjectKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ordered, nil
+}
+
+// checkAltText refuses to publish a post with an image without alt text when the deployment requires it
+func (p *postService) checkAltText(ctx context.Context, postID string) error {
+	if !p.cfg.ImageRequireAltText {
+		return nil
+	}
+
+	images, err := p.imageRepo.GetByPostID(ctx, postID)
+	if err != nil {
+		return err
+	}
+
+	for _, image := range images {
+		if strings.TrimSpace(image.AltText) == "" {
+			return errors.New("у изображений поста нет альтернативного текста")
+		}
+	}
+
+	return nil
+}
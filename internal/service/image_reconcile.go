@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"microblogCPT/internal/config"
+	"microblogCPT/internal/repository"
+	"microblogCPT/internal/storage"
+	"time"
+)
+
+// ReconcileReport lists what the reconciliation found and what it removed
+type ReconcileReport struct {
+	DryRun bool `json:"dryRun"`
+	// OrphanObjects are the keys of the stored objects no row refers to
+	OrphanObjects []string `json:"orphanObjects"`
+	// DanglingImages are the ids of the images whose object is missing
+	DanglingImages []string `json:"danglingImages"`
+	DeletedObjects int      `json:"deletedObjects"`
+	DeletedImages  int      `json:"deletedImages"`
+}
+
+type ReconcileService interface {
+	Reconcile(ctx context.Context, dryRun bool) (*ReconcileReport, error)
+}
+
+type reconcileService struct {
+	imageRepo repository.ImageRepository
+	storage   storage.Storage
+	cfg       *config.Config
+}
+
+func NewReconcileService(imageRepo repository.ImageRepository, storage storage.Storage, cfg *config.Config) ReconcileService {
+	return &reconcileService{
+		imageRepo: imageRepo,
+		storage:   storage,
+		cfg:       cfg,
+	}
+}
+
+// Reconcile compares the storage with the images table. Objects and rows newer than ReconcileMinAge
+// are skipped, an upload may have stored its object and not written its row yet. In the dry run
+// nothing is removed
+func (r *reconcileService) Reconcile(ctx context.Context, dryRun bool) (*ReconcileReport, error) {
+	before := time.Now().Add(-r.cfg.ReconcileMinAge)
+	report := &ReconcileReport{DryRun: dryRun, OrphanObjects: []string{}, DanglingImages: []string{}}
+
+	// the objects are listed first, so an object stored after the listing is never taken for an orphan
+	objects, err := r.storage.ListImages(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := r.imageRepo.ListObjectKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		known[key] = true
+	}
+
+	stored := make(map[string]bool, len(objects))
+	for _, object := range objects {
+		stored[object.Key] = true
+		if !known[object.Key] && object.LastModified.Before(before) {
+			report.OrphanObjects = append(report.OrphanObjects, object.Key)
+		}
+	}
+
+	images, err := r.imageRepo.GetCreatedBefore(ctx, before)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, image := range images {
+		if !stored[image.ObjectKey] {
+			report.DanglingImages = append(report.DanglingImages, image.ImageID)
+		}
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	for _, objectName := range report.OrphanObjects {
+		if err := r.storage.DeleteImage(ctx, objectName); err != nil {
+			fmt.Printf("Предупреждение: не удалось удалить из хранилища: %v\n", err)
+			continue
+		}
+		report.DeletedObjects++
+	}
+
+	for _, imageID := range report.DanglingImages {
+		released, err := r.imageRepo.Delete(ctx, imageID)
+		if err != nil {
+			fmt.Printf("Предупреждение: не удалось удалить изображение %s: %v\n", imageID, err)
+			continue
+		}
+		// the variants without their original are useless
+		deleteReleasedObjects(ctx, r.storage, released)
+		report.DeletedImages++
+	}
+
+	return report, nil
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"microblogCPT/internal/media"
+	"microblogCPT/internal/models"
+	"microblogCPT/internal/repository"
+	"microblogCPT/internal/storage"
+	"strings"
+	"time"
+)
+
+// CreateImageUpload registers an upload of the image straight to the storage
+// and returns it together with the presigned PUT url
+func (p *postService) CreateImageUpload(ctx context.Context, req repository.CreateImageUploadRequest) (*models.ImageUpload, string, error) {
+	if req.Size <= 0 || req.Size > p.cfg.MaxUploadSize {
+		return nil, "", fmt.Errorf("размер файла превышает %d MB", p.cfg.MaxUploadSize/(1024*1024))
+	}
+
+	if err := checkQuota(ctx, p.usageRepo, p.cfg, req.AuthorID, req.Size); err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	upload := &models.ImageUpload{
+		UploadID:    uuid.New().String(),
+		PostID:      req.PostID,
+		AuthorID:    req.AuthorID,
+		ObjectKey:   storage.NewObjectName(req.PostID, req.FileName),
+		FileName:    req.FileName,
+		ContentType: req.ContentType,
+		Size:        req.Size,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(p.cfg.UploadURLExpiry),
+	}
+
+	uploadURL, err := p.storage.PresignUpload(ctx, upload.ObjectKey, upload.ContentType, upload.Size, p.cfg.UploadURLExpiry)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := p.uploadRepo.Create(ctx, upload); err != nil {
+		return nil, "", err
+	}
+
+	return upload, uploadURL, nil
+}
+
+// CompleteImageUpload checks that the object was uploaded as declared and turns the upload into an image of the post
+func (p *postService) CompleteImageUpload(ctx context.Context, postID, uploadID string, details repository.ImageDetails) (*models.Image, *models.ImageUpload, error) {
+	upload, err := p.uploadRepo.GetByID(ctx, uploadID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if upload.PostID != postID {
+		return nil, nil, errors.New("загрузка не найдена")
+	}
+
+	if upload.ExpiresAt.Before(time.Now()) {
+		return nil, nil, errors.New("срок загрузки истек")
+	}
+
+	info, err := p.storage.StatImage(ctx, upload.ObjectKey)
+	if err != nil {
+		if strings.Contains(err.Error(), "не найден") {
+			return nil, nil, errors.New("файл не загружен")
+		}
+		return nil, nil, err
+	}
+
+	imageInfo, checkErr := p.checkUploadedImage(ctx, upload, info)
+
+	// the object is removed so that the client can start over with a new upload
+	if checkErr != nil {
+		if err := p.storage.DeleteImage(ctx, upload.ObjectKey); err != nil {
+			fmt.Printf("Предупреждение: не удалось удалить из MinIO: %v\n", err)
+		}
+		if err := p.uploadRepo.Delete(ctx, upload.UploadID); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, checkErr
+	}
+
+	// the content is stored without its metadata as a blob, the uploaded object is not needed after that
+	content, err := storedContent(ctx, p.storage, upload.ObjectKey, imageInfo, info.Size, p.cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	image := &models.Image{
+		ImageID:   uuid.New().String(),
+		PostID:    upload.PostID,
+		CreatedAt: time.Now(),
+		AltText:   details.AltText,
+		Caption:   details.Caption,
+	}
+
+	if err := createBlobImage(ctx, p.imageRepo, p.storage, p.cfg, image, content); err != nil {
+		if isQuotaExceeded(err) {
+			return nil, nil, err
+		}
+		return nil, nil, fmt.Errorf("ошибка сохранения изображения: %w", err)
+	}
+
+	if err := p.storage.DeleteImage(ctx, upload.ObjectKey); err != nil {
+		fmt.Printf("Предупреждение: не удалось удалить из хранилища: %v\n", err)
+	}
+
+	if err := p.uploadRepo.Delete(ctx, upload.UploadID); err != nil {
+		return nil, nil, err
+	}
+
+	image.ImageURL, err = p.storage.ImageURL(ctx, image.ObjectKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return image, upload, nil
+}
+
+// checkUploadedImage compares the object with the declared upload. The signed headers only bind
+// what the client declared, so the content itself is inspected as well
+func (p *postService) checkUploadedImage(ctx context.Context, upload *models.ImageUpload, info *storage.ObjectInfo) (*media.ImageInfo, error) {
+	if info.Size != upload.Size || info.ContentType != upload.ContentType {
+		return nil, errors.New("загруженный файл не совпадает с заявленным")
+	}
+
+	imageInfo, err := inspectStoredImage(ctx, p.storage, upload.ObjectKey, upload.FileName, p.cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if imageInfo.MimeType != upload.ContentType {
+		return nil, errors.New("загруженный файл не совпадает с заявленным")
+	}
+
+	return imageInfo, nil
+}
+
+// CleanupExpiredUploads removes the uploads that were never completed together with their objects
+// and returns the number of removed uploads
+func (p *postService) CleanupExpiredUploads(ctx context.Context) (int, error) {
+	uploads, err := p.uploadRepo.GetExpired(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, upload := range uploads {
+		// the client may have never uploaded the object, so a missing one is not an error
+		if _, err := p.storage.StatImage(ctx, upload.ObjectKey); err == nil {
+			if err := p.storage.DeleteImage(ctx, upload.ObjectKey); err != nil {
+				fmt.Printf("Предупреждение: не удалось удалить из MinIO: %v\n", err)
+				continue
+			}
+		} else if !strings.Contains(err.Error(), "не найден") {
+			fmt.Printf("Предупреждение: не удалось проверить объект в MinIO: %v\n", err)
+			continue
+		}
+
+		if err := p.uploadRepo.Delete(ctx, upload.UploadID); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"microblogCPT/internal/config"
+	"microblogCPT/internal/media"
+	"microblogCPT/internal/storage"
+	"path/filepath"
+)
+
+// imageLimits returns the dimensions of the largest accepted image
+func imageLimits(cfg *config.Config) media.Limits {
+	return media.Limits{
+		MaxWidth:  cfg.ImageMaxWidth,
+		MaxHeight: cfg.ImageMaxHeight,
+		MaxPixels: cfg.ImageMaxPixels,
+	}
+}
+
+// inspectStoredImage checks the content of an object that the client uploaded past the API
+func inspectStoredImage(ctx context.Context, store storage.Storage, objectName, fileName string, cfg *config.Config) (*media.ImageInfo, error) {
+	object, err := store.OpenImage(ctx, objectName)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	info, _, err := media.Inspect(object, fileName, imageLimits(cfg))
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// imageFileName gives a file without an extension the one of its detected type
+func imageFileName(fileName, mimeType string) string {
+	if filepath.Ext(fileName) == "" {
+		return fileName + media.Extension(mimeType)
+	}
+	return fileName
+}
+
+// metadataOptions returns the metadata policy of the deployment
+func metadataOptions(cfg *config.Config) media.MetadataOptions {
+	return media.MetadataOptions{
+		Strip:   cfg.ImageStripMetadata,
+		Keep:    cfg.ImageKeepMetadata,
+		Quality: cfg.VariantQuality,
+	}
+}
+
+// sanitizeImage reads the whole file and removes its metadata before it is stored
+func sanitizeImage(file io.Reader, info *media.ImageInfo, cfg *config.Config) ([]byte, *media.ImageInfo, error) {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка чтения файла: %w", err)
+	}
+
+	return media.Sanitize(data, info, metadataOptions(cfg))
+}
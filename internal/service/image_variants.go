@@ -0,0 +1,163 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"microblogCPT/internal/config"
+	"microblogCPT/internal/media"
+	"microblogCPT/internal/models"
+	"microblogCPT/internal/repository"
+	"microblogCPT/internal/storage"
+	"path"
+	"strings"
+	"time"
+)
+
+// variantBatchSize is the number of images claimed by one run of the generator
+const variantBatchSize = 10
+
+type VariantService interface {
+	GenerateVariants(ctx context.Context) (int, error)
+}
+
+type variantService struct {
+	imageRepo   repository.ImageRepository
+	variantRepo repository.ImageVariantRepository
+	storage     storage.Storage
+	cfg         *config.Config
+}
+
+func NewVariantService(imageRepo repository.ImageRepository, variantRepo repository.ImageVariantRepository, storage storage.Storage, cfg *config.Config) VariantService {
+	return &variantService{
+		imageRepo:   imageRepo,
+		variantRepo: variantRepo,
+		storage:     storage,
+		cfg:         cfg,
+	}
+}
+
+// GenerateVariants resizes a batch of new originals to the configured widths and returns the number
+// of processed originals. The original of deduplicated images is processed once, for its blob.
+// An original that fails for a transient reason goes back to the queue until it has used
+// VariantMaxAttempts, then it is marked as failed
+func (v *variantService) GenerateVariants(ctx context.Context) (int, error) {
+	sources, err := v.imageRepo.ClaimPendingVariants(ctx, variantBatchSize, time.Now().Add(-v.cfg.VariantClaimTimeout))
+	if err != nil {
+		return 0, err
+	}
+
+	processed := 0
+	for i := range sources {
+		status := "failed"
+		// an original claimed again after the last attempt has stopped the worker every time
+		if sources[i].VariantsAttempts <= v.cfg.VariantMaxAttempts {
+			status, err = v.generate(ctx, &sources[i])
+			if err != nil {
+				log.Printf("Ошибка создания вариантов изображения %s: %v", sources[i].ObjectKey, err)
+				status = "pending"
+				if sources[i].VariantsAttempts >= v.cfg.VariantMaxAttempts {
+					status = "failed"
+				}
+			}
+		}
+
+		if err := v.imageRepo.SetVariantsStatus(ctx, sources[i], status); err != nil {
+			v.releaseClaims(ctx, sources[i:])
+			return processed, err
+		}
+		if status != "pending" {
+			processed++
+		}
+	}
+
+	return processed, nil
+}
+
+// releaseClaims returns the originals left in the batch to the queue at once instead of after the claim timeout.
+// It also runs when the generator is stopped, so the context is not cancelled with it
+func (v *variantService) releaseClaims(ctx context.Context, sources []models.VariantSource) {
+	if err := v.imageRepo.ReleaseVariantClaims(context.WithoutCancel(ctx), sources); err != nil {
+		log.Printf("Ошибка возврата изображений в очередь вариантов: %v", err)
+	}
+}
+
+// generate creates the variants of the original and returns its new status
+func (v *variantService) generate(ctx context.Context, source *models.VariantSource) (string, error) {
+	// the original may have been removed from the bucket by hand
+	if _, err := v.storage.StatImage(ctx, source.ObjectKey); err != nil {
+		if strings.Contains(err.Error(), "не найден") {
+			return "skipped", nil
+		}
+		return "", err
+	}
+
+	object, err := v.storage.OpenImage(ctx, source.ObjectKey)
+	if err != nil {
+		return "", err
+	}
+	defer object.Close()
+
+	// images stored before the validation are checked here, so a bomb is never decoded
+	info, file, err := media.Inspect(object, source.ObjectKey, imageLimits(v.cfg))
+	if err != nil {
+		if strings.Contains(err.Error(), "ошибка чтения файла") {
+			return "", err
+		}
+		return "skipped", nil
+	}
+
+	// WebP originals can not be decoded in pure Go, they are served as is
+	if info.MimeType == "image/webp" {
+		return "skipped", nil
+	}
+
+	src, err := media.Decode(file)
+	if err != nil {
+		return "skipped", nil
+	}
+
+	for _, width := range v.cfg.VariantWidths {
+		// an image is never scaled up
+		if width >= info.Width {
+			continue
+		}
+
+		resized := media.Resize(src, width)
+		data, err := media.EncodeJPEG(resized, v.cfg.VariantQuality)
+		if err != nil {
+			return "", err
+		}
+
+		// the variants of a blob belong to the blob, not to one of its images
+		variant := &models.ImageVariant{
+			BlobHash:  source.BlobHash,
+			ObjectKey: variantObjectName(source.ObjectKey, width, ".jpg"),
+			MimeType:  "image/jpeg",
+			Width:     width,
+			Height:    resized.Bounds().Dy(),
+			Size:      int64(len(data)),
+			CreatedAt: time.Now(),
+		}
+		if source.ImageID != nil {
+			variant.ImageID = *source.ImageID
+		}
+
+		if err := v.storage.SaveImage(ctx, variant.ObjectKey, variant.MimeType, bytes.NewReader(data), variant.Size); err != nil {
+			return "", err
+		}
+
+		if err := v.variantRepo.Create(ctx, variant); err != nil {
+			v.storage.DeleteImage(ctx, variant.ObjectKey)
+			return "", err
+		}
+	}
+
+	return "ready", nil
+}
+
+// variantObjectName keeps the variant next to the original: posts/{postID}/{yyyy}/{mm}/{uuid}_w{width}{ext}
+func variantObjectName(objectKey string, width int, ext string) string {
+	return fmt.Sprintf("%s_w%d%s", strings.TrimSuffix(objectKey, path.Ext(objectKey)), width, ext)
+}
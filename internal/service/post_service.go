@@ -2,10 +2,15 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"io"
 	"microblogCPT/internal/config"
+	"microblogCPT/internal/media"
 	"microblogCPT/internal/models"
 	"microblogCPT/internal/repository"
 	"microblogCPT/internal/storage"
@@ -13,31 +18,54 @@ import (
 )
 
 type PostService interface {
-	CreatePost(ctx context.Context, req repository.CreatePostRequest) (*models.Post, error)
-	UpdatePost(ctx context.Context, req repository.UpdatePostRequest) error
+	CreatePost(ctx context.Context, req repository.CreatePostRequest, response repository.PostCreatedResponse) (*models.Post, *models.IdempotencyKey, error)
+	UpdatePost(ctx context.Context, req repository.UpdatePostRequest) (*models.Post, error)
 	DeletePost(ctx context.Context, postID string) error
+	GetTrash(ctx context.Context, authorID string) ([]models.Post, error)
+	RestorePost(ctx context.Context, postID, authorID string) error
+	PurgeTrash(ctx context.Context) (int, error)
 	PublishPost(ctx context.Context, postID string) error
-	AddedImage(ctx context.Context, postID, fileName string, file io.Reader, size int64) (*models.Image, error)
-	DeleteImage(ctx context.Context, imageID string) error
+	AddedImage(ctx context.Context, postID, fileName string, file io.Reader, details repository.ImageDetails) (*models.Image, error)
+	UpdateImage(ctx context.Context, req repository.UpdateImageRequest) (*models.Image, error)
+	ReorderImages(ctx context.Context, postID string, imageIDs []string) ([]*models.Image, error)
+	DeleteImage(ctx context.Context, postID, imageID string) error
+	AttachImages(ctx context.Context, posts []models.Post) error
+	CreateImageUpload(ctx context.Context, req repository.CreateImageUploadRequest) (*models.ImageUpload, string, error)
+	CompleteImageUpload(ctx context.Context, postID, uploadID string, details repository.ImageDetails) (*models.Image, *models.ImageUpload, error)
+	CleanupExpiredUploads(ctx context.Context) (int, error)
+	GetRevisions(ctx context.Context, postID string) ([]models.PostRevision, error)
+	GetRevision(ctx context.Context, postID string, revision int) (*models.PostRevision, error)
+	DiffRevisions(ctx context.Context, postID string, fromRevision, toRevision int) (string, error)
+	RestoreRevision(ctx context.Context, postID string, revision int) (*models.Post, error)
 }
 
 type postService struct {
-	postRepo  repository.PostRepository
-	imageRepo repository.ImageRepository
-	storage   storage.Storage
-	cfg       *config.Config
+	postRepo     repository.PostRepository
+	imageRepo    repository.ImageRepository
+	variantRepo  repository.ImageVariantRepository
+	uploadRepo   repository.ImageUploadRepository
+	revisionRepo repository.PostRevisionRepository
+	usageRepo    repository.StorageUsageRepository
+	storage      storage.Storage
+	cfg          *config.Config
 }
 
-func NewPostService(postRepo repository.PostRepository, imageRepo repository.ImageRepository, storage storage.Storage, cfg *config.Config) PostService {
+func NewPostService(postRepo repository.PostRepository, imageRepo repository.ImageRepository, variantRepo repository.ImageVariantRepository, uploadRepo repository.ImageUploadRepository, revisionRepo repository.PostRevisionRepository, usageRepo repository.StorageUsageRepository, storage storage.Storage, cfg *config.Config) PostService {
 	return &postService{
-		postRepo:  postRepo,
-		imageRepo: imageRepo,
-		storage:   storage,
-		cfg:       cfg,
+		postRepo:     postRepo,
+		imageRepo:    imageRepo,
+		variantRepo:  variantRepo,
+		uploadRepo:   uploadRepo,
+		revisionRepo: revisionRepo,
+		usageRepo:    usageRepo,
+		storage:      storage,
+		cfg:          cfg,
 	}
 }
 
-func (p *postService) CreatePost(ctx context.Context, req repository.CreatePostRequest) (*models.Post, error) {
+// CreatePost creates a post. The response to a request with an idempotency key is stored with the key,
+// a retry with the same key creates nothing and gets the stored key to replay the original response
+func (p *postService) CreatePost(ctx context.Context, req repository.CreatePostRequest, response repository.PostCreatedResponse) (*models.Post, *models.IdempotencyKey, error) {
 	post := &models.Post{
 		AuthorID:       req.AuthorID,
 		IdempotencyKey: req.IdempotencyKey,
@@ -46,29 +74,63 @@ func (p *postService) CreatePost(ctx context.Context, req repository.CreatePostR
 		Status:         "Draft",
 	}
 
-	err := p.postRepo.Create(ctx, post, []string{})
+	if req.IdempotencyKey == nil || *req.IdempotencyKey == "" {
+		post.IdempotencyKey = nil
+
+		err := p.postRepo.Create(ctx, post, []string{})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return post, nil, nil
+	}
+
+	requestHash := hashCreatePostRequest(req)
+
+	existingKey, err := p.postRepo.CreateIdempotent(ctx, post, requestHash, response, p.cfg.IdempotencyKeyTTL)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return post, nil
+	if existingKey == nil {
+		return post, nil, nil
+	}
+
+	// the same key with another payload is a client error, not a retry
+	if existingKey.RequestHash != requestHash {
+		return nil, nil, errors.New("ключ идемпотентности уже использован с другим запросом")
+	}
+
+	return nil, existingKey, nil
+}
+
+// hashCreatePostRequest identifies the payload of the request to detect reuse of a key with other data
+func hashCreatePostRequest(req repository.CreatePostRequest) string {
+	payload, _ := json.Marshal(struct {
+		Title   string `json:"title"`
+		Content string `json:"content"`
+	}{req.Title, req.Content})
+
+	hash := sha256.Sum256(payload)
+	return hex.EncodeToString(hash[:])
 }
 
-func (p *postService) UpdatePost(ctx context.Context, req repository.UpdatePostRequest) error {
+func (p *postService) UpdatePost(ctx context.Context, req repository.UpdatePostRequest) (*models.Post, error) {
 	post, err := p.postRepo.GetByID(ctx, req.PostID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	post.Title = req.Title
 	post.Content = req.Content
+	post.Version = req.Version
 
 	err = p.postRepo.Update(ctx, post)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return post, nil
 }
 
 func (p *postService) DeletePost(ctx context.Context, postID string) error {
@@ -80,7 +142,41 @@ func (p *postService) DeletePost(ctx context.Context, postID string) error {
 	return nil
 }
 
+func (p *postService) GetTrash(ctx context.Context, authorID string) ([]models.Post, error) {
+	return p.postRepo.GetDeletedByUserID(ctx, authorID)
+}
+
+func (p *postService) RestorePost(ctx context.Context, postID, authorID string) error {
+	return p.postRepo.Restore(ctx, postID, authorID)
+}
+
+// PurgeTrash deletes the posts that have been in the trash longer than the retention period
+// together with the objects only they referred to and returns the number of purged posts
+func (p *postService) PurgeTrash(ctx context.Context) (int, error) {
+	posts, err := p.postRepo.GetDeletedBefore(ctx, time.Now().Add(-p.cfg.TrashRetention))
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, post := range posts {
+		// the rows go first, the objects left by a failed removal are orphans for the reconciliation
+		released, err := p.postRepo.Purge(ctx, post.PostID)
+		if err != nil {
+			return purged, err
+		}
+		deleteReleasedObjects(ctx, p.storage, released)
+		purged++
+	}
+
+	return purged, nil
+}
+
 func (p *postService) PublishPost(ctx context.Context, postID string) error {
+	if err := p.checkAltText(ctx, postID); err != nil {
+		return err
+	}
+
 	err := p.postRepo.Publish(ctx, postID)
 	if err != nil {
 		return err
@@ -88,46 +184,176 @@ func (p *postService) PublishPost(ctx context.Context, postID string) error {
 	return nil
 }
 
-func (p *postService) AddedImage(ctx context.Context, postID, fileName string, file io.Reader, size int64) (*models.Image, error) {
-	// uploading an image to MinIO
-	objectName, imageURL, err := p.storage.UploadImage(ctx, postID, fileName, file, size)
+func (p *postService) AddedImage(ctx context.Context, postID, fileName string, file io.Reader, details repository.ImageDetails) (*models.Image, error) {
+	// the type is detected from the content, the name and the header of the request are not trusted
+	info, file, err := media.Inspect(file, fileName, imageLimits(p.cfg))
+	if err != nil {
+		return nil, err
+	}
+	fileName = imageFileName(fileName, info.MimeType)
+
+	// GPS coordinates and camera details must not reach the bucket
+	data, info, err := sanitizeImage(file, info, p.cfg)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка загрузки изображения в MinIO: %w", err)
+		return nil, err
 	}
+	size := int64(len(data))
 
-	// create image in db
+	// the quota of the author is checked before the upload and again when the image is added
+	post, err := p.postRepo.GetByID(ctx, postID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkQuota(ctx, p.usageRepo, p.cfg, post.AuthorID, size); err != nil {
+		return nil, err
+	}
+
+	// the same content is stored once, the image refers to the blob of an earlier upload if there is one
 	image := &models.Image{
 		ImageID:   uuid.New().String(),
 		PostID:    postID,
-		ImageURL:  imageURL,
 		CreatedAt: time.Now(),
+		AltText:   details.AltText,
+		Caption:   details.Caption,
 	}
 
-	err = p.imageRepo.Create(ctx, image)
+	err = createBlobImage(ctx, p.imageRepo, p.storage, p.cfg, image, bytesContent(p.storage, data, info))
 	if err != nil {
-		p.storage.DeleteImage(ctx, objectName)
-		return nil, fmt.Errorf("ошибка сохранения изображения в БД: %w", err)
+		if isQuotaExceeded(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("ошибка сохранения изображения: %w", err)
+	}
+
+	image.ImageURL, err = p.storage.ImageURL(ctx, image.ObjectKey)
+	if err != nil {
+		return nil, err
 	}
 
 	return image, nil
 }
 
-func (p *postService) DeleteImage(ctx context.Context, imageID string) error {
-	// get image by id
-	_, err := p.imageRepo.GetByImageID(ctx, imageID)
+// DeleteImage removes the image of the post. The row goes first: an object left by a failed removal
+// is only an orphan for the reconciliation, while a row without its object is a broken image.
+// The object and the variants of a shared blob stay until its last image is removed
+func (p *postService) DeleteImage(ctx context.Context, postID, imageID string) error {
+	image, err := p.imageRepo.GetByImageID(ctx, imageID)
 	if err != nil {
+		return err
+	}
+	if image.PostID != postID {
 		return fmt.Errorf("изображение не найдено")
 	}
 
-	// delete image in MinIO
-	if err := p.storage.DeleteImage(ctx, imageID); err != nil {
-		fmt.Printf("Предупреждение: не удалось удалить из MinIO: %v\n", err)
+	released, err := p.imageRepo.Delete(ctx, imageID)
+	if err != nil {
+		return fmt.Errorf("ошибка удаления из БД: %w", err)
 	}
 
-	// delete image in db
-	if err := p.imageRepo.Delete(ctx, imageID); err != nil {
-		return fmt.Errorf("ошибка удаления из БД: %w", err)
+	deleteReleasedObjects(ctx, p.storage, released)
+	return nil
+}
+
+// AttachImages fills the images of the posts with one query for the whole list
+func (p *postService) AttachImages(ctx context.Context, posts []models.Post) error {
+	postIDs := make([]string, 0, len(posts))
+	for _, post := range posts {
+		postIDs = append(postIDs, post.PostID)
+	}
+
+	imagesByPost, err := p.imageRepo.GetByPostIDs(ctx, postIDs)
+	if err != nil {
+		return err
+	}
+
+	imageIDs := []string{}
+	for _, images := range imagesByPost {
+		for _, image := range images {
+			imageIDs = append(imageIDs, image.ImageID)
+		}
+	}
+
+	variantsByImage, err := p.variantRepo.GetByImageIDs(ctx, imageIDs)
+	if err != nil {
+		return err
+	}
+
+	for i := range posts {
+		images := imagesByPost[posts[i].PostID]
+
+		// urls are issued on every response, so presigned ones never outlive their expiry in the database
+		for j := range images {
+			images[j].ImageURL, err = p.storage.ImageURL(ctx, images[j].ObjectKey)
+			if err != nil {
+				return err
+			}
+
+			variants := variantsByImage[images[j].ImageID]
+			for k := range variants {
+				variants[k].URL, err = p.storage.ImageURL(ctx, variants[k].ObjectKey)
+				if err != nil {
+					return err
+				}
+			}
+			images[j].Variants = variants
+		}
+
+		posts[i].Images = images
 	}
 
 	return nil
 }
+
+func (p *postService) GetRevisions(ctx context.Context, postID string) ([]models.PostRevision, error) {
+	return p.revisionRepo.GetByPostID(ctx, postID)
+}
+
+func (p *postService) GetRevision(ctx context.Context, postID string, revision int) (*models.PostRevision, error) {
+	return p.revisionRepo.GetByRevision(ctx, postID, revision)
+}
+
+func (p *postService) DiffRevisions(ctx context.Context, postID string, fromRevision, toRevision int) (string, error) {
+	from, err := p.revisionRepo.GetByRevision(ctx, postID, fromRevision)
+	if err != nil {
+		return "", err
+	}
+
+	to, err := p.revisionRepo.GetByRevision(ctx, postID, toRevision)
+	if err != nil {
+		return "", err
+	}
+
+	// the title is compared as the first line of the revision
+	fromText := from.Title + "\n\n" + from.Content
+	toText := to.Title + "\n\n" + to.Content
+
+	return unifiedDiff(
+		fmt.Sprintf("revision %d", from.Revision),
+		fmt.Sprintf("revision %d", to.Revision),
+		fromText,
+		toText,
+	), nil
+}
+
+func (p *postService) RestoreRevision(ctx context.Context, postID string, revision int) (*models.Post, error) {
+	postRevision, err := p.revisionRepo.GetByRevision(ctx, postID, revision)
+	if err != nil {
+		return nil, err
+	}
+
+	post, err := p.postRepo.GetByID(ctx, postID)
+	if err != nil {
+		return nil, err
+	}
+
+	// restoring is an ordinary update, so it gets its own revision
+	post.Title = postRevision.Title
+	post.Content = postRevision.Content
+
+	err = p.postRepo.Update(ctx, post)
+	if err != nil {
+		return nil, err
+	}
+
+	return post, nil
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+)
+
+// number of unchanged lines shown around every change
+const diffContextLines = 3
+
+type diffLine struct {
+	kind byte // ' ', '-' or '+'
+	text string
+	aPos int // index of the line in the old text
+	bPos int // index of the line in the new text
+}
+
+// unifiedDiff returns a line-level diff of two texts in the unified format,
+// an empty string means that the texts are equal
+func unifiedDiff(fromName, toName, from, to string) string {
+	lines := diffLines(strings.Split(from, "\n"), strings.Split(to, "\n"))
+
+	var changes []int
+	for i, line := range lines {
+		if line.kind != ' ' {
+			changes = append(changes, i)
+		}
+	}
+
+	if len(changes) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+
+	// changes that are close to each other are merged into one hunk
+	for i := 0; i < len(changes); {
+		start := max(changes[i]-diffContextLines, 0)
+		end := changes[i] + 1
+		for i < len(changes) && changes[i] <= end+2*diffContextLines {
+			end = changes[i] + 1
+			i++
+		}
+		end = min(end+diffContextLines, len(lines))
+
+		writeHunk(&sb, lines[start:end])
+	}
+
+	return sb.String()
+}
+
+func writeHunk(sb *strings.Builder, hunk []diffLine) {
+	aCount, bCount := 0, 0
+	for _, line := range hunk {
+		if line.kind != '+' {
+			aCount++
+		}
+		if line.kind != '-' {
+			bCount++
+		}
+	}
+
+	// an empty range points at the line before it, as in GNU diff
+	aStart, bStart := hunk[0].aPos+1, hunk[0].bPos+1
+	if aCount == 0 {
+		aStart--
+	}
+	if bCount == 0 {
+		bStart--
+	}
+
+	fmt.Fprintf(sb, "@@ -%d,%d +%d,%d @@\n", aStart, aCount, bStart, bCount)
+	for _, line := range hunk {
+		sb.WriteByte(line.kind)
+		sb.WriteString(line.text)
+		sb.WriteByte('\n')
+	}
+}
+
+// diffLines builds the edit script of two line slices from their longest common subsequence
+func diffLines(a, b []string) []diffLine {
+	// the common prefix and suffix do not take part in the quadratic search
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	midA := a[prefix : len(a)-suffix]
+	midB := b[prefix : len(b)-suffix]
+
+	// lcs[i][j] is the length of the common subsequence of midA[i:] and midB[j:]
+	lcs := make([][]int, len(midA)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(midB)+1)
+	}
+	for i := len(midA) - 1; i >= 0; i-- {
+		for j := len(midB) - 1; j >= 0; j-- {
+			if midA[i] == midB[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	lines := make([]diffLine, 0, len(a)+len(b))
+	for i := 0; i < prefix; i++ {
+		lines = append(lines, diffLine{kind: ' ', text: a[i], aPos: i, bPos: i})
+	}
+
+	i, j := 0, 0
+	for i < len(midA) || j < len(midB) {
+		aPos, bPos := prefix+i, prefix+j
+		switch {
+		case i < len(midA) && j < len(midB) && midA[i] == midB[j]:
+			lines = append(lines, diffLine{kind: ' ', text: midA[i], aPos: aPos, bPos: bPos})
+			i++
+			j++
+		case j == len(midB) || (i < len(midA) && lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{kind: '-', text: midA[i], aPos: aPos, bPos: bPos})
+			i++
+		default:
+			lines = append(lines, diffLine{kind: '+', text: midB[j], aPos: aPos, bPos: bPos})
+			j++
+		}
+	}
+
+	for k := 0; k < suffix; k++ {
+		aPos, bPos := len(a)-suffix+k, len(b)-suffix+k
+		lines = append(lines, diffLine{kind: ' ', text: a[aPos], aPos: aPos, bPos: bPos})
+	}
+
+	return lines
+}
@@ -8,18 +8,32 @@ import (
 )
 
 type Service struct {
-	User   UserService
-	Post   PostService
-	Auth   AuthService
-	Tables TablesService
+	User      UserService
+	Post      PostService
+	Upload    UploadService
+	Variant   VariantService
+	Reconcile ReconcileService
+	Usage     UsageService
+	Auth      AuthService
+	Follow    FollowService
+	Timeline  TimelineService
+	Comment   CommentService
+	Tables    TablesService
 }
 
 func NewService(rep *repository.Repository, cfg *config.Config, storage storage.Storage) *Service {
 	return &Service{
-		User:   NewUserService(rep.User, cfg),
-		Post:   NewPostService(rep.Post, rep.Image, storage, cfg),
-		Auth:   NewAuthService(rep.User, cfg),
-		Tables: NewTablesService(rep.Tables),
+		User:      NewUserService(rep.User, rep.UserImage, rep.Post, rep.Follow, storage, cfg),
+		Post:      NewPostService(rep.Post, rep.Image, rep.Variant, rep.Upload, rep.Revision, rep.Usage, storage, cfg),
+		Upload:    NewUploadService(rep.Tus, rep.Image, rep.Usage, storage, cfg),
+		Variant:   NewVariantService(rep.Image, rep.Variant, storage, cfg),
+		Reconcile: NewReconcileService(rep.Image, storage, cfg),
+		Usage:     NewUsageService(rep.Usage, rep.Image, storage, cfg),
+		Auth:      NewAuthService(rep.User, cfg),
+		Follow:    NewFollowService(rep.Follow, rep.User, rep.UserImage, storage),
+		Timeline:  NewTimelineService(rep.Post),
+		Comment:   NewCommentService(rep.Comment, rep.Post, rep.User, rep.UserImage, storage),
+		Tables:    NewTablesService(rep.Tables),
 	}
 }
 
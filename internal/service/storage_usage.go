@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"microblogCPT/internal/config"
+	"microblogCPT/internal/models"
+	"microblogCPT/internal/repository"
+	"microblogCPT/internal/storage"
+	"strings"
+	"time"
+)
+
+// UsageReport is the usage of the user with its quota and the usage of every post
+type UsageReport struct {
+	Usage *models.StorageUsage
+	// Quota is nil when the role of the user is not limited
+	Quota *models.StorageQuota
+	Posts []models.PostStorageUsage
+}
+
+type UsageService interface {
+	GetUsage(ctx context.Context, userID string) (*UsageReport, error)
+	Recompute(ctx context.Context) (int, error)
+}
+
+type usageService struct {
+	usageRepo repository.StorageUsageRepository
+	imageRepo repository.ImageRepository
+	storage   storage.Storage
+	cfg       *config.Config
+}
+
+func NewUsageService(usageRepo repository.StorageUsageRepository, imageRepo repository.ImageRepository, storage storage.Storage, cfg *config.Config) UsageService {
+	return &usageService{
+		usageRepo: usageRepo,
+		imageRepo: imageRepo,
+		storage:   storage,
+		cfg:       cfg,
+	}
+}
+
+func (u *usageService) GetUsage(ctx context.Context, userID string) (*UsageReport, error) {
+	usage, err := u.usageRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	posts, err := u.usageRepo.GetPostsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &UsageReport{Usage: usage, Posts: posts}
+	if quota, ok := u.cfg.StorageQuotas[usage.Role]; ok {
+		report.Quota = &quota
+	}
+
+	return report, nil
+}
+
+// Recompute takes the sizes of the images from the storage and rebuilds the usage counters from them.
+// It returns the number of images whose size was corrected, the images without an object keep their size
+func (u *usageService) Recompute(ctx context.Context) (int, error) {
+	objects, err := u.storage.ListImages(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	sizes := make(map[string]int64, len(objects))
+	for _, object := range objects {
+		sizes[object.Key] = object.Size
+	}
+
+	images, err := u.imageRepo.GetCreatedBefore(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	corrected := 0
+	for _, image := range images {
+		size, ok := sizes[image.ObjectKey]
+		if !ok || size == image.Size {
+			continue
+		}
+		if err := u.imageRepo.SetSize(ctx, image.ImageID, size); err != nil {
+			return corrected, err
+		}
+		corrected++
+	}
+
+	if err := u.usageRepo.Recompute(ctx); err != nil {
+		return corrected, err
+	}
+
+	return corrected, nil
+}
+
+// checkQuota refuses an upload that would not fit into the quota of the user before anything is stored.
+// The image repository checks the quota again when the image is added
+func checkQuota(ctx context.Context, usageRepo repository.StorageUsageRepository, cfg *config.Config, userID string, size int64) error {
+	usage, err := usageRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	quota, ok := cfg.StorageQuotas[usage.Role]
+	if !ok {
+		return nil
+	}
+
+	usage.Bytes += size
+	usage.Objects++
+	if repository.QuotaExceeded(usage, quota) {
+		return repository.QuotaError(quota)
+	}
+
+	return nil
+}
+
+// isQuotaExceeded reports whether the image was refused by the quota, the error is shown to the client as is
+func isQuotaExceeded(err error) bool {
+	return strings.Contains(err.Error(), "превышена квота")
+}
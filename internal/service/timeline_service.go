@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"microblogCPT/internal/models"
+	"microblogCPT/internal/repository"
+)
+
+// TimelineService builds the home timeline of a user. The timeline is read from the posts of the followed
+// authors on every request (fan-out on read); an implementation that writes the posts into materialised
+// timelines on publish (fan-out on write) can replace it behind the same interface
+type TimelineService interface {
+	// HomeTimeline returns a page of the published posts of the followed authors, newest first,
+	// and the cursor of the next page, empty on the last one
+	HomeTimeline(ctx context.Context, userID, cursor string, limit int) ([]models.Post, string, error)
+}
+
+type readTimelineService struct {
+	postRepo repository.PostRepository
+}
+
+func NewTimelineService(postRepo repository.PostRepository) TimelineService {
+	return &readTimelineService{postRepo: postRepo}
+}
+
+func (t *readTimelineService) HomeTimeline(ctx context.Context, userID, cursor string, limit int) ([]models.Post, string, error) {
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// one extra post tells whether there is a next page
+	posts, err := t.postRepo.GetByFollowedAuthors(ctx, userID, after, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if len(posts) > limit {
+		posts = posts[:limit]
+		last := posts[limit-1]
+		next = encodeCursor(*last.PublishedAt, last.PostID)
+	}
+
+	return posts, next, nil
+}
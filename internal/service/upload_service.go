@@ -0,0 +1,276 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"microblogCPT/internal/config"
+	"microblogCPT/internal/models"
+	"microblogCPT/internal/repository"
+	"microblogCPT/internal/storage"
+	"sync"
+	"time"
+)
+
+// tusPartSize is the size of the parts of the multipart upload, the smallest one allowed by S3
+const tusPartSize = 5 * 1024 * 1024
+
+type UploadService interface {
+	CreateUpload(ctx context.Context, req repository.CreateTusUploadRequest) (*models.TusUpload, error)
+	GetUpload(ctx context.Context, uploadID, authorID string) (*models.TusUpload, error)
+	WriteChunk(ctx context.Context, uploadID, authorID string, offset int64, chunk io.Reader) (*models.TusUpload, error)
+	TerminateUpload(ctx context.Context, uploadID, authorID string) error
+	AttachUpload(ctx context.Context, uploadID, authorID, postID string, details repository.ImageDetails) (*models.Image, *models.TusUpload, error)
+	CleanupExpiredUploads(ctx context.Context) (int, error)
+}
+
+type uploadService struct {
+	tusRepo   repository.TusUploadRepository
+	imageRepo repository.ImageRepository
+	usageRepo repository.StorageUsageRepository
+	storage   storage.Storage
+	cfg       *config.Config
+	// locks keeps one chunk at a time per upload inside this instance
+	locks sync.Map
+}
+
+func NewUploadService(tusRepo repository.TusUploadRepository, imageRepo repository.ImageRepository, usageRepo repository.StorageUsageRepository, storage storage.Storage, cfg *config.Config) UploadService {
+	return &uploadService{
+		tusRepo:   tusRepo,
+		imageRepo: imageRepo,
+		usageRepo: usageRepo,
+		storage:   storage,
+		cfg:       cfg,
+	}
+}
+
+func (u *uploadService) CreateUpload(ctx context.Context, req repository.CreateTusUploadRequest) (*models.TusUpload, error) {
+	if req.Length <= 0 || req.Length > u.cfg.TusMaxSize {
+		return nil, fmt.Errorf("размер файла превышает %d MB", u.cfg.TusMaxSize/(1024*1024))
+	}
+
+	if err := checkQuota(ctx, u.usageRepo, u.cfg, req.AuthorID, req.Length); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	upload := &models.TusUpload{
+		UploadID:    uuid.New().String(),
+		AuthorID:    req.AuthorID,
+		FileName:    req.FileName,
+		ContentType: req.ContentType,
+		Length:      req.Length,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(u.cfg.TusUploadExpiry),
+	}
+	// the object gets its place in the post only when the upload is attached
+	upload.ObjectKey = "uploads/" + upload.UploadID
+
+	storageUploadID, err := u.storage.NewMultipartUpload(ctx, upload.ObjectKey, upload.ContentType)
+	if err != nil {
+		return nil, err
+	}
+	upload.StorageUploadID = storageUploadID
+
+	if err := u.tusRepo.Create(ctx, upload); err != nil {
+		u.storage.AbortMultipartUpload(ctx, upload.ObjectKey, storageUploadID)
+		return nil, err
+	}
+
+	return upload, nil
+}
+
+// GetUpload returns the upload of the author, uploads of other users are reported as missing
+func (u *uploadService) GetUpload(ctx context.Context, uploadID, authorID string) (*models.TusUpload, error) {
+	upload, err := u.tusRepo.GetByID(ctx, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	if upload.AuthorID != authorID {
+		return nil, errors.New("загрузка не найдена")
+	}
+
+	return upload, nil
+}
+
+// WriteChunk appends the chunk at the offset. Full parts go to the storage right away and the tail is kept
+// in the database, so the bytes received before a broken connection are not lost
+func (u *uploadService) WriteChunk(ctx context.Context, uploadID, authorID string, offset int64, chunk io.Reader) (*models.TusUpload, error) {
+	lock, _ := u.locks.LoadOrStore(uploadID, &sync.Mutex{})
+	if !lock.(*sync.Mutex).TryLock() {
+		return nil, errors.New("загрузка уже выполняется")
+	}
+	defer lock.(*sync.Mutex).Unlock()
+
+	upload, err := u.GetUpload(ctx, uploadID, authorID)
+	if err != nil {
+		return nil, err
+	}
+
+	if offset != upload.Offset {
+		return upload, fmt.Errorf("неверное смещение загрузки: ожидается %d", upload.Offset)
+	}
+
+	if upload.Completed {
+		return upload, nil
+	}
+
+	// the received data is saved even if the client has gone away
+	storeCtx := context.WithoutCancel(ctx)
+
+	body := io.LimitReader(chunk, upload.Length-upload.Offset)
+	buffer := bytes.NewBuffer(upload.Pending)
+	etags := upload.PartETags
+	received := int64(0)
+
+	var writeErr error
+	for {
+		n, err := io.CopyN(buffer, body, int64(tusPartSize-buffer.Len()))
+		received += n
+		finished := upload.Offset+received == upload.Length
+
+		if buffer.Len() == tusPartSize || (finished && buffer.Len() > 0) {
+			etag, partErr := u.storage.UploadPart(storeCtx, upload.ObjectKey, upload.StorageUploadID,
+				len(etags)+1, bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+			if partErr != nil {
+				writeErr = partErr
+				break
+			}
+			etags = append(etags, etag)
+			buffer.Reset()
+		}
+
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				writeErr = err
+			}
+			break
+		}
+		if finished {
+			break
+		}
+	}
+
+	previousOffset := upload.Offset
+	upload.Offset += received
+	upload.PartETags = etags
+	upload.Pending = buffer.Bytes()
+
+	if writeErr == nil && upload.Offset == upload.Length && len(upload.Pending) == 0 {
+		writeErr = u.storage.CompleteMultipartUpload(storeCtx, upload.ObjectKey, upload.StorageUploadID, etags)
+		upload.Completed = writeErr == nil
+	}
+
+	if err := u.tusRepo.UpdateProgress(storeCtx, upload, previousOffset); err != nil {
+		return nil, err
+	}
+
+	if writeErr != nil {
+		return upload, fmt.Errorf("ошибка записи загрузки: %w", writeErr)
+	}
+
+	return upload, nil
+}
+
+// TerminateUpload cancels the upload and frees everything it has stored
+func (u *uploadService) TerminateUpload(ctx context.Context, uploadID, authorID string) error {
+	upload, err := u.GetUpload(ctx, uploadID, authorID)
+	if err != nil {
+		return err
+	}
+
+	return u.removeUpload(ctx, upload)
+}
+
+// AttachUpload moves the finished upload into the post and adds it to the post images
+func (u *uploadService) AttachUpload(ctx context.Context, uploadID, authorID, postID string, details repository.ImageDetails) (*models.Image, *models.TusUpload, error) {
+	upload, err := u.GetUpload(ctx, uploadID, authorID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !upload.Completed {
+		return nil, nil, errors.New("загрузка еще не завершена")
+	}
+
+	// the metadata only names the type, the content decides whether it is an image.
+	// A rejected upload is left to the client to terminate or to the janitor
+	info, err := inspectStoredImage(ctx, u.storage, upload.ObjectKey, upload.FileName, u.cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.MimeType != upload.ContentType {
+		return nil, nil, errors.New("загруженный файл не совпадает с заявленным")
+	}
+
+	// the content is stored without its metadata as a blob, the upload is removed after that
+	content, err := storedContent(ctx, u.storage, upload.ObjectKey, info, upload.Length, u.cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	image := &models.Image{
+		ImageID:   uuid.New().String(),
+		PostID:    postID,
+		CreatedAt: time.Now(),
+		AltText:   details.AltText,
+		Caption:   details.Caption,
+	}
+
+	if err := createBlobImage(ctx, u.imageRepo, u.storage, u.cfg, image, content); err != nil {
+		if isQuotaExceeded(err) {
+			return nil, nil, err
+		}
+		return nil, nil, fmt.Errorf("ошибка сохранения изображения: %w", err)
+	}
+
+	if err := u.removeUpload(ctx, upload); err != nil {
+		fmt.Printf("Предупреждение: не удалось удалить загрузку: %v\n", err)
+	}
+
+	image.ImageURL, err = u.storage.ImageURL(ctx, image.ObjectKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return image, upload, nil
+}
+
+// CleanupExpiredUploads removes the uploads that were not finished or attached in time
+// and returns the number of removed uploads
+func (u *uploadService) CleanupExpiredUploads(ctx context.Context) (int, error) {
+	uploads, err := u.tusRepo.GetExpired(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for i := range uploads {
+		if err := u.removeUpload(ctx, &uploads[i]); err != nil {
+			fmt.Printf("Предупреждение: не удалось удалить загрузку: %v\n", err)
+			continue
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+func (u *uploadService) removeUpload(ctx context.Context, upload *models.TusUpload) error {
+	var err error
+	if upload.Completed {
+		err = u.storage.DeleteImage(ctx, upload.ObjectKey)
+	} else {
+		err = u.storage.AbortMultipartUpload(ctx, upload.ObjectKey, upload.StorageUploadID)
+	}
+	if err != nil {
+		return err
+	}
+
+	u.locks.Delete(upload.UploadID)
+	return u.tusRepo.Delete(ctx, upload.UploadID)
+}
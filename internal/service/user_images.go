@@ -0,0 +1,237 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"image"
+	"io"
+	"microblogCPT/internal/media"
+	"microblogCPT/internal/models"
+	"microblogCPT/internal/repository"
+	"microblogCPT/internal/storage"
+	"strconv"
+)
+
+const (
+	ProfileImageAvatar = "avatar"
+	ProfileImageBanner = "banner"
+)
+
+// AvatarSizes are the sides in pixels of the square avatars stored for every upload
+var AvatarSizes = []int{48, 96, 256}
+
+// banners are cropped to 3:1 and never stored wider than bannerMaxWidth
+const (
+	bannerRatioW   = 3
+	bannerRatioH   = 1
+	bannerMaxWidth = 1500
+)
+
+var errUnknownProfileImage = errors.New("неизвестный тип изображения профиля")
+
+// SetProfileImage crops the uploaded image, stores its sizes under users/{id}/ and replaces the previous image
+// of the kind. The objects of the previous image are removed once the new one is saved
+func (s *userService) SetProfileImage(ctx context.Context, userID, kind, fileName string, file io.Reader) (*models.ProfileImages, error) {
+	if kind != ProfileImageAvatar && kind != ProfileImageBanner {
+		return nil, errUnknownProfileImage
+	}
+
+	src, err := s.decodeProfileImage(file, fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	id := uuid.New().String()
+	var images []models.UserImage
+
+	if kind == ProfileImageAvatar {
+		square := media.Crop(src, 1, 1)
+		for _, size := range AvatarSizes {
+			objectKey := storage.NewUserObjectName(userID, kind, id, fmt.Sprintf("_%d.jpg", size))
+			images = append(images, models.UserImage{Size: size, ObjectKey: objectKey})
+
+			if err := s.saveProfileImage(ctx, objectKey, media.Resize(square, size)); err != nil {
+				deleteReleasedObjects(ctx, s.storage, userImageKeys(images))
+				return nil, err
+			}
+		}
+	} else {
+		banner := media.Crop(src, bannerRatioW, bannerRatioH)
+		width := min(banner.Bounds().Dx(), bannerMaxWidth)
+		objectKey := storage.NewUserObjectName(userID, kind, id, ".jpg")
+		images = append(images, models.UserImage{Size: width, ObjectKey: objectKey})
+
+		if err := s.saveProfileImage(ctx, objectKey, media.Resize(banner, width)); err != nil {
+			return nil, err
+		}
+	}
+
+	oldKeys, err := s.userImageRepo.Replace(ctx, userID, kind, images)
+	if err != nil {
+		deleteReleasedObjects(ctx, s.storage, userImageKeys(images))
+		return nil, err
+	}
+	deleteReleasedObjects(ctx, s.storage, oldKeys)
+
+	return s.GetProfileImages(ctx, userID)
+}
+
+// DeleteProfileImage removes the avatar or the banner of the user, removing a missing one is not an error
+func (s *userService) DeleteProfileImage(ctx context.Context, userID, kind string) error {
+	if kind != ProfileImageAvatar && kind != ProfileImageBanner {
+		return errUnknownProfileImage
+	}
+
+	keys, err := s.userImageRepo.Delete(ctx, userID, kind)
+	if err != nil {
+		return err
+	}
+	deleteReleasedObjects(ctx, s.storage, keys)
+
+	return nil
+}
+
+func (s *userService) GetProfileImages(ctx context.Context, userID string) (*models.ProfileImages, error) {
+	imagesByUser, err := s.userImageRepo.GetByUserIDs(ctx, []string{userID})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.profileImages(ctx, imagesByUser[userID])
+}
+
+// AttachAuthors fills the authors of the posts with one query for the users and one for their images
+func (s *userService) AttachAuthors(ctx context.Context, posts []models.Post) error {
+	authorIDs := []string{}
+	seen := make(map[string]bool, len(posts))
+	for _, post := range posts {
+		if !seen[post.AuthorID] {
+			seen[post.AuthorID] = true
+			authorIDs = append(authorIDs, post.AuthorID)
+		}
+	}
+
+	// the posts of one author share the author, so every url is issued once
+	authors, err := loadAuthors(ctx, s.userRepo, s.userImageRepo, s.storage, authorIDs)
+	if err != nil {
+		return err
+	}
+
+	for i := range posts {
+		posts[i].Author = authors[posts[i].AuthorID]
+	}
+
+	return nil
+}
+
+// loadAuthors reads the handles, the names and the avatars of the users by their IDs
+func loadAuthors(ctx context.Context, userRepo repository.UserRepository, userImageRepo repository.UserImageRepository,
+	store storage.Storage, authorIDs []string) (map[string]*models.PostAuthor, error) {
+	users, err := userRepo.GetUsersByIDs(ctx, authorIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	imagesByUser, err := userImageRepo.GetByUserIDs(ctx, authorIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	authors := make(map[string]*models.PostAuthor, len(authorIDs))
+	for _, authorID := range authorIDs {
+		images, err := profileImageURLs(ctx, store, imagesByUser[authorID])
+		if err != nil {
+			return nil, err
+		}
+		authors[authorID] = &models.PostAuthor{UserID: authorID, ProfileImages: *images}
+	}
+	for _, user := range users {
+		authors[user.UserID].Handle = user.Handle
+		authors[user.UserID].DisplayName = user.DisplayName
+	}
+
+	return authors, nil
+}
+
+// profileImages issues the urls of the stored images of the user
+func (s *userService) profileImages(ctx context.Context, images []models.UserImage) (*models.ProfileImages, error) {
+	return profileImageURLs(ctx, s.storage, images)
+}
+
+// profileImageURLs issues the urls of the profile images, the avatar urls are keyed by the size
+func profileImageURLs(ctx context.Context, store storage.Storage, images []models.UserImage) (*models.ProfileImages, error) {
+	result := &models.ProfileImages{}
+	for _, image := range images {
+		url, err := store.ImageURL(ctx, image.ObjectKey)
+		if err != nil {
+			return nil, err
+		}
+
+		switch image.Kind {
+		case ProfileImageAvatar:
+			if result.AvatarURLs == nil {
+				result.AvatarURLs = make(map[string]string)
+			}
+			result.AvatarURLs[strconv.Itoa(image.Size)] = url
+		case ProfileImageBanner:
+			result.BannerURL = url
+		}
+	}
+
+	return result, nil
+}
+
+// saveProfileImage encodes the image as JPEG and stores it under the key
+func (s *userService) saveProfileImage(ctx context.Context, objectKey string, img image.Image) error {
+	data, err := media.EncodeJPEG(img, s.cfg.VariantQuality)
+	if err != nil {
+		return err
+	}
+
+	return s.storage.SaveImage(ctx, objectKey, "image/jpeg", bytes.NewReader(data), int64(len(data)))
+}
+
+// decodeProfileImage checks the upload with the limits of the post images and decodes it upright.
+// The pixels are re-encoded, so no metadata of the upload is ever stored
+func (s *userService) decodeProfileImage(file io.Reader, fileName string) (image.Image, error) {
+	info, file, err := media.Inspect(file, fileName, imageLimits(s.cfg))
+	if err != nil {
+		return nil, err
+	}
+
+	// WebP can not be decoded in pure Go, so it can not be cropped either
+	if info.MimeType == "image/webp" {
+		return nil, errors.New("изображение профиля в формате WebP не поддерживается")
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения файла: %w", err)
+	}
+
+	// stripping the EXIF turns a JPEG upright by its orientation
+	opts := metadataOptions(s.cfg)
+	opts.Strip = true
+	data, _, err = media.Sanitize(data, info, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	src, err := media.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.New("не удалось прочитать изображение")
+	}
+
+	return src, nil
+}
+
+func userImageKeys(images []models.UserImage) []string {
+	keys := make([]string, 0, len(images))
+	for _, image := range images {
+		keys = append(keys, image.ObjectKey)
+	}
+	return keys
+}
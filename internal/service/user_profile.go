@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"microblogCPT/internal/models"
+	"microblogCPT/internal/repository"
+	"strings"
+	"time"
+)
+
+// UpdateProfile changes the public profile of the user. The handle is changed at most once per
+// HandleChangeInterval, and the previous handle redirects to the new one for HandleRedirectPeriod
+func (s *userService) UpdateProfile(ctx context.Context, req repository.UpdateProfileRequest) (*models.User, error) {
+	user, err := s.userRepo.GetUserByID(ctx, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	// the time of the last change is checked by the repository in the transaction that changes the handle
+	previousHandle := user.Handle
+	if req.Handle != nil && *req.Handle != user.Handle {
+		now := time.Now()
+		user.Handle = *req.Handle
+		user.HandleChangedAt = &now
+	}
+	if req.DisplayName != nil {
+		user.DisplayName = *req.DisplayName
+	}
+	if req.Bio != nil {
+		user.Bio = *req.Bio
+	}
+	if req.Links != nil {
+		user.Links = *req.Links
+	}
+
+	err = s.userRepo.UpdateProfile(ctx, user, previousHandle, s.cfg.HandleChangeInterval, time.Now().Add(s.cfg.HandleRedirectPeriod))
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// GetPublicProfile returns the profile of the handle. For a previous handle whose redirect lasts it returns
+// no profile but the current handle of the user
+func (s *userService) GetPublicProfile(ctx context.Context, handle string) (*models.PublicProfile, string, error) {
+	user, err := s.userRepo.GetUserByHandle(ctx, handle)
+	if err != nil {
+		if !strings.Contains(err.Error(), "не найден") {
+			return nil, "", err
+		}
+
+		current, err := s.userRepo.GetHandleRedirect(ctx, handle)
+		if err != nil {
+			return nil, "", err
+		}
+		return nil, current, nil
+	}
+
+	images, err := s.GetProfileImages(ctx, user.UserID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	postCount, err := s.postRepo.CountPublishedByAuthor(ctx, user.UserID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	followers, following, err := s.followRepo.GetCounts(ctx, user.UserID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	links := []string(user.Links)
+	if links == nil {
+		links = []string{}
+	}
+
+	return &models.PublicProfile{
+		UserID:         user.UserID,
+		Handle:         user.Handle,
+		DisplayName:    user.DisplayName,
+		Bio:            user.Bio,
+		Links:          links,
+		ProfileImages:  *images,
+		PostCount:      postCount,
+		FollowerCount:  followers,
+		FollowingCount: following,
+	}, "", nil
+}
@@ -2,24 +2,41 @@ package service
 
 import (
 	"context"
+	"io"
 	"microblogCPT/internal/config"
+	"microblogCPT/internal/models"
 	"microblogCPT/internal/repository"
+	"microblogCPT/internal/storage"
 )
 
 type UserService interface {
 	UpdateUser(ctx context.Context, req repository.UpdateUserRequest) error
 	DeleteUser(ctx context.Context, userID string) error
+	SetProfileImage(ctx context.Context, userID, kind, fileName string, file io.Reader) (*models.ProfileImages, error)
+	DeleteProfileImage(ctx context.Context, userID, kind string) error
+	GetProfileImages(ctx context.Context, userID string) (*models.ProfileImages, error)
+	AttachAuthors(ctx context.Context, posts []models.Post) error
+	UpdateProfile(ctx context.Context, req repository.UpdateProfileRequest) (*models.User, error)
+	GetPublicProfile(ctx context.Context, handle string) (*models.PublicProfile, string, error)
 }
 
 type userService struct {
-	userRepo repository.UserRepository
-	cfg      *config.Config
+	userRepo      repository.UserRepository
+	userImageRepo repository.UserImageRepository
+	postRepo      repository.PostRepository
+	followRepo    repository.FollowRepository
+	storage       storage.Storage
+	cfg           *config.Config
 }
 
-func NewUserService(userRepo repository.UserRepository, cfg *config.Config) UserService {
+func NewUserService(userRepo repository.UserRepository, userImageRepo repository.UserImageRepository, postRepo repository.PostRepository, followRepo repository.FollowRepository, storage storage.Storage, cfg *config.Config) UserService {
 	return &userService{
-		userRepo: userRepo,
-		cfg:      cfg,
+		userRepo:      userRepo,
+		userImageRepo: userImageRepo,
+		postRepo:      postRepo,
+		followRepo:    followRepo,
+		storage:       storage,
+		cfg:           cfg,
 	}
 }
 
@@ -42,11 +59,15 @@ func (s *userService) UpdateUser(ctx context.Context, req repository.UpdateUserR
 	return nil
 }
 
+// DeleteUser removes the account with its posts, their images and the profile images, the objects that are not
+// referenced anymore are removed after
 func (s *userService) DeleteUser(ctx context.Context, userID string) error {
-	err := s.userRepo.DeleteUser(ctx, userID)
+	released, err := s.userRepo.DeleteUser(ctx, userID)
 	if err != nil {
 		return err
 	}
 
+	deleteReleasedObjects(ctx, s.storage, released)
+
 	return nil
 }
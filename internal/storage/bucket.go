@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+	"microblogCPT/internal/config"
+	"reflect"
+	"time"
+)
+
+// bucketSetupTimeout bounds the checks of the bucket at startup
+const bucketSetupTimeout = 30 * time.Second
+
+// ensureBucket checks the access to the bucket, creates it in the configured region when it is missing
+// and applies the versioning and the lifecycle rules from the configuration. The lifecycle rules set on
+// the bucket by an operator are kept
+func (m *MinIOClient) ensureBucket(ctx context.Context) error {
+	cfg := m.config.MinIO
+
+	exists, err := m.client.BucketExists(ctx, m.bucket)
+	if err != nil {
+		return bucketError(m.bucket, err)
+	}
+
+	if !exists {
+		if !cfg.CreateBucket {
+			return fmt.Errorf("бакет %s не существует, создайте его или включите MINIO_CREATE_BUCKET", m.bucket)
+		}
+
+		err := m.client.MakeBucket(ctx, m.bucket, minio.MakeBucketOptions{Region: cfg.Region})
+		if err != nil {
+			// another instance may have created it at the same time
+			if code := minio.ToErrorResponse(err).Code; code != "BucketAlreadyOwnedByYou" && code != "BucketAlreadyExists" {
+				return bucketError(m.bucket, err)
+			}
+		} else {
+			fmt.Printf("Бакет %s создан в регионе %s\n", m.bucket, cfg.Region)
+		}
+	}
+
+	if cfg.Versioning {
+		if err := m.client.EnableVersioning(ctx, m.bucket); err != nil {
+			return fmt.Errorf("ошибка включения версионирования бакета %s: %w", m.bucket, err)
+		}
+	}
+
+	if rules := BucketLifecycle(cfg); !rules.Empty() {
+		current, err := m.client.GetBucketLifecycle(ctx, m.bucket)
+		if err != nil && minio.ToErrorResponse(err).Code != "NoSuchLifecycleConfiguration" {
+			return fmt.Errorf("ошибка чтения жизненного цикла бакета %s: %w", m.bucket, err)
+		}
+
+		if merged, changed := MergeLifecycle(current, rules); changed {
+			if err := m.client.SetBucketLifecycle(ctx, m.bucket, merged); err != nil {
+				return fmt.Errorf("ошибка настройки жизненного цикла бакета %s: %w", m.bucket, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// MergeLifecycle adds the rules of the application to the rules already set on the bucket: a rule with
+// the same ID is replaced, the other rules are kept in their order. It reports whether the merged rules
+// differ from the current ones, so the bucket is not rewritten on every start
+func MergeLifecycle(current, rules *lifecycle.Configuration) (*lifecycle.Configuration, bool) {
+	own := make(map[string]lifecycle.Rule, len(rules.Rules))
+	for _, rule := range rules.Rules {
+		own[rule.ID] = rule
+	}
+
+	merged := &lifecycle.Configuration{}
+	changed := false
+	applied := make(map[string]bool, len(rules.Rules))
+
+	if current != nil {
+		for _, rule := range current.Rules {
+			if ownRule, ok := own[rule.ID]; ok {
+				if !reflect.DeepEqual(ownRule, rule) {
+					changed = true
+				}
+				applied[rule.ID] = true
+				rule = ownRule
+			}
+			merged.Rules = append(merged.Rules, rule)
+		}
+	}
+
+	for _, rule := range rules.Rules {
+		if !applied[rule.ID] {
+			merged.Rules = append(merged.Rules, rule)
+			changed = true
+		}
+	}
+
+	return merged, changed
+}
+
+// BucketLifecycle builds the lifecycle rules of the bucket: unfinished multipart uploads are aborted
+// after AbortIncompleteDays, and with versioning the previous versions expire after NoncurrentDays
+func BucketLifecycle(cfg config.MinIO) *lifecycle.Configuration {
+	rules := &lifecycle.Configuration{}
+
+	if cfg.AbortIncompleteDays > 0 {
+		rules.Rules = append(rules.Rules, lifecycle.Rule{
+			ID:         "abort-incomplete-uploads",
+			Status:     "Enabled",
+			RuleFilter: lifecycle.Filter{Prefix: ""},
+			AbortIncompleteMultipartUpload: lifecycle.AbortIncompleteMultipartUpload{
+				DaysAfterInitiation: lifecycle.ExpirationDays(cfg.AbortIncompleteDays),
+			},
+		})
+	}
+
+	if cfg.Versioning && cfg.NoncurrentDays > 0 {
+		rules.Rules = append(rules.Rules, lifecycle.Rule{
+			ID:         "expire-noncurrent-versions",
+			Status:     "Enabled",
+			RuleFilter: lifecycle.Filter{Prefix: ""},
+			NoncurrentVersionExpiration: lifecycle.NoncurrentVersionExpiration{
+				NoncurrentDays: lifecycle.ExpirationDays(cfg.NoncurrentDays),
+			},
+		})
+	}
+
+	return rules
+}
+
+// bucketError explains the error of the first request to MinIO, most often it is a wrong configuration
+func bucketError(bucket string, err error) error {
+	switch minio.ToErrorResponse(err).Code {
+	case "InvalidAccessKeyId", "SignatureDoesNotMatch":
+		return fmt.Errorf("MinIO отклонил ключи доступа, проверьте MINIO_ACCESS_KEY и MINIO_SECRET_KEY: %w", err)
+	case "AccessDenied":
+		return fmt.Errorf("нет доступа к бакету %s, проверьте права ключа MINIO_ACCESS_KEY: %w", bucket, err)
+	case "AuthorizationHeaderMalformed", "InvalidRegion":
+		return fmt.Errorf("неверный регион бакета %s, проверьте MINIO_REGION: %w", bucket, err)
+	}
+	return fmt.Errorf("ошибка подключения к MinIO: %w", err)
+}
@@ -0,0 +1,314 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// multipartDir keeps the parts of unfinished multipart uploads inside the storage directory
+const multipartDir = ".multipart"
+
+// LocalStorage keeps the objects as files under a directory and serves them through signed /media/ urls
+type LocalStorage struct {
+	dir    string
+	signer *URLSigner
+	expiry time.Duration
+}
+
+func NewLocalStorage(dir string, signer *URLSigner, expiry time.Duration) (*LocalStorage, error) {
+	if err := os.MkdirAll(filepath.Join(dir, multipartDir), 0o755); err != nil {
+		return nil, fmt.Errorf("ошибка создания каталога хранилища: %w", err)
+	}
+
+	fmt.Printf("Локальное хранилище: %s\n", dir)
+	return &LocalStorage{dir: dir, signer: signer, expiry: expiry}, nil
+}
+
+// path returns the file of the object, keys that could leave the directory are rejected
+func (l *LocalStorage) path(objectName string) (string, error) {
+	if !validObjectName(objectName) {
+		return "", fmt.Errorf("недопустимый ключ объекта %s", objectName)
+	}
+	return filepath.Join(l.dir, filepath.FromSlash(objectName)), nil
+}
+
+func (l *LocalStorage) UploadImage(ctx context.Context, postID, fileName, contentType string, file io.Reader, size int64) (string, error) {
+	objectName := NewObjectName(postID, fileName)
+
+	if err := l.SaveImage(ctx, objectName, contentType, file, size); err != nil {
+		return "", err
+	}
+
+	return objectName, nil
+}
+
+// SaveImage writes the file next to its destination and renames it, so a reader never sees a partial object
+func (l *LocalStorage) SaveImage(ctx context.Context, objectName, contentType string, file io.Reader, size int64) error {
+	filePath, err := l.path(objectName)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return fmt.Errorf("ошибка создания каталога: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("ошибка создания файла: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	// an unknown size (-1) is copied as is, a known one is read one byte past it to catch a longer file
+	reader := file
+	if size >= 0 {
+		reader = io.LimitReader(file, size+1)
+	}
+
+	written, err := io.Copy(tmp, reader)
+	closeErr := tmp.Close()
+	if err != nil {
+		return fmt.Errorf("ошибка записи файла: %w", err)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("ошибка записи файла: %w", closeErr)
+	}
+	if size >= 0 && written != size {
+		return fmt.Errorf("размер файла %d не совпадает с заявленным %d", written, size)
+	}
+
+	if err := os.Rename(tmp.Name(), filePath); err != nil {
+		return fmt.Errorf("ошибка сохранения файла: %w", err)
+	}
+
+	return nil
+}
+
+func (l *LocalStorage) PresignUpload(ctx context.Context, objectName, contentType string, size int64, expiry time.Duration) (string, error) {
+	if !validObjectName(objectName) {
+		return "", fmt.Errorf("недопустимый ключ объекта %s", objectName)
+	}
+	return l.signer.URL(http.MethodPut, objectName, contentType, size, expiry), nil
+}
+
+// StatImage returns the size of the file, the content type is derived from its extension
+func (l *LocalStorage) StatImage(ctx context.Context, objectName string) (*ObjectInfo, error) {
+	filePath, err := l.path(objectName)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Stat(filePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("объект %s не найден", objectName)
+		}
+		return nil, fmt.Errorf("ошибка получения файла: %w", err)
+	}
+
+	return &ObjectInfo{
+		Key:          objectName,
+		Size:         stat.Size(),
+		ContentType:  mime.TypeByExtension(path.Ext(objectName)),
+		LastModified: stat.ModTime(),
+	}, nil
+}
+
+// ListImages walks the storage directory, the multipart parts and the files being written are not objects
+func (l *LocalStorage) ListImages(ctx context.Context) ([]ObjectInfo, error) {
+	objects := []ObjectInfo{}
+	err := filepath.WalkDir(l.dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if entry.Name() == multipartDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(entry.Name(), ".upload-") {
+			return nil
+		}
+
+		stat, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(l.dir, filePath)
+		if err != nil {
+			return err
+		}
+		objectName := filepath.ToSlash(relPath)
+
+		objects = append(objects, ObjectInfo{
+			Key:          objectName,
+			Size:         stat.Size(),
+			ContentType:  mime.TypeByExtension(path.Ext(objectName)),
+			LastModified: stat.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения списка файлов: %w", err)
+	}
+
+	return objects, nil
+}
+
+func (l *LocalStorage) OpenImage(ctx context.Context, objectName string) (io.ReadCloser, error) {
+	filePath, err := l.path(objectName)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("объект %s не найден", objectName)
+		}
+		return nil, fmt.Errorf("ошибка открытия файла: %w", err)
+	}
+
+	return file, nil
+}
+
+func (l *LocalStorage) ImageURL(ctx context.Context, objectName string) (string, error) {
+	return l.signer.URL(http.MethodGet, objectName, "", 0, l.expiry), nil
+}
+
+func (l *LocalStorage) CopyImage(ctx context.Context, srcObjectName, dstObjectName string) error {
+	src, err := l.OpenImage(ctx, srcObjectName)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := l.StatImage(ctx, srcObjectName)
+	if err != nil {
+		return err
+	}
+
+	return l.SaveImage(ctx, dstObjectName, info.ContentType, src, info.Size)
+}
+
+// DeleteImage removes the file, a missing one is not an error just like in S3
+func (l *LocalStorage) DeleteImage(ctx context.Context, objectName string) error {
+	filePath, err := l.path(objectName)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(filePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("ошибка удаления файла: %w", err)
+	}
+
+	return nil
+}
+
+func (l *LocalStorage) uploadDir(uploadID string) (string, error) {
+	if _, err := uuid.Parse(uploadID); err != nil {
+		return "", errors.New("составная загрузка не найдена")
+	}
+	return filepath.Join(l.dir, multipartDir, uploadID), nil
+}
+
+func (l *LocalStorage) NewMultipartUpload(ctx context.Context, objectName, contentType string) (string, error) {
+	if !validObjectName(objectName) {
+		return "", fmt.Errorf("недопустимый ключ объекта %s", objectName)
+	}
+
+	uploadID := uuid.New().String()
+	if err := os.MkdirAll(filepath.Join(l.dir, multipartDir, uploadID), 0o755); err != nil {
+		return "", fmt.Errorf("ошибка создания составной загрузки: %w", err)
+	}
+
+	return uploadID, nil
+}
+
+// UploadPart stores the part as a file of the upload and returns the MD5 of its content as the ETag
+func (l *LocalStorage) UploadPart(ctx context.Context, objectName, uploadID string, partNumber int, data io.Reader, size int64) (string, error) {
+	dir, err := l.uploadDir(uploadID)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return "", errors.New("составная загрузка не найдена")
+	}
+
+	part, err := os.Create(filepath.Join(dir, strconv.Itoa(partNumber)))
+	if err != nil {
+		return "", fmt.Errorf("ошибка записи части: %w", err)
+	}
+	defer part.Close()
+
+	hash := md5.New()
+	written, err := io.Copy(io.MultiWriter(part, hash), data)
+	if err != nil {
+		return "", fmt.Errorf("ошибка записи части: %w", err)
+	}
+	if written != size {
+		return "", fmt.Errorf("размер части %d не совпадает с заявленным %d", written, size)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// CompleteMultipartUpload joins the parts into the object in the order of their ETags
+func (l *LocalStorage) CompleteMultipartUpload(ctx context.Context, objectName, uploadID string, etags []string) error {
+	dir, err := l.uploadDir(uploadID)
+	if err != nil {
+		return err
+	}
+
+	readers := make([]io.Reader, 0, len(etags))
+	var size int64
+	for i := range etags {
+		part, err := os.Open(filepath.Join(dir, strconv.Itoa(i+1)))
+		if err != nil {
+			return fmt.Errorf("часть %d составной загрузки не найдена", i+1)
+		}
+		defer part.Close()
+
+		stat, err := part.Stat()
+		if err != nil {
+			return fmt.Errorf("ошибка чтения части: %w", err)
+		}
+		size += stat.Size()
+		readers = append(readers, part)
+	}
+
+	if err := l.SaveImage(ctx, objectName, mime.TypeByExtension(path.Ext(objectName)), io.MultiReader(readers...), size); err != nil {
+		return err
+	}
+
+	return os.RemoveAll(dir)
+}
+
+func (l *LocalStorage) AbortMultipartUpload(ctx context.Context, objectName, uploadID string) error {
+	dir, err := l.uploadDir(uploadID)
+	if err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("ошибка отмены составной загрузки: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NewMediaHandler serves the objects of a storage without its own web server under /media/.
+// GET and HEAD download an object by a url from ImageURL, PUT uploads one by a url from PresignUpload
+func NewMediaHandler(store Storage, signer *URLSigner) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		objectName := strings.TrimPrefix(r.URL.Path, MediaPathPrefix)
+		if !validObjectName(objectName) {
+			http.Error(w, "Неверный путь", http.StatusBadRequest)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			serveObject(w, r, store, signer, objectName)
+		case http.MethodPut:
+			receiveObject(w, r, store, signer, objectName)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func serveObject(w http.ResponseWriter, r *http.Request, store Storage, signer *URLSigner, objectName string) {
+	if err := signer.Verify(http.MethodGet, objectName, "", 0, r.URL.Query()); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	info, err := store.StatImage(r.Context(), objectName)
+	if err != nil {
+		if strings.Contains(err.Error(), "не найден") {
+			http.Error(w, "Объект не найден", http.StatusNotFound)
+		} else {
+			http.Error(w, "Ошибка получения объекта", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	object, err := store.OpenImage(r.Context(), objectName)
+	if err != nil {
+		http.Error(w, "Ошибка получения объекта", http.StatusInternalServerError)
+		return
+	}
+	defer object.Close()
+
+	if info.ContentType != "" {
+		w.Header().Set("Content-Type", info.ContentType)
+	}
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+
+	// files and in-memory objects can be seeked, so ranges and conditional requests are supported
+	if seeker, ok := object.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, objectName, time.Time{}, seeker)
+		return
+	}
+
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	if r.Method == http.MethodHead {
+		return
+	}
+	io.Copy(w, object)
+}
+
+func receiveObject(w http.ResponseWriter, r *http.Request, store Storage, signer *URLSigner, objectName string) {
+	contentType := r.Header.Get("Content-Type")
+	if err := signer.Verify(http.MethodPut, objectName, contentType, r.ContentLength, r.URL.Query()); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	err := store.SaveImage(r.Context(), objectName, contentType, r.Body, r.ContentLength)
+	if err != nil {
+		http.Error(w, "Ошибка сохранения объекта", http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// validObjectName rejects keys that could leave the storage directory
+func validObjectName(objectName string) bool {
+	if objectName == "" || strings.HasPrefix(objectName, "/") || strings.Contains(objectName, "\\") {
+		return false
+	}
+
+	for _, segment := range strings.Split(objectName, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,243 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// MemoryStorage keeps the objects in memory. It is meant for tests and for running the API
+// without an object storage, everything is lost on restart
+type MemoryStorage struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+	uploads map[string]*memoryUpload
+	signer  *URLSigner
+	expiry  time.Duration
+}
+
+type memoryObject struct {
+	data        []byte
+	contentType string
+	modifiedAt  time.Time
+}
+
+type memoryUpload struct {
+	objectName  string
+	contentType string
+	parts       map[int][]byte
+}
+
+func NewMemoryStorage(signer *URLSigner, expiry time.Duration) *MemoryStorage {
+	return &MemoryStorage{
+		objects: make(map[string]memoryObject),
+		uploads: make(map[string]*memoryUpload),
+		signer:  signer,
+		expiry:  expiry,
+	}
+}
+
+func (m *MemoryStorage) UploadImage(ctx context.Context, postID, fileName, contentType string, file io.Reader, size int64) (string, error) {
+	objectName := NewObjectName(postID, fileName)
+
+	if err := m.SaveImage(ctx, objectName, contentType, file, size); err != nil {
+		return "", err
+	}
+
+	return objectName, nil
+}
+
+func (m *MemoryStorage) SaveImage(ctx context.Context, objectName, contentType string, file io.Reader, size int64) error {
+	if !validObjectName(objectName) {
+		return fmt.Errorf("недопустимый ключ объекта %s", objectName)
+	}
+
+	// an unknown size (-1) is read as is, a known one one byte past it to catch a longer file
+	reader := file
+	if size >= 0 {
+		reader = io.LimitReader(file, size+1)
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения файла: %w", err)
+	}
+	if size >= 0 && int64(len(data)) != size {
+		return fmt.Errorf("размер файла %d не совпадает с заявленным %d", len(data), size)
+	}
+
+	m.mu.Lock()
+	m.objects[objectName] = memoryObject{data: data, contentType: contentType, modifiedAt: time.Now()}
+	m.mu.Unlock()
+
+	return nil
+}
+
+func (m *MemoryStorage) PresignUpload(ctx context.Context, objectName, contentType string, size int64, expiry time.Duration) (string, error) {
+	if !validObjectName(objectName) {
+		return "", fmt.Errorf("недопустимый ключ объекта %s", objectName)
+	}
+	return m.signer.URL(http.MethodPut, objectName, contentType, size, expiry), nil
+}
+
+func (m *MemoryStorage) StatImage(ctx context.Context, objectName string) (*ObjectInfo, error) {
+	m.mu.RLock()
+	object, ok := m.objects[objectName]
+	m.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("объект %s не найден", objectName)
+	}
+
+	return &ObjectInfo{
+		Key:          objectName,
+		Size:         int64(len(object.data)),
+		ContentType:  object.contentType,
+		LastModified: object.modifiedAt,
+	}, nil
+}
+
+func (m *MemoryStorage) ListImages(ctx context.Context) ([]ObjectInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	objects := make([]ObjectInfo, 0, len(m.objects))
+	for objectName, object := range m.objects {
+		objects = append(objects, ObjectInfo{
+			Key:          objectName,
+			Size:         int64(len(object.data)),
+			ContentType:  object.contentType,
+			LastModified: object.modifiedAt,
+		})
+	}
+
+	return objects, nil
+}
+
+// OpenImage returns a reader of the object, the stored content is never modified in place
+func (m *MemoryStorage) OpenImage(ctx context.Context, objectName string) (io.ReadCloser, error) {
+	m.mu.RLock()
+	object, ok := m.objects[objectName]
+	m.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("объект %s не найден", objectName)
+	}
+
+	return memoryReader{bytes.NewReader(object.data)}, nil
+}
+
+func (m *MemoryStorage) ImageURL(ctx context.Context, objectName string) (string, error) {
+	return m.signer.URL(http.MethodGet, objectName, "", 0, m.expiry), nil
+}
+
+func (m *MemoryStorage) CopyImage(ctx context.Context, srcObjectName, dstObjectName string) error {
+	if !validObjectName(dstObjectName) {
+		return fmt.Errorf("недопустимый ключ объекта %s", dstObjectName)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	object, ok := m.objects[srcObjectName]
+	if !ok {
+		return fmt.Errorf("объект %s не найден", srcObjectName)
+	}
+	object.modifiedAt = time.Now()
+	m.objects[dstObjectName] = object
+
+	return nil
+}
+
+func (m *MemoryStorage) DeleteImage(ctx context.Context, objectName string) error {
+	m.mu.Lock()
+	delete(m.objects, objectName)
+	m.mu.Unlock()
+
+	return nil
+}
+
+func (m *MemoryStorage) NewMultipartUpload(ctx context.Context, objectName, contentType string) (string, error) {
+	if !validObjectName(objectName) {
+		return "", fmt.Errorf("недопустимый ключ объекта %s", objectName)
+	}
+
+	uploadID := uuid.New().String()
+
+	m.mu.Lock()
+	m.uploads[uploadID] = &memoryUpload{objectName: objectName, contentType: contentType, parts: map[int][]byte{}}
+	m.mu.Unlock()
+
+	return uploadID, nil
+}
+
+func (m *MemoryStorage) UploadPart(ctx context.Context, objectName, uploadID string, partNumber int, data io.Reader, size int64) (string, error) {
+	content, err := io.ReadAll(data)
+	if err != nil {
+		return "", fmt.Errorf("ошибка чтения части: %w", err)
+	}
+	if int64(len(content)) != size {
+		return "", fmt.Errorf("размер части %d не совпадает с заявленным %d", len(content), size)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	upload, ok := m.uploads[uploadID]
+	if !ok {
+		return "", errors.New("составная загрузка не найдена")
+	}
+	upload.parts[partNumber] = content
+
+	hash := md5.Sum(content)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+func (m *MemoryStorage) CompleteMultipartUpload(ctx context.Context, objectName, uploadID string, etags []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	upload, ok := m.uploads[uploadID]
+	if !ok {
+		return errors.New("составная загрузка не найдена")
+	}
+
+	var data []byte
+	for i := range etags {
+		part, ok := upload.parts[i+1]
+		if !ok {
+			return fmt.Errorf("часть %d составной загрузки не найдена", i+1)
+		}
+		data = append(data, part...)
+	}
+
+	m.objects[upload.objectName] = memoryObject{data: data, contentType: upload.contentType, modifiedAt: time.Now()}
+	delete(m.uploads, uploadID)
+
+	return nil
+}
+
+func (m *MemoryStorage) AbortMultipartUpload(ctx context.Context, objectName, uploadID string) error {
+	m.mu.Lock()
+	delete(m.uploads, uploadID)
+	m.mu.Unlock()
+
+	return nil
+}
+
+// memoryReader lets the media handler seek in the object
+type memoryReader struct {
+	*bytes.Reader
+}
+
+func (memoryReader) Close() error {
+	return nil
+}
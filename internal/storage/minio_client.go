@@ -8,19 +8,46 @@ import (
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	"io"
 	"microblogCPT/internal/config"
-	"mime"
+	"net/http"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// maxPresignExpiry is the longest lifetime of a presigned url allowed by S3
+const maxPresignExpiry = 7 * 24 * time.Hour
+
 type Storage interface {
-	UploadImage(ctx context.Context, postID, fileName string, file io.Reader, size int64) (string, string, error)
+	UploadImage(ctx context.Context, postID, fileName, contentType string, file io.Reader, size int64) (string, error)
+	SaveImage(ctx context.Context, objectName, contentType string, file io.Reader, size int64) error
+	PresignUpload(ctx context.Context, objectName, contentType string, size int64, expiry time.Duration) (string, error)
+	StatImage(ctx context.Context, objectName string) (*ObjectInfo, error)
+	ListImages(ctx context.Context) ([]ObjectInfo, error)
+	OpenImage(ctx context.Context, objectName string) (io.ReadCloser, error)
+	ImageURL(ctx context.Context, objectName string) (string, error)
+	CopyImage(ctx context.Context, srcObjectName, dstObjectName string) error
 	DeleteImage(ctx context.Context, objectName string) error
+
+	NewMultipartUpload(ctx context.Context, objectName, contentType string) (string, error)
+	UploadPart(ctx context.Context, objectName, uploadID string, partNumber int, data io.Reader, size int64) (string, error)
+	CompleteMultipartUpload(ctx context.Context, objectName, uploadID string, etags []string) error
+	AbortMultipartUpload(ctx context.Context, objectName, uploadID string) error
+}
+
+// ObjectInfo describes an object stored in the bucket, the key and the modification time are set by ListImages
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	LastModified time.Time
 }
 
 type MinIOClient struct {
 	client *minio.Client
+	// core gives access to the low level multipart api
+	core   *minio.Core
+	bucket string
 	config *config.Config
 }
 
@@ -28,6 +55,8 @@ func NewMinIOClient(cfg *config.Config) (*MinIOClient, error) {
 	minioClient, err := minio.New(cfg.MinIO.Endpoint, &minio.Options{
 		Creds:  credentials.NewStaticV4(cfg.MinIO.AccessKey, cfg.MinIO.SecretKey, ""),
 		Secure: cfg.MinIO.UseSSL,
+		// with a known region urls are presigned without asking the server for the bucket location
+		Region: cfg.MinIO.Region,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("ошибка создания MinIO клиента: %w", err)
@@ -35,57 +64,173 @@ func NewMinIOClient(cfg *config.Config) (*MinIOClient, error) {
 
 	client := &MinIOClient{
 		client: minioClient,
+		core:   &minio.Core{Client: minioClient},
+		bucket: cfg.MinIO.BucketName,
 		config: cfg,
 	}
 
+	// a wrong endpoint, credentials or bucket stop the start instead of failing the first upload
+	ctx, cancel := context.WithTimeout(context.Background(), bucketSetupTimeout)
+	defer cancel()
+
+	if err := client.ensureBucket(ctx); err != nil {
+		return nil, err
+	}
+
 	fmt.Println("MinIO клиент инициализирован")
 	return client, nil
 }
 
-func (m *MinIOClient) UploadImage(ctx context.Context, postID string, fileName string, file io.Reader, size int64) (string, string, error) {
-	fileExt := strings.ToLower(filepath.Ext(fileName))
-	if fileExt == "" {
-		fileExt = ".jpg"
+// UploadImage stores the file under a new key of the post. The content type is the one detected
+// from the file content, not from its name
+func (m *MinIOClient) UploadImage(ctx context.Context, postID, fileName, contentType string, file io.Reader, size int64) (string, error) {
+	now := time.Now()
+	objectName := NewObjectName(postID, fileName)
+
+	_, err := m.client.PutObject(ctx, m.bucket, objectName, file, size,
+		minio.PutObjectOptions{
+			ContentType: contentType,
+			UserMetadata: map[string]string{
+				"original-filename": fileName,
+				"post-id":           postID,
+				"uploaded-at":       now.Format(time.RFC3339),
+			},
+		})
+	if err != nil {
+		return "", fmt.Errorf("ошибка загрузки в MinIO: %w", err)
 	}
 
-	contentType := mime.TypeByExtension(fileExt)
-	if contentType == "" {
-		contentType = "application/octet-stream"
+	return objectName, nil
+}
+
+// SaveImage stores the file under the given key, it is used for the objects derived from an image
+func (m *MinIOClient) SaveImage(ctx context.Context, objectName, contentType string, file io.Reader, size int64) error {
+	_, err := m.client.PutObject(ctx, m.bucket, objectName, file, size,
+		minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		return fmt.Errorf("ошибка загрузки в MinIO: %w", err)
 	}
 
+	return nil
+}
+
+// NewObjectName builds the key of a new image of the post: posts/{postID}/{yyyy}/{mm}/{uuid}{ext}
+func NewObjectName(postID, fileName string) string {
 	now := time.Now()
-	objectName := fmt.Sprintf("posts/%s/%d/%02d/%s%s",
+	return fmt.Sprintf("posts/%s/%d/%02d/%s%s",
 		postID,
 		now.Year(),
 		now.Month(),
 		uuid.New().String(),
-		fileExt)
+		imageExt(fileName))
+}
 
-	_, err := m.client.PutObject(ctx, "images", objectName, file, size,
-		minio.PutObjectOptions{
-			ContentType: contentType,
-			UserMetadata: map[string]string{
-				"original-filename": fileName,
-				"post-id":           postID,
-				"uploaded-at":       now.Format(time.RFC3339),
-			},
+// NewBlobObjectName builds the key of a new blob: blobs/{hash[:2]}/{hash}-{uuid}{ext}. The key is unique
+// for every stored blob, so the content uploaded again never lands on an object that is being removed
+func NewBlobObjectName(hash, fileName string) string {
+	return fmt.Sprintf("blobs/%s/%s-%s%s",
+		hash[:2],
+		hash,
+		uuid.New().String(),
+		imageExt(fileName))
+}
+
+// NewUserObjectName builds the key of a profile image: users/{userID}/{kind}/{uuid}{suffix}.
+// The sizes of one avatar share the uuid and differ by the suffix
+func NewUserObjectName(userID, kind, id, suffix string) string {
+	return fmt.Sprintf("users/%s/%s/%s%s", userID, kind, id, suffix)
+}
+
+func imageExt(fileName string) string {
+	fileExt := strings.ToLower(filepath.Ext(fileName))
+	if fileExt == "" {
+		fileExt = ".jpg"
+	}
+	return fileExt
+}
+
+// PresignUpload returns a PUT url for uploading the object straight to the bucket. The content type
+// and the length are signed, so the storage rejects an upload with other values
+func (m *MinIOClient) PresignUpload(ctx context.Context, objectName, contentType string, size int64, expiry time.Duration) (string, error) {
+	if expiry <= 0 || expiry > maxPresignExpiry {
+		expiry = maxPresignExpiry
+	}
+
+	headers := http.Header{}
+	headers.Set("Content-Type", contentType)
+	headers.Set("Content-Length", strconv.FormatInt(size, 10))
+
+	presignedURL, err := m.client.PresignHeader(ctx, http.MethodPut, m.bucket, objectName, expiry, nil, headers)
+	if err != nil {
+		return "", fmt.Errorf("ошибка создания ссылки для загрузки: %w", err)
+	}
+
+	return presignedURL.String(), nil
+}
+
+// StatImage returns the size and the content type of the uploaded object
+func (m *MinIOClient) StatImage(ctx context.Context, objectName string) (*ObjectInfo, error) {
+	info, err := m.client.StatObject(ctx, m.bucket, objectName, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, fmt.Errorf("объект %s не найден", objectName)
+		}
+		return nil, fmt.Errorf("ошибка получения объекта из MinIO: %w", err)
+	}
+
+	return &ObjectInfo{Key: objectName, Size: info.Size, ContentType: info.ContentType, LastModified: info.LastModified}, nil
+}
+
+// ListImages returns all objects of the bucket
+func (m *MinIOClient) ListImages(ctx context.Context) ([]ObjectInfo, error) {
+	objects := []ObjectInfo{}
+	for object := range m.client.ListObjects(ctx, m.bucket, minio.ListObjectsOptions{Recursive: true}) {
+		if object.Err != nil {
+			return nil, fmt.Errorf("ошибка получения списка объектов из MinIO: %w", object.Err)
+		}
+		objects = append(objects, ObjectInfo{
+			Key:          object.Key,
+			Size:         object.Size,
+			ContentType:  object.ContentType,
+			LastModified: object.LastModified,
 		})
+	}
+
+	return objects, nil
+}
+
+// OpenImage returns a reader of the object content, the caller closes it
+func (m *MinIOClient) OpenImage(ctx context.Context, objectName string) (io.ReadCloser, error) {
+	object, err := m.client.GetObject(ctx, m.bucket, objectName, minio.GetObjectOptions{})
 	if err != nil {
-		return "", "", fmt.Errorf("ошибка загрузки в MinIO: %w", err)
+		return nil, fmt.Errorf("ошибка получения объекта из MinIO: %w", err)
+	}
+
+	return object, nil
+}
+
+// ImageURL returns the url of the object for the client: a link from the public base url when the bucket
+// is served publicly, otherwise a presigned GET url that expires after MinIO.URLExpiry
+func (m *MinIOClient) ImageURL(ctx context.Context, objectName string) (string, error) {
+	if m.config.MinIO.PublicBaseURL != "" {
+		return strings.TrimSuffix(m.config.MinIO.PublicBaseURL, "/") + "/" + objectName, nil
 	}
 
-	imageURL := fmt.Sprintf("%s/%s/%s",
-		strings.TrimSuffix("localhost:9000", ":9000"),
-		"images",
-		objectName)
+	expiry := m.config.MinIO.URLExpiry
+	if expiry <= 0 || expiry > maxPresignExpiry {
+		expiry = maxPresignExpiry
+	}
 
-	imageURL = "http://" + imageURL
+	presignedURL, err := m.client.PresignedGetObject(ctx, m.bucket, objectName, expiry, nil)
+	if err != nil {
+		return "", fmt.Errorf("ошибка создания ссылки на изображение: %w", err)
+	}
 
-	return objectName, imageURL, nil
+	return presignedURL.String(), nil
 }
 
 func (m *MinIOClient) DeleteImage(ctx context.Context, objectName string) error {
-	err := m.client.RemoveObject(ctx, "images", objectName,
+	err := m.client.RemoveObject(ctx, m.bucket, objectName,
 		minio.RemoveObjectOptions{
 			GovernanceBypass: true,
 			VersionID:        "",
@@ -95,3 +240,54 @@ func (m *MinIOClient) DeleteImage(ctx context.Context, objectName string) error
 	}
 	return nil
 }
+
+// CopyImage copies the object inside the bucket without downloading it
+func (m *MinIOClient) CopyImage(ctx context.Context, srcObjectName, dstObjectName string) error {
+	_, err := m.client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: m.bucket, Object: dstObjectName},
+		minio.CopySrcOptions{Bucket: m.bucket, Object: srcObjectName})
+	if err != nil {
+		return fmt.Errorf("ошибка копирования в MinIO: %w", err)
+	}
+	return nil
+}
+
+func (m *MinIOClient) NewMultipartUpload(ctx context.Context, objectName, contentType string) (string, error) {
+	uploadID, err := m.core.NewMultipartUpload(ctx, m.bucket, objectName, minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		return "", fmt.Errorf("ошибка создания составной загрузки в MinIO: %w", err)
+	}
+	return uploadID, nil
+}
+
+// UploadPart stores one part of the multipart upload and returns its ETag,
+// every part except the last one must be at least 5 MB
+func (m *MinIOClient) UploadPart(ctx context.Context, objectName, uploadID string, partNumber int, data io.Reader, size int64) (string, error) {
+	part, err := m.core.PutObjectPart(ctx, m.bucket, objectName, uploadID, partNumber, data, size, minio.PutObjectPartOptions{})
+	if err != nil {
+		return "", fmt.Errorf("ошибка загрузки части в MinIO: %w", err)
+	}
+	return part.ETag, nil
+}
+
+// CompleteMultipartUpload joins the parts in the order of their ETags into the object
+func (m *MinIOClient) CompleteMultipartUpload(ctx context.Context, objectName, uploadID string, etags []string) error {
+	parts := make([]minio.CompletePart, 0, len(etags))
+	for i, etag := range etags {
+		parts = append(parts, minio.CompletePart{PartNumber: i + 1, ETag: etag})
+	}
+
+	_, err := m.core.CompleteMultipartUpload(ctx, m.bucket, objectName, uploadID, parts, minio.PutObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("ошибка завершения составной загрузки в MinIO: %w", err)
+	}
+	return nil
+}
+
+func (m *MinIOClient) AbortMultipartUpload(ctx context.Context, objectName, uploadID string) error {
+	err := m.core.AbortMultipartUpload(ctx, m.bucket, objectName, uploadID)
+	if err != nil {
+		return fmt.Errorf("ошибка отмены составной загрузки в MinIO: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"fmt"
+	"microblogCPT/internal/config"
+	"net/http"
+)
+
+// New creates the storage selected by STORAGE_DRIVER: minio, local or memory. The local and the memory
+// storages also return the handler that serves their objects under /media/, for MinIO it is nil
+func New(cfg *config.Config) (Storage, http.Handler, error) {
+	signer := NewURLSigner(cfg.LocalStorage.SigningKey, cfg.LocalStorage.BaseURL)
+
+	switch cfg.StorageDriver {
+	case "minio", "":
+		client, err := NewMinIOClient(cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		return client, nil, nil
+	case "local":
+		local, err := NewLocalStorage(cfg.LocalStorage.Dir, signer, cfg.LocalStorage.URLExpiry)
+		if err != nil {
+			return nil, nil, err
+		}
+		return local, NewMediaHandler(local, signer), nil
+	case "memory":
+		memory := NewMemoryStorage(signer, cfg.LocalStorage.URLExpiry)
+		fmt.Println("Хранилище в памяти: файлы будут потеряны при перезапуске")
+		return memory, NewMediaHandler(memory, signer), nil
+	}
+
+	return nil, nil, fmt.Errorf("неизвестный STORAGE_DRIVER: %s", cfg.StorageDriver)
+}
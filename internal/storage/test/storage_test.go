@@ -0,0 +1,278 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"microblogCPT/internal/config"
+	"microblogCPT/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const baseURL = "http://localhost:8080"
+
+func newStorages(t *testing.T) map[string]storage.Storage {
+	signer := storage.NewURLSigner("test-secret", baseURL)
+
+	local, err := storage.NewLocalStorage(t.TempDir(), signer, time.Hour)
+	require.NoError(t, err)
+
+	return map[string]storage.Storage{
+		"local":  local,
+		"memory": storage.NewMemoryStorage(signer, time.Hour),
+	}
+}
+
+// mediaRequest turns the signed url into a request to the media handler
+func mediaRequest(t *testing.T, method, signedURL string, body io.Reader) *http.Request {
+	parsed, err := url.Parse(signedURL)
+	require.NoError(t, err)
+	return httptest.NewRequest(method, parsed.RequestURI(), body)
+}
+
+func TestURLSigner_Verify(t *testing.T) {
+	signer := storage.NewURLSigner("test-secret", baseURL)
+
+	signedURL := signer.URL(http.MethodPut, "posts/post1/photo.png", "image/png", 1024, time.Hour)
+	assert.True(t, strings.HasPrefix(signedURL, baseURL+"/media/posts/post1/photo.png?"))
+
+	parsed, err := url.Parse(signedURL)
+	require.NoError(t, err)
+	query := parsed.Query()
+
+	assert.NoError(t, signer.Verify(http.MethodPut, "posts/post1/photo.png", "image/png", 1024, query))
+	assert.Error(t, signer.Verify(http.MethodGet, "posts/post1/photo.png", "image/png", 1024, query))
+	assert.Error(t, signer.Verify(http.MethodPut, "posts/post1/other.png", "image/png", 1024, query))
+	assert.Error(t, signer.Verify(http.MethodPut, "posts/post1/photo.png", "image/jpeg", 1024, query))
+	assert.Error(t, signer.Verify(http.MethodPut, "posts/post1/photo.png", "image/png", 2048, query))
+
+	other := storage.NewURLSigner("other-secret", baseURL)
+	assert.Error(t, other.Verify(http.MethodPut, "posts/post1/photo.png", "image/png", 1024, query))
+
+	query.Set("expires", "1")
+	err = signer.Verify(http.MethodPut, "posts/post1/photo.png", "image/png", 1024, query)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "срок действия ссылки истек")
+}
+
+func TestStorage_RoundTrip(t *testing.T) {
+	for name, store := range newStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			content := []byte("image content")
+
+			objectName, err := store.UploadImage(ctx, "post1", "photo.png", "image/png", bytes.NewReader(content), int64(len(content)))
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(objectName, "posts/post1/"))
+
+			info, err := store.StatImage(ctx, objectName)
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(content)), info.Size)
+			assert.Equal(t, "image/png", info.ContentType)
+
+			object, err := store.OpenImage(ctx, objectName)
+			require.NoError(t, err)
+			data, err := io.ReadAll(object)
+			object.Close()
+			require.NoError(t, err)
+			assert.Equal(t, content, data)
+
+			require.NoError(t, store.CopyImage(ctx, objectName, "posts/post1/copy.png"))
+			_, err = store.StatImage(ctx, "posts/post1/copy.png")
+			assert.NoError(t, err)
+
+			require.NoError(t, store.DeleteImage(ctx, objectName))
+			_, err = store.StatImage(ctx, objectName)
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), "не найден")
+
+			objects, err := store.ListImages(ctx)
+			require.NoError(t, err)
+			require.Len(t, objects, 1)
+			assert.Equal(t, "posts/post1/copy.png", objects[0].Key)
+			assert.False(t, objects[0].LastModified.IsZero())
+
+			// deleting a missing object is not an error, like in S3
+			assert.NoError(t, store.DeleteImage(ctx, objectName))
+		})
+	}
+}
+
+func TestStorage_SaveImageSizeMismatch(t *testing.T) {
+	for name, store := range newStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			err := store.SaveImage(context.Background(), "posts/post1/photo.png", "image/png", strings.NewReader("short"), 100)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestStorage_SaveImageUnknownSize(t *testing.T) {
+	for name, store := range newStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			objectName := "posts/post1/unknown.png"
+
+			err := store.SaveImage(ctx, objectName, "image/png", strings.NewReader("image data"), -1)
+			require.NoError(t, err)
+
+			object, err := store.OpenImage(ctx, objectName)
+			require.NoError(t, err)
+			defer object.Close()
+
+			data, err := io.ReadAll(object)
+			require.NoError(t, err)
+			assert.Equal(t, "image data", string(data))
+		})
+	}
+}
+
+func TestStorage_Multipart(t *testing.T) {
+	for name, store := range newStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			uploadID, err := store.NewMultipartUpload(ctx, "uploads/test", "image/png")
+			require.NoError(t, err)
+
+			etag1, err := store.UploadPart(ctx, "uploads/test", uploadID, 1, strings.NewReader("first "), 6)
+			require.NoError(t, err)
+			etag2, err := store.UploadPart(ctx, "uploads/test", uploadID, 2, strings.NewReader("second"), 6)
+			require.NoError(t, err)
+
+			require.NoError(t, store.CompleteMultipartUpload(ctx, "uploads/test", uploadID, []string{etag1, etag2}))
+
+			object, err := store.OpenImage(ctx, "uploads/test")
+			require.NoError(t, err)
+			data, _ := io.ReadAll(object)
+			object.Close()
+			assert.Equal(t, "first second", string(data))
+
+			// an aborted upload leaves no object
+			uploadID, err = store.NewMultipartUpload(ctx, "uploads/aborted", "image/png")
+			require.NoError(t, err)
+			_, err = store.UploadPart(ctx, "uploads/aborted", uploadID, 1, strings.NewReader("data"), 4)
+			require.NoError(t, err)
+			require.NoError(t, store.AbortMultipartUpload(ctx, "uploads/aborted", uploadID))
+
+			_, err = store.StatImage(ctx, "uploads/aborted")
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLocalStorage_RejectsPathTraversal(t *testing.T) {
+	local, err := storage.NewLocalStorage(t.TempDir(), storage.NewURLSigner("test-secret", baseURL), time.Hour)
+	require.NoError(t, err)
+
+	err = local.SaveImage(context.Background(), "../outside.png", "image/png", strings.NewReader("data"), 4)
+	assert.Error(t, err)
+
+	_, err = local.OpenImage(context.Background(), "posts/../../outside.png")
+	assert.Error(t, err)
+}
+
+func TestMediaHandler(t *testing.T) {
+	signer := storage.NewURLSigner("test-secret", baseURL)
+	store := storage.NewMemoryStorage(signer, time.Hour)
+	handler := storage.NewMediaHandler(store, signer)
+	ctx := context.Background()
+
+	// upload by the presigned url
+	content := "image content"
+	uploadURL, err := store.PresignUpload(ctx, "posts/post1/photo.png", "image/png", int64(len(content)), time.Hour)
+	require.NoError(t, err)
+
+	req := mediaRequest(t, http.MethodPut, uploadURL, strings.NewReader(content))
+	req.Header.Set("Content-Type", "image/png")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// another content type is not covered by the signature
+	req = mediaRequest(t, http.MethodPut, uploadURL, strings.NewReader(content))
+	req.Header.Set("Content-Type", "image/jpeg")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	// download by the signed url
+	imageURL, err := store.ImageURL(ctx, "posts/post1/photo.png")
+	require.NoError(t, err)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, mediaRequest(t, http.MethodGet, imageURL, nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, content, rr.Body.String())
+	assert.Equal(t, "image/png", rr.Header().Get("Content-Type"))
+
+	// the upload url does not allow downloading
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, mediaRequest(t, http.MethodGet, uploadURL, nil))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	// unsigned request
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/media/posts/post1/photo.png", nil))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	// missing object
+	missingURL := signer.URL(http.MethodGet, "posts/post1/missing.png", "", 0, time.Hour)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, mediaRequest(t, http.MethodGet, missingURL, nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestBucketLifecycle(t *testing.T) {
+	rules := storage.BucketLifecycle(config.MinIO{AbortIncompleteDays: 7, NoncurrentDays: 30})
+	require.Len(t, rules.Rules, 1)
+	assert.Equal(t, "abort-incomplete-uploads", rules.Rules[0].ID)
+	assert.Equal(t, 7, int(rules.Rules[0].AbortIncompleteMultipartUpload.DaysAfterInitiation))
+
+	rules = storage.BucketLifecycle(config.MinIO{Versioning: true, AbortIncompleteDays: 7, NoncurrentDays: 30})
+	require.Len(t, rules.Rules, 2)
+	assert.Equal(t, 30, int(rules.Rules[1].NoncurrentVersionExpiration.NoncurrentDays))
+
+	rules = storage.BucketLifecycle(config.MinIO{})
+	assert.True(t, rules.Empty())
+}
+
+func TestMergeLifecycle(t *testing.T) {
+	rules := storage.BucketLifecycle(config.MinIO{AbortIncompleteDays: 7})
+	operatorRule := lifecycle.Rule{
+		ID:         "expire-tmp",
+		Status:     "Enabled",
+		RuleFilter: lifecycle.Filter{Prefix: "tmp/"},
+		Expiration: lifecycle.Expiration{Days: 1},
+	}
+
+	// the rules of the operator are kept next to the rules of the application
+	merged, changed := storage.MergeLifecycle(&lifecycle.Configuration{Rules: []lifecycle.Rule{operatorRule}}, rules)
+	assert.True(t, changed)
+	require.Len(t, merged.Rules, 2)
+	assert.Equal(t, "expire-tmp", merged.Rules[0].ID)
+	assert.Equal(t, "abort-incomplete-uploads", merged.Rules[1].ID)
+
+	// the rules already applied do not rewrite the bucket
+	_, changed = storage.MergeLifecycle(merged, rules)
+	assert.False(t, changed)
+
+	// a changed rule of the application replaces the old one in place
+	merged, changed = storage.MergeLifecycle(merged, storage.BucketLifecycle(config.MinIO{AbortIncompleteDays: 3}))
+	assert.True(t, changed)
+	require.Len(t, merged.Rules, 2)
+	assert.Equal(t, 3, int(merged.Rules[1].AbortIncompleteMultipartUpload.DaysAfterInitiation))
+
+	// a bucket without a configuration gets the rules of the application
+	merged, changed = storage.MergeLifecycle(nil, rules)
+	assert.True(t, changed)
+	assert.Len(t, merged.Rules, 1)
+}
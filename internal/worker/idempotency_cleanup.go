@@ -0,0 +1,43 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"microblogCPT/internal/repository"
+	"time"
+)
+
+// StartIdempotencyCleanup periodically removes the idempotency keys whose lifetime has expired
+func StartIdempotencyCleanup(ctx context.Context, repo *repository.Repository, interval time.Duration) {
+	// a zero interval disables the cleanup
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			deleted, err := repo.Post.DeleteExpiredIdempotencyKeys(ctx)
+			if err != nil {
+				log.Printf("Ошибка очистки ключей идемпотентности: %v", err)
+			}
+
+			requests, err := repo.Idempotency.DeleteExpired(ctx)
+			if err != nil {
+				log.Printf("Ошибка очистки ключей идемпотентности: %v", err)
+			}
+
+			if deleted+requests > 0 {
+				log.Printf("Удалено истекших ключей идемпотентности: %d", deleted+requests)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,59 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"microblogCPT/internal/service"
+	"time"
+)
+
+// StartImageReconciler periodically looks for orphaned objects and images without objects.
+// In the dry run they are only logged
+func StartImageReconciler(ctx context.Context, reconcileService service.ReconcileService, interval time.Duration, dryRun bool) {
+	// a zero interval disables the reconciliation
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			report, err := reconcileService.Reconcile(ctx, dryRun)
+			if err != nil {
+				log.Printf("Ошибка сверки хранилища: %v", err)
+			} else {
+				LogReconcileReport(report)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// LogReconcileReport prints the found objects and images, nothing is printed when the storage is consistent
+func LogReconcileReport(report *service.ReconcileReport) {
+	for _, objectName := range report.OrphanObjects {
+		log.Printf("Объект без записи в БД: %s", objectName)
+	}
+	for _, imageID := range report.DanglingImages {
+		log.Printf("Изображение без объекта в хранилище: %s", imageID)
+	}
+
+	if report.DryRun {
+		if len(report.OrphanObjects) > 0 || len(report.DanglingImages) > 0 {
+			log.Printf("Сверка хранилища без удаления: объектов %d, изображений %d",
+				len(report.OrphanObjects), len(report.DanglingImages))
+		}
+		return
+	}
+
+	if report.DeletedObjects > 0 || report.DeletedImages > 0 {
+		log.Printf("Сверка хранилища: удалено объектов %d, изображений %d", report.DeletedObjects, report.DeletedImages)
+	}
+}
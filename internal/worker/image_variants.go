@@ -0,0 +1,45 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"microblogCPT/internal/service"
+	"time"
+)
+
+// StartVariantGenerator periodically creates the resized variants of new images
+func StartVariantGenerator(ctx context.Context, variantService service.VariantService, interval time.Duration) {
+	// a zero interval disables the generator
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			// batches are taken one after another while there is progress, so a backlog is drained in one run
+			total := 0
+			for ctx.Err() == nil {
+				processed, err := variantService.GenerateVariants(ctx)
+				if err != nil {
+					log.Printf("Ошибка создания вариантов изображений: %v", err)
+				}
+				if err != nil || processed == 0 {
+					break
+				}
+				total += processed
+			}
+			if total > 0 {
+				log.Printf("Обработано изображений для вариантов: %d", total)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,36 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"microblogCPT/internal/service"
+	"time"
+)
+
+// StartTrashPurge periodically removes the posts whose retention period in the trash has expired
+func StartTrashPurge(ctx context.Context, postService service.PostService, interval time.Duration) {
+	// a zero interval disables the purge
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			purged, err := postService.PurgeTrash(ctx)
+			if err != nil {
+				log.Printf("Ошибка очистки корзины: %v", err)
+			} else if purged > 0 {
+				log.Printf("Из корзины окончательно удалено постов: %d", purged)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,43 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"microblogCPT/internal/service"
+	"time"
+)
+
+// StartUploadJanitor periodically removes the direct and resumable uploads that were never completed
+func StartUploadJanitor(ctx context.Context, postService service.PostService, uploadService service.UploadService, interval time.Duration) {
+	// a zero interval disables the janitor
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			removed, err := postService.CleanupExpiredUploads(ctx)
+			if err != nil {
+				log.Printf("Ошибка очистки незавершенных загрузок: %v", err)
+			}
+
+			resumable, err := uploadService.CleanupExpiredUploads(ctx)
+			if err != nil {
+				log.Printf("Ошибка очистки незавершенных загрузок: %v", err)
+			}
+
+			if removed+resumable > 0 {
+				log.Printf("Удалено незавершенных загрузок: %d", removed+resumable)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
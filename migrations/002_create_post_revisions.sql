@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS post_revisions (
+    post_id UUID NOT NULL REFERENCES posts(post_id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+    title VARCHAR(500) NOT NULL,
+    content TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (post_id, revision)
+);
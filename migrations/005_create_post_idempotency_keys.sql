@@ -0,0 +1,15 @@
+-- idempotency keys are scoped per author and live in their own table
+ALTER TABLE posts DROP CONSTRAINT IF EXISTS posts_idempotency_key_key;
+
+CREATE TABLE IF NOT EXISTS post_idempotency_keys (
+    author_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    idempotency_key VARCHAR(255) NOT NULL,
+    request_hash VARCHAR(64) NOT NULL,
+    response_status INTEGER NOT NULL DEFAULT 0,
+    response_body BYTEA,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (author_id, idempotency_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_idempotency_keys_expires_at ON post_idempotency_keys(expires_at);
@@ -0,0 +1,16 @@
+-- responses of mutating requests sent with the Idempotency-Key header
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    principal VARCHAR(255) NOT NULL,
+    method VARCHAR(10) NOT NULL,
+    path TEXT NOT NULL,
+    idempotency_key VARCHAR(255) NOT NULL,
+    request_hash VARCHAR(64) NOT NULL,
+    response_status INTEGER NOT NULL DEFAULT 0,
+    response_headers BYTEA,
+    response_body BYTEA,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (principal, method, path, idempotency_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
@@ -0,0 +1,14 @@
+-- images keep only the key of the object in the bucket, urls are built when responses are formed
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_name = 'images' AND column_name = 'image_url'
+    ) THEN
+        ALTER TABLE images RENAME COLUMN image_url TO object_key;
+
+        UPDATE images
+        SET object_key = substring(object_key FROM position('/posts/' IN object_key) + 1)
+        WHERE position('/posts/' IN object_key) > 0;
+    END IF;
+END $$;
@@ -0,0 +1,14 @@
+-- uploads that go straight to the storage through a presigned url and wait for completion
+CREATE TABLE IF NOT EXISTS image_uploads (
+    upload_id UUID PRIMARY KEY,
+    post_id UUID NOT NULL REFERENCES posts(post_id) ON DELETE CASCADE,
+    author_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    object_key TEXT NOT NULL,
+    file_name VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_image_uploads_expires_at ON image_uploads(expires_at);
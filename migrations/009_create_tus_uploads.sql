@@ -0,0 +1,18 @@
+-- resumable uploads (tus), the bytes are collected in a multipart upload of the storage
+CREATE TABLE IF NOT EXISTS tus_uploads (
+    upload_id UUID PRIMARY KEY,
+    author_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    object_key TEXT NOT NULL,
+    storage_upload_id TEXT NOT NULL,
+    file_name VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    length BIGINT NOT NULL,
+    upload_offset BIGINT NOT NULL DEFAULT 0,
+    part_etags TEXT[] NOT NULL DEFAULT '{}',
+    pending BYTEA,
+    completed BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_tus_uploads_expires_at ON tus_uploads(expires_at);
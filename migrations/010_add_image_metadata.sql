@@ -0,0 +1,5 @@
+-- the type and the dimensions detected from the file content, existing images keep the defaults
+ALTER TABLE images ADD COLUMN IF NOT EXISTS mime_type VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE images ADD COLUMN IF NOT EXISTS width INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE images ADD COLUMN IF NOT EXISTS height INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE images ADD COLUMN IF NOT EXISTS size BIGINT NOT NULL DEFAULT 0;
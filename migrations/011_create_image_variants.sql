@@ -0,0 +1,14 @@
+-- resized copies of the images, generated by a background worker after the upload
+CREATE TABLE IF NOT EXISTS image_variants (
+    image_id UUID NOT NULL REFERENCES images(image_id) ON DELETE CASCADE,
+    object_key TEXT NOT NULL,
+    mime_type VARCHAR(100) NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    size BIGINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (image_id, mime_type, width)
+);
+
+-- pending -> processing -> ready, or skipped when the original can not be decoded
+ALTER TABLE images ADD COLUMN IF NOT EXISTS variants_status VARCHAR(20) NOT NULL DEFAULT 'pending';
@@ -0,0 +1,18 @@
+-- bytes and number of images stored by every user and in every post, kept by the image repository
+-- in the same transaction as the images. The resized variants are not counted
+CREATE TABLE IF NOT EXISTS user_storage_usage (
+    user_id UUID PRIMARY KEY REFERENCES users(user_id) ON DELETE CASCADE,
+    bytes BIGINT NOT NULL DEFAULT 0,
+    objects INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS post_storage_usage (
+    post_id UUID PRIMARY KEY REFERENCES posts(post_id) ON DELETE CASCADE,
+    author_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    bytes BIGINT NOT NULL DEFAULT 0,
+    objects INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_storage_usage_author_id ON post_storage_usage(author_id);
@@ -0,0 +1,15 @@
+-- the stored content of the images by its SHA-256, images with the same content share one object.
+-- ref_count is the number of images pointing at the blob, the object is removed with the last of them
+CREATE TABLE IF NOT EXISTS image_blobs (
+    hash CHAR(64) PRIMARY KEY,
+    object_key TEXT NOT NULL,
+    mime_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    ref_count INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- images stored before the deduplication have no blob and own their object
+ALTER TABLE images ADD COLUMN IF NOT EXISTS blob_hash CHAR(64) REFERENCES image_blobs(hash);
+
+CREATE INDEX IF NOT EXISTS idx_images_blob_hash ON images(blob_hash);
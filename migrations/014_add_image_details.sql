@@ -0,0 +1,18 @@
+-- alt text for screen readers, an optional caption and the place of the image in the post
+ALTER TABLE images ADD COLUMN IF NOT EXISTS alt_text TEXT NOT NULL DEFAULT '';
+ALTER TABLE images ADD COLUMN IF NOT EXISTS caption TEXT NOT NULL DEFAULT '';
+
+-- the existing images keep their upload order, the column is filled only once
+ALTER TABLE images ADD COLUMN IF NOT EXISTS position INTEGER;
+
+UPDATE images SET position = ordered.position
+FROM (
+    SELECT image_id, ROW_NUMBER() OVER (PARTITION BY post_id ORDER BY created_at) - 1 AS position
+    FROM images
+) ordered
+WHERE images.image_id = ordered.image_id AND images.position IS NULL;
+
+ALTER TABLE images ALTER COLUMN position SET NOT NULL;
+ALTER TABLE images ALTER COLUMN position SET DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_images_post_position ON images(post_id, position);
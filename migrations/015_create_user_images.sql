@@ -0,0 +1,9 @@
+-- avatars and banners of the users: every avatar is stored in several square sizes, a banner in one
+CREATE TABLE IF NOT EXISTS user_images (
+    user_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('avatar', 'banner')),
+    size INTEGER NOT NULL,
+    object_key TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, kind, size)
+);
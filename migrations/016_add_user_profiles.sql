@@ -0,0 +1,24 @@
+-- public profile of the user: a unique lowercase @handle, a display name, a bio and website links
+ALTER TABLE users ADD COLUMN IF NOT EXISTS handle VARCHAR(30);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS display_name VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS bio TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS links TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS handle_changed_at TIMESTAMP WITH TIME ZONE;
+
+-- the existing users get the same generated handle as the new ones, it is filled only once
+UPDATE users SET handle = 'user' || substr(replace(user_id::text, '-', ''), 1, 12) WHERE handle IS NULL;
+
+ALTER TABLE users ALTER COLUMN handle SET NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_handle ON users(handle);
+
+-- the previous handles of the users, they redirect to the current handle until expires_at
+-- and can not be taken by another user before that
+CREATE TABLE IF NOT EXISTS user_handle_redirects (
+    handle VARCHAR(30) PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_handle_redirects_user_id ON user_handle_redirects(user_id);
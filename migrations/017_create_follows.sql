@@ -0,0 +1,11 @@
+-- who follows whom, the lists of followers and followings are read newest first
+CREATE TABLE IF NOT EXISTS follows (
+    follower_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    followee_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (follower_id, followee_id),
+    CHECK (follower_id <> followee_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_follows_follower_created ON follows(follower_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_follows_followee_created ON follows(followee_id, created_at DESC);
@@ -0,0 +1,17 @@
+-- the comments of the posts, a reply refers to the comment it answers. A deleted comment that has replies
+-- keeps its place in the thread with deleted_at set and the content removed
+CREATE TABLE IF NOT EXISTS comments (
+    comment_id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    post_id UUID NOT NULL REFERENCES posts(post_id) ON DELETE CASCADE,
+    parent_id UUID REFERENCES comments(comment_id) ON DELETE CASCADE,
+    author_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    content TEXT NOT NULL,
+    hidden BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+-- the comments of a post are read oldest first, the threads are collected by the parent
+CREATE INDEX IF NOT EXISTS idx_comments_post_created ON comments(post_id, created_at, comment_id);
+CREATE INDEX IF NOT EXISTS idx_comments_parent ON comments(parent_id);
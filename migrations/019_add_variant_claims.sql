@@ -0,0 +1,11 @@
+-- a claim that is not finished in time (the worker crashed or was stopped) is taken again,
+-- and an image that keeps failing is given up as failed after a number of attempts
+ALTER TABLE images ADD COLUMN IF NOT EXISTS variants_claimed_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE images ADD COLUMN IF NOT EXISTS variants_attempts INTEGER NOT NULL DEFAULT 0;
+
+-- the images claimed before the claims got a time go back to the queue
+UPDATE images SET variants_status = 'pending' WHERE variants_status = 'processing' AND variants_claimed_at IS NULL;
+
+-- the images of a blob share the variants of the blob, only the images that own their object are queued
+CREATE INDEX IF NOT EXISTS idx_images_variants_queue ON images(created_at)
+    WHERE variants_status IN ('pending', 'processing') AND blob_hash IS NULL;
@@ -0,0 +1,9 @@
+-- the home timeline is ordered by the time of publication, not by the time the draft was created
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS published_at TIMESTAMP WITH TIME ZONE;
+
+-- the posts published before the column existed keep their place in the timelines
+UPDATE posts SET published_at = created_at WHERE status = 'Published' AND published_at IS NULL;
+
+-- the home timeline is read from the published posts of the followed authors, newest first
+CREATE INDEX IF NOT EXISTS idx_posts_author_published_at ON posts(author_id, published_at DESC, post_id DESC)
+    WHERE status = 'Published' AND deleted_at IS NULL;
@@ -0,0 +1,32 @@
+-- the variants of deduplicated images belong to their blob: they are generated once for the content,
+-- shared by all the images of the blob and removed with its last image. The blobs have their own queue
+ALTER TABLE image_blobs ADD COLUMN IF NOT EXISTS variants_status VARCHAR(20) NOT NULL DEFAULT 'pending';
+ALTER TABLE image_blobs ADD COLUMN IF NOT EXISTS variants_claimed_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE image_blobs ADD COLUMN IF NOT EXISTS variants_attempts INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_image_blobs_variants_queue ON image_blobs(created_at)
+    WHERE variants_status IN ('pending', 'processing');
+
+-- a variant belongs either to an image or to a blob
+ALTER TABLE image_variants ADD COLUMN IF NOT EXISTS blob_hash CHAR(64) REFERENCES image_blobs(hash) ON DELETE CASCADE;
+ALTER TABLE image_variants DROP CONSTRAINT IF EXISTS image_variants_pkey;
+ALTER TABLE image_variants ALTER COLUMN image_id DROP NOT NULL;
+
+-- the variants generated for every image of a blob move to the blob, one copy of each size is kept:
+-- all the copies were written to the same keys next to the object of the blob
+UPDATE image_variants v SET blob_hash = i.blob_hash, image_id = NULL
+FROM images i
+WHERE v.image_id = i.image_id AND i.blob_hash IS NOT NULL;
+
+DELETE FROM image_variants a USING image_variants b
+WHERE a.blob_hash = b.blob_hash AND a.mime_type = b.mime_type AND a.width = b.width AND a.ctid > b.ctid;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_image_variants_image ON image_variants(image_id, mime_type, width)
+    WHERE image_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_image_variants_blob ON image_variants(blob_hash, mime_type, width)
+    WHERE blob_hash IS NOT NULL;
+
+-- the blobs whose images were processed before keep the result
+UPDATE image_blobs b SET variants_status = i.variants_status
+FROM images i
+WHERE i.blob_hash = b.hash AND b.variants_status = 'pending' AND i.variants_status IN ('ready', 'skipped', 'failed');